@@ -0,0 +1,282 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConfirmChannel is a Channel that supports publisher confirms and returns.
+// It is highly recommended to use *amqp.Channel as the interface
+// implementation.
+type ConfirmChannel interface {
+	Channel
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+}
+
+var (
+	// ErrConfirmTimeout is returned by ConfirmDeliverer when the broker didn't
+	// confirm a publishing in time. The publishing may or may not have been
+	// routed.
+	ErrConfirmTimeout = errors.New("amqp: timed out waiting for publisher confirm")
+
+	// ErrConfirmChannelClosed is returned by ConfirmDeliverer when the channel
+	// was closed before the broker confirmed a publishing.
+	ErrConfirmChannelClosed = errors.New("amqp: channel closed before publisher confirm")
+)
+
+// NackError is returned by ConfirmDeliverer when the broker negatively
+// acknowledged a publishing, which means it failed to take responsibility for
+// it, typically because of an internal error.
+type NackError struct {
+	DeliveryTag uint64
+}
+
+// Error implements error.
+func (e NackError) Error() string {
+	return fmt.Sprintf("amqp: publishing %d was nacked by the broker", e.DeliveryTag)
+}
+
+// ReturnError is returned by ConfirmDeliverer when the broker returned a
+// mandatory publishing because it couldn't be routed to any queue.
+type ReturnError struct {
+	Return amqp.Return
+}
+
+// Error implements error.
+func (e ReturnError) Error() string {
+	return fmt.Sprintf("amqp: publishing to exchange %q with key %q was returned: %d %s",
+		e.Return.Exchange, e.Return.RoutingKey, e.Return.ReplyCode, e.Return.ReplyText)
+}
+
+// ConfirmDeliverer publishes in confirm mode, and waits for the broker to
+// acknowledge each publishing. Its Deliver method is a Deliverer.
+//
+// Delivery tags are counted by the ConfirmDeliverer, so it must be the only
+// one publishing on its channel. Returned publishings are matched to the
+// pending ones by their CorrelationId, which Publisher always sets.
+type ConfirmDeliverer struct {
+	ch        ConfirmChannel
+	timeout   time.Duration
+	mandatory bool
+
+	mtx     sync.Mutex
+	tag     uint64
+	pending map[uint64]*pendingConfirm
+	closed  bool
+}
+
+type pendingConfirm struct {
+	correlationID string
+	returned      *amqp.Return
+	done          chan error
+}
+
+// NewConfirmDeliverer puts the channel in confirm mode, and returns a
+// ConfirmDeliverer that publishes on it.
+func NewConfirmDeliverer(ch ConfirmChannel, options ...ConfirmDelivererOption) (*ConfirmDeliverer, error) {
+	d := &ConfirmDeliverer{
+		ch:        ch,
+		timeout:   5 * time.Second,
+		mandatory: true,
+		pending:   map[uint64]*pendingConfirm{},
+	}
+	for _, option := range options {
+		option(d)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	// The channels are unbuffered, so that a return is always received
+	// before the confirm of the same publishing.
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	go d.listen(confirms, returns)
+	return d, nil
+}
+
+// ConfirmDialer returns a new ConfirmDeliverer, typically on a new connection.
+// It's called by Retry every time the previous ConfirmDeliverer's channel is
+// closed.
+type ConfirmDialer func() (*ConfirmDeliverer, error)
+
+// DialConfirmDeliverer returns a ConfirmDialer that dials a new connection to
+// the URL, and returns a ConfirmDeliverer publishing on a channel of it. The
+// connection is closed when Retry replaces the ConfirmDeliverer.
+func DialConfirmDeliverer(url string, config amqp.Config, options ...ConfirmDelivererOption) ConfirmDialer {
+	return func() (*ConfirmDeliverer, error) {
+		conn, err := amqp.DialConfig(url, config)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		d, err := NewConfirmDeliverer(connChannel{Channel: ch, conn: conn}, options...)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return d, nil
+	}
+}
+
+// ConfirmDelivererOption sets an optional parameter for ConfirmDeliverers.
+type ConfirmDelivererOption func(*ConfirmDeliverer)
+
+// ConfirmTimeout sets how long to wait for the broker to confirm each
+// publishing, unless the context is done earlier. By default, it's 5 seconds.
+func ConfirmTimeout(timeout time.Duration) ConfirmDelivererOption {
+	return func(d *ConfirmDeliverer) { d.timeout = timeout }
+}
+
+// ConfirmMandatory sets the mandatory flag of the publishings. Unroutable
+// mandatory publishings are returned by the broker, and fail with a
+// ReturnError; others are silently dropped. By default, it's true.
+func ConfirmMandatory(mandatory bool) ConfirmDelivererOption {
+	return func(d *ConfirmDeliverer) { d.mandatory = mandatory }
+}
+
+// Deliver publishes the publishing to the exchange and key set in the context,
+// and waits for the broker to confirm it. It returns a nil delivery: like
+// SendAndForgetDeliverer, it doesn't wait for a reply. It publishes on the
+// channel of the ConfirmDeliverer, rather than on the one of the Publisher.
+func (d *ConfirmDeliverer) Deliver(ctx context.Context, _ Publisher, pub *amqp.Publishing) (*amqp.Delivery, error) {
+	pc := &pendingConfirm{
+		correlationID: pub.CorrelationId,
+		done:          make(chan error, 1),
+	}
+
+	d.mtx.Lock()
+	if d.closed {
+		d.mtx.Unlock()
+		return nil, ErrConfirmChannelClosed
+	}
+	err := d.ch.Publish(
+		getPublishExchange(ctx),
+		getPublishKey(ctx),
+		d.mandatory,
+		false, //immediate
+		*pub,
+	)
+	if err != nil {
+		d.mtx.Unlock()
+		return nil, err
+	}
+	d.tag++
+	tag := d.tag
+	d.pending[tag] = pc
+	d.mtx.Unlock()
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-pc.done:
+		return nil, err
+	case <-timer.C:
+		d.forget(tag)
+		return nil, ErrConfirmTimeout
+	case <-ctx.Done():
+		d.forget(tag)
+		return nil, ctx.Err()
+	}
+}
+
+func (d *ConfirmDeliverer) forget(tag uint64) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.pending, tag)
+}
+
+func (d *ConfirmDeliverer) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for confirms != nil || returns != nil {
+		select {
+		case c, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				d.close()
+				continue
+			}
+			d.confirm(c)
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			d.returned(r)
+		}
+	}
+}
+
+func (d *ConfirmDeliverer) confirm(c amqp.Confirmation) {
+	d.mtx.Lock()
+	pc, ok := d.pending[c.DeliveryTag]
+	delete(d.pending, c.DeliveryTag)
+	d.mtx.Unlock()
+	if !ok {
+		return
+	}
+
+	switch {
+	case !c.Ack:
+		pc.done <- NackError{DeliveryTag: c.DeliveryTag}
+	case pc.returned != nil:
+		pc.done <- ReturnError{Return: *pc.returned}
+	default:
+		pc.done <- nil
+	}
+}
+
+func (d *ConfirmDeliverer) returned(r amqp.Return) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	// The broker returns a publishing before confirming it, so it's the
+	// oldest pending one with the same correlation ID.
+	var (
+		oldest uint64
+		match  *pendingConfirm
+	)
+	for tag, pc := range d.pending {
+		if pc.returned == nil && pc.correlationID == r.CorrelationId && (match == nil || tag < oldest) {
+			oldest, match = tag, pc
+		}
+	}
+	if match != nil {
+		match.returned = &r
+	}
+}
+
+// isClosed reports whether the channel of the ConfirmDeliverer is closed.
+func (d *ConfirmDeliverer) isClosed() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.closed
+}
+
+// release closes the channel of the ConfirmDeliverer, and its connection, if
+// the channel owns it.
+func (d *ConfirmDeliverer) release() {
+	if c, ok := d.ch.(interface{ Close() error }); ok {
+		c.Close()
+	}
+}
+
+// close fails the pending publishings once the channel is closed.
+func (d *ConfirmDeliverer) close() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.closed = true
+	for tag, pc := range d.pending {
+		pc.done <- ErrConfirmChannelClosed
+		delete(d.pending, tag)
+	}
+}
@@ -0,0 +1,172 @@
+package amqp_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqptransport "github.com/go-kit/kit/transport/amqp"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// confirmChannel is a ConfirmChannel that answers every publishing with the
+// outcome returned by f, like a broker in confirm mode would. The publishings
+// are sent to the c channel of its mockChannel, if any.
+type confirmChannel struct {
+	mockChannel
+	f func(key string, mandatory bool) (ack, returned bool)
+
+	mtx      sync.Mutex
+	tag      uint64
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	shut     bool
+}
+
+func (ch *confirmChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	ch.mtx.Lock()
+	if ch.shut {
+		ch.mtx.Unlock()
+		return amqp.ErrClosed
+	}
+	ch.tag++
+	tag := ch.tag
+	ack, returned := ch.f(key, mandatory)
+	ch.mtx.Unlock()
+	if ch.c != nil {
+		ch.c <- msg
+	}
+	if ack && !returned && key == "slow" {
+		return nil // never confirmed
+	}
+	go func() {
+		if returned {
+			ch.returns <- amqp.Return{
+				ReplyCode:     312,
+				ReplyText:     "NO_ROUTE",
+				Exchange:      exchange,
+				RoutingKey:    key,
+				CorrelationId: msg.CorrelationId,
+			}
+		}
+		ch.confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: ack}
+	}()
+	return nil
+}
+
+// shutdown closes the channel like a connection loss would.
+func (ch *confirmChannel) shutdown() {
+	ch.mtx.Lock()
+	defer ch.mtx.Unlock()
+	ch.shut = true
+	close(ch.returns)
+	close(ch.confirms)
+}
+
+func (ch *confirmChannel) Confirm(noWait bool) error { return nil }
+
+func (ch *confirmChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	ch.confirms = c
+	return c
+}
+
+func (ch *confirmChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	ch.returns = c
+	return c
+}
+
+func TestConfirmDeliverer(t *testing.T) {
+	ch := &confirmChannel{f: func(key string, mandatory bool) (bool, bool) {
+		switch key {
+		case "nack":
+			return false, false
+		case "unroutable":
+			return true, mandatory
+		default:
+			return true, false
+		}
+	}}
+	deliverer, err := amqptransport.NewConfirmDeliverer(ch, amqptransport.ConfirmTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish := func(key string) error {
+		q := &amqp.Queue{Name: "some queue"}
+		pub := amqptransport.NewPublisher(
+			ch,
+			q,
+			func(context.Context, *amqp.Publishing, interface{}) error { return nil },
+			func(context.Context, *amqp.Delivery) (interface{}, error) { return nil, nil },
+			amqptransport.PublisherBefore(amqptransport.SetPublishKey(key)),
+			amqptransport.PublisherDeliverer(deliverer.Deliver),
+		)
+		_, err := pub.Endpoint()(context.Background(), struct{}{})
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, testcase := range []struct {
+		key   string
+		check func(error) bool
+	}{
+		{"ok", func(err error) bool { return err == nil }},
+		{"nack", func(err error) bool { var e amqptransport.NackError; return errors.As(err, &e) }},
+		{"unroutable", func(err error) bool {
+			var e amqptransport.ReturnError
+			return errors.As(err, &e) && e.Return.ReplyCode == 312 && e.Return.RoutingKey == "unroutable"
+		}},
+		{"slow", func(err error) bool { return err == amqptransport.ErrConfirmTimeout }},
+	} {
+		testcase := testcase
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := publish(testcase.key); !testcase.check(err) {
+				t.Errorf("%s: unexpected error %v", testcase.key, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConfirmDelivererNotMandatory(t *testing.T) {
+	ch := &confirmChannel{f: func(key string, mandatory bool) (bool, bool) {
+		return true, mandatory
+	}}
+	deliverer, err := amqptransport.NewConfirmDeliverer(ch, amqptransport.ConfirmMandatory(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deliverer.Deliver(context.Background(), amqptransport.Publisher{}, &amqp.Publishing{}); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+}
+
+func TestConfirmDelivererChannelClosed(t *testing.T) {
+	ch := &confirmChannel{f: func(string, bool) (bool, bool) { return true, false }}
+	deliverer, err := amqptransport.NewConfirmDeliverer(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		ctx := context.WithValue(context.Background(), amqptransport.ContextKeyPublishKey, "slow")
+		_, err := deliverer.Deliver(ctx, amqptransport.Publisher{}, &amqp.Publishing{})
+		errc <- err
+	}()
+	// The channel closes before the publishing is confirmed.
+	time.Sleep(10 * time.Millisecond)
+	close(ch.returns)
+	close(ch.confirms)
+	if err := <-errc; err != amqptransport.ErrConfirmChannelClosed {
+		t.Errorf("want %v, have %v", amqptransport.ErrConfirmChannelClosed, err)
+	}
+
+	if _, err := deliverer.Deliver(context.Background(), amqptransport.Publisher{}, &amqp.Publishing{}); err != amqptransport.ErrConfirmChannelClosed {
+		t.Errorf("want %v, have %v", amqptransport.ErrConfirmChannelClosed, err)
+	}
+}
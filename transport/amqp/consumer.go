@@ -0,0 +1,287 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrConsumerClosed is returned by Consumer.Run once the consumer is shut
+// down.
+var ErrConsumerClosed = errors.New("amqp: consumer closed")
+
+// ConsumerChannel is a Channel that a Consumer can manage. It is highly
+// recommended to use *amqp.Channel as the interface implementation.
+type ConsumerChannel interface {
+	Channel
+	QueueDeclarer
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Cancel(consumer string, noWait bool) error
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// ChannelDialer opens a new channel, typically on a new connection. It's
+// called by Consumer every time it needs to (re)connect.
+type ChannelDialer func() (ConsumerChannel, error)
+
+// DialChannel returns a ChannelDialer that dials a new connection to the URL,
+// and opens a channel on it. Closing the channel closes its connection.
+func DialChannel(url string, config amqp.Config) ChannelDialer {
+	return func() (ConsumerChannel, error) {
+		conn, err := amqp.DialConfig(url, config)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return connChannel{Channel: ch, conn: conn}, nil
+	}
+}
+
+// connChannel is an *amqp.Channel that owns its connection.
+type connChannel struct {
+	*amqp.Channel
+	conn *amqp.Connection
+}
+
+func (c connChannel) Close() error {
+	c.Channel.Close()
+	return c.conn.Close()
+}
+
+// Consumer consumes a queue, and handles its deliveries on a fixed pool of
+// workers. It owns the lifecycle of its channel: it opens it, sets its
+// prefetch count, declares the topology, and opens it again with an
+// exponential backoff whenever it's closed by the broker or by a connection
+// loss.
+type Consumer struct {
+	dial         ChannelDialer
+	queue        string
+	handler      func(Channel) func(*amqp.Delivery)
+	workers      int
+	prefetch     int
+	tag          string
+	topology     []func(QueueDeclarer) error
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	errorHandler transport.ErrorHandler
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewConsumer constructs a Consumer of the queue, whose deliveries are passed
+// to the handler, which is typically Subscriber.ServeDelivery. Deliveries
+// aren't acked automatically, so the handler, or its ErrorEncoder, must
+// settle them.
+func NewConsumer(
+	dial ChannelDialer,
+	queue string,
+	handler func(Channel) func(*amqp.Delivery),
+	options ...ConsumerOption,
+) *Consumer {
+	c := &Consumer{
+		dial:         dial,
+		queue:        queue,
+		handler:      handler,
+		workers:      1,
+		tag:          "gokit-" + randomString(16),
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   30 * time.Second,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.workers < 1 {
+		c.workers = 1
+	}
+	return c
+}
+
+// ConsumerOption sets an optional parameter for consumers.
+type ConsumerOption func(*Consumer)
+
+// ConsumerWorkers sets the number of deliveries handled concurrently. By
+// default, it's 1.
+func ConsumerWorkers(n int) ConsumerOption {
+	return func(c *Consumer) { c.workers = n }
+}
+
+// ConsumerPrefetch sets the number of unacked deliveries the broker sends to
+// the consumer. It should be at least the number of workers. By default, it's
+// 0, which means no limit.
+func ConsumerPrefetch(n int) ConsumerOption {
+	return func(c *Consumer) { c.prefetch = n }
+}
+
+// ConsumerTag sets the consumer tag. By default, a random one is generated.
+func ConsumerTag(tag string) ConsumerOption {
+	return func(c *Consumer) { c.tag = tag }
+}
+
+// ConsumerTopology functions are executed on every new channel, before
+// consuming, to declare the queues the consumer relies on, such as
+// Retry.DeclareTopology. They're passed the ConsumerChannel.
+func ConsumerTopology(topology ...func(QueueDeclarer) error) ConsumerOption {
+	return func(c *Consumer) { c.topology = append(c.topology, topology...) }
+}
+
+// ConsumerDeclareQueue is a topology function declaring a durable queue, with
+// the optional arguments.
+func ConsumerDeclareQueue(name string, args amqp.Table) func(QueueDeclarer) error {
+	return func(ch QueueDeclarer) error {
+		_, err := ch.QueueDeclare(
+			name,
+			true,  // durable
+			false, // autoDelete
+			false, // exclusive
+			false, // noWait
+			args,
+		)
+		return err
+	}
+}
+
+// ConsumerBackoff sets the delay before the consumer reconnects, which
+// doubles after each failed attempt, from min up to max. By default, it's
+// between 100ms and 30s.
+func ConsumerBackoff(min, max time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.minBackoff, c.maxBackoff = min, max }
+}
+
+// ConsumerErrorHandler is used to handle the errors that caused the consumer
+// to reconnect. By default, they're ignored.
+func ConsumerErrorHandler(errorHandler transport.ErrorHandler) ConsumerOption {
+	return func(c *Consumer) { c.errorHandler = errorHandler }
+}
+
+// Run consumes the queue until the consumer is shut down, reconnecting
+// whenever its channel is closed. It always returns ErrConsumerClosed, and
+// must be called only once.
+func (c *Consumer) Run() error {
+	defer close(c.done)
+
+	backoff := c.minBackoff
+	for {
+		select {
+		case <-c.stop:
+			return ErrConsumerClosed
+		default:
+		}
+
+		connected, err := c.consume()
+		if err == nil {
+			return ErrConsumerClosed
+		}
+		c.errorHandler.Handle(context.Background(), err)
+		if connected {
+			backoff = c.minBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-c.stop:
+			timer.Stop()
+			return ErrConsumerClosed
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// consume opens a channel and handles its deliveries until it's closed, or
+// the consumer is shut down, in which case it returns a nil error.
+func (c *Consumer) consume() (connected bool, err error) {
+	ch, err := c.dial()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	if c.prefetch > 0 {
+		if err := ch.Qos(c.prefetch, 0, false); err != nil {
+			return false, err
+		}
+	}
+	for _, f := range c.topology {
+		if err := f(ch); err != nil {
+			return false, err
+		}
+	}
+	deliveries, err := ch.Consume(
+		c.queue,
+		c.tag,
+		false, // autoAck
+		false, // exclusive
+		false, // noLocal
+		false, // noWait
+		nil,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	// Deliveries is closed both when the consumer is canceled and when the
+	// channel is closed, which stops the workers.
+	var (
+		handler = c.handler(ch)
+		wg      sync.WaitGroup
+	)
+	wg.Add(c.workers)
+	for i := 0; i < c.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for deliv := range deliveries {
+				deliv := deliv
+				handler(&deliv)
+			}
+		}()
+	}
+
+	select {
+	case amqpErr := <-closed:
+		wg.Wait()
+		if amqpErr == nil {
+			return true, errors.New("amqp: channel closed")
+		}
+		return true, amqpErr
+	case <-c.stop:
+		// Once canceled, the broker stops sending deliveries, and the ones
+		// already sent are handled before the channel is closed, so that
+		// they can still be acked.
+		if err := ch.Cancel(c.tag, false); err != nil {
+			c.errorHandler.Handle(context.Background(), err)
+			ch.Close()
+		}
+		wg.Wait()
+		return true, nil
+	}
+}
+
+// Shutdown stops consuming, and waits for the deliveries already received to
+// be handled, or for the context to be done. It's safe to call more than once.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,218 @@
+package amqp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	amqptransport "github.com/go-kit/kit/transport/amqp"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// consumerChannel is a ConsumerChannel whose deliveries are sent by the test.
+type consumerChannel struct {
+	mockChannel
+	deliveries chan amqp.Delivery
+	prefetch   int
+	declared   []string
+
+	mtx      sync.Mutex
+	closed   chan *amqp.Error
+	canceled bool
+	done     bool
+}
+
+func newConsumerChannel() *consumerChannel {
+	return &consumerChannel{deliveries: make(chan amqp.Delivery)}
+}
+
+func (ch *consumerChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWail bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return ch.deliveries, nil
+}
+
+func (ch *consumerChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	ch.declared = append(ch.declared, name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (ch *consumerChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *consumerChannel) Cancel(consumer string, noWait bool) error {
+	ch.mtx.Lock()
+	defer ch.mtx.Unlock()
+	ch.canceled = true
+	ch.shutdown(nil)
+	return nil
+}
+
+func (ch *consumerChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	ch.mtx.Lock()
+	defer ch.mtx.Unlock()
+	ch.closed = c
+	return c
+}
+
+func (ch *consumerChannel) Close() error {
+	ch.mtx.Lock()
+	defer ch.mtx.Unlock()
+	ch.shutdown(nil)
+	return nil
+}
+
+// fail closes the channel like a broker or a connection loss would.
+func (ch *consumerChannel) fail(err *amqp.Error) {
+	ch.mtx.Lock()
+	defer ch.mtx.Unlock()
+	ch.shutdown(err)
+}
+
+func (ch *consumerChannel) shutdown(err *amqp.Error) {
+	if ch.done {
+		return
+	}
+	ch.done = true
+	close(ch.deliveries)
+	if err != nil {
+		ch.closed <- err
+	}
+	if !ch.canceled {
+		close(ch.closed)
+	}
+}
+
+func TestConsumerReconnects(t *testing.T) {
+	var (
+		channels = make(chan *consumerChannel, 2)
+		handled  = make(chan string)
+	)
+	consumer := amqptransport.NewConsumer(
+		func() (amqptransport.ConsumerChannel, error) {
+			ch := newConsumerChannel()
+			channels <- ch
+			return ch, nil
+		},
+		"work",
+		func(amqptransport.Channel) func(*amqp.Delivery) {
+			return func(deliv *amqp.Delivery) { handled <- string(deliv.Body) }
+		},
+		amqptransport.ConsumerPrefetch(10),
+		amqptransport.ConsumerTopology(amqptransport.ConsumerDeclareQueue("work", nil)),
+		amqptransport.ConsumerBackoff(time.Millisecond, time.Millisecond),
+	)
+	errc := make(chan error, 1)
+	go func() { errc <- consumer.Run() }()
+
+	first := <-channels
+	first.deliveries <- amqp.Delivery{Body: []byte("first")}
+	if want, have := "first", <-handled; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	first.fail(&amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restarted"})
+
+	second := <-channels
+	second.deliveries <- amqp.Delivery{Body: []byte("second")}
+	if want, have := "second", <-handled; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	for _, ch := range []*consumerChannel{first, second} {
+		if want, have := 10, ch.prefetch; want != have {
+			t.Errorf("prefetch: want %d, have %d", want, have)
+		}
+		if want, have := 1, len(ch.declared); want != have {
+			t.Errorf("declared queues: want %d, have %d", want, have)
+		}
+	}
+
+	if err := consumer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := amqptransport.ErrConsumerClosed, <-errc; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestConsumerShutdownWaitsForInFlight(t *testing.T) {
+	var (
+		ch       = newConsumerChannel()
+		started  = make(chan struct{}, 2)
+		release  = make(chan struct{})
+		mtx      sync.Mutex
+		acks     []*acknowledger
+		consumer = amqptransport.NewConsumer(
+			func() (amqptransport.ConsumerChannel, error) { return ch, nil },
+			"work",
+			func(amqptransport.Channel) func(*amqp.Delivery) {
+				return func(deliv *amqp.Delivery) {
+					started <- struct{}{}
+					<-release
+					deliv.Ack(false)
+				}
+			},
+			amqptransport.ConsumerWorkers(2),
+		)
+	)
+	go consumer.Run()
+
+	for i := 0; i < 2; i++ {
+		ack := &acknowledger{}
+		mtx.Lock()
+		acks = append(acks, ack)
+		mtx.Unlock()
+		ch.deliveries <- amqp.Delivery{Acknowledger: ack}
+	}
+	// Both workers handle a delivery concurrently.
+	<-started
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- consumer.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before in-flight deliveries were handled: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	ch.mtx.Lock()
+	if !ch.canceled {
+		t.Error("consumer wasn't canceled")
+	}
+	ch.mtx.Unlock()
+	mtx.Lock()
+	defer mtx.Unlock()
+	for i, ack := range acks {
+		if !ack.acked {
+			t.Errorf("delivery %d wasn't acked", i)
+		}
+	}
+}
+
+func TestConsumerShutdownTimeout(t *testing.T) {
+	var (
+		ch       = newConsumerChannel()
+		release  = make(chan struct{})
+		consumer = amqptransport.NewConsumer(
+			func() (amqptransport.ConsumerChannel, error) { return ch, nil },
+			"work",
+			func(amqptransport.Channel) func(*amqp.Delivery) {
+				return func(*amqp.Delivery) { <-release }
+			},
+		)
+	)
+	defer close(release)
+	go consumer.Run()
+	ch.deliveries <- amqp.Delivery{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if want, have := context.DeadlineExceeded, consumer.Shutdown(ctx); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
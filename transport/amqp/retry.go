@@ -0,0 +1,281 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers set by Retry on the publishings it republishes.
+const (
+	// RetryAttemptHeader holds the number of times a message has been
+	// retried. It's absent from the first delivery of a message.
+	RetryAttemptHeader = "x-retry-attempt"
+
+	// FailureReasonHeader holds the error of the last failed attempt of a
+	// dead-lettered message.
+	FailureReasonHeader = "x-failure-reason"
+	// FailureAttemptsHeader holds the number of times a dead-lettered message
+	// was processed, including the first delivery.
+	FailureAttemptsHeader = "x-failure-attempts"
+	// FailureQueueHeader holds the queue a dead-lettered message was
+	// consumed from.
+	FailureQueueHeader = "x-failure-queue"
+	// FailureExchangeHeader and FailureRoutingKeyHeader hold the exchange and
+	// routing key a retried message was first published with.
+	FailureExchangeHeader   = "x-failure-exchange"
+	FailureRoutingKeyHeader = "x-failure-routing-key"
+	// FailureTimeHeader holds the time a message was dead-lettered.
+	FailureTimeHeader = "x-failure-time"
+)
+
+// QueueDeclarer declares queues. It is highly recommended to use
+// *amqp.Channel as the interface implementation.
+type QueueDeclarer interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+}
+
+// Retry republishes the deliveries that failed to be processed to delay
+// queues, rather than requeueing them immediately, which would redeliver a
+// poison message in a tight loop.
+//
+// Each retry has its own delay queue, which isn't consumed: its messages
+// expire after the delay of the retry, and are then dead-lettered through the
+// default exchange back to the work queue. Once every retry failed, messages
+// are published to a dead-letter queue, with headers describing the failure.
+//
+// Messages are republished through a ConfirmDeliverer, and the failed delivery
+// is only acked once the broker confirmed the republished message, so that a
+// message is never lost if the broker drops it. Once the channel of the
+// ConfirmDeliverer is closed, such as by a connection loss, a new one is
+// dialed for the next failed delivery.
+type Retry struct {
+	queue           string
+	dialConfirm     ConfirmDialer
+	delays          []time.Duration
+	deadLetterQueue string
+	durable         bool
+	errorHandler    transport.ErrorHandler
+
+	mtx     sync.Mutex
+	confirm *ConfirmDeliverer
+}
+
+// NewRetry returns a Retry for the work queue, which retries failed messages
+// once for each of the delays, in order. Messages are thus processed at most
+// len(delays)+1 times. They're republished through the ConfirmDeliverers
+// returned by dialConfirm, which must publish on another channel than the one
+// the deliveries are consumed from.
+func NewRetry(queue string, delays []time.Duration, dialConfirm ConfirmDialer, options ...RetryOption) *Retry {
+	r := &Retry{
+		queue:           queue,
+		dialConfirm:     dialConfirm,
+		delays:          delays,
+		deadLetterQueue: queue + ".dead",
+		durable:         true,
+		errorHandler:    transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// RetryOption sets an optional parameter for Retry.
+type RetryOption func(*Retry)
+
+// RetryDeadLetterQueue sets the name of the dead-letter queue. By default,
+// it's the name of the work queue followed by ".dead".
+func RetryDeadLetterQueue(name string) RetryOption {
+	return func(r *Retry) { r.deadLetterQueue = name }
+}
+
+// RetryDurable sets whether the delay and dead-letter queues are durable. By
+// default, they are.
+func RetryDurable(durable bool) RetryOption {
+	return func(r *Retry) { r.durable = durable }
+}
+
+// RetryErrorHandler is used to handle errors republishing failed messages,
+// which are then requeued instead. By default, they're ignored.
+func RetryErrorHandler(errorHandler transport.ErrorHandler) RetryOption {
+	return func(r *Retry) { r.errorHandler = errorHandler }
+}
+
+// DelayQueue returns the name of the delay queue of the attempt-th retry,
+// starting at 1.
+func (r *Retry) DelayQueue(attempt int) string {
+	return r.queue + ".retry." + strconv.Itoa(attempt)
+}
+
+// DeadLetterQueue returns the name of the dead-letter queue.
+func (r *Retry) DeadLetterQueue() string {
+	return r.deadLetterQueue
+}
+
+// DeclareTopology declares the delay queues and the dead-letter queue. The
+// work queue itself must be declared by the caller.
+func (r *Retry) DeclareTopology(ch QueueDeclarer) error {
+	for i, delay := range r.delays {
+		_, err := ch.QueueDeclare(
+			r.DelayQueue(i+1),
+			r.durable,
+			false, // autoDelete
+			false, // exclusive
+			false, // noWait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": r.queue,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(
+		r.deadLetterQueue,
+		r.durable,
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		nil,
+	)
+	return err
+}
+
+// ErrorEncoder is an ErrorEncoder that republishes the failed delivery to the
+// delay queue of its next retry, or to the dead-letter queue once every retry
+// failed, and acks it once the broker confirmed the republished message. If
+// republishing fails, or isn't confirmed, the delivery is nacked and requeued.
+func (r *Retry) ErrorEncoder(ctx context.Context, err error, deliv *amqp.Delivery, _ Channel, _ *amqp.Publishing) {
+	attempt := RetryAttempt(deliv) + 1
+	retry := deliveryPublishing(deliv)
+
+	// Delay queues dead-letter messages to the work queue through the default
+	// exchange, so their original destination is kept in headers.
+	if _, ok := retry.Headers[FailureExchangeHeader]; !ok {
+		retry.Headers[FailureExchangeHeader] = deliv.Exchange
+		retry.Headers[FailureRoutingKeyHeader] = deliv.RoutingKey
+	}
+
+	var key string
+	if attempt <= len(r.delays) {
+		key = r.DelayQueue(attempt)
+		retry.Headers[RetryAttemptHeader] = int32(attempt)
+	} else {
+		key = r.deadLetterQueue
+		retry.Headers[FailureReasonHeader] = err.Error()
+		retry.Headers[FailureAttemptsHeader] = int32(attempt)
+		retry.Headers[FailureQueueHeader] = r.queue
+		retry.Headers[FailureTimeHeader] = time.Now()
+	}
+
+	ctx = context.WithValue(ctx, ContextKeyExchange, "") // default exchange
+	ctx = context.WithValue(ctx, ContextKeyPublishKey, key)
+	if err := r.republish(ctx, &retry); err != nil {
+		r.errorHandler.Handle(ctx, err)
+		deliv.Nack(
+			false, //multiple
+			true,  //requeue
+		)
+		return
+	}
+	deliv.Ack(false)
+}
+
+// republish publishes through the current ConfirmDeliverer. If its channel is
+// closed, which it may only notice when publishing, a new one is dialed.
+func (r *Retry) republish(ctx context.Context, pub *amqp.Publishing) error {
+	for retried := false; ; retried = true {
+		d, err := r.deliverer()
+		if err != nil {
+			return err
+		}
+		_, err = d.Deliver(ctx, Publisher{}, pub)
+		if !retried && (err == ErrConfirmChannelClosed || errors.Is(err, amqp.ErrClosed)) {
+			r.drop(d)
+			continue
+		}
+		return err
+	}
+}
+
+// deliverer returns the current ConfirmDeliverer, after dialing a new one if
+// there's none, or if its channel is closed.
+func (r *Retry) deliverer() (*ConfirmDeliverer, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.confirm != nil && r.confirm.isClosed() {
+		r.confirm.release()
+		r.confirm = nil
+	}
+	if r.confirm == nil {
+		d, err := r.dialConfirm()
+		if err != nil {
+			return nil, err
+		}
+		r.confirm = d
+	}
+	return r.confirm, nil
+}
+
+// drop forgets the ConfirmDeliverer, unless it was already replaced.
+func (r *Retry) drop(d *ConfirmDeliverer) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.confirm == d {
+		d.release()
+		r.confirm = nil
+	}
+}
+
+// RetryAttempt returns the number of times the delivery has been retried by
+// a Retry, which is 0 for the first delivery of a message.
+func RetryAttempt(deliv *amqp.Delivery) int {
+	switch v := deliv.Headers[RetryAttemptHeader].(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// deliveryPublishing returns a publishing with the content and properties of
+// the delivery, but without its expiration, which would conflict with the
+// TTL of the delay queues.
+func deliveryPublishing(deliv *amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range deliv.Headers {
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     deliv.ContentType,
+		ContentEncoding: deliv.ContentEncoding,
+		DeliveryMode:    deliv.DeliveryMode,
+		Priority:        deliv.Priority,
+		CorrelationId:   deliv.CorrelationId,
+		ReplyTo:         deliv.ReplyTo,
+		MessageId:       deliv.MessageId,
+		Timestamp:       deliv.Timestamp,
+		Type:            deliv.Type,
+		UserId:          deliv.UserId,
+		AppId:           deliv.AppId,
+		Body:            deliv.Body,
+	}
+}
@@ -0,0 +1,267 @@
+package amqp_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport"
+	amqptransport "github.com/go-kit/kit/transport/amqp"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// declaringChannel records the queues declared on it.
+type declaringChannel struct {
+	queues map[string]amqp.Table
+}
+
+func (ch *declaringChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	ch.queues[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+// acknowledger records how a delivery was settled.
+type acknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// dialConfirm returns a ConfirmDialer that always returns d.
+func dialConfirm(d *amqptransport.ConfirmDeliverer) amqptransport.ConfirmDialer {
+	return func() (*amqptransport.ConfirmDeliverer, error) { return d, nil }
+}
+
+func TestRetryDeclareTopology(t *testing.T) {
+	retry := amqptransport.NewRetry("work", []time.Duration{time.Second, time.Minute}, nil)
+	ch := &declaringChannel{queues: map[string]amqp.Table{}}
+	if err := retry.DeclareTopology(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 3, len(ch.queues); want != have {
+		t.Fatalf("declared queues: want %d, have %d", want, have)
+	}
+	if _, ok := ch.queues["work.dead"]; !ok {
+		t.Errorf("dead-letter queue %q wasn't declared", retry.DeadLetterQueue())
+	}
+	for i, ttl := range []int64{1000, 60000} {
+		args, ok := ch.queues[retry.DelayQueue(i+1)]
+		if !ok {
+			t.Fatalf("delay queue %q wasn't declared", retry.DelayQueue(i+1))
+		}
+		if want, have := ttl, args["x-message-ttl"]; want != have {
+			t.Errorf("%s TTL: want %v, have %v", retry.DelayQueue(i+1), want, have)
+		}
+		if want, have := "work", args["x-dead-letter-routing-key"]; want != have {
+			t.Errorf("%s dead-letter routing key: want %v, have %v", retry.DelayQueue(i+1), want, have)
+		}
+	}
+}
+
+func TestRetryErrorEncoder(t *testing.T) {
+	var (
+		keys = make(chan string, 1)
+		pubs = make(chan amqp.Publishing, 1)
+		ch   = &confirmChannel{
+			mockChannel: mockChannel{c: pubs},
+			f: func(key string, mandatory bool) (bool, bool) {
+				keys <- key
+				return true, false
+			},
+		}
+	)
+	confirm, err := amqptransport.NewConfirmDeliverer(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		retry = amqptransport.NewRetry("work", []time.Duration{time.Second, time.Minute}, dialConfirm(confirm))
+		sub   = amqptransport.NewSubscriber(
+			func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("poison") },
+			func(context.Context, *amqp.Delivery) (interface{}, error) { return struct{}{}, nil },
+			amqptransport.EncodeNopResponse,
+			amqptransport.SubscriberErrorEncoder(retry.ErrorEncoder),
+		)
+		deliv = amqp.Delivery{
+			Exchange:      "events",
+			RoutingKey:    "thing.created",
+			CorrelationId: "1234",
+			Body:          []byte("body"),
+		}
+	)
+
+	for _, want := range []string{"work.retry.1", "work.retry.2", "work.dead"} {
+		ack := &acknowledger{}
+		deliv.Acknowledger = ack
+		sub.ServeDelivery(&mockChannel{f: nullFunc})(&deliv)
+
+		if have := <-keys; want != have {
+			t.Fatalf("republished to: want %q, have %q", want, have)
+		}
+		if !ack.acked {
+			t.Errorf("%s: delivery wasn't acked", want)
+		}
+		pub := <-pubs
+		if want, have := "1234", pub.CorrelationId; want != have {
+			t.Errorf("correlation ID: want %q, have %q", want, have)
+		}
+		if want, have := "body", string(pub.Body); want != have {
+			t.Errorf("body: want %q, have %q", want, have)
+		}
+
+		// The delay queue dead-letters the message back to the work queue.
+		deliv = amqp.Delivery{
+			Exchange:      "",
+			RoutingKey:    "work",
+			Headers:       pub.Headers,
+			CorrelationId: pub.CorrelationId,
+			Body:          pub.Body,
+		}
+	}
+
+	for k, want := range map[string]interface{}{
+		amqptransport.FailureReasonHeader:     "poison",
+		amqptransport.FailureAttemptsHeader:   int32(3),
+		amqptransport.FailureQueueHeader:      "work",
+		amqptransport.FailureExchangeHeader:   "events",
+		amqptransport.FailureRoutingKeyHeader: "thing.created",
+	} {
+		if have := deliv.Headers[k]; want != have {
+			t.Errorf("%s: want %v, have %v", k, want, have)
+		}
+	}
+	if _, ok := deliv.Headers[amqptransport.FailureTimeHeader].(time.Time); !ok {
+		t.Errorf("%s: want a time, have %v", amqptransport.FailureTimeHeader, deliv.Headers[amqptransport.FailureTimeHeader])
+	}
+}
+
+func TestRetryErrorEncoderNotConfirmed(t *testing.T) {
+	ch := &confirmChannel{f: func(string, bool) (bool, bool) { return false, false }}
+	confirm, err := amqptransport.NewConfirmDeliverer(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled error
+	retry := amqptransport.NewRetry("work", []time.Duration{time.Second}, dialConfirm(confirm),
+		amqptransport.RetryErrorHandler(transport.ErrorHandlerFunc(func(_ context.Context, err error) { handled = err })),
+	)
+	ack := &acknowledger{}
+	retry.ErrorEncoder(context.Background(), errors.New("poison"), &amqp.Delivery{Acknowledger: ack}, &mockChannel{}, &amqp.Publishing{})
+
+	if ack.acked {
+		t.Error("delivery was acked although the broker nacked the republished message")
+	}
+	if !ack.nacked || !ack.requeued {
+		t.Errorf("want delivery nacked and requeued, have nacked=%v requeued=%v", ack.nacked, ack.requeued)
+	}
+	var nack amqptransport.NackError
+	if !errors.As(handled, &nack) {
+		t.Errorf("want %T handled, have %v", nack, handled)
+	}
+}
+
+func TestRetryConsumerReconnects(t *testing.T) {
+	var (
+		channels  = make(chan *consumerChannel, 2)
+		confirms  = make(chan *confirmChannel, 2)
+		published = make(chan string, 1)
+		handled   = make(chan struct{})
+	)
+	retry := amqptransport.NewRetry("work", []time.Duration{time.Second}, func() (*amqptransport.ConfirmDeliverer, error) {
+		ch := &confirmChannel{f: func(key string, mandatory bool) (bool, bool) {
+			published <- key
+			return true, false
+		}}
+		confirms <- ch
+		return amqptransport.NewConfirmDeliverer(ch)
+	})
+	sub := amqptransport.NewSubscriber(
+		func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("poison") },
+		func(context.Context, *amqp.Delivery) (interface{}, error) { return struct{}{}, nil },
+		amqptransport.EncodeNopResponse,
+		amqptransport.SubscriberErrorEncoder(retry.ErrorEncoder),
+	)
+	consumer := amqptransport.NewConsumer(
+		func() (amqptransport.ConsumerChannel, error) {
+			ch := newConsumerChannel()
+			channels <- ch
+			return ch, nil
+		},
+		"work",
+		func(ch amqptransport.Channel) func(*amqp.Delivery) {
+			serve := sub.ServeDelivery(ch)
+			return func(deliv *amqp.Delivery) {
+				serve(deliv)
+				handled <- struct{}{}
+			}
+		},
+		amqptransport.ConsumerTopology(amqptransport.ConsumerDeclareQueue("work", nil), retry.DeclareTopology),
+		amqptransport.ConsumerBackoff(time.Millisecond, time.Millisecond),
+	)
+	go consumer.Run()
+	defer consumer.Shutdown(context.Background())
+
+	deliver := func(ch *consumerChannel) *acknowledger {
+		ack := &acknowledger{}
+		ch.deliveries <- amqp.Delivery{Acknowledger: ack, RoutingKey: "work"}
+		if want, have := "work.retry.1", <-published; want != have {
+			t.Errorf("republished to: want %q, have %q", want, have)
+		}
+		<-handled
+		return ack
+	}
+
+	first := <-channels
+	if ack := deliver(first); !ack.acked {
+		t.Error("first delivery wasn't acked")
+	}
+
+	// The connection is lost, which closes both channels.
+	(<-confirms).shutdown()
+	first.fail(&amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restarted"})
+
+	second := <-channels
+	if ack := deliver(second); !ack.acked {
+		t.Errorf("second delivery wasn't acked, nacked=%v", ack.nacked)
+	}
+	if want, have := 1, len(confirms); want != have {
+		t.Errorf("redialed confirm deliverers: want %d, have %d", want, have)
+	}
+	for _, ch := range []*consumerChannel{first, second} {
+		if want, have := []string{"work", "work.retry.1", "work.dead"}, ch.declared; !reflect.DeepEqual(want, have) {
+			t.Errorf("declared queues: want %v, have %v", want, have)
+		}
+	}
+}
+
+func TestRetryAttempt(t *testing.T) {
+	for _, testcase := range []struct {
+		header interface{}
+		want   int
+	}{
+		{nil, 0},
+		{int32(2), 2},
+		{int64(3), 3},
+		{"4", 0},
+	} {
+		deliv := &amqp.Delivery{Headers: amqp.Table{amqptransport.RetryAttemptHeader: testcase.header}}
+		if want, have := testcase.want, amqptransport.RetryAttempt(deliv); want != have {
+			t.Errorf("%#v: want %d, have %d", testcase.header, want, have)
+		}
+	}
+}
@@ -1,2 +1,6 @@
 // Package awslambda provides an AWS Lambda transport layer.
+//
+// Handler works on raw payloads. HTTPHandler adapts an http.Handler to the
+// events of API Gateway and Application Load Balancers, and SQSHandler and
+// SNSHandler invoke an endpoint for every record of SQS and SNS events.
 package awslambda
@@ -0,0 +1,299 @@
+package awslambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HTTPHandler adapts an http.Handler, typically a transport/http Server, to
+// the proxy events of API Gateway REST APIs (payload format 1.0) and HTTP APIs
+// (payload format 2.0), and to the events of Application Load Balancers.
+// Events are converted to an *http.Request, so the DecodeRequestFunc,
+// ErrorEncoder, StatusCoder and Headerer of the Server apply as they would
+// behind an HTTP listener:
+//
+//	lambda.StartHandler(awslambda.NewHTTPHandler(httptransport.NewServer(e, dec, enc)))
+//
+// The event is available in the context of the request under
+// ContextKeyEvent. Response bodies which aren't valid UTF-8 are base64
+// encoded.
+type HTTPHandler struct {
+	handler http.Handler
+}
+
+// NewHTTPHandler constructs a new HTTPHandler, which implements the AWS
+// lambda.Handler interface.
+func NewHTTPHandler(handler http.Handler) *HTTPHandler {
+	return &HTTPHandler{handler: handler}
+}
+
+type contextKey int
+
+const (
+	// ContextKeyEvent is populated in the context of the requests of
+	// HTTPHandlers. Its value is the event: an
+	// events.APIGatewayProxyRequest, an events.APIGatewayV2HTTPRequest or an
+	// events.ALBTargetGroupRequest.
+	ContextKeyEvent contextKey = iota
+)
+
+// httpEvent holds the fields that tell the kind of an event apart.
+type httpEvent struct {
+	Version        string `json:"version"`
+	RequestContext struct {
+		ELB *struct{} `json:"elb"`
+	} `json:"requestContext"`
+}
+
+// Invoke implements the AWS lambda.Handler interface. It tells the kind of
+// the event from the payload.
+func (h *HTTPHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var kind httpEvent
+	if err := json.Unmarshal(payload, &kind); err != nil {
+		return nil, err
+	}
+
+	var (
+		resp interface{}
+		err  error
+	)
+	switch {
+	case kind.RequestContext.ELB != nil:
+		var event events.ALBTargetGroupRequest
+		if err = json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		resp, err = h.ServeALB(ctx, event)
+	case kind.Version == "2.0":
+		var event events.APIGatewayV2HTTPRequest
+		if err = json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		resp, err = h.ServeAPIGatewayV2HTTP(ctx, event)
+	default:
+		var event events.APIGatewayProxyRequest
+		if err = json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		resp, err = h.ServeAPIGatewayProxy(ctx, event)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// ServeAPIGatewayProxy serves the proxy event of an API Gateway REST API.
+func (h *HTTPHandler) ServeAPIGatewayProxy(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	r, err := newRequest(ctx, event, event.HTTPMethod, (&url.URL{Path: event.Path}).EscapedPath(), encodeQuery(event.QueryStringParameters, event.MultiValueQueryStringParameters), event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	setHeaders(r, event.Headers, event.MultiValueHeaders)
+	r.RemoteAddr = event.RequestContext.Identity.SourceIP
+
+	w := h.serve(r)
+	body, isBase64 := w.encodedBody()
+	return events.APIGatewayProxyResponse{
+		StatusCode:        w.status,
+		MultiValueHeaders: w.header,
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}, nil
+}
+
+// ServeAPIGatewayV2HTTP serves the event of an API Gateway HTTP API, with
+// the payload format 2.0.
+func (h *HTTPHandler) ServeAPIGatewayV2HTTP(ctx context.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	r, err := newRequest(ctx, event, event.RequestContext.HTTP.Method, event.RawPath, event.RawQueryString, event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	setHeaders(r, event.Headers, nil)
+	if len(event.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(event.Cookies, "; "))
+	}
+	r.RemoteAddr = event.RequestContext.HTTP.SourceIP
+
+	w := h.serve(r)
+	cookies := w.header["Set-Cookie"]
+	w.header.Del("Set-Cookie")
+	body, isBase64 := w.encodedBody()
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      w.status,
+		Headers:         singleValueHeaders(w.header, ","),
+		Body:            body,
+		IsBase64Encoded: isBase64,
+		Cookies:         cookies,
+	}, nil
+}
+
+// ServeALB serves the event of an Application Load Balancer. The response
+// has multi-value headers if the event has, which is the case when they're
+// enabled on the target group.
+func (h *HTTPHandler) ServeALB(ctx context.Context, event events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	r, err := newRequest(ctx, event, event.HTTPMethod, event.Path, joinQuery(event.QueryStringParameters, event.MultiValueQueryStringParameters), event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return events.ALBTargetGroupResponse{}, err
+	}
+	setHeaders(r, event.Headers, event.MultiValueHeaders)
+
+	w := h.serve(r)
+	body, isBase64 := w.encodedBody()
+	resp := events.ALBTargetGroupResponse{
+		StatusCode:        w.status,
+		StatusDescription: strings.TrimSpace(strconv.Itoa(w.status) + " " + http.StatusText(w.status)),
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}
+	if event.MultiValueHeaders != nil {
+		resp.MultiValueHeaders = w.header
+	} else {
+		resp.Headers = singleValueHeaders(w.header, ", ")
+	}
+	return resp, nil
+}
+
+func (h *HTTPHandler) serve(r *http.Request) *responseWriter {
+	w := &responseWriter{header: http.Header{}}
+	h.handler.ServeHTTP(w, r)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w
+}
+
+// newRequest returns the request of an event. The path is URL encoded, as in
+// the events of API Gateway v2 and ALB; API Gateway v1 events carry it
+// decoded.
+func newRequest(ctx context.Context, event interface{}, method, path, query, body string, isBase64 bool) (*http.Request, error) {
+	var b []byte
+	if isBase64 {
+		var err error
+		if b, err = base64.StdEncoding.DecodeString(body); err != nil {
+			return nil, err
+		}
+	} else {
+		b = []byte(body)
+	}
+	if method == "" {
+		return nil, errors.New("event has no HTTP method")
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query
+	r, err := http.NewRequest(method, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	r.RequestURI = u.RequestURI()
+	return r.WithContext(context.WithValue(ctx, ContextKeyEvent, event)), nil
+}
+
+func encodeQuery(single map[string]string, multi map[string][]string) string {
+	values := url.Values{}
+	for k, vs := range multi {
+		values[k] = vs
+	}
+	for k, v := range single {
+		if _, ok := values[k]; !ok {
+			values.Set(k, v)
+		}
+	}
+	return values.Encode()
+}
+
+// joinQuery joins query parameters which are still URL encoded, like the
+// ones of ALB events.
+func joinQuery(single map[string]string, multi map[string][]string) string {
+	values := map[string][]string{}
+	for k, v := range single {
+		values[k] = []string{v}
+	}
+	for k, vs := range multi {
+		values[k] = vs
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range values[k] {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func setHeaders(r *http.Request, single map[string]string, multi map[string][]string) {
+	for k, vs := range multi {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	for k, v := range single {
+		if r.Header.Get(k) == "" {
+			r.Header.Set(k, v)
+		}
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		r.Host = host
+	}
+}
+
+func singleValueHeaders(header http.Header, sep string) map[string]string {
+	m := make(map[string]string, len(header))
+	for k, vs := range header {
+		m[k] = strings.Join(vs, sep)
+	}
+	return m
+}
+
+// responseWriter records the response of the http.Handler.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(b)
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) encodedBody() (body string, isBase64 bool) {
+	if utf8.Valid(w.body.Bytes()) {
+		return w.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+}
@@ -0,0 +1,213 @@
+package awslambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+type greetRequest struct {
+	Name  string
+	Lang  string
+	Event interface{}
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func (greetResponse) StatusCode() int { return http.StatusCreated }
+
+func (greetResponse) Headers() http.Header {
+	return http.Header{"X-Greeter": []string{"go-kit"}, "Set-Cookie": []string{"a=1", "b=2"}}
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string   { return "not found" }
+func (notFoundError) StatusCode() int { return http.StatusNotFound }
+
+func newGreetServer() http.Handler {
+	return httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			req := request.(greetRequest)
+			if req.Name == "nobody" {
+				return nil, notFoundError{}
+			}
+			return greetResponse{Greeting: "hello " + req.Name + " (" + req.Lang + ")"}, nil
+		},
+		func(_ context.Context, r *http.Request) (interface{}, error) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			if r.Method != http.MethodPost || r.URL.Path != "/greet" {
+				return nil, errors.New("bad route " + r.Method + " " + r.URL.Path)
+			}
+			return greetRequest{
+				Name:  string(body),
+				Lang:  r.URL.Query().Get("lang") + "/" + r.Header.Get("Accept-Language"),
+				Event: r.Context().Value(ContextKeyEvent),
+			}, nil
+		},
+		httptransport.EncodeJSONResponse,
+	)
+}
+
+func TestHTTPHandlerAPIGatewayProxy(t *testing.T) {
+	handler := NewHTTPHandler(newGreetServer())
+	resp, err := handler.ServeAPIGatewayProxy(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:                      http.MethodPost,
+		Path:                            "/greet",
+		MultiValueQueryStringParameters: map[string][]string{"lang": {"en"}},
+		Headers:                         map[string]string{"Accept-Language": "fr"},
+		Body:                            base64.StdEncoding.EncodeToString([]byte("bob")),
+		IsBase64Encoded:                 true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusCreated, resp.StatusCode; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if want, have := `{"greeting":"hello bob (en/fr)"}`+"\n", resp.Body; want != have {
+		t.Errorf("body: want %q, have %q", want, have)
+	}
+	if want, have := "go-kit", resp.MultiValueHeaders["X-Greeter"]; len(have) != 1 || have[0] != want {
+		t.Errorf("header: want %q, have %q", want, have)
+	}
+	if resp.IsBase64Encoded {
+		t.Error("text body shouldn't be base64 encoded")
+	}
+}
+
+func TestHTTPHandlerAPIGatewayV2HTTP(t *testing.T) {
+	handler := NewHTTPHandler(newGreetServer())
+	event := events.APIGatewayV2HTTPRequest{
+		Version:        "2.0",
+		RawPath:        "/greet",
+		RawQueryString: "lang=de",
+		Headers:        map[string]string{"accept-language": "it"},
+		Body:           "alice",
+	}
+	event.RequestContext.HTTP.Method = http.MethodPost
+	payload, _ := json.Marshal(event)
+
+	b, err := handler.Invoke(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp events.APIGatewayV2HTTPResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusCreated, resp.StatusCode; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if want, have := `{"greeting":"hello alice (de/it)"}`+"\n", resp.Body; want != have {
+		t.Errorf("body: want %q, have %q", want, have)
+	}
+	if want, have := 2, len(resp.Cookies); want != have {
+		t.Errorf("cookies: want %d, have %d", want, have)
+	}
+	if _, ok := resp.Headers["Set-Cookie"]; ok {
+		t.Error("cookies should be moved out of the headers")
+	}
+}
+
+func TestHTTPHandlerALB(t *testing.T) {
+	var event events.ALBTargetGroupRequest
+	event.HTTPMethod = http.MethodPost
+	event.Path = "/greet"
+	event.QueryStringParameters = map[string]string{"lang": "pt%2Fbr"}
+	event.Body = "nobody"
+	event.RequestContext.ELB.TargetGroupArn = "arn:aws:elasticloadbalancing:region:123456789012:targetgroup/my-target-group/6d0ecf831eec9f09"
+	payload, _ := json.Marshal(event)
+
+	b, err := NewHTTPHandler(newGreetServer()).Invoke(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp events.ALBTargetGroupResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusNotFound, resp.StatusCode; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if want, have := "404 Not Found", resp.StatusDescription; want != have {
+		t.Errorf("status description: want %q, have %q", want, have)
+	}
+	if want, have := "not found", resp.Body; want != have {
+		t.Errorf("body: want %q, have %q", want, have)
+	}
+	if resp.MultiValueHeaders != nil {
+		t.Error("response shouldn't have multi-value headers")
+	}
+}
+
+func TestHTTPHandlerEventInContext(t *testing.T) {
+	var have interface{}
+	handler := NewHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have = r.Context().Value(ContextKeyEvent)
+		if want, have := "pt/br", r.URL.Query().Get("lang"); want != have {
+			t.Errorf("query: want %q, have %q", want, have)
+		}
+		w.Write([]byte{0xff, 0xfe})
+	}))
+	event := events.ALBTargetGroupRequest{
+		HTTPMethod:                      http.MethodGet,
+		Path:                            "/",
+		MultiValueQueryStringParameters: map[string][]string{"lang": {"pt%2Fbr"}},
+		MultiValueHeaders:               map[string][]string{"Accept": {"*/*"}},
+	}
+	resp, err := handler.ServeALB(context.Background(), event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.(events.ALBTargetGroupRequest); !ok {
+		t.Errorf("want the event in the context, have %T", have)
+	}
+	if want, have := base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe}), resp.Body; !resp.IsBase64Encoded || want != have {
+		t.Errorf("body: want base64 %q, have %q", want, have)
+	}
+	if resp.MultiValueHeaders == nil {
+		t.Error("response should have multi-value headers")
+	}
+}
+
+func TestHTTPHandlerEscapedPaths(t *testing.T) {
+	var path, requestURI string
+	handler := NewHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, requestURI = r.URL.Path, r.RequestURI
+	}))
+
+	v1 := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/a b/c%d"}
+	v2 := events.APIGatewayV2HTTPRequest{Version: "2.0", RawPath: "/a%20b/c%25d"}
+	v2.RequestContext.HTTP.Method = http.MethodGet
+	var alb events.ALBTargetGroupRequest
+	alb.HTTPMethod = http.MethodGet
+	alb.Path = "/a%20b/c%25d"
+	alb.RequestContext.ELB.TargetGroupArn = "arn:aws:elasticloadbalancing:region:123456789012:targetgroup/my-target-group/6d0ecf831eec9f09"
+
+	for name, event := range map[string]interface{}{"v1": v1, "v2": v2, "alb": alb} {
+		payload, _ := json.Marshal(event)
+		if _, err := handler.Invoke(context.Background(), payload); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want, have := "/a b/c%d", path; want != have {
+			t.Errorf("%s: path: want %q, have %q", name, want, have)
+		}
+		if want, have := "/a%20b/c%25d", requestURI; want != have {
+			t.Errorf("%s: request URI: want %q, have %q", name, want, have)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package awslambda
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// SNSDecodeRequestFunc extracts a user-domain request object from a record
+// of an SNS event.
+type SNSDecodeRequestFunc func(context.Context, events.SNSEventRecord) (interface{}, error)
+
+// SNSRequestFunc may take information from a record of an SNS event and use
+// it to place items in the request scoped context. SNSRequestFuncs are
+// executed prior to decoding the record.
+type SNSRequestFunc func(context.Context, events.SNSEventRecord) context.Context
+
+// SNSFinalizerFunc is executed at the end of the handling of every record.
+// This can be used for logging purposes.
+type SNSFinalizerFunc func(ctx context.Context, record events.SNSEventRecord, err error)
+
+// SNSHandler wraps an endpoint, which it invokes for every record of SNS
+// events. SNS has no partial failures: when the handling of a record fails,
+// the whole event is delivered again, according to the retry policy of the
+// asynchronous invocation.
+type SNSHandler struct {
+	e            endpoint.Endpoint
+	dec          SNSDecodeRequestFunc
+	before       []SNSRequestFunc
+	finalizer    []SNSFinalizerFunc
+	errorHandler transport.ErrorHandler
+}
+
+// NewSNSHandler constructs a new SNS handler, which implements the AWS
+// lambda.Handler interface.
+func NewSNSHandler(
+	e endpoint.Endpoint,
+	dec SNSDecodeRequestFunc,
+	options ...SNSHandlerOption,
+) *SNSHandler {
+	h := &SNSHandler{
+		e:            e,
+		dec:          dec,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// SNSHandlerOption sets an optional parameter for SNS handlers.
+type SNSHandlerOption func(*SNSHandler)
+
+// SNSHandlerBefore functions are executed on every record, before it's
+// decoded.
+func SNSHandlerBefore(before ...SNSRequestFunc) SNSHandlerOption {
+	return func(h *SNSHandler) { h.before = append(h.before, before...) }
+}
+
+// SNSHandlerErrorHandler is used to handle the errors of records.
+// By default, errors are ignored.
+func SNSHandlerErrorHandler(errorHandler transport.ErrorHandler) SNSHandlerOption {
+	return func(h *SNSHandler) { h.errorHandler = errorHandler }
+}
+
+// SNSHandlerFinalizer sets finalizers which are called at the end of the
+// handling of every record. By default no finalizer is registered.
+func SNSHandlerFinalizer(f ...SNSFinalizerFunc) SNSHandlerOption {
+	return func(h *SNSHandler) { h.finalizer = append(h.finalizer, f...) }
+}
+
+// Invoke implements the AWS lambda.Handler interface.
+func (h *SNSHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var event events.SNSEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return nil, h.HandleSNS(ctx, event)
+}
+
+// HandleSNS invokes the endpoint for every record of the event, in order,
+// and returns the first error.
+func (h *SNSHandler) HandleSNS(ctx context.Context, event events.SNSEvent) error {
+	for _, record := range event.Records {
+		if err := h.handle(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *SNSHandler) handle(ctx context.Context, record events.SNSEventRecord) (err error) {
+	if len(h.finalizer) > 0 {
+		defer func() {
+			for _, f := range h.finalizer {
+				f(ctx, record, err)
+			}
+		}()
+	}
+
+	for _, f := range h.before {
+		ctx = f(ctx, record)
+	}
+
+	request, err := h.dec(ctx, record)
+	if err != nil {
+		h.errorHandler.Handle(ctx, err)
+		return err
+	}
+
+	if _, err = h.e(ctx, request); err != nil {
+		h.errorHandler.Handle(ctx, err)
+		return err
+	}
+	return nil
+}
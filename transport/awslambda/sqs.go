@@ -0,0 +1,153 @@
+package awslambda
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// SQSDecodeRequestFunc extracts a user-domain request object from a message
+// of an SQS event.
+type SQSDecodeRequestFunc func(context.Context, events.SQSMessage) (interface{}, error)
+
+// SQSRequestFunc may take information from a message of an SQS event and use
+// it to place items in the request scoped context. SQSRequestFuncs are
+// executed prior to decoding the message.
+type SQSRequestFunc func(context.Context, events.SQSMessage) context.Context
+
+// SQSResponseFunc may take information from a request context and the
+// response of the endpoint. SQSResponseFuncs are executed after invoking the
+// endpoint successfully.
+type SQSResponseFunc func(ctx context.Context, msg events.SQSMessage, response interface{}) context.Context
+
+// SQSFinalizerFunc is executed at the end of the handling of every message.
+// This can be used for logging purposes.
+type SQSFinalizerFunc func(ctx context.Context, msg events.SQSMessage, err error)
+
+// SQSHandler wraps an endpoint, which it invokes for every message of SQS
+// events. Messages whose handling failed are reported as batch item
+// failures, so only those are delivered again, which requires the
+// ReportBatchItemFailures response type on the event source mapping.
+type SQSHandler struct {
+	e            endpoint.Endpoint
+	dec          SQSDecodeRequestFunc
+	before       []SQSRequestFunc
+	after        []SQSResponseFunc
+	finalizer    []SQSFinalizerFunc
+	errorHandler transport.ErrorHandler
+}
+
+// NewSQSHandler constructs a new SQS handler, which implements the AWS
+// lambda.Handler interface.
+func NewSQSHandler(
+	e endpoint.Endpoint,
+	dec SQSDecodeRequestFunc,
+	options ...SQSHandlerOption,
+) *SQSHandler {
+	h := &SQSHandler{
+		e:            e,
+		dec:          dec,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// SQSHandlerOption sets an optional parameter for SQS handlers.
+type SQSHandlerOption func(*SQSHandler)
+
+// SQSHandlerBefore functions are executed on every message, before it's
+// decoded.
+func SQSHandlerBefore(before ...SQSRequestFunc) SQSHandlerOption {
+	return func(h *SQSHandler) { h.before = append(h.before, before...) }
+}
+
+// SQSHandlerAfter functions are executed on every message, after the
+// endpoint is invoked successfully.
+func SQSHandlerAfter(after ...SQSResponseFunc) SQSHandlerOption {
+	return func(h *SQSHandler) { h.after = append(h.after, after...) }
+}
+
+// SQSHandlerErrorHandler is used to handle the errors of messages.
+// By default, errors are ignored.
+func SQSHandlerErrorHandler(errorHandler transport.ErrorHandler) SQSHandlerOption {
+	return func(h *SQSHandler) { h.errorHandler = errorHandler }
+}
+
+// SQSHandlerFinalizer sets finalizers which are called at the end of the
+// handling of every message. By default no finalizer is registered.
+func SQSHandlerFinalizer(f ...SQSFinalizerFunc) SQSHandlerOption {
+	return func(h *SQSHandler) { h.finalizer = append(h.finalizer, f...) }
+}
+
+// Invoke implements the AWS lambda.Handler interface.
+func (h *SQSHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var event events.SQSEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	resp, err := h.HandleSQS(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// HandleSQS invokes the endpoint for every message of the event, in order,
+// and reports the messages whose handling failed. Since the messages of FIFO
+// queues must be handled in order, the messages following a failure in a
+// FIFO queue aren't handled, and are reported as failures too.
+func (h *SQSHandler) HandleSQS(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	resp := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	for i, msg := range event.Records {
+		if err := h.handle(ctx, msg); err != nil {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: msg.MessageId})
+			if strings.HasSuffix(msg.EventSourceARN, ".fifo") {
+				for _, msg := range event.Records[i+1:] {
+					resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: msg.MessageId})
+				}
+				break
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (h *SQSHandler) handle(ctx context.Context, msg events.SQSMessage) (err error) {
+	if len(h.finalizer) > 0 {
+		defer func() {
+			for _, f := range h.finalizer {
+				f(ctx, msg, err)
+			}
+		}()
+	}
+
+	for _, f := range h.before {
+		ctx = f(ctx, msg)
+	}
+
+	request, err := h.dec(ctx, msg)
+	if err != nil {
+		h.errorHandler.Handle(ctx, err)
+		return err
+	}
+
+	response, err := h.e(ctx, request)
+	if err != nil {
+		h.errorHandler.Handle(ctx, err)
+		return err
+	}
+
+	for _, f := range h.after {
+		ctx = f(ctx, msg, response)
+	}
+	return nil
+}
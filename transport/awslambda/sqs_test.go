@@ -0,0 +1,139 @@
+package awslambda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/go-kit/kit/transport"
+)
+
+func failOn(bodies ...string) func(context.Context, interface{}) (interface{}, error) {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		for _, body := range bodies {
+			if request.(string) == body {
+				return nil, errors.New("failed " + body)
+			}
+		}
+		return request, nil
+	}
+}
+
+func decodeSQSBody(_ context.Context, msg events.SQSMessage) (interface{}, error) {
+	return msg.Body, nil
+}
+
+func sqsEvent(arn string, bodies ...string) events.SQSEvent {
+	var event events.SQSEvent
+	for _, body := range bodies {
+		event.Records = append(event.Records, events.SQSMessage{MessageId: "id-" + body, Body: body, EventSourceARN: arn})
+	}
+	return event
+}
+
+func failures(resp events.SQSEventResponse) []string {
+	ids := []string{}
+	for _, f := range resp.BatchItemFailures {
+		ids = append(ids, f.ItemIdentifier)
+	}
+	return ids
+}
+
+func TestSQSHandlerPartialBatchFailure(t *testing.T) {
+	var (
+		handled  []string
+		errs     []error
+		finished int
+	)
+	handler := NewSQSHandler(
+		failOn("b", "d"),
+		decodeSQSBody,
+		SQSHandlerAfter(func(ctx context.Context, _ events.SQSMessage, response interface{}) context.Context {
+			handled = append(handled, response.(string))
+			return ctx
+		}),
+		SQSHandlerErrorHandler(transport.ErrorHandlerFunc(func(_ context.Context, err error) { errs = append(errs, err) })),
+		SQSHandlerFinalizer(func(context.Context, events.SQSMessage, error) { finished++ }),
+	)
+
+	payload, _ := json.Marshal(sqsEvent("arn:aws:sqs:us-east-1:123456789012:orders", "a", "b", "c", "d"))
+	b, err := handler.Invoke(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp events.SQSEventResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := []string{"id-b", "id-d"}, failures(resp); !reflect.DeepEqual(want, have) {
+		t.Errorf("failures: want %v, have %v", want, have)
+	}
+	if want, have := []string{"a", "c"}, handled; !reflect.DeepEqual(want, have) {
+		t.Errorf("handled: want %v, have %v", want, have)
+	}
+	if want, have := 2, len(errs); want != have {
+		t.Errorf("handled errors: want %d, have %d", want, have)
+	}
+	if want, have := 4, finished; want != have {
+		t.Errorf("finalized messages: want %d, have %d", want, have)
+	}
+}
+
+func TestSQSHandlerFIFO(t *testing.T) {
+	var decoded []string
+	handler := NewSQSHandler(
+		failOn("b"),
+		decodeSQSBody,
+		SQSHandlerBefore(func(ctx context.Context, msg events.SQSMessage) context.Context {
+			decoded = append(decoded, msg.Body)
+			return ctx
+		}),
+	)
+	resp, err := handler.HandleSQS(context.Background(), sqsEvent("arn:aws:sqs:us-east-1:123456789012:orders.fifo", "a", "b", "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := []string{"id-b", "id-c"}, failures(resp); !reflect.DeepEqual(want, have) {
+		t.Errorf("failures: want %v, have %v", want, have)
+	}
+	if want, have := []string{"a", "b"}, decoded; !reflect.DeepEqual(want, have) {
+		t.Errorf("handled: want %v, have %v", want, have)
+	}
+}
+
+func TestSQSHandlerNoFailures(t *testing.T) {
+	b, err := NewSQSHandler(failOn(), decodeSQSBody).Invoke(context.Background(), []byte(`{"Records":[{"messageId":"1","body":"a"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"batchItemFailures":[]}`, string(b); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestSNSHandler(t *testing.T) {
+	var messages []string
+	handler := NewSNSHandler(
+		failOn("b"),
+		func(_ context.Context, record events.SNSEventRecord) (interface{}, error) {
+			messages = append(messages, record.SNS.Message)
+			return record.SNS.Message, nil
+		},
+	)
+	event := events.SNSEvent{Records: []events.SNSEventRecord{
+		{SNS: events.SNSEntity{Message: "a"}},
+		{SNS: events.SNSEntity{Message: "b"}},
+		{SNS: events.SNSEntity{Message: "c"}},
+	}}
+	err := handler.HandleSNS(context.Background(), event)
+	if want, have := "failed b", err; have == nil || want != have.Error() {
+		t.Errorf("want %q, have %v", want, have)
+	}
+	if want, have := []string{"a", "b"}, messages; !reflect.DeepEqual(want, have) {
+		t.Errorf("messages: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,88 @@
+package cloudevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	amqptransport "github.com/go-kit/kit/transport/amqp"
+)
+
+// amqpPrefix prefixes the attributes of events in AMQP headers.
+const amqpPrefix = "cloudEvents:"
+
+// AMQPToContext returns a RequestFunc which puts the id, source, type and
+// subject of the event carried by the delivery in the context. The context
+// is left as is if the delivery doesn't carry a valid event.
+func AMQPToContext() amqptransport.RequestFunc {
+	return func(ctx context.Context, _ *amqp.Publishing, d *amqp.Delivery) context.Context {
+		e, err := readAMQP(d)
+		if err != nil {
+			return ctx
+		}
+		return NewContext(ctx, e)
+	}
+}
+
+// DecodeAMQPDelivery returns a DecodeRequestFunc which reads the event of the
+// delivery, in either content mode, and passes it to dec. Convert it to an
+// amqp.DecodeResponseFunc to decode replies.
+func DecodeAMQPDelivery(dec DecodeEventFunc) amqptransport.DecodeRequestFunc {
+	return func(ctx context.Context, d *amqp.Delivery) (interface{}, error) {
+		e, err := readAMQP(d)
+		if err != nil {
+			return nil, err
+		}
+		return dec(NewContext(ctx, e), e)
+	}
+}
+
+// EncodeAMQPPublishing returns an EncodeRequestFunc which writes the event
+// encoded by enc to the publishing, in the mode. Convert it to an
+// amqp.EncodeResponseFunc to encode replies.
+func EncodeAMQPPublishing(enc EncodeEventFunc, mode Mode) amqptransport.EncodeRequestFunc {
+	return func(ctx context.Context, p *amqp.Publishing, request interface{}) error {
+		e, err := encode(ctx, enc, request)
+		if err != nil {
+			return err
+		}
+		contentType, attrs, body, err := writeEvent(e, mode)
+		if err != nil {
+			return err
+		}
+		if len(attrs) > 0 && p.Headers == nil {
+			p.Headers = amqp.Table{}
+		}
+		for name, value := range attrs {
+			p.Headers[amqpPrefix+name] = value
+		}
+		p.ContentType = contentType
+		p.Body = body
+		return nil
+	}
+}
+
+func readAMQP(d *amqp.Delivery) (Event, error) {
+	attrs := map[string]string{}
+	for key, value := range d.Headers {
+		if !strings.HasPrefix(key, amqpPrefix) {
+			continue
+		}
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case time.Time:
+			s = v.UTC().Format(time.RFC3339Nano)
+		default:
+			s = fmt.Sprint(v)
+		}
+		attrs[strings.ToLower(key[len(amqpPrefix):])] = s
+	}
+	return readEvent(d.ContentType, attrs, d.Body)
+}
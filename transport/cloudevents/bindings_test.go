@@ -0,0 +1,99 @@
+package cloudevents_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/go-kit/kit/transport/cloudevents"
+	kafkatransport "github.com/go-kit/kit/transport/kafka"
+)
+
+var modes = map[string]cloudevents.Mode{
+	"binary":     cloudevents.Binary,
+	"structured": cloudevents.Structured,
+}
+
+func TestAMQP(t *testing.T) {
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			var p amqp.Publishing
+			enc := cloudevents.EncodeAMQPPublishing(encodeGreeting("com.example.greeting"), mode)
+			if err := enc(context.Background(), &p, "hello"); err != nil {
+				t.Fatal(err)
+			}
+			d := &amqp.Delivery{Headers: p.Headers, ContentType: p.ContentType, Body: p.Body}
+
+			ctx := cloudevents.AMQPToContext()(context.Background(), nil, d)
+			if want, have := "/greeter", ctx.Value(cloudevents.ContextKeySource); want != have {
+				t.Errorf("source: want %q, have %v", want, have)
+			}
+			response, err := cloudevents.DecodeAMQPDelivery(decodeGreeting)(ctx, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := `hello (a "quoted" value, 100%)`, response; want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestNATS(t *testing.T) {
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			msg := nats.NewMsg("greetings")
+			enc := cloudevents.EncodeNATSMsg(encodeGreeting("com.example.greeting"), mode)
+			if err := enc(context.Background(), msg, "hello"); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := cloudevents.NATSToContext()(context.Background(), msg)
+			if want, have := "1", ctx.Value(cloudevents.ContextKeyID); want != have {
+				t.Errorf("id: want %q, have %v", want, have)
+			}
+			response, err := cloudevents.DecodeNATSMsg(decodeGreeting)(ctx, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := `hello (a "quoted" value, 100%)`, response; want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestKafka(t *testing.T) {
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			var record kafkatransport.Record
+			enc := cloudevents.EncodeKafkaRecord(func(ctx context.Context, e *cloudevents.Event, v interface{}) error {
+				if err := encodeGreeting("com.example.greeting")(ctx, e, v); err != nil {
+					return err
+				}
+				e.Extensions["partitionkey"] = "greeter-1"
+				return nil
+			}, mode)
+			if err := enc(context.Background(), &record, "hello"); err != nil {
+				t.Fatal(err)
+			}
+			if want, have := "greeter-1", string(record.Key); want != have {
+				t.Errorf("key: want %q, have %q", want, have)
+			}
+
+			ctx := cloudevents.KafkaToContext()(context.Background(), &record)
+			if want, have := "com.example.greeting", ctx.Value(cloudevents.ContextKeyType); want != have {
+				t.Errorf("type: want %q, have %v", want, have)
+			}
+			response, err := cloudevents.DecodeKafkaRecord(decodeGreeting)(ctx, &record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := `hello (a "quoted" value, 100%)`, response; want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package cloudevents
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	// ContextKeyID is populated in the context with the id of incoming
+	// events.
+	ContextKeyID contextKey = iota
+
+	// ContextKeySource is populated in the context with the source of
+	// incoming events.
+	ContextKeySource
+
+	// ContextKeyType is populated in the context with the type of incoming
+	// events. Router dispatches by it.
+	ContextKeyType
+
+	// ContextKeySubject is populated in the context with the subject of
+	// incoming events, if any.
+	ContextKeySubject
+)
+
+// NewContext returns a copy of ctx carrying the id, source, type and subject
+// of the event.
+func NewContext(ctx context.Context, e Event) context.Context {
+	ctx = context.WithValue(ctx, ContextKeyID, e.ID)
+	ctx = context.WithValue(ctx, ContextKeySource, e.Source)
+	ctx = context.WithValue(ctx, ContextKeyType, e.Type)
+	if e.Subject != "" {
+		ctx = context.WithValue(ctx, ContextKeySubject, e.Subject)
+	}
+	return ctx
+}
@@ -0,0 +1,16 @@
+// Package cloudevents provides CloudEvents bindings for the HTTP, AMQP, NATS
+// and Kafka transports.
+//
+// Events are read from and written to messages in either content mode of the
+// CloudEvents specification: in binary mode, the attributes of the event are
+// carried in the headers of the message, and its data in the body; in
+// structured mode, the whole event is encoded as JSON in the body, with the
+// application/cloudevents+json content type. Decoders accept both modes.
+//
+// The decoders and encoders of this package wrap a DecodeEventFunc or an
+// EncodeEventFunc, which convert between events and user-domain objects, into
+// the DecodeRequestFunc and EncodeRequestFunc types of each transport. The
+// HTTPToContext, AMQPToContext, NATSToContext and KafkaToContext request
+// funcs put the id, source, type and subject of incoming events in the
+// context, and a Router dispatches events to endpoints by type.
+package cloudevents
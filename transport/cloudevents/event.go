@@ -0,0 +1,348 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SpecVersion is the version of the CloudEvents specification implemented by
+// the package.
+const SpecVersion = "1.0"
+
+// ContentType is the content type of events in structured mode.
+const ContentType = "application/cloudevents+json"
+
+// ErrInvalidEvent is wrapped by the errors returned for events which aren't
+// valid, like events missing a required attribute.
+var ErrInvalidEvent = errors.New("invalid CloudEvent")
+
+// Event is a CloudEvent.
+type Event struct {
+	// Required attributes. SpecVersion defaults to the SpecVersion constant
+	// when events are encoded.
+	ID          string
+	Source      string
+	SpecVersion string
+	Type        string
+
+	// Optional attributes.
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+
+	// Extensions are the extension attributes of the event, by name.
+	Extensions map[string]string
+
+	// Data is the payload of the event, encoded with the DataContentType.
+	Data []byte
+}
+
+// Mode is the content mode in which events are written to messages.
+type Mode int
+
+const (
+	// Binary mode carries the attributes of events in the headers of
+	// messages, and their data in the body.
+	Binary Mode = iota
+
+	// Structured mode encodes events as JSON in the body of messages.
+	Structured
+)
+
+// Validate returns an error wrapping ErrInvalidEvent if the event is missing
+// a required attribute, has an unsupported spec version, or has an
+// extension with an invalid name.
+func (e Event) Validate() error {
+	switch {
+	case e.ID == "":
+		return fmt.Errorf("%w: missing id", ErrInvalidEvent)
+	case e.Source == "":
+		return fmt.Errorf("%w: missing source", ErrInvalidEvent)
+	case e.SpecVersion != SpecVersion:
+		return fmt.Errorf("%w: unsupported specversion %q", ErrInvalidEvent, e.SpecVersion)
+	case e.Type == "":
+		return fmt.Errorf("%w: missing type", ErrInvalidEvent)
+	}
+	for name := range e.Extensions {
+		if !validName(name) {
+			return fmt.Errorf("%w: invalid extension name %q", ErrInvalidEvent, name)
+		}
+		if _, ok := attributeNames[name]; ok {
+			return fmt.Errorf("%w: extension %q shadows an attribute", ErrInvalidEvent, name)
+		}
+	}
+	return nil
+}
+
+// attributeNames are the names of the context attributes defined by the
+// specification.
+var attributeNames = map[string]struct{}{
+	"id": {}, "source": {}, "specversion": {}, "type": {},
+	"subject": {}, "time": {}, "datacontenttype": {}, "dataschema": {},
+}
+
+// validName reports whether the attribute name is made of lowercase letters
+// and digits, as the specification requires.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// attributes returns the attributes of the event other than datacontenttype,
+// which every binding maps to its own content type header, formatted as
+// strings.
+func (e Event) attributes() map[string]string {
+	attrs := make(map[string]string, len(e.Extensions)+7)
+	for name, value := range e.Extensions {
+		attrs[name] = value
+	}
+	attrs["id"] = e.ID
+	attrs["source"] = e.Source
+	attrs["specversion"] = e.SpecVersion
+	if attrs["specversion"] == "" {
+		attrs["specversion"] = SpecVersion
+	}
+	attrs["type"] = e.Type
+	if e.Subject != "" {
+		attrs["subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		attrs["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.DataSchema != "" {
+		attrs["dataschema"] = e.DataSchema
+	}
+	return attrs
+}
+
+// setAttribute sets the attribute of the event from its string form.
+func (e *Event) setAttribute(name, value string) error {
+	switch name {
+	case "id":
+		e.ID = value
+	case "source":
+		e.Source = value
+	case "specversion":
+		e.SpecVersion = value
+	case "type":
+		e.Type = value
+	case "subject":
+		e.Subject = value
+	case "time":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("%w: invalid time %q", ErrInvalidEvent, value)
+		}
+		e.Time = t
+	case "datacontenttype":
+		e.DataContentType = value
+	case "dataschema":
+		e.DataSchema = value
+	default:
+		if e.Extensions == nil {
+			e.Extensions = map[string]string{}
+		}
+		e.Extensions[name] = value
+	}
+	return nil
+}
+
+// MarshalJSON encodes the event in the JSON format of the specification.
+// Data is written as is when the DataContentType is JSON, and is otherwise
+// base64 encoded in data_base64.
+func (e Event) MarshalJSON() ([]byte, error) {
+	attrs := e.attributes()
+	names := make([]string, 0, len(attrs)+2)
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONField(&buf, name, attrs[name])
+	}
+	if e.DataContentType != "" {
+		buf.WriteByte(',')
+		writeJSONField(&buf, "datacontenttype", e.DataContentType)
+	}
+	if e.Data != nil {
+		buf.WriteByte(',')
+		if isJSON(e.DataContentType) && json.Valid(e.Data) {
+			buf.WriteString(`"data":`)
+			if err := json.Compact(&buf, e.Data); err != nil {
+				return nil, err
+			}
+		} else {
+			writeJSONField(&buf, "data_base64", base64.StdEncoding.EncodeToString(e.Data))
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJSONField(buf *bytes.Buffer, name, value string) {
+	b, _ := json.Marshal(name)
+	buf.Write(b)
+	buf.WriteByte(':')
+	b, _ = json.Marshal(value)
+	buf.Write(b)
+}
+
+// UnmarshalJSON decodes the event from the JSON format of the specification.
+// Extensions whose values aren't JSON strings are kept in their JSON form.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	*e = Event{}
+	var data, dataBase64 json.RawMessage
+	for name, raw := range fields {
+		switch name {
+		case "data":
+			data = raw
+			continue
+		case "data_base64":
+			dataBase64 = raw
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			if _, ok := attributeNames[name]; ok {
+				return fmt.Errorf("%w: %s isn't a string", ErrInvalidEvent, name)
+			}
+			value = string(raw)
+		}
+		if err := e.setAttribute(name, value); err != nil {
+			return err
+		}
+	}
+	switch {
+	case data != nil && dataBase64 != nil:
+		return fmt.Errorf("%w: both data and data_base64 are set", ErrInvalidEvent)
+	case dataBase64 != nil:
+		var s string
+		if err := json.Unmarshal(dataBase64, &s); err != nil {
+			return fmt.Errorf("%w: data_base64 isn't a string", ErrInvalidEvent)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+		}
+		e.Data = decoded
+	case data != nil && !isJSON(e.DataContentType):
+		// Data of other content types is carried as a JSON string, if at
+		// all.
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("%w: data of type %s isn't a string", ErrInvalidEvent, e.DataContentType)
+		}
+		e.Data = []byte(s)
+	case data != nil:
+		e.Data = []byte(data)
+	}
+	return nil
+}
+
+// isJSON reports whether the content type is JSON. Events without a content
+// type carry JSON data.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isStructured reports whether the content type is the one of events in
+// structured mode.
+func isStructured(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == ContentType
+}
+
+// readEvent reads an event from a message. The attributes are read from the
+// headers in binary mode; they're ignored in structured mode.
+func readEvent(contentType string, attrs map[string]string, body []byte) (Event, error) {
+	var e Event
+	if isStructured(contentType) {
+		if err := json.Unmarshal(body, &e); err != nil {
+			return Event{}, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+		}
+	} else {
+		for name, value := range attrs {
+			if err := e.setAttribute(name, value); err != nil {
+				return Event{}, err
+			}
+		}
+		e.DataContentType = contentType
+		if len(body) > 0 {
+			e.Data = body
+		}
+	}
+	if err := e.Validate(); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
+
+// writeEvent returns the content type, the attributes to write to the
+// headers, and the body of a message carrying the event in the mode. The
+// event must be valid.
+func writeEvent(e Event, mode Mode) (contentType string, attrs map[string]string, body []byte, err error) {
+	if e.SpecVersion == "" {
+		e.SpecVersion = SpecVersion
+	}
+	if err := e.Validate(); err != nil {
+		return "", nil, nil, err
+	}
+	if mode == Structured {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return ContentType + "; charset=utf-8", nil, body, nil
+	}
+	return e.DataContentType, e.attributes(), e.Data, nil
+}
+
+// DecodeEventFunc extracts a user-domain request or response object from an
+// event. The context carries the id, source, type and subject of the event.
+type DecodeEventFunc func(context.Context, Event) (interface{}, error)
+
+// EncodeEventFunc encodes the passed request or response object into the
+// event. SpecVersion may be left empty.
+type EncodeEventFunc func(context.Context, *Event, interface{}) error
+
+// encode returns the event encoded by enc from the object.
+func encode(ctx context.Context, enc EncodeEventFunc, v interface{}) (Event, error) {
+	var e Event
+	if err := enc(ctx, &e, v); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
@@ -0,0 +1,100 @@
+package cloudevents_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/cloudevents"
+)
+
+func TestEventJSON(t *testing.T) {
+	for name, testcase := range map[string]struct {
+		event cloudevents.Event
+		field string
+	}{
+		"json data": {
+			event: cloudevents.Event{
+				ID: "1", Source: "/orders", SpecVersion: "1.0", Type: "com.example.order.created",
+				Subject:         "42",
+				Time:            time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				DataContentType: "application/json",
+				Extensions:      map[string]string{"traceparent": "00-abc-def-01"},
+				Data:            []byte(`{"order":42}`),
+			},
+			field: "data",
+		},
+		"binary data": {
+			event: cloudevents.Event{
+				ID: "2", Source: "/images", SpecVersion: "1.0", Type: "com.example.image",
+				DataContentType: "image/png",
+				Data:            []byte{0x89, 'P', 'N', 'G'},
+			},
+			field: "data_base64",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(testcase.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(b, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := fields[testcase.field]; !ok {
+				t.Errorf("want %s in %s", testcase.field, b)
+			}
+
+			var have cloudevents.Event
+			if err := json.Unmarshal(b, &have); err != nil {
+				t.Fatal(err)
+			}
+			want := testcase.event
+			if want.ID != have.ID || want.Source != have.Source || want.Type != have.Type ||
+				want.Subject != have.Subject || !want.Time.Equal(have.Time) ||
+				want.DataContentType != have.DataContentType ||
+				want.Extensions["traceparent"] != have.Extensions["traceparent"] ||
+				!bytes.Equal(want.Data, have.Data) {
+				t.Errorf("want %+v, have %+v", want, have)
+			}
+		})
+	}
+}
+
+func TestEventJSONExtensions(t *testing.T) {
+	var e cloudevents.Event
+	err := json.Unmarshal([]byte(`{"id":"1","source":"/s","specversion":"1.0","type":"t","sequence":7,"datacontenttype":"text/plain","data":"hi"}`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "7", e.Extensions["sequence"]; want != have {
+		t.Errorf("sequence: want %q, have %q", want, have)
+	}
+	if want, have := "hi", string(e.Data); want != have {
+		t.Errorf("data: want %q, have %q", want, have)
+	}
+}
+
+func TestEventValidate(t *testing.T) {
+	valid := cloudevents.Event{ID: "1", Source: "/s", SpecVersion: "1.0", Type: "t"}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, mutate := range map[string]func(*cloudevents.Event){
+		"id":          func(e *cloudevents.Event) { e.ID = "" },
+		"source":      func(e *cloudevents.Event) { e.Source = "" },
+		"specversion": func(e *cloudevents.Event) { e.SpecVersion = "0.3" },
+		"type":        func(e *cloudevents.Event) { e.Type = "" },
+		"extension":   func(e *cloudevents.Event) { e.Extensions = map[string]string{"Bad-Name": "x"} },
+		"shadowing":   func(e *cloudevents.Event) { e.Extensions = map[string]string{"subject": "x"} },
+	} {
+		e := valid
+		mutate(&e)
+		if err := e.Validate(); !errors.Is(err, cloudevents.ErrInvalidEvent) {
+			t.Errorf("%s: want ErrInvalidEvent, have %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// httpPrefix prefixes the attributes of events in HTTP headers.
+const httpPrefix = "Ce-"
+
+// HTTPToContext returns a RequestFunc which puts the id, source, type and
+// subject of the event carried by the request in the context. The request is
+// left as is if it doesn't carry a valid event, so that the decoder can
+// report the error.
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ctx
+		}
+		e, err := readHTTP(r.Header, body)
+		if err != nil {
+			return ctx
+		}
+		return NewContext(ctx, e)
+	}
+}
+
+// DecodeHTTPRequest returns a DecodeRequestFunc which reads the event of the
+// request, in either content mode, and passes it to dec.
+func DecodeHTTPRequest(dec DecodeEventFunc) httptransport.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		e, err := readHTTP(r.Header, body)
+		if err != nil {
+			return nil, err
+		}
+		return dec(NewContext(ctx, e), e)
+	}
+}
+
+// EncodeHTTPRequest returns an EncodeRequestFunc which writes the event
+// encoded by enc to the request, in the mode.
+func EncodeHTTPRequest(enc EncodeEventFunc, mode Mode) httptransport.EncodeRequestFunc {
+	return func(ctx context.Context, r *http.Request, request interface{}) error {
+		e, err := encode(ctx, enc, request)
+		if err != nil {
+			return err
+		}
+		body, err := writeHTTP(r.Header, e, mode)
+		if err != nil {
+			return err
+		}
+		r.ContentLength = int64(len(body))
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		return nil
+	}
+}
+
+// EncodeHTTPResponse returns an EncodeResponseFunc which writes the event
+// encoded by enc to the response, in the mode.
+func EncodeHTTPResponse(enc EncodeEventFunc, mode Mode) httptransport.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		e, err := encode(ctx, enc, response)
+		if err != nil {
+			return err
+		}
+		body, err := writeHTTP(w.Header(), e, mode)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, err = w.Write(body)
+		return err
+	}
+}
+
+// DecodeHTTPResponse returns a DecodeResponseFunc which reads the event of
+// the response, in either content mode, and passes it to dec. Responses with
+// a status other than 2xx are reported as errors.
+func DecodeHTTPResponse(dec DecodeEventFunc) httptransport.DecodeResponseFunc {
+	return func(ctx context.Context, resp *http.Response) (interface{}, error) {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		e, err := readHTTP(resp.Header, body)
+		if err != nil {
+			return nil, err
+		}
+		return dec(NewContext(ctx, e), e)
+	}
+}
+
+func readHTTP(header http.Header, body []byte) (Event, error) {
+	attrs := map[string]string{}
+	for key, values := range header {
+		if len(values) == 0 || !strings.HasPrefix(key, httpPrefix) {
+			continue
+		}
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			return Event{}, fmt.Errorf("%w: header %s: %v", ErrInvalidEvent, key, err)
+		}
+		attrs[strings.ToLower(key[len(httpPrefix):])] = value
+	}
+	return readEvent(header.Get("Content-Type"), attrs, body)
+}
+
+func writeHTTP(header http.Header, e Event, mode Mode) ([]byte, error) {
+	contentType, attrs, body, err := writeEvent(e, mode)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range attrs {
+		header.Set(httpPrefix+name, escapeHeader(value))
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return body, nil
+}
+
+// escapeHeader percent-encodes the characters of the value which the HTTP
+// binding doesn't allow in header values: spaces, double quotes, percent
+// signs, and anything outside of printable ASCII.
+func escapeHeader(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package cloudevents_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/transport/cloudevents"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func encodeGreeting(eventType string) cloudevents.EncodeEventFunc {
+	return func(_ context.Context, e *cloudevents.Event, v interface{}) error {
+		e.ID = "1"
+		e.Source = "/greeter"
+		e.Type = eventType
+		e.Subject = "greeting"
+		e.DataContentType = "text/plain; charset=utf-8"
+		e.Extensions = map[string]string{"comment": `a "quoted" value, 100%`}
+		e.Data = []byte(v.(string))
+		return nil
+	}
+}
+
+func decodeGreeting(_ context.Context, e cloudevents.Event) (interface{}, error) {
+	return string(e.Data) + " (" + e.Extensions["comment"] + ")", nil
+}
+
+func TestHTTP(t *testing.T) {
+	for name, mode := range map[string]cloudevents.Mode{
+		"binary":     cloudevents.Binary,
+		"structured": cloudevents.Structured,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var before, decoded context.Context
+			server := httptransport.NewServer(
+				func(ctx context.Context, request interface{}) (interface{}, error) {
+					decoded = ctx
+					return strings.ToUpper(request.(string)), nil
+				},
+				cloudevents.DecodeHTTPRequest(decodeGreeting),
+				cloudevents.EncodeHTTPResponse(encodeGreeting("com.example.reply"), mode),
+				httptransport.ServerBefore(func(ctx context.Context, r *http.Request) context.Context {
+					before = cloudevents.HTTPToContext()(ctx, r)
+					return before
+				}),
+			)
+			s := httptest.NewServer(server)
+			defer s.Close()
+
+			tgt, _ := url.Parse(s.URL)
+			client := httptransport.NewClient(
+				http.MethodPost, tgt,
+				cloudevents.EncodeHTTPRequest(encodeGreeting("com.example.greeting"), mode),
+				cloudevents.DecodeHTTPResponse(decodeGreeting),
+			)
+			response, err := client.Endpoint()(context.Background(), "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := `HELLO (A "QUOTED" VALUE, 100%) (a "quoted" value, 100%)`, response; want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+			for _, ctx := range []context.Context{before, decoded} {
+				if want, have := "com.example.greeting", ctx.Value(cloudevents.ContextKeyType); want != have {
+					t.Errorf("type: want %q, have %v", want, have)
+				}
+				if want, have := "greeting", ctx.Value(cloudevents.ContextKeySubject); want != have {
+					t.Errorf("subject: want %q, have %v", want, have)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPInvalidEvent(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+	r.Header.Set("Ce-Id", "1")
+	r.Header.Set("Ce-Specversion", "1.0")
+	r.Header.Set("Ce-Type", "com.example.greeting")
+
+	ctx := cloudevents.HTTPToContext()(context.Background(), r)
+	if have := ctx.Value(cloudevents.ContextKeyID); have != nil {
+		t.Errorf("want no id, have %v", have)
+	}
+	_, err := cloudevents.DecodeHTTPRequest(decodeGreeting)(ctx, r)
+	if !errors.Is(err, cloudevents.ErrInvalidEvent) {
+		t.Errorf("want ErrInvalidEvent, have %v", err)
+	}
+}
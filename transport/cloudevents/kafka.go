@@ -0,0 +1,87 @@
+package cloudevents
+
+import (
+	"context"
+	"strings"
+
+	kafkatransport "github.com/go-kit/kit/transport/kafka"
+)
+
+const (
+	// kafkaPrefix prefixes the attributes of events in Kafka headers.
+	kafkaPrefix = "ce_"
+
+	kafkaContentType = "content-type"
+
+	// partitionKey is the attribute of the partitioning extension, which
+	// the Kafka binding maps to the key of records.
+	partitionKey = "partitionkey"
+)
+
+// KafkaToContext returns a RequestFunc which puts the id, source, type and
+// subject of the event carried by the record in the context. The context is
+// left as is if the record doesn't carry a valid event.
+func KafkaToContext() kafkatransport.RequestFunc {
+	return func(ctx context.Context, record *kafkatransport.Record) context.Context {
+		e, err := readKafka(record)
+		if err != nil {
+			return ctx
+		}
+		return NewContext(ctx, e)
+	}
+}
+
+// DecodeKafkaRecord returns a DecodeRequestFunc which reads the event of the
+// record, in either content mode, and passes it to dec.
+func DecodeKafkaRecord(dec DecodeEventFunc) kafkatransport.DecodeRequestFunc {
+	return func(ctx context.Context, record *kafkatransport.Record) (interface{}, error) {
+		e, err := readKafka(record)
+		if err != nil {
+			return nil, err
+		}
+		return dec(NewContext(ctx, e), e)
+	}
+}
+
+// EncodeKafkaRecord returns an EncodeRequestFunc which writes the event
+// encoded by enc to the record, in the mode. The partitionkey extension of
+// the event, if any, is used as the key of records without one.
+func EncodeKafkaRecord(enc EncodeEventFunc, mode Mode) kafkatransport.EncodeRequestFunc {
+	return func(ctx context.Context, record *kafkatransport.Record, request interface{}) error {
+		e, err := encode(ctx, enc, request)
+		if err != nil {
+			return err
+		}
+		contentType, attrs, body, err := writeEvent(e, mode)
+		if err != nil {
+			return err
+		}
+		for name, value := range attrs {
+			record.SetHeader(kafkaPrefix+name, []byte(value))
+		}
+		if contentType != "" {
+			record.SetHeader(kafkaContentType, []byte(contentType))
+		}
+		if key, ok := e.Extensions[partitionKey]; ok && record.Key == nil {
+			record.Key = []byte(key)
+		}
+		record.Value = body
+		return nil
+	}
+}
+
+func readKafka(record *kafkatransport.Record) (Event, error) {
+	var contentType string
+	attrs := map[string]string{}
+	// Later headers replace earlier ones with the same key, as with
+	// Record.Header.
+	for _, h := range record.Headers {
+		switch key := strings.ToLower(h.Key); {
+		case key == kafkaContentType:
+			contentType = string(h.Value)
+		case strings.HasPrefix(key, kafkaPrefix):
+			attrs[key[len(kafkaPrefix):]] = string(h.Value)
+		}
+	}
+	return readEvent(contentType, attrs, record.Value)
+}
@@ -0,0 +1,103 @@
+package cloudevents
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+
+	natstransport "github.com/go-kit/kit/transport/nats"
+)
+
+// natsPrefix prefixes the attributes of events in NATS headers.
+const natsPrefix = "ce-"
+
+// NATSToContext returns a RequestFunc which puts the id, source, type and
+// subject of the event carried by the message in the context. The context
+// is left as is if the message doesn't carry a valid event.
+func NATSToContext() natstransport.RequestFunc {
+	return func(ctx context.Context, msg *nats.Msg) context.Context {
+		e, err := readNATS(msg)
+		if err != nil {
+			return ctx
+		}
+		return NewContext(ctx, e)
+	}
+}
+
+// DecodeNATSMsg returns a DecodeRequestFunc which reads the event of the
+// message, in either content mode, and passes it to dec. Convert it to a
+// nats.DecodeResponseFunc to decode replies.
+func DecodeNATSMsg(dec DecodeEventFunc) natstransport.DecodeRequestFunc {
+	return func(ctx context.Context, msg *nats.Msg) (interface{}, error) {
+		e, err := readNATS(msg)
+		if err != nil {
+			return nil, err
+		}
+		return dec(NewContext(ctx, e), e)
+	}
+}
+
+// EncodeNATSMsg returns an EncodeRequestFunc which writes the event encoded
+// by enc to the message, in the mode.
+func EncodeNATSMsg(enc EncodeEventFunc, mode Mode) natstransport.EncodeRequestFunc {
+	return func(ctx context.Context, msg *nats.Msg, request interface{}) error {
+		e, err := encode(ctx, enc, request)
+		if err != nil {
+			return err
+		}
+		return writeNATS(msg, e, mode)
+	}
+}
+
+// EncodeNATSResponse returns an EncodeResponseFunc which publishes the event
+// encoded by enc to the reply subject, in the mode, along with the headers
+// set by nats.SetReplyHeader.
+func EncodeNATSResponse(enc EncodeEventFunc, mode Mode) natstransport.EncodeResponseFunc {
+	return func(ctx context.Context, reply string, nc *nats.Conn, response interface{}) error {
+		e, err := encode(ctx, enc, response)
+		if err != nil {
+			return err
+		}
+		msg := natstransport.NewReplyMsg(ctx, reply)
+		if err := writeNATS(msg, e, mode); err != nil {
+			return err
+		}
+		return nc.PublishMsg(msg)
+	}
+}
+
+func readNATS(msg *nats.Msg) (Event, error) {
+	var contentType string
+	attrs := map[string]string{}
+	for key, values := range msg.Header {
+		if len(values) == 0 {
+			continue
+		}
+		switch lower := strings.ToLower(key); {
+		case lower == "content-type":
+			contentType = values[0]
+		case strings.HasPrefix(lower, natsPrefix):
+			attrs[lower[len(natsPrefix):]] = values[0]
+		}
+	}
+	return readEvent(contentType, attrs, msg.Data)
+}
+
+func writeNATS(msg *nats.Msg, e Event, mode Mode) error {
+	contentType, attrs, body, err := writeEvent(e, mode)
+	if err != nil {
+		return err
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	for name, value := range attrs {
+		msg.Header.Set(natsPrefix+name, value)
+	}
+	if contentType != "" {
+		msg.Header.Set("Content-Type", contentType)
+	}
+	msg.Data = body
+	return nil
+}
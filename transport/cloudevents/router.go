@@ -0,0 +1,89 @@
+package cloudevents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ErrNoRoute is wrapped by the errors returned by Router for events of a type
+// without a route.
+var ErrNoRoute = errors.New("no route for CloudEvent type")
+
+// Router dispatches events to endpoints by type, behind a single subscriber.
+// Use its Decode method as the DecodeEventFunc of the subscriber, and its
+// Endpoint as the endpoint:
+//
+//	router := cloudevents.NewRouter()
+//	router.Handle("com.example.order.created", decodeOrderCreated, orderCreated)
+//	router.Handle("com.example.order.canceled", decodeOrderCanceled, orderCanceled)
+//	sub := natstransport.NewSubscriber(
+//	    router.Endpoint(),
+//	    cloudevents.DecodeNATSMsg(router.Decode),
+//	    natstransport.EncodeJSONResponse,
+//	)
+type Router struct {
+	routes   map[string]route
+	fallback *route
+}
+
+type route struct {
+	dec DecodeEventFunc
+	e   endpoint.Endpoint
+}
+
+// routedRequest is the request decoded by Router.Decode, which carries the
+// endpoint of the route.
+type routedRequest struct {
+	e       endpoint.Endpoint
+	request interface{}
+}
+
+// NewRouter returns a Router without routes.
+func NewRouter() *Router {
+	return &Router{routes: map[string]route{}}
+}
+
+// Handle routes the events of the type to the endpoint, after decoding them
+// with dec. It replaces any previous route for the type.
+func (r *Router) Handle(eventType string, dec DecodeEventFunc, e endpoint.Endpoint) {
+	r.routes[eventType] = route{dec: dec, e: e}
+}
+
+// HandleDefault routes the events of types without a route to the endpoint,
+// after decoding them with dec. By default, they're rejected with an error
+// wrapping ErrNoRoute.
+func (r *Router) HandleDefault(dec DecodeEventFunc, e endpoint.Endpoint) {
+	r.fallback = &route{dec: dec, e: e}
+}
+
+// Decode implements DecodeEventFunc. It decodes the event with the decoder of
+// its route.
+func (r *Router) Decode(ctx context.Context, e Event) (interface{}, error) {
+	rt, ok := r.routes[e.Type]
+	if !ok {
+		if r.fallback == nil {
+			return nil, fmt.Errorf("%w %q", ErrNoRoute, e.Type)
+		}
+		rt = *r.fallback
+	}
+	request, err := rt.dec(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return routedRequest{e: rt.e, request: request}, nil
+}
+
+// Endpoint returns an endpoint which calls the endpoint of the route of
+// requests decoded by Decode.
+func (r *Router) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		routed, ok := request.(routedRequest)
+		if !ok {
+			return nil, errors.New("cloudevents: request wasn't decoded by Router.Decode")
+		}
+		return routed.e(ctx, routed.request)
+	}
+}
@@ -0,0 +1,59 @@
+package cloudevents_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/transport/cloudevents"
+)
+
+func TestRouter(t *testing.T) {
+	router := cloudevents.NewRouter()
+	for _, eventType := range []string{"com.example.created", "com.example.deleted"} {
+		eventType := eventType
+		router.Handle(
+			eventType,
+			func(_ context.Context, e cloudevents.Event) (interface{}, error) { return string(e.Data), nil },
+			func(_ context.Context, request interface{}) (interface{}, error) {
+				return eventType + ": " + request.(string), nil
+			},
+		)
+	}
+	serve := func(eventType string) (interface{}, error) {
+		e := cloudevents.Event{ID: "1", Source: "/s", SpecVersion: "1.0", Type: eventType, Data: []byte("42")}
+		request, err := router.Decode(context.Background(), e)
+		if err != nil {
+			return nil, err
+		}
+		return router.Endpoint()(context.Background(), request)
+	}
+
+	for _, eventType := range []string{"com.example.created", "com.example.deleted"} {
+		response, err := serve(eventType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := eventType+": 42", response; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+
+	if _, err := serve("com.example.updated"); !errors.Is(err, cloudevents.ErrNoRoute) {
+		t.Errorf("want ErrNoRoute, have %v", err)
+	}
+
+	router.HandleDefault(
+		func(_ context.Context, e cloudevents.Event) (interface{}, error) { return e.Type, nil },
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			return "default: " + request.(string), nil
+		},
+	)
+	response, err := serve("com.example.updated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "default: com.example.updated", response; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
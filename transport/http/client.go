@@ -27,6 +27,8 @@ type Client struct {
 	after          []ClientResponseFunc
 	finalizer      []ClientFinalizerFunc
 	bufferedStream bool
+	acceptEncoding string
+	cacheEntries   int
 }
 
 // NewClient constructs a usable Client for a single remote method.
@@ -46,6 +48,9 @@ func NewExplicitClient(req CreateRequestFunc, dec DecodeResponseFunc, options ..
 	for _, option := range options {
 		option(c)
 	}
+	if c.cacheEntries > 0 {
+		c.client = newConditionalCache(c.client, c.cacheEntries)
+	}
 	return c
 }
 
@@ -117,12 +122,24 @@ func (c Client) Endpoint() endpoint.Endpoint {
 			ctx = f(ctx, req)
 		}
 
+		if c.acceptEncoding != "" && req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		}
+
 		resp, err = c.client.Do(req.WithContext(ctx))
 		if err != nil {
 			cancel()
 			return nil, err
 		}
 
+		if c.acceptEncoding != "" {
+			if err = decompressResponse(resp); err != nil {
+				resp.Body.Close()
+				cancel()
+				return nil, err
+			}
+		}
+
 		// If the caller asked for a buffered stream, we don't cancel the
 		// context when the endpoint returns. Instead, we should call the
 		// cancel func when closing the response body.
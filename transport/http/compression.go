@@ -0,0 +1,575 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings supported by the compression options in this package.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+	EncodingZstd    = "zstd"
+)
+
+// DefaultCompressionEncodings is the order of preference in which content
+// codings are chosen when the client accepts several of them equally.
+var DefaultCompressionEncodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip, EncodingDeflate}
+
+// DefaultCompressibleContentTypes are the media types compressed by
+// ServerCompression when ResponseCompression.ContentTypes is empty. A trailing
+// "/*" matches every subtype.
+var DefaultCompressibleContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/x-protobuf",
+	"image/svg+xml",
+}
+
+// DefaultCompressionMinSize is the minimum response size, in bytes, that's
+// compressed when ResponseCompression.MinSize is zero. Smaller responses tend
+// to grow when compressed.
+const DefaultCompressionMinSize = 1024
+
+// ResponseCompression configures ServerCompression.
+type ResponseCompression struct {
+	// Encodings lists the content codings the server may use, in order of
+	// preference. By default, DefaultCompressionEncodings is used.
+	Encodings []string
+
+	// MinSize is the minimum size of a response body, in bytes, for it to be
+	// compressed. By default, DefaultCompressionMinSize is used. A negative
+	// value compresses every response.
+	MinSize int
+
+	// ContentTypes is the allowlist of media types that may be compressed. By
+	// default, DefaultCompressibleContentTypes is used.
+	ContentTypes []string
+}
+
+// ServerCompression compresses response bodies with the content coding the
+// client prefers, according to its Accept-Encoding header. Responses that are
+// smaller than the minimum size, that have a media type outside of the
+// allowlist, or that already set a Content-Encoding are written unchanged.
+//
+// Compression happens closest to the client, so a ServerFinalizerFunc sees the
+// Content-Encoding header and the compressed size of the response.
+func ServerCompression(c ResponseCompression) ServerOption {
+	cfg := &compression{
+		encodings:    c.Encodings,
+		minSize:      c.MinSize,
+		contentTypes: c.ContentTypes,
+	}
+	if len(cfg.encodings) == 0 {
+		cfg.encodings = DefaultCompressionEncodings
+	}
+	if cfg.minSize == 0 {
+		cfg.minSize = DefaultCompressionMinSize
+	}
+	if len(cfg.contentTypes) == 0 {
+		cfg.contentTypes = DefaultCompressibleContentTypes
+	}
+	return func(s *Server) { s.compression = cfg }
+}
+
+// ServerDecompression decodes request bodies sent with a Content-Encoding of
+// gzip, deflate, br or zstd before the request is passed to the ServerBefore
+// functions and the DecodeRequestFunc. Requests with any other content coding
+// are rejected with StatusUnsupportedMediaType (415).
+//
+// If maxSize is positive, reading more than maxSize decompressed bytes fails
+// with an error that reports StatusRequestEntityTooLarge (413), which guards
+// against decompression bombs.
+func ServerDecompression(maxSize int64) ServerOption {
+	return func(s *Server) {
+		s.decompression = true
+		s.decompressionMaxSize = maxSize
+	}
+}
+
+// ClientAcceptEncoding sets the Accept-Encoding header on outgoing requests to
+// the given content codings, in order of preference, and transparently
+// decompresses response bodies that use one of them. By default, all of
+// gzip, deflate, br and zstd are accepted.
+//
+// The response's Content-Encoding and Content-Length headers are removed once
+// the body is wrapped, so DecodeResponseFuncs see the decoded body.
+func ClientAcceptEncoding(encodings ...string) ClientOption {
+	if len(encodings) == 0 {
+		encodings = DefaultCompressionEncodings
+	}
+	header := strings.Join(encodings, ", ")
+	return func(c *Client) { c.acceptEncoding = header }
+}
+
+// errUnsupportedEncoding is returned when a request or response body uses a
+// content coding that can't be decoded.
+type errUnsupportedEncoding string
+
+func (e errUnsupportedEncoding) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q", string(e))
+}
+
+func (e errUnsupportedEncoding) StatusCode() int { return http.StatusUnsupportedMediaType }
+
+// ErrDecompressedBodyTooLarge is returned when reading a request body that
+// expands beyond the size given to ServerDecompression. It implements
+// StatusCoder.
+var ErrDecompressedBodyTooLarge error = errBodyTooLarge{}
+
+type errBodyTooLarge struct{}
+
+func (errBodyTooLarge) Error() string   { return "decompressed request body too large" }
+func (errBodyTooLarge) StatusCode() int { return http.StatusRequestEntityTooLarge }
+
+// errMalformedBody is returned when a compressed body can't be decoded, as
+// opposed to read. It implements StatusCoder.
+type errMalformedBody struct{ err error }
+
+func (e errMalformedBody) Error() string   { return "malformed compressed body: " + e.err.Error() }
+func (e errMalformedBody) Unwrap() error   { return e.err }
+func (e errMalformedBody) StatusCode() int { return http.StatusBadRequest }
+
+// compression holds the configuration applied by ServerCompression.
+type compression struct {
+	encodings    []string
+	minSize      int
+	contentTypes []string
+}
+
+// wrap returns a compressWriter if the response to r may be compressed.
+func (c *compression) wrap(w http.ResponseWriter, r *http.Request) (*compressWriter, bool) {
+	if r.Method == http.MethodHead {
+		return nil, false
+	}
+	return &compressWriter{
+		ResponseWriter: w,
+		config:         c,
+		encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), c.encodings),
+		code:           http.StatusOK,
+	}, true
+}
+
+func (c *compression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.contentTypes {
+		if allowed == mediaType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, allowed[:len(allowed)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// response should be compressed, and then either writes it through an
+// encoder or passes it to the wrapped ResponseWriter unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	config      *compression
+	encoding    string
+	code        int
+	wroteHeader bool
+	decided     bool
+	buf         bytes.Buffer
+	enc         encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	w.code = code
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	n, _ := w.buf.Write(p)
+	if w.buf.Len() >= w.config.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// reimplementInterfaces returns the writer, implementing the same
+// combination of http.Hijacker, http.CloseNotifier, http.Pusher, http.Flusher
+// and io.ReaderFrom as the wrapped ResponseWriter, like
+// interceptingWriter.reimplementInterfaces. Flushes and ReadFrom go through
+// the compressWriter; the other interfaces are those of the wrapped writer.
+func (w *compressWriter) reimplementInterfaces() http.ResponseWriter {
+	hj, _ := w.ResponseWriter.(http.Hijacker)
+	cn, _ := w.ResponseWriter.(http.CloseNotifier)
+	pu, _ := w.ResponseWriter.(http.Pusher)
+	var (
+		fl http.Flusher
+		rf io.ReaderFrom
+	)
+	if _, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl = compressFlusher{w}
+	}
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		rf = compressReaderFrom{w}
+	}
+	return withInterfaces(w, hj, cn, pu, fl, rf)
+}
+
+// compressFlusher implements http.Flusher for a compressWriter. Flushing
+// before the minimum size has been reached commits to compressing the
+// response, as long as its media type allows it.
+type compressFlusher struct{ w *compressWriter }
+
+func (f compressFlusher) Flush() {
+	w := f.w
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// compressReaderFrom implements io.ReaderFrom for a compressWriter, by
+// writing what it reads through the compressWriter.
+type compressReaderFrom struct{ w *compressWriter }
+
+func (rf compressReaderFrom) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{rf.w}, r)
+}
+
+// Unwrap returns the wrapped ResponseWriter.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close writes any buffered data and terminates the compressed stream. It
+// must be called once the handler is done with the response.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	if w.enc == nil {
+		return nil
+	}
+	err := w.enc.Close()
+	releaseEncoder(w.encoding, w.enc)
+	w.enc = nil
+	return err
+}
+
+// decide writes the response header, choosing whether to compress the body,
+// and then writes anything that was buffered so far. If the minimum size has
+// not been reached, the response is written unchanged.
+func (w *compressWriter) decide(sizeReached bool) error {
+	w.decided = true
+	h := w.Header()
+	if w.bodyAllowed() && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" {
+		if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+			h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+		}
+		if w.config.compressible(h.Get("Content-Type")) {
+			h.Add("Vary", "Accept-Encoding")
+			if w.encoding != "" && (sizeReached || w.buf.Len() > 0 && w.buf.Len() >= w.config.minSize) {
+				h.Set("Content-Encoding", w.encoding)
+				h.Del("Content-Length")
+				w.enc = acquireEncoder(w.encoding, w.ResponseWriter)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) bodyAllowed() bool {
+	return w.code != http.StatusNoContent && w.code != http.StatusNotModified && w.code != http.StatusPartialContent
+}
+
+// encoder is implemented by the writers of every supported content coding.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	EncodingDeflate: {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+	EncodingBrotli: {New: func() interface{} {
+		return brotli.NewWriter(nil)
+	}},
+	EncodingZstd: {New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+}
+
+func acquireEncoder(encoding string, w io.Writer) encoder {
+	enc := encoderPools[encoding].Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+func releaseEncoder(encoding string, enc encoder) {
+	enc.Reset(nil)
+	encoderPools[encoding].Put(enc)
+}
+
+// negotiateEncoding picks the content coding to use for a request with the
+// given Accept-Encoding header. Among the supported codings with the highest
+// q-value, the one that comes first in supported wins. It returns the empty
+// string if the response shouldn't be compressed.
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qvalues := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseQValue(part)
+		if coding != "" {
+			qvalues[coding] = q
+		}
+	}
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, coding := range supported {
+		if _, ok := encoderPools[coding]; !ok {
+			continue
+		}
+		q, ok := qvalues[coding]
+		if !ok {
+			q, ok = qvalues["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+func parseQValue(s string) (string, float64) {
+	params := strings.Split(s, ";")
+	coding := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(param[2:]), 64)
+		if err != nil {
+			return "", 0
+		}
+		q = v
+	}
+	return coding, q
+}
+
+// decompressBody replaces the body of r with one that decodes its content
+// codings, and removes the Content-Encoding header.
+func decompressBody(r *http.Request, maxSize int64) error {
+	codings := contentCodings(r.Header.Get("Content-Encoding"))
+	if len(codings) == 0 || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body, err := newDecoder(r.Body, codings)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 {
+		body = &limitedBody{ReadCloser: body, remaining: maxSize}
+	}
+	r.Body = body
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+// decompressResponse replaces the body of resp with one that decodes its
+// content codings, and removes the Content-Encoding header.
+func decompressResponse(resp *http.Response) error {
+	codings := contentCodings(resp.Header.Get("Content-Encoding"))
+	if len(codings) == 0 {
+		return nil
+	}
+	body, err := newDecoder(resp.Body, codings)
+	if err != nil {
+		return err
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// contentCodings parses a Content-Encoding header, ignoring identity.
+func contentCodings(header string) []string {
+	var codings []string
+	for _, coding := range strings.Split(header, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// newDecoder wraps body so that it decodes the given content codings, which
+// are listed in the order in which they were applied.
+func newDecoder(body io.ReadCloser, codings []string) (io.ReadCloser, error) {
+	for _, coding := range codings {
+		if _, ok := encoderPools[coding]; !ok {
+			return nil, errUnsupportedEncoding(coding)
+		}
+	}
+	d := &decodingBody{ReadCloser: body, src: &sourceReader{r: body}}
+	var r io.Reader = d.src
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		switch codings[i] {
+		case EncodingGzip:
+			r, err = gzip.NewReader(r)
+		case EncodingDeflate:
+			r, err = zlib.NewReader(r)
+		case EncodingBrotli:
+			r = brotli.NewReader(r)
+		case EncodingZstd:
+			var dec *zstd.Decoder
+			if dec, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1)); err == nil {
+				d.closers = append(d.closers, dec.Close)
+				r = dec
+			}
+		}
+		if err != nil {
+			d.Close()
+			return nil, d.malformed(err)
+		}
+	}
+	d.r = r
+	return d, nil
+}
+
+// sourceReader remembers the last error of the reader it wraps, so that the
+// errors of decoders can be told apart from those of the body they decode.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// decodingBody reads from a chain of decoders and closes both the decoders
+// and the original body. Errors of the decoders are wrapped in
+// errMalformedBody.
+type decodingBody struct {
+	io.ReadCloser
+	src     *sourceReader
+	r       io.Reader
+	closers []func()
+}
+
+func (d *decodingBody) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	return n, d.malformed(err)
+}
+
+// malformed wraps err in errMalformedBody, unless it's io.EOF or an error of
+// the original body.
+func (d *decodingBody) malformed(err error) error {
+	if err == nil || err == io.EOF || d.src.err != nil && errors.Is(err, d.src.err) {
+		return err
+	}
+	return errMalformedBody{err}
+}
+
+func (d *decodingBody) Close() error {
+	for _, fn := range d.closers {
+		fn()
+	}
+	d.closers = nil
+	return d.ReadCloser.Close()
+}
+
+// limitedBody fails with ErrDecompressedBodyTooLarge once more than remaining
+// bytes have been read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrDecompressedBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrDecompressedBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,293 @@
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var compressibleBody = strings.Repeat("go eat a fly ugly ", 200)
+
+func compressionServer(t *testing.T, contentType, body string, options ...httptransport.ServerOption) *httptransport.Server {
+	t.Helper()
+	return httptransport.NewServer(
+		endpoint.Nop,
+		func(context.Context, *http.Request) (interface{}, error) { return struct{}{}, nil },
+		func(_ context.Context, w http.ResponseWriter, _ interface{}) error {
+			w.Header().Set("Content-Type", contentType)
+			_, err := w.Write([]byte(body))
+			return err
+		},
+		options...,
+	)
+}
+
+func TestServerCompressionRoundTrip(t *testing.T) {
+	server := httptest.NewServer(compressionServer(t, "text/plain", compressibleBody,
+		httptransport.ServerCompression(httptransport.ResponseCompression{}),
+	))
+	defer server.Close()
+
+	for _, encoding := range []string{
+		httptransport.EncodingGzip,
+		httptransport.EncodingDeflate,
+		httptransport.EncodingBrotli,
+		httptransport.EncodingZstd,
+	} {
+		t.Run(encoding, func(t *testing.T) {
+			var contentEncoding string
+			client := httptransport.NewClient(
+				"GET",
+				mustParse(server.URL),
+				func(context.Context, *http.Request, interface{}) error { return nil },
+				func(_ context.Context, r *http.Response) (interface{}, error) {
+					buf, err := ioutil.ReadAll(r.Body)
+					return string(buf), err
+				},
+				httptransport.ClientAcceptEncoding(encoding),
+				httptransport.ClientAfter(func(ctx context.Context, r *http.Response) context.Context {
+					contentEncoding = r.Header.Get("Content-Encoding")
+					return ctx
+				}),
+			)
+			response, err := client.Endpoint()(context.Background(), struct{}{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := compressibleBody, response.(string); want != have {
+				t.Errorf("Body: want %d bytes, have %d bytes", len(want), len(have))
+			}
+			if want, have := "", contentEncoding; want != have {
+				t.Errorf("Content-Encoding after decompression: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestServerCompressionFinalizer(t *testing.T) {
+	var (
+		size     int64
+		encoding string
+	)
+	handler := compressionServer(t, "application/json", compressibleBody,
+		httptransport.ServerCompression(httptransport.ResponseCompression{}),
+		httptransport.ServerFinalizer(func(ctx context.Context, code int, _ *http.Request) {
+			size = ctx.Value(httptransport.ContextKeyResponseSize).(int64)
+			encoding = ctx.Value(httptransport.ContextKeyResponseHeaders).(http.Header).Get("Content-Encoding")
+		}),
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if want, have := "gzip", rec.Header().Get("Content-Encoding"); want != have {
+		t.Fatalf("Content-Encoding: want %q, have %q", want, have)
+	}
+	if want, have := "gzip", encoding; want != have {
+		t.Errorf("finalizer Content-Encoding: want %q, have %q", want, have)
+	}
+	if want, have := int64(rec.Body.Len()), size; want != have {
+		t.Errorf("finalizer size: want %d, have %d", want, have)
+	}
+	if size >= int64(len(compressibleBody)) {
+		t.Errorf("compressed size %d not smaller than %d", size, len(compressibleBody))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadAll(zr)
+	if want, have := compressibleBody, string(buf); want != have {
+		t.Errorf("Body: want %d bytes, have %d bytes", len(want), len(have))
+	}
+}
+
+func TestServerCompressionSkipped(t *testing.T) {
+	for _, testcase := range []struct {
+		name           string
+		contentType    string
+		body           string
+		acceptEncoding string
+		wantVary       bool
+	}{
+		{"no Accept-Encoding", "text/plain", compressibleBody, "", true},
+		{"identity only", "text/plain", compressibleBody, "gzip;q=0, identity", true},
+		{"unsupported coding", "text/plain", compressibleBody, "compress", true},
+		{"below minimum size", "text/plain", "small", "gzip", true},
+		{"content type not allowed", "image/png", compressibleBody, "gzip", false},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			handler := compressionServer(t, testcase.contentType, testcase.body,
+				httptransport.ServerCompression(httptransport.ResponseCompression{}),
+			)
+			req := httptest.NewRequest("GET", "/", nil)
+			if testcase.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", testcase.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := "", rec.Header().Get("Content-Encoding"); want != have {
+				t.Errorf("Content-Encoding: want %q, have %q", want, have)
+			}
+			if want, have := testcase.body, rec.Body.String(); want != have {
+				t.Errorf("Body: want %d bytes, have %d bytes", len(want), len(have))
+			}
+			if want, have := testcase.wantVary, rec.Header().Get("Vary") == "Accept-Encoding"; want != have {
+				t.Errorf("Vary: want %v, have %q", want, rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestServerCompressionNegotiation(t *testing.T) {
+	for _, testcase := range []struct {
+		acceptEncoding string
+		encodings      []string
+		want           string
+	}{
+		{"gzip, br", nil, "br"},
+		{"gzip, br;q=0.5", nil, "gzip"},
+		{"*", nil, "zstd"},
+		{"*;q=0.1, deflate", nil, "deflate"},
+		{"gzip, br, zstd", []string{"gzip", "br"}, "gzip"},
+		{"GZIP", nil, "gzip"},
+	} {
+		t.Run(testcase.acceptEncoding, func(t *testing.T) {
+			handler := compressionServer(t, "text/plain", compressibleBody,
+				httptransport.ServerCompression(httptransport.ResponseCompression{Encodings: testcase.encodings}),
+			)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", testcase.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := testcase.want, rec.Header().Get("Content-Encoding"); want != have {
+				t.Errorf("Content-Encoding: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestServerCompressionCustomConfig(t *testing.T) {
+	handler := compressionServer(t, "application/vnd.custom", "tiny",
+		httptransport.ServerCompression(httptransport.ResponseCompression{
+			MinSize:      -1,
+			ContentTypes: []string{"application/vnd.custom"},
+		}),
+	)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if want, have := "gzip", rec.Header().Get("Content-Encoding"); want != have {
+		t.Errorf("Content-Encoding: want %q, have %q", want, have)
+	}
+}
+
+func TestServerDecompression(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(compressibleBody))
+	zw.Close()
+	corrupt := append([]byte(nil), compressed.Bytes()...)
+	for i := len(corrupt) / 2; i < len(corrupt)/2+8; i++ {
+		corrupt[i] ^= 0xff
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		encoding string
+		payload  []byte
+		maxSize  int64
+		wantCode int
+		wantBody string
+	}{
+		{"gzip", "gzip", compressed.Bytes(), 0, http.StatusOK, compressibleBody},
+		{"unsupported", "compress", compressed.Bytes(), 0, http.StatusUnsupportedMediaType, ""},
+		{"too large", "gzip", compressed.Bytes(), 100, http.StatusRequestEntityTooLarge, ""},
+		{"corrupt header", "deflate", compressed.Bytes(), 0, http.StatusBadRequest, ""},
+		{"corrupt data", "gzip", corrupt, 0, http.StatusBadRequest, ""},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var body string
+			handler := httptransport.NewServer(
+				endpoint.Nop,
+				func(_ context.Context, r *http.Request) (interface{}, error) {
+					buf, err := ioutil.ReadAll(r.Body)
+					if err != nil {
+						return nil, err
+					}
+					if r.Header.Get("Content-Encoding") != "" {
+						return nil, errors.New("Content-Encoding not removed")
+					}
+					body = string(buf)
+					return struct{}{}, nil
+				},
+				func(context.Context, http.ResponseWriter, interface{}) error { return nil },
+				httptransport.ServerDecompression(testcase.maxSize),
+			)
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(testcase.payload))
+			req.Header.Set("Content-Encoding", testcase.encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := testcase.wantCode, rec.Code; want != have {
+				t.Errorf("StatusCode: want %d, have %d (%s)", want, have, rec.Body.String())
+			}
+			if want, have := testcase.wantBody, body; want != have {
+				t.Errorf("Body: want %d bytes, have %d bytes", len(want), len(have))
+			}
+		})
+	}
+}
+
+func TestServerCompressionInterfaces(t *testing.T) {
+	for _, testcase := range []struct {
+		name    string
+		w       http.ResponseWriter
+		flusher bool
+	}{
+		{"plain", struct{ http.ResponseWriter }{httptest.NewRecorder()}, false},
+		{"flusher", httptest.NewRecorder(), true},
+	} {
+		var flusher, hijacker bool
+		handler := httptransport.NewServer(
+			endpoint.Nop,
+			func(context.Context, *http.Request) (interface{}, error) { return struct{}{}, nil },
+			func(_ context.Context, w http.ResponseWriter, _ interface{}) error {
+				_, flusher = w.(http.Flusher)
+				_, hijacker = w.(http.Hijacker)
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(compressibleBody))
+				if flusher {
+					w.(http.Flusher).Flush()
+				}
+				return nil
+			},
+			httptransport.ServerCompression(httptransport.ResponseCompression{}),
+		)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(testcase.w, req)
+
+		if want, have := testcase.flusher, flusher; want != have {
+			t.Errorf("%s: http.Flusher: want %v, have %v", testcase.name, want, have)
+		}
+		if hijacker {
+			t.Errorf("%s: http.Hijacker: want false, have true", testcase.name)
+		}
+	}
+}
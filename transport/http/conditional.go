@@ -0,0 +1,482 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ETagger may be implemented by response types. If a response implements
+// ETagger, EncodeConditionalResponse sets the ETag header to the returned
+// entity tag and uses it to evaluate If-None-Match and If-Match. The tag may
+// be given with or without surrounding quotes, and is treated as weak if it
+// has a W/ prefix. An empty tag is ignored.
+type ETagger interface {
+	ETag() string
+}
+
+// LastModifier may be implemented by response types. If a response implements
+// LastModifier, EncodeConditionalResponse sets the Last-Modified header to the
+// returned time and uses it to evaluate If-Modified-Since and
+// If-Unmodified-Since. A zero time is ignored.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// ErrPreconditionFailed is returned by the Preconditions middleware when the
+// conditional headers of a request don't match the current state of the
+// resource. It implements StatusCoder, reporting StatusPreconditionFailed
+// (412).
+var ErrPreconditionFailed error = errPreconditionFailed{}
+
+type errPreconditionFailed struct{}
+
+func (errPreconditionFailed) Error() string   { return "precondition failed" }
+func (errPreconditionFailed) StatusCode() int { return http.StatusPreconditionFailed }
+
+// ServerConditionalRequests adds support for conditional requests to the
+// server. It registers PopulateConditionalRequest as a ServerBefore function
+// and wraps the server's EncodeResponseFunc with EncodeConditionalResponse,
+// so it must be passed to NewServer after any option that replaces the
+// encoder.
+func ServerConditionalRequests() ServerOption {
+	return func(s *Server) {
+		s.before = append(s.before, PopulateConditionalRequest)
+		s.enc = EncodeConditionalResponse(s.enc)
+	}
+}
+
+// PopulateConditionalRequest is a RequestFunc that captures the method and the
+// conditional headers of the request in the context, where they're consulted by
+// EncodeConditionalResponse and the Preconditions middleware.
+func PopulateConditionalRequest(ctx context.Context, r *http.Request) context.Context {
+	c := conditions{
+		method:      r.Method,
+		ifMatch:     r.Header.Get("If-Match"),
+		ifNoneMatch: r.Header.Get("If-None-Match"),
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		c.ifModifiedSince = t
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil {
+		c.ifUnmodifiedSince = t
+	}
+	return context.WithValue(ctx, conditionsKey{}, c)
+}
+
+// EncodeConditionalResponse returns an EncodeResponseFunc that sets the ETag
+// and Last-Modified headers of responses implementing ETagger or LastModifier.
+// For GET and HEAD requests, it then evaluates the conditional headers
+// captured by PopulateConditionalRequest against those validators, as
+// specified in RFC 9110, section 13.2.2. If the client's representation is
+// still current, it writes StatusNotModified (304) without calling next; if
+// an If-Match or If-Unmodified-Since precondition fails, it writes
+// StatusPreconditionFailed (412). Otherwise the response is passed to next.
+//
+// Requests with other methods are always passed to next, since the response
+// reflects the state after the change. Use the Preconditions middleware to
+// guard those.
+func EncodeConditionalResponse(next EncodeResponseFunc) EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		v := responseValidators(response)
+		if v.etag != "" {
+			w.Header().Set("ETag", v.etag)
+		}
+		if !v.lastModified.IsZero() {
+			w.Header().Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+		}
+
+		c, ok := ctx.Value(conditionsKey{}).(conditions)
+		if !ok || !c.safe() {
+			return next(ctx, w, response)
+		}
+		switch c.evaluate(v) {
+		case http.StatusNotModified:
+			if headerer, ok := response.(Headerer); ok {
+				for k, values := range headerer.Headers() {
+					for _, v := range values {
+						w.Header().Add(k, v)
+					}
+				}
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		case http.StatusPreconditionFailed:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return nil
+		}
+		return next(ctx, w, response)
+	}
+}
+
+// Preconditions returns an endpoint middleware that guards state-changing
+// requests with the conditional headers captured by PopulateConditionalRequest.
+// Before the wrapped endpoint is invoked, current is called to fetch the
+// validators of the resource the request targets; it may return an empty ETag
+// or a zero time if the resource doesn't have one, and should return an empty
+// ETag and zero time if the resource doesn't exist. If the request's If-Match,
+// If-Unmodified-Since or If-None-Match headers don't hold, ErrPreconditionFailed
+// is returned and the wrapped endpoint isn't invoked.
+//
+// GET and HEAD requests, requests without conditional headers, and contexts
+// that were never populated pass through without calling current.
+func Preconditions(current func(ctx context.Context, request interface{}) (etag string, lastModified time.Time, err error)) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			c, ok := ctx.Value(conditionsKey{}).(conditions)
+			if !ok || c.safe() || !c.guarded() {
+				return next(ctx, request)
+			}
+			etag, lastModified, err := current(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			v := validators{etag: quoteETag(etag), lastModified: lastModified}
+			if c.evaluate(v) != http.StatusOK {
+				return nil, ErrPreconditionFailed
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+type conditionsKey struct{}
+
+// conditions holds the conditional headers of a request.
+type conditions struct {
+	method            string
+	ifMatch           string
+	ifNoneMatch       string
+	ifModifiedSince   time.Time
+	ifUnmodifiedSince time.Time
+}
+
+func (c conditions) safe() bool {
+	return c.method == http.MethodGet || c.method == http.MethodHead
+}
+
+func (c conditions) guarded() bool {
+	return c.ifMatch != "" || c.ifNoneMatch != "" || !c.ifModifiedSince.IsZero() || !c.ifUnmodifiedSince.IsZero()
+}
+
+// evaluate returns the status code the request should be answered with given
+// the current validators of the resource: StatusOK if the request should be
+// processed normally, StatusNotModified or StatusPreconditionFailed.
+func (c conditions) evaluate(v validators) int {
+	safe := c.safe()
+	exists := v.etag != "" || !v.lastModified.IsZero()
+
+	switch {
+	case c.ifMatch != "":
+		if !matchETag(c.ifMatch, v.etag, exists, true) {
+			return http.StatusPreconditionFailed
+		}
+	case !c.ifUnmodifiedSince.IsZero() && !v.lastModified.IsZero():
+		if v.lastModified.Truncate(time.Second).After(c.ifUnmodifiedSince) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	switch {
+	case c.ifNoneMatch != "":
+		if matchETag(c.ifNoneMatch, v.etag, exists, false) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	case safe && !c.ifModifiedSince.IsZero() && !v.lastModified.IsZero():
+		if !v.lastModified.Truncate(time.Second).After(c.ifModifiedSince) {
+			return http.StatusNotModified
+		}
+	}
+	return http.StatusOK
+}
+
+// validators are the ETag and Last-Modified time of a representation.
+type validators struct {
+	etag         string
+	lastModified time.Time
+}
+
+func responseValidators(response interface{}) validators {
+	var v validators
+	if e, ok := response.(ETagger); ok {
+		v.etag = quoteETag(e.ETag())
+	}
+	if lm, ok := response.(LastModifier); ok {
+		v.lastModified = lm.LastModified()
+	}
+	return v
+}
+
+// quoteETag returns the entity tag in its quoted wire form.
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// matchETag reports whether the entity tag matches the list in an If-Match or
+// If-None-Match header. Strong comparison is used for If-Match, and weak
+// comparison for If-None-Match.
+func matchETag(header, etag string, exists, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		switch {
+		case candidate == "*":
+			if exists {
+				return true
+			}
+		case etag == "":
+		case strong:
+			if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+				return true
+			}
+		default:
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ClientConditionalCache makes the client remember the most recent successful
+// response to up to maxEntries GET requests that carried an ETag or
+// Last-Modified header. Subsequent GET requests for the same URL are sent with
+// If-None-Match and If-Modified-Since headers, and a StatusNotModified (304)
+// response is replaced with the remembered one, so DecodeResponseFuncs never
+// see it. Responses marked with Cache-Control: no-store or Vary: *, and bodies
+// larger than 1 MiB, aren't remembered.
+//
+// Responses are remembered per URL and per credentials: requests with
+// different Authorization or Cookie headers never share a response, so a
+// client may be shared by several users. A remembered response is only used
+// for requests whose headers named by its Vary header match those of the
+// request it answered.
+//
+// The cache wraps the HTTPClient set by SetClient, regardless of the order in
+// which the options are given.
+func ClientConditionalCache(maxEntries int) ClientOption {
+	return func(c *Client) { c.cacheEntries = maxEntries }
+}
+
+// maxCachedBodySize is the largest response body remembered by the cache
+// installed with ClientConditionalCache.
+const maxCachedBodySize = 1 << 20
+
+// conditionalCache is an HTTPClient that sends conditional GET requests and
+// answers 304 responses from an LRU cache.
+type conditionalCache struct {
+	next       HTTPClient
+	maxEntries int
+
+	mtx     sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key          string
+	vary         http.Header // the request headers named by Vary
+	status       int
+	header       http.Header
+	body         []byte
+	etag         string
+	lastModified string
+}
+
+func newConditionalCache(next HTTPClient, maxEntries int) *conditionalCache {
+	return &conditionalCache{
+		next:       next,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// Do implements HTTPClient.
+func (c *conditionalCache) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return c.next.Do(req)
+	}
+
+	key := cacheKey(req)
+	cached, ok := c.get(key)
+	if ok && !cached.matches(req) {
+		cached, ok = nil, false
+	}
+	if ok {
+		req = req.Clone(req.Context())
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := c.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ok && resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		header := cached.header.Clone()
+		for k, v := range resp.Header {
+			if !representationHeaders[k] {
+				header[k] = v
+			}
+		}
+		return &http.Response{
+			Status:        http.StatusText(cached.status),
+			StatusCode:    cached.status,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       resp.Request,
+			TLS:           resp.TLS,
+		}, nil
+
+	case resp.StatusCode == http.StatusOK:
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag == "" && lastModified == "" {
+			break
+		}
+		if strings.Contains(resp.Header.Get("Cache-Control"), "no-store") || resp.Header.Get("Vary") == "*" {
+			c.remove(key)
+			break
+		}
+		if resp.ContentLength > maxCachedBodySize {
+			break
+		}
+		rest := resp.Body
+		body, err := ioutil.ReadAll(io.LimitReader(rest, maxCachedBodySize+1))
+		if err != nil || len(body) > maxCachedBodySize {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), rest), rest}
+			break
+		}
+		rest.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		c.put(&cacheEntry{
+			key:          key,
+			vary:         varyHeader(req, resp),
+			status:       resp.StatusCode,
+			header:       resp.Header.Clone(),
+			body:         body,
+			etag:         etag,
+			lastModified: lastModified,
+		})
+	}
+	return resp, nil
+}
+
+// representationHeaders describe the remembered body, so they're kept when the
+// other headers of a remembered response are updated from a 304 response, as
+// in RFC 9111, section 4.3.4.
+var representationHeaders = map[string]bool{
+	"Content-Length":   true,
+	"Content-Encoding": true,
+	"Content-Type":     true,
+}
+
+// cacheKey returns the key of the request in the cache: its URL, and a hash of
+// its credentials.
+func cacheKey(req *http.Request) string {
+	h := sha256.New()
+	for _, name := range []string{"Authorization", "Cookie"} {
+		for _, v := range req.Header.Values(name) {
+			io.WriteString(h, v)
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+	return req.URL.String() + " " + hex.EncodeToString(h.Sum(nil))
+}
+
+// varyHeader returns the headers of the request named by the Vary header of
+// the response.
+func varyHeader(req *http.Request, resp *http.Response) http.Header {
+	vary := http.Header{}
+	for _, v := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" {
+				vary[name] = req.Header.Values(name)
+			}
+		}
+	}
+	return vary
+}
+
+// matches reports whether the request has the same headers named by Vary as
+// the request the entry answered.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, values := range e.vary {
+		have := req.Header.Values(name)
+		if len(have) != len(values) {
+			return false
+		}
+		for i := range values {
+			if have[i] != values[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c *conditionalCache) get(key string) (*cacheEntry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry), true
+}
+
+func (c *conditionalCache) put(entry *cacheEntry) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, ok := c.entries[entry.key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *conditionalCache) remove(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,290 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var documentModified = time.Date(2022, time.March, 4, 12, 30, 0, 0, time.UTC)
+
+type documentResponse struct {
+	Body string `json:"body"`
+}
+
+func (documentResponse) ETag() string            { return "v1" }
+func (documentResponse) LastModified() time.Time { return documentModified }
+func (documentResponse) Headers() http.Header    { return http.Header{"Cache-Control": {"max-age=60"}} }
+
+func TestConditionalResponse(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		method   string
+		header   http.Header
+		wantCode int
+	}{
+		{"unconditional", "GET", http.Header{}, http.StatusOK},
+		{"If-None-Match match", "GET", http.Header{"If-None-Match": {`"v0", W/"v1"`}}, http.StatusNotModified},
+		{"If-None-Match wildcard", "GET", http.Header{"If-None-Match": {`*`}}, http.StatusNotModified},
+		{"If-None-Match mismatch", "GET", http.Header{"If-None-Match": {`"v0"`}}, http.StatusOK},
+		{"If-Modified-Since not modified", "GET", http.Header{"If-Modified-Since": {documentModified.Format(http.TimeFormat)}}, http.StatusNotModified},
+		{"If-Modified-Since modified", "GET", http.Header{"If-Modified-Since": {documentModified.Add(-time.Second).Format(http.TimeFormat)}}, http.StatusOK},
+		{"If-None-Match takes precedence", "GET", http.Header{"If-None-Match": {`"v0"`}, "If-Modified-Since": {documentModified.Format(http.TimeFormat)}}, http.StatusOK},
+		{"If-Match mismatch", "GET", http.Header{"If-Match": {`"v0"`}}, http.StatusPreconditionFailed},
+		{"If-Match weak", "GET", http.Header{"If-Match": {`W/"v1"`}}, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since modified", "GET", http.Header{"If-Unmodified-Since": {documentModified.Add(-time.Second).Format(http.TimeFormat)}}, http.StatusPreconditionFailed},
+		{"unsafe method", "POST", http.Header{"If-None-Match": {`"v1"`}}, http.StatusOK},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			encoded := false
+			handler := httptransport.NewServer(
+				func(context.Context, interface{}) (interface{}, error) { return documentResponse{Body: "hello"}, nil },
+				httptransport.NopRequestDecoder,
+				func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+					encoded = true
+					return httptransport.EncodeJSONResponse(ctx, w, response)
+				},
+				httptransport.ServerConditionalRequests(),
+			)
+			req := httptest.NewRequest(testcase.method, "/", nil)
+			req.Header = testcase.header
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := testcase.wantCode, rec.Code; want != have {
+				t.Errorf("StatusCode: want %d, have %d", want, have)
+			}
+			if want, have := testcase.wantCode == http.StatusOK, encoded; want != have {
+				t.Errorf("encoder called: want %v, have %v", want, have)
+			}
+			if want, have := `"v1"`, rec.Header().Get("ETag"); want != have {
+				t.Errorf("ETag: want %q, have %q", want, have)
+			}
+			if want, have := "Fri, 04 Mar 2022 12:30:00 GMT", rec.Header().Get("Last-Modified"); want != have {
+				t.Errorf("Last-Modified: want %q, have %q", want, have)
+			}
+			if testcase.wantCode == http.StatusNotModified {
+				if want, have := "max-age=60", rec.Header().Get("Cache-Control"); want != have {
+					t.Errorf("Cache-Control: want %q, have %q", want, have)
+				}
+			}
+		})
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		exists   bool
+		header   http.Header
+		wantCode int
+	}{
+		{"unconditional", true, http.Header{}, http.StatusOK},
+		{"If-Match match", true, http.Header{"If-Match": {`"v1"`}}, http.StatusOK},
+		{"If-Match mismatch", true, http.Header{"If-Match": {`"v0"`}}, http.StatusPreconditionFailed},
+		{"If-Match wildcard missing", false, http.Header{"If-Match": {`*`}}, http.StatusPreconditionFailed},
+		{"If-None-Match wildcard missing", false, http.Header{"If-None-Match": {`*`}}, http.StatusOK},
+		{"If-None-Match wildcard exists", true, http.Header{"If-None-Match": {`*`}}, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since unmodified", true, http.Header{"If-Unmodified-Since": {documentModified.Format(http.TimeFormat)}}, http.StatusOK},
+		{"If-Unmodified-Since modified", true, http.Header{"If-Unmodified-Since": {documentModified.Add(-time.Hour).Format(http.TimeFormat)}}, http.StatusPreconditionFailed},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			updated := false
+			current := func(context.Context, interface{}) (string, time.Time, error) {
+				if !testcase.exists {
+					return "", time.Time{}, nil
+				}
+				return "v1", documentModified, nil
+			}
+			handler := httptransport.NewServer(
+				httptransport.Preconditions(current)(func(context.Context, interface{}) (interface{}, error) {
+					updated = true
+					return struct{}{}, nil
+				}),
+				httptransport.NopRequestDecoder,
+				httptransport.EncodeJSONResponse,
+				httptransport.ServerBefore(httptransport.PopulateConditionalRequest),
+			)
+			req := httptest.NewRequest("PUT", "/", nil)
+			req.Header = testcase.header
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := testcase.wantCode, rec.Code; want != have {
+				t.Errorf("StatusCode: want %d, have %d", want, have)
+			}
+			if want, have := testcase.wantCode == http.StatusOK, updated; want != have {
+				t.Errorf("endpoint called: want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestClientConditionalCache(t *testing.T) {
+	var (
+		requests int
+		encoded  int
+	)
+	server := httptest.NewServer(httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return documentResponse{Body: "hello"}, nil },
+		func(_ context.Context, r *http.Request) (interface{}, error) {
+			requests++
+			return nil, nil
+		},
+		func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+			encoded++
+			return httptransport.EncodeJSONResponse(ctx, w, response)
+		},
+		httptransport.ServerConditionalRequests(),
+	))
+	defer server.Close()
+
+	client := httptransport.NewClient(
+		"GET",
+		mustParse(server.URL),
+		httptransport.EncodeJSONRequest,
+		func(_ context.Context, r *http.Response) (interface{}, error) {
+			if r.StatusCode != http.StatusOK {
+				t.Errorf("StatusCode: want %d, have %d", http.StatusOK, r.StatusCode)
+			}
+			buf, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			var response documentResponse
+			if err := json.Unmarshal(buf, &response); err != nil {
+				return nil, err
+			}
+			return response, nil
+		},
+		httptransport.ClientConditionalCache(8),
+	)
+
+	for i := 0; i < 3; i++ {
+		response, err := client.Endpoint()(context.Background(), struct{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := "hello", response.(documentResponse).Body; want != have {
+			t.Errorf("request %d: want %q, have %q", i, want, have)
+		}
+	}
+	if want, have := 3, requests; want != have {
+		t.Errorf("requests: want %d, have %d", want, have)
+	}
+	if want, have := 1, encoded; want != have {
+		t.Errorf("full responses: want %d, have %d", want, have)
+	}
+}
+
+func TestClientConditionalCacheCredentials(t *testing.T) {
+	// The server answers If-None-Match with 304 regardless of who asks, so
+	// only the cache keeps the responses of different users apart.
+	var full int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		json.NewEncoder(w).Encode(documentResponse{Body: r.Header.Get("Authorization") + " " + r.Header.Get("Accept-Language")})
+	}))
+	defer server.Close()
+
+	type headers struct{ authorization, language string }
+	type headersKey struct{}
+	client := httptransport.NewClient(
+		"GET",
+		mustParse(server.URL),
+		httptransport.EncodeJSONRequest,
+		func(_ context.Context, r *http.Response) (interface{}, error) {
+			var response documentResponse
+			err := json.NewDecoder(r.Body).Decode(&response)
+			return response.Body, err
+		},
+		httptransport.ClientBefore(func(ctx context.Context, r *http.Request) context.Context {
+			h := ctx.Value(headersKey{}).(headers)
+			r.Header.Set("Authorization", h.authorization)
+			r.Header.Set("Accept-Language", h.language)
+			return ctx
+		}),
+		httptransport.ClientConditionalCache(8),
+	)
+
+	for _, testcase := range []struct {
+		headers headers
+		want    string
+		full    int
+	}{
+		{headers{"alice", "en"}, "alice en", 1},
+		{headers{"alice", "en"}, "alice en", 1},
+		{headers{"bob", "en"}, "bob en", 2},
+		{headers{"bob", "fr"}, "bob fr", 3},
+		{headers{"bob", "fr"}, "bob fr", 3},
+	} {
+		ctx := context.WithValue(context.Background(), headersKey{}, testcase.headers)
+		response, err := client.Endpoint()(ctx, struct{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := testcase.want, response; want != have {
+			t.Errorf("%v: want %q, have %q", testcase.headers, want, have)
+		}
+		if want, have := testcase.full, full; want != have {
+			t.Errorf("%v: full responses: want %d, have %d", testcase.headers, want, have)
+		}
+	}
+}
+
+func TestClientConditionalCacheNotModifiedHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			// A misbehaving server describes an empty body in its 304.
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("X-Revalidated", "true")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(documentResponse{Body: "hello"})
+	}))
+	defer server.Close()
+
+	client := httptransport.NewClient(
+		"GET",
+		mustParse(server.URL),
+		httptransport.EncodeJSONRequest,
+		func(_ context.Context, r *http.Response) (interface{}, error) {
+			return r.Header, nil
+		},
+		httptransport.ClientConditionalCache(8),
+	)
+	var header http.Header
+	for i := 0; i < 2; i++ {
+		response, err := client.Endpoint()(context.Background(), struct{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		header = response.(http.Header)
+	}
+
+	for k, want := range map[string]string{
+		"Content-Type":     "application/json",
+		"Content-Encoding": "",
+		"X-Revalidated":    "true",
+	} {
+		if have := header.Get(k); want != have {
+			t.Errorf("%s: want %q, have %q", k, want, have)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// Client wraps a URL and provides a method that implements endpoint.Endpoint,
+// for a single method of a Protobuf service.
+type Client struct {
+	client      httptransport.HTTPClient
+	protocol    Protocol
+	url         string
+	enc         EncodeRequestFunc
+	newResponse func() proto.Message
+	dec         DecodeResponseFunc
+	json        bool
+	before      []httptransport.RequestFunc
+	after       []httptransport.ClientResponseFunc
+	finalizer   []ClientFinalizerFunc
+}
+
+// NewClient constructs a usable Client for the method of the
+// fully-qualified Protobuf service, served with the protocol under the base
+// URL. newResponse returns a new response message of the method, which is
+// passed to the DecodeResponseFunc.
+func NewClient(
+	protocol Protocol,
+	tgt *url.URL,
+	service, method string,
+	enc EncodeRequestFunc,
+	newResponse func() proto.Message,
+	dec DecodeResponseFunc,
+	options ...ClientOption,
+) *Client {
+	c := &Client{
+		client:      http.DefaultClient,
+		protocol:    protocol,
+		url:         strings.TrimSuffix(tgt.String(), "/") + Path(protocol, service, method),
+		enc:         enc,
+		newResponse: newResponse,
+		dec:         dec,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(*Client)
+
+// SetClient sets the underlying HTTP client used for requests.
+// By default, http.DefaultClient is used.
+func SetClient(client httptransport.HTTPClient) ClientOption {
+	return func(c *Client) { c.client = client }
+}
+
+// ClientJSON sets whether messages are encoded as JSON, instead of binary
+// Protobuf. By default, they're encoded as binary Protobuf.
+func ClientJSON(json bool) ClientOption {
+	return func(c *Client) { c.json = json }
+}
+
+// ClientBefore adds one or more RequestFuncs to be applied to the outgoing
+// HTTP request before it's invoked.
+func ClientBefore(before ...httptransport.RequestFunc) ClientOption {
+	return func(c *Client) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter adds one or more ClientResponseFuncs, which are applied to the
+// incoming HTTP response prior to it being decoded.
+func ClientAfter(after ...httptransport.ClientResponseFunc) ClientOption {
+	return func(c *Client) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer adds one or more ClientFinalizerFuncs to be executed at the
+// end of every HTTP request. By default, no finalizer is registered.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *Client) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// Endpoint returns a usable Go kit endpoint that calls the remote method.
+// Errors answered by the server are returned as an *Error.
+func (c Client) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		if c.finalizer != nil {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		msg, err := c.enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		b, err := marshal(msg, c.json)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", contentType(c.protocol, c.json))
+		if c.protocol == ConnectProtocol {
+			req.Header.Set(connectProtocolVersion, "1")
+			if deadline, ok := ctx.Deadline(); ok {
+				ms := time.Until(deadline).Milliseconds()
+				if ms < 1 {
+					ms = 1
+				}
+				req.Header.Set(connectTimeout, strconv.FormatInt(ms, 10))
+			}
+		}
+
+		for _, f := range c.before {
+			ctx = f(ctx, req)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		for _, f := range c.after {
+			ctx = f(ctx, resp)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, readError(c.protocol, resp)
+		}
+		isJSON, ok := parseContentType(resp.Header.Get("Content-Type"))
+		if !ok {
+			return nil, errors.New("unsupported response content type " + resp.Header.Get("Content-Type"))
+		}
+		if b, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+		out := c.newResponse()
+		if err = unmarshal(b, out, isJSON); err != nil {
+			return nil, err
+		}
+
+		response, err = c.dec(ctx, out)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+// ClientFinalizerFunc can be used to perform work at the end of a client HTTP
+// request, after the response is returned. The principal intended use is for
+// error logging.
+// Note: err may be nil.
+type ClientFinalizerFunc func(ctx context.Context, err error)
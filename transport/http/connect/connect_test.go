@@ -0,0 +1,248 @@
+package connect_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/go-kit/kit/transport/http/connect"
+)
+
+const service = "acme.greeter.v1.GreeterService"
+
+type statusError int
+
+func (e statusError) Error() string   { return http.StatusText(int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+func greetEndpoint(ctx context.Context, request interface{}) (interface{}, error) {
+	switch name := request.(string); name {
+	case "nobody":
+		return nil, connect.NewError(connect.CodeNotFound, "no such person")
+	case "lost":
+		return nil, connect.NewError(connect.CodeDataLoss, "gone")
+	case "banned":
+		return nil, statusError(http.StatusForbidden)
+	case "plain":
+		return nil, errors.New("boom")
+	case "deadline":
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			return nil, errors.New("no deadline")
+		}
+		return "in time", nil
+	default:
+		return "hello " + name, nil
+	}
+}
+
+func newGreetServer(t *testing.T, options ...connect.ServerOption) *httptest.Server {
+	server := connect.NewServer(
+		greetEndpoint,
+		func() proto.Message { return &wrapperspb.StringValue{} },
+		func(_ context.Context, msg proto.Message) (interface{}, error) {
+			return msg.(*wrapperspb.StringValue).Value, nil
+		},
+		func(_ context.Context, response interface{}) (proto.Message, error) {
+			return wrapperspb.String(response.(string)), nil
+		},
+		options...,
+	)
+	mux := http.NewServeMux()
+	connect.Register(mux, service, "Greet", server)
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func greetClient(s *httptest.Server, protocol connect.Protocol, options ...connect.ClientOption) func(context.Context, string) (interface{}, error) {
+	tgt, _ := url.Parse(s.URL)
+	e := connect.NewClient(
+		protocol, tgt, service, "Greet",
+		func(_ context.Context, request interface{}) (proto.Message, error) {
+			return wrapperspb.String(request.(string)), nil
+		},
+		func() proto.Message { return &wrapperspb.StringValue{} },
+		func(_ context.Context, msg proto.Message) (interface{}, error) {
+			return msg.(*wrapperspb.StringValue).Value, nil
+		},
+		options...,
+	).Endpoint()
+	return func(ctx context.Context, name string) (interface{}, error) { return e(ctx, name) }
+}
+
+func TestClientServer(t *testing.T) {
+	s := newGreetServer(t)
+	for name, testcase := range map[string]struct {
+		protocol connect.Protocol
+		json     bool
+	}{
+		"connect proto": {connect.ConnectProtocol, false},
+		"connect json":  {connect.ConnectProtocol, true},
+		"twirp proto":   {connect.TwirpProtocol, false},
+		"twirp json":    {connect.TwirpProtocol, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			greet := greetClient(s, testcase.protocol, connect.ClientJSON(testcase.json))
+			response, err := greet(context.Background(), "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := "hello alice", response; want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+
+			_, err = greet(context.Background(), "nobody")
+			var e *connect.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("want *connect.Error, have %v", err)
+			}
+			if want, have := connect.CodeNotFound, e.Code; want != have {
+				t.Errorf("code: want %q, have %q", want, have)
+			}
+			if want, have := "no such person", e.Message; want != have {
+				t.Errorf("message: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	s := newGreetServer(t)
+	for _, testcase := range []struct {
+		name     string
+		protocol connect.Protocol
+		code     connect.Code
+	}{
+		{"lost", connect.TwirpProtocol, connect.CodeDataLoss},
+		{"lost", connect.ConnectProtocol, connect.CodeDataLoss},
+		{"banned", connect.ConnectProtocol, connect.CodePermissionDenied},
+		{"plain", connect.ConnectProtocol, connect.CodeUnknown},
+	} {
+		_, err := greetClient(s, testcase.protocol)(context.Background(), testcase.name)
+		if want, have := testcase.code, connect.CodeOf(err); want != have {
+			t.Errorf("%s (%d): want %q, have %q", testcase.name, testcase.protocol, want, have)
+		}
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	s := newGreetServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	response, err := greetClient(s, connect.ConnectProtocol)(ctx, "deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "in time", response; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	s := newGreetServer(t)
+
+	resp, err := http.Post(s.URL+"/"+service+"/Greet", "application/json", strings.NewReader(`"bob"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if want, have := "application/json", resp.Header.Get("Content-Type"); want != have {
+		t.Errorf("content type: want %q, have %q", want, have)
+	}
+	if want, have := `"hello bob"`, strings.TrimSpace(string(b)); want != have {
+		t.Errorf("body: want %s, have %s", want, have)
+	}
+
+	for _, testcase := range []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		response    map[string]interface{}
+	}{
+		{
+			name: "connect error", method: http.MethodPost, path: "/" + service + "/Greet",
+			contentType: "application/json", body: `"nobody"`,
+			status: http.StatusNotFound, response: map[string]interface{}{"code": "not_found", "message": "no such person"},
+		},
+		{
+			name: "twirp error", method: http.MethodPost, path: "/twirp/" + service + "/Greet",
+			contentType: "application/json", body: `"lost"`,
+			status: http.StatusInternalServerError, response: map[string]interface{}{"code": "dataloss", "msg": "gone"},
+		},
+		{
+			name: "twirp malformed", method: http.MethodPost, path: "/twirp/" + service + "/Greet",
+			contentType: "application/json", body: `{`,
+			status: http.StatusBadRequest, response: map[string]interface{}{"code": "malformed"},
+		},
+		{
+			name: "twirp bad route", method: http.MethodGet, path: "/twirp/" + service + "/Greet",
+			status: http.StatusNotFound, response: map[string]interface{}{"code": "bad_route"},
+		},
+		{
+			name: "connect method", method: http.MethodGet, path: "/" + service + "/Greet",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "connect content type", method: http.MethodPost, path: "/" + service + "/Greet",
+			contentType: "text/plain", body: "bob",
+			status: http.StatusUnsupportedMediaType,
+		},
+	} {
+		req, _ := http.NewRequest(testcase.method, s.URL+testcase.path, strings.NewReader(testcase.body))
+		if testcase.contentType != "" {
+			req.Header.Set("Content-Type", testcase.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		if want, have := testcase.status, resp.StatusCode; want != have {
+			t.Errorf("%s: status: want %d, have %d", testcase.name, want, have)
+		}
+		for k, want := range testcase.response {
+			if have := body[k]; want != have {
+				t.Errorf("%s: %s: want %v, have %v", testcase.name, k, want, have)
+			}
+		}
+	}
+}
+
+func TestServerFinalizer(t *testing.T) {
+	var (
+		protocol connect.Protocol
+		final    error
+	)
+	s := newGreetServer(t, connect.ServerFinalizer(func(ctx context.Context, err error) {
+		protocol = ctx.Value(connect.ContextKeyProtocol).(connect.Protocol)
+		final = err
+	}))
+	greetClient(s, connect.TwirpProtocol)(context.Background(), "nobody")
+	if want, have := connect.TwirpProtocol, protocol; want != have {
+		t.Errorf("protocol: want %d, have %d", want, have)
+	}
+	if want, have := connect.CodeNotFound, connect.CodeOf(final); want != have {
+		t.Errorf("error: want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,8 @@
+// Package connect provides a binding for endpoints to the unary RPCs of the
+// Connect protocol and of Twirp.
+//
+// Both protocols send a Protobuf message, encoded as binary Protobuf or JSON,
+// in the body of an HTTP POST request to the path of the procedure, and
+// answer errors with a JSON body holding an error code. Servers serve both
+// protocols, so browsers may call services without a gRPC-Web proxy.
+package connect
@@ -0,0 +1,23 @@
+package connect
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DecodeRequestFunc extracts a user-domain request object from the request
+// message. It's designed to be used in servers, for server-side endpoints.
+type DecodeRequestFunc func(ctx context.Context, msg proto.Message) (request interface{}, err error)
+
+// EncodeResponseFunc encodes the passed response object into the response
+// message. It's designed to be used in servers, for server-side endpoints.
+type EncodeResponseFunc func(ctx context.Context, response interface{}) (msg proto.Message, err error)
+
+// EncodeRequestFunc encodes the passed request object into the request
+// message. It's designed to be used in clients, for client-side endpoints.
+type EncodeRequestFunc func(ctx context.Context, request interface{}) (msg proto.Message, err error)
+
+// DecodeResponseFunc extracts a user-domain response object from the response
+// message. It's designed to be used in clients, for client-side endpoints.
+type DecodeResponseFunc func(ctx context.Context, msg proto.Message) (response interface{}, err error)
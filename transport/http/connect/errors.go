@@ -0,0 +1,176 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// Code is the error code of an RPC. The codes are shared by the Connect
+// protocol, Twirp and gRPC.
+type Code string
+
+// The error codes.
+const (
+	CodeCanceled           Code = "canceled"
+	CodeUnknown            Code = "unknown"
+	CodeInvalidArgument    Code = "invalid_argument"
+	CodeDeadlineExceeded   Code = "deadline_exceeded"
+	CodeNotFound           Code = "not_found"
+	CodeAlreadyExists      Code = "already_exists"
+	CodePermissionDenied   Code = "permission_denied"
+	CodeResourceExhausted  Code = "resource_exhausted"
+	CodeFailedPrecondition Code = "failed_precondition"
+	CodeAborted            Code = "aborted"
+	CodeOutOfRange         Code = "out_of_range"
+	CodeUnimplemented      Code = "unimplemented"
+	CodeInternal           Code = "internal"
+	CodeUnavailable        Code = "unavailable"
+	CodeDataLoss           Code = "data_loss"
+	CodeUnauthenticated    Code = "unauthenticated"
+)
+
+// Coder is checked by servers for the code of the errors returned by
+// endpoints and DecodeRequestFuncs.
+type Coder interface {
+	Code() Code
+}
+
+// Error is the error of an RPC. Servers send the code and message of errors
+// of this type as is. Clients return the errors received from servers as an
+// *Error.
+type Error struct {
+	Code    Code
+	Message string
+
+	// Meta is the metadata of Twirp errors. It isn't sent by the Connect
+	// protocol.
+	Meta map[string]string
+}
+
+// NewError returns an error with the code and the message.
+func NewError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return string(e.Code)
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+// CodeOf returns the code of the error. It's the code of an *Error or a
+// Coder in the chain of the error, canceled or deadline_exceeded for the
+// errors of contexts, or derived from the status of an
+// httptransport.StatusCoder. It's unknown otherwise.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	}
+	var sc httptransport.StatusCoder
+	if errors.As(err, &sc) {
+		return codeFromStatus(sc.StatusCode())
+	}
+	return CodeUnknown
+}
+
+// toError converts the error to an *Error.
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Code: CodeOf(err), Message: err.Error()}
+}
+
+func codeFromStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidArgument
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodePermissionDenied
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return CodeDeadlineExceeded
+	case http.StatusConflict:
+		return CodeAborted
+	case http.StatusPreconditionFailed:
+		return CodeFailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return CodeResourceExhausted
+	case http.StatusNotImplemented:
+		return CodeUnimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusInternalServerError:
+		return CodeInternal
+	default:
+		return CodeUnknown
+	}
+}
+
+// connectStatus is the HTTP status of the error codes in the Connect
+// protocol.
+var connectStatus = map[Code]int{
+	CodeCanceled:           499,
+	CodeUnknown:            http.StatusInternalServerError,
+	CodeInvalidArgument:    http.StatusBadRequest,
+	CodeDeadlineExceeded:   http.StatusGatewayTimeout,
+	CodeNotFound:           http.StatusNotFound,
+	CodeAlreadyExists:      http.StatusConflict,
+	CodePermissionDenied:   http.StatusForbidden,
+	CodeResourceExhausted:  http.StatusTooManyRequests,
+	CodeFailedPrecondition: http.StatusBadRequest,
+	CodeAborted:            http.StatusConflict,
+	CodeOutOfRange:         http.StatusBadRequest,
+	CodeUnimplemented:      http.StatusNotImplemented,
+	CodeInternal:           http.StatusInternalServerError,
+	CodeUnavailable:        http.StatusServiceUnavailable,
+	CodeDataLoss:           http.StatusInternalServerError,
+	CodeUnauthenticated:    http.StatusUnauthorized,
+}
+
+// twirpStatus is the HTTP status of the error codes in Twirp.
+var twirpStatus = map[Code]int{
+	CodeCanceled:           http.StatusRequestTimeout,
+	CodeUnknown:            http.StatusInternalServerError,
+	CodeInvalidArgument:    http.StatusBadRequest,
+	CodeDeadlineExceeded:   http.StatusRequestTimeout,
+	CodeNotFound:           http.StatusNotFound,
+	CodeAlreadyExists:      http.StatusConflict,
+	CodePermissionDenied:   http.StatusForbidden,
+	CodeResourceExhausted:  http.StatusTooManyRequests,
+	CodeFailedPrecondition: http.StatusPreconditionFailed,
+	CodeAborted:            http.StatusConflict,
+	CodeOutOfRange:         http.StatusBadRequest,
+	CodeUnimplemented:      http.StatusNotImplemented,
+	CodeInternal:           http.StatusInternalServerError,
+	CodeUnavailable:        http.StatusServiceUnavailable,
+	CodeDataLoss:           http.StatusInternalServerError,
+	CodeUnauthenticated:    http.StatusUnauthorized,
+}
+
+// Twirp spells some codes differently, and has codes of its own.
+const (
+	twirpDataLoss  = "dataloss"
+	twirpMalformed = "malformed"
+	twirpBadRoute  = "bad_route"
+)
@@ -0,0 +1,162 @@
+package connect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protocol is the RPC protocol spoken by a client, or by the caller of a
+// server.
+type Protocol int
+
+const (
+	// ConnectProtocol is the unary protocol of Connect, whose procedures are
+	// served under /package.Service/Method.
+	ConnectProtocol Protocol = iota
+
+	// TwirpProtocol is the protocol of Twirp, whose procedures are served
+	// under /twirp/package.Service/Method.
+	TwirpProtocol
+)
+
+// TwirpPrefix is the path prefix of the procedures of Twirp.
+const TwirpPrefix = "/twirp"
+
+// Path returns the path of the method of the fully-qualified Protobuf
+// service, like "acme.user.v1.UserService", with the protocol.
+func Path(protocol Protocol, service, method string) string {
+	path := "/" + service + "/" + method
+	if protocol == TwirpProtocol {
+		path = TwirpPrefix + path
+	}
+	return path
+}
+
+const (
+	contentTypeJSON        = "application/json"
+	contentTypeConnect     = "application/proto"
+	contentTypeTwirp       = "application/protobuf"
+	connectProtocolVersion = "Connect-Protocol-Version"
+	connectTimeout         = "Connect-Timeout-Ms"
+)
+
+// contentType returns the content type of messages.
+func contentType(protocol Protocol, isJSON bool) string {
+	switch {
+	case isJSON:
+		return contentTypeJSON
+	case protocol == TwirpProtocol:
+		return contentTypeTwirp
+	default:
+		return contentTypeConnect
+	}
+}
+
+// parseContentType returns whether messages of the content type are JSON,
+// or whether the content type isn't supported.
+func parseContentType(header string) (isJSON bool, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false, false
+	}
+	switch mediaType {
+	case contentTypeJSON:
+		return true, true
+	case contentTypeConnect, contentTypeTwirp:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+func marshal(msg proto.Message, isJSON bool) ([]byte, error) {
+	if isJSON {
+		return protojson.Marshal(msg)
+	}
+	return proto.Marshal(msg)
+}
+
+func unmarshal(b []byte, msg proto.Message, isJSON bool) error {
+	if isJSON {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, msg)
+	}
+	return proto.Unmarshal(b, msg)
+}
+
+// connectError is the JSON body of errors in the Connect protocol.
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// twirpError is the JSON body of errors in Twirp.
+type twirpError struct {
+	Code string            `json:"code"`
+	Msg  string            `json:"msg"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// writeError writes the error with the protocol. The code is written as is,
+// unless it's empty.
+func writeError(w http.ResponseWriter, protocol Protocol, e *Error, code string) {
+	var (
+		body   interface{}
+		status int
+	)
+	switch protocol {
+	case TwirpProtocol:
+		status = twirpStatus[e.Code]
+		if code == "" {
+			code = string(e.Code)
+			if e.Code == CodeDataLoss {
+				code = twirpDataLoss
+			}
+		}
+		body = twirpError{Code: code, Msg: e.Message, Meta: e.Meta}
+	default:
+		status = connectStatus[e.Code]
+		if code == "" {
+			code = string(e.Code)
+		}
+		body = connectError{Code: code, Message: e.Message}
+	}
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// readError reads the error of the response, which has a status other than
+// 200 OK.
+func readError(protocol Protocol, resp *http.Response) *Error {
+	e := &Error{Code: codeFromStatus(resp.StatusCode)}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), contentTypeJSON) {
+		e.Message = http.StatusText(resp.StatusCode)
+		return e
+	}
+	switch protocol {
+	case TwirpProtocol:
+		var body twirpError
+		if json.Unmarshal(b, &body) == nil && body.Code != "" {
+			e.Code, e.Message, e.Meta = Code(body.Code), body.Msg, body.Meta
+			if body.Code == twirpDataLoss {
+				e.Code = CodeDataLoss
+			}
+		}
+	default:
+		var body connectError
+		if json.Unmarshal(b, &body) == nil && body.Code != "" {
+			e.Code, e.Message = Code(body.Code), body.Message
+		}
+	}
+	return e
+}
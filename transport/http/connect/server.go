@@ -0,0 +1,247 @@
+package connect
+
+import (
+	"context"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/log"
+)
+
+// Server wraps an endpoint and implements http.Handler, for a single method
+// of a Protobuf service. It serves both the Connect protocol and Twirp:
+// requests whose path starts with TwirpPrefix, or with the
+// application/protobuf content type, are served with Twirp.
+type Server struct {
+	e            endpoint.Endpoint
+	newRequest   func() proto.Message
+	dec          DecodeRequestFunc
+	enc          EncodeResponseFunc
+	before       []httptransport.RequestFunc
+	after        []httptransport.ServerResponseFunc
+	finalizer    []ServerFinalizerFunc
+	errorHandler transport.ErrorHandler
+}
+
+// NewServer constructs a new server, which implements http.Handler and wraps
+// the provided endpoint. newRequest returns a new request message of the
+// method, which is passed to the DecodeRequestFunc. Mount the server under
+// the paths of the method with Register.
+func NewServer(
+	e endpoint.Endpoint,
+	newRequest func() proto.Message,
+	dec DecodeRequestFunc,
+	enc EncodeResponseFunc,
+	options ...ServerOption,
+) *Server {
+	s := &Server{
+		e:            e,
+		newRequest:   newRequest,
+		dec:          dec,
+		enc:          enc,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(*Server)
+
+// ServerBefore functions are executed on the HTTP request object before the
+// request is decoded.
+func ServerBefore(before ...httptransport.RequestFunc) ServerOption {
+	return func(s *Server) { s.before = append(s.before, before...) }
+}
+
+// ServerAfter functions are executed on the HTTP response writer after the
+// endpoint is invoked, but before anything is written to the client.
+func ServerAfter(after ...httptransport.ServerResponseFunc) ServerOption {
+	return func(s *Server) { s.after = append(s.after, after...) }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored. This is intended as a diagnostic measure.
+func ServerErrorHandler(errorHandler transport.ErrorHandler) ServerOption {
+	return func(s *Server) { s.errorHandler = errorHandler }
+}
+
+// ServerFinalizer is executed at the end of every HTTP request.
+// By default, no finalizer is registered.
+func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
+	return func(s *Server) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// ServeHTTP implements http.Handler. Errors are written with the code
+// returned by CodeOf, and their message.
+func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	protocol := requestProtocol(r)
+	ctx := context.WithValue(r.Context(), ContextKeyProtocol, protocol)
+
+	var err error
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	if r.Method != http.MethodPost {
+		err = NewError(CodeUnimplemented, "unsupported HTTP method "+r.Method)
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeBadRoute(ctx, w, protocol, err.(*Error))
+		return
+	}
+	isJSON, ok := parseContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		err = NewError(CodeInvalidArgument, "unsupported content type "+r.Header.Get("Content-Type"))
+		s.writeBadRoute(ctx, w, protocol, err.(*Error))
+		return
+	}
+	if protocol == ConnectProtocol {
+		if version := r.Header.Get(connectProtocolVersion); version != "" && version != "1" {
+			err = NewError(CodeInvalidArgument, "unsupported Connect protocol version "+version)
+			s.writeError(ctx, w, protocol, err, "")
+			return
+		}
+		if timeout := r.Header.Get(connectTimeout); timeout != "" {
+			ms, parseErr := strconv.ParseInt(timeout, 10, 64)
+			if parseErr != nil {
+				err = NewError(CodeInvalidArgument, "invalid timeout "+timeout)
+				s.writeError(ctx, w, protocol, err, "")
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+			defer cancel()
+		}
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		err = NewError(CodeUnimplemented, "unsupported content encoding "+encoding)
+		s.writeError(ctx, w, protocol, err, "")
+		return
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, r)
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(ctx, w, protocol, err, "")
+		return
+	}
+	msg := s.newRequest()
+	if err = unmarshal(b, msg, isJSON); err != nil {
+		s.writeError(ctx, w, protocol, &Error{Code: CodeInvalidArgument, Message: err.Error()}, twirpMalformed)
+		return
+	}
+
+	request, err := s.dec(ctx, msg)
+	if err != nil {
+		s.writeError(ctx, w, protocol, err, "")
+		return
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.writeError(ctx, w, protocol, err, "")
+		return
+	}
+
+	for _, f := range s.after {
+		ctx = f(ctx, w)
+	}
+
+	out, err := s.enc(ctx, response)
+	if err != nil {
+		s.writeError(ctx, w, protocol, err, "")
+		return
+	}
+	if b, err = marshal(out, isJSON); err != nil {
+		s.writeError(ctx, w, protocol, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", contentType(protocol, isJSON))
+	w.Write(b)
+}
+
+// writeError writes the error. The twirpCode, if any, replaces its code with
+// Twirp.
+func (s Server) writeError(ctx context.Context, w http.ResponseWriter, protocol Protocol, err error, twirpCode string) {
+	s.errorHandler.Handle(ctx, err)
+	if headerer, ok := err.(httptransport.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	var code string
+	if protocol == TwirpProtocol {
+		code = twirpCode
+	}
+	writeError(w, protocol, toError(err), code)
+}
+
+// writeBadRoute writes the error of a request which isn't an RPC.
+func (s Server) writeBadRoute(ctx context.Context, w http.ResponseWriter, protocol Protocol, e *Error) {
+	s.errorHandler.Handle(ctx, e)
+	if protocol == TwirpProtocol {
+		writeError(w, protocol, &Error{Code: CodeNotFound, Message: e.Message}, twirpBadRoute)
+		return
+	}
+	if e.Code == CodeInvalidArgument {
+		w.Header().Set("Accept-Post", strings.Join([]string{contentTypeConnect, contentTypeJSON}, ", "))
+		http.Error(w, e.Message, http.StatusUnsupportedMediaType)
+		return
+	}
+	http.Error(w, e.Message, http.StatusMethodNotAllowed)
+}
+
+func requestProtocol(r *http.Request) Protocol {
+	if strings.HasPrefix(r.URL.Path, TwirpPrefix+"/") {
+		return TwirpProtocol
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == contentTypeTwirp {
+		return TwirpProtocol
+	}
+	return ConnectProtocol
+}
+
+// Mux is the interface of *http.ServeMux used by Register.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// Register mounts the handler, typically a Server, on the mux under the
+// paths of the method of the fully-qualified Protobuf service, for both the
+// Connect protocol and Twirp.
+func Register(mux Mux, service, method string, handler http.Handler) {
+	mux.Handle(Path(ConnectProtocol, service, method), handler)
+	mux.Handle(Path(TwirpProtocol, service, method), handler)
+}
+
+type contextKey int
+
+const (
+	// ContextKeyProtocol is populated in the context by servers. Its value is
+	// the Protocol of the request.
+	ContextKeyProtocol contextKey = iota
+)
+
+// ServerFinalizerFunc can be used to perform work at the end of an HTTP
+// request, after the response has been written to the client.
+type ServerFinalizerFunc func(ctx context.Context, err error)
@@ -0,0 +1,255 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which cross-origin requests a server accepts, as
+// specified by the CORS protocol of the Fetch standard. Install it on a Server
+// with ServerCORS, and answer preflight requests with ServerCORS or with the
+// handler returned by PreflightHandler.
+type CORSPolicy struct {
+	// AllowedOrigins lists the origins that may make cross-origin requests,
+	// such as "https://example.com". An origin may contain "*" wildcards,
+	// each matching one or more characters, as in "https://*.example.com". The
+	// single entry "*" allows every origin except "null", which must be
+	// listed explicitly.
+	AllowedOrigins []string
+
+	// AllowedOriginPatterns are regular expressions matched against the whole
+	// Origin header, in addition to AllowedOrigins.
+	AllowedOriginPatterns []*regexp.Regexp
+
+	// AllowedMethods lists the methods that may be used in cross-origin
+	// requests. By default, GET, HEAD and POST are allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers that may be used in
+	// cross-origin requests, matched case-insensitively. The single entry "*"
+	// allows every header. By default, only Content-Type and the CORS-safelisted
+	// request headers are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers that scripts may read, beyond
+	// the CORS-safelisted response headers.
+	ExposedHeaders []string
+
+	// AllowCredentials permits requests that include cookies or HTTP
+	// authentication. The allowed origin is then always echoed, never "*".
+	//
+	// Credentials require the allowed origins to be listed: a policy with
+	// AllowCredentials and the "*" entry in AllowedOrigins would let every
+	// site make authenticated requests on behalf of the user, and makes
+	// ServerCORS and PreflightHandler panic.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache the result of a preflight request.
+	// It's sent with second precision. By default, the header is omitted and
+	// browsers use their own default.
+	MaxAge time.Duration
+
+	// anchored are the AllowedOriginPatterns, anchored to match the whole
+	// origin.
+	anchored []*regexp.Regexp
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	defaultCORSHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+)
+
+// ServerCORS applies the CORS policy to every response written by the server,
+// including error responses. Preflight requests, that is, OPTIONS requests
+// carrying an Access-Control-Request-Method header, are answered directly
+// without invoking the decoder or the endpoint, so the same Server may be
+// mounted for OPTIONS as well. The policy is copied; later changes to it have
+// no effect.
+func ServerCORS(p *CORSPolicy) ServerOption {
+	c := p.build()
+	return func(s *Server) { s.cors = c }
+}
+
+// PreflightHandler returns an http.Handler that answers preflight requests
+// according to the policy. Allowed preflights get StatusNoContent (204) with
+// the Access-Control-Allow-* headers; denied preflights and OPTIONS requests
+// that aren't preflights get StatusForbidden (403) without them. The policy is
+// copied; later changes to it have no effect.
+func (p *CORSPolicy) PreflightHandler() http.Handler {
+	return http.HandlerFunc(p.build().servePreflight)
+}
+
+// build returns a copy of the policy, ready to be used. It panics if the
+// policy allows credentials from any origin.
+func (p *CORSPolicy) build() *CORSPolicy {
+	c := *p
+	if c.AllowCredentials {
+		for _, allowed := range c.AllowedOrigins {
+			if allowed == "*" {
+				panic(`CORSPolicy: AllowCredentials requires explicit AllowedOrigins, not "*"`)
+			}
+		}
+	}
+	c.anchored = make([]*regexp.Regexp, len(c.AllowedOriginPatterns))
+	for i, re := range c.AllowedOriginPatterns {
+		c.anchored[i] = regexp.MustCompile(`^(?:` + re.String() + `)$`)
+	}
+	return &c
+}
+
+// isPreflight reports whether r is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func (p *CORSPolicy) servePreflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if !isPreflight(r) || !p.originAllowed(origin) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !p.methodAllowed(method) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	requested := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	for _, name := range requested {
+		if !p.headerAllowed(name) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	h.Set("Access-Control-Allow-Origin", p.allowOrigin(origin))
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(p.methods(), ", "))
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(p.MaxAge/time.Second), 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setHeaders adds the CORS response headers for the actual (non-preflight)
+// request r.
+func (p *CORSPolicy) setHeaders(h http.Header, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	allowOrigin := ""
+	if origin != "" && p.originAllowed(origin) {
+		allowOrigin = p.allowOrigin(origin)
+	}
+	if allowOrigin != "*" {
+		h.Add("Vary", "Origin")
+	}
+	if allowOrigin == "" {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", allowOrigin)
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+	}
+}
+
+// allowOrigin returns the value of Access-Control-Allow-Origin for an allowed
+// origin.
+func (p *CORSPolicy) allowOrigin(origin string) string {
+	if len(p.AllowedOrigins) == 1 && p.AllowedOrigins[0] == "*" && len(p.AllowedOriginPatterns) == 0 {
+		return "*"
+	}
+	return origin
+}
+
+func (p *CORSPolicy) originAllowed(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			if origin != "null" {
+				return true
+			}
+			continue
+		}
+		if matchWildcard(strings.ToLower(allowed), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	for _, re := range p.anchored {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) methods() []string {
+	if len(p.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return p.AllowedMethods
+}
+
+func (p *CORSPolicy) methodAllowed(method string) bool {
+	for _, allowed := range p.methods() {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) headerAllowed(name string) bool {
+	allowed := p.AllowedHeaders
+	if len(allowed) == 0 {
+		allowed = defaultCORSHeaders
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard reports whether s matches pattern, in which every "*" matches
+// one or more characters.
+func matchWildcard(pattern, s string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pattern[:i]) {
+		return false
+	}
+	for rest, j := s[i:], 1; j <= len(rest); j++ {
+		if matchWildcard(pattern[i+1:], rest[j:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHeaderList splits a comma-separated list of header names, dropping
+// empty elements.
+func parseHeaderList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
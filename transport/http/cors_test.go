@@ -0,0 +1,237 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func corsServer(policy *httptransport.CORSPolicy, e endpoint.Endpoint) *httptransport.Server {
+	return httptransport.NewServer(
+		e,
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerCORS(policy),
+	)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	policy := &httptransport.CORSPolicy{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.staging.example.com"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`http://localhost:\d+`)},
+		AllowedMethods:        []string{"GET", "PUT", "DELETE"},
+		AllowedHeaders:        []string{"Content-Type", "X-Request-Id"},
+		AllowCredentials:      true,
+		MaxAge:                10 * time.Minute,
+	}
+	for _, testcase := range []struct {
+		name        string
+		origin      string
+		method      string
+		headers     string
+		wantCode    int
+		wantHeaders http.Header
+	}{
+		{
+			name:     "allowed",
+			origin:   "https://app.example.com",
+			method:   "PUT",
+			headers:  "content-type, X-Request-ID",
+			wantCode: http.StatusNoContent,
+			wantHeaders: http.Header{
+				"Access-Control-Allow-Origin":      {"https://app.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"GET, PUT, DELETE"},
+				"Access-Control-Allow-Headers":     {"content-type, x-request-id"},
+				"Access-Control-Max-Age":           {"600"},
+				"Vary":                             {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{
+			name:     "wildcard origin",
+			origin:   "https://pr-42.staging.example.com",
+			method:   "DELETE",
+			wantCode: http.StatusNoContent,
+			wantHeaders: http.Header{
+				"Access-Control-Allow-Origin":      {"https://pr-42.staging.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"GET, PUT, DELETE"},
+				"Access-Control-Max-Age":           {"600"},
+				"Vary":                             {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{
+			name:     "regex origin",
+			origin:   "http://localhost:3000",
+			method:   "GET",
+			wantCode: http.StatusNoContent,
+			wantHeaders: http.Header{
+				"Access-Control-Allow-Origin":      {"http://localhost:3000"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"GET, PUT, DELETE"},
+				"Access-Control-Max-Age":           {"600"},
+				"Vary":                             {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{"wildcard needs a subdomain", "https://staging.example.com", "GET", "", http.StatusForbidden, nil},
+		{"regex must match fully", "http://localhost:3000.evil.com", "GET", "", http.StatusForbidden, nil},
+		{"origin not allowed", "https://evil.com", "GET", "", http.StatusForbidden, nil},
+		{"method not allowed", "https://app.example.com", "PATCH", "", http.StatusForbidden, nil},
+		{"header not allowed", "https://app.example.com", "PUT", "X-Secret", http.StatusForbidden, nil},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			handler := corsServer(policy, func(context.Context, interface{}) (interface{}, error) {
+				t.Error("endpoint called for preflight request")
+				return struct{}{}, nil
+			})
+			req := httptest.NewRequest("OPTIONS", "/", nil)
+			req.Header.Set("Origin", testcase.origin)
+			req.Header.Set("Access-Control-Request-Method", testcase.method)
+			if testcase.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", testcase.headers)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := testcase.wantCode, rec.Code; want != have {
+				t.Errorf("StatusCode: want %d, have %d", want, have)
+			}
+			wantHeaders := testcase.wantHeaders
+			if wantHeaders == nil {
+				wantHeaders = http.Header{"Vary": {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}}
+			}
+			if want, have := wantHeaders, rec.Header(); !reflect.DeepEqual(want, have) {
+				t.Errorf("Headers: want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestCORSPreflightHandler(t *testing.T) {
+	handler := (&httptransport.CORSPolicy{AllowedOrigins: []string{"*"}}).PreflightHandler()
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if want, have := http.StatusNoContent, rec.Code; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	if want, have := "*", rec.Header().Get("Access-Control-Allow-Origin"); want != have {
+		t.Errorf("Access-Control-Allow-Origin: want %q, have %q", want, have)
+	}
+
+	req = httptest.NewRequest("OPTIONS", "/", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if want, have := http.StatusForbidden, rec.Code; want != have {
+		t.Errorf("non-preflight StatusCode: want %d, have %d", want, have)
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	for _, testcase := range []struct {
+		name        string
+		policy      *httptransport.CORSPolicy
+		origin      string
+		err         error
+		wantHeaders http.Header
+	}{
+		{
+			name:   "any origin",
+			policy: &httptransport.CORSPolicy{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Total-Count", "ETag"}},
+			origin: "https://anywhere.example",
+			wantHeaders: http.Header{
+				"Access-Control-Allow-Origin":   {"*"},
+				"Access-Control-Expose-Headers": {"X-Total-Count, ETag"},
+			},
+		},
+		{
+			name:   "pattern alternation",
+			policy: &httptransport.CORSPolicy{AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`https://a|https://ab`)}},
+			origin: "https://ab",
+			wantHeaders: http.Header{
+				"Access-Control-Allow-Origin": {"https://ab"},
+				"Vary":                        {"Origin"},
+			},
+		},
+		{
+			name:        "pattern prefix",
+			policy:      &httptransport.CORSPolicy{AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`https://a`)}},
+			origin:      "https://ab",
+			wantHeaders: http.Header{"Vary": {"Origin"}},
+		},
+		{
+			name:   "error response",
+			policy: &httptransport.CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}},
+			origin: "https://app.example.com",
+			err:    errors.New("dang"),
+			wantHeaders: http.Header{
+				"Access-Control-Allow-Origin": {"https://app.example.com"},
+				"Vary":                        {"Origin"},
+			},
+		},
+		{
+			name:        "origin not allowed",
+			policy:      &httptransport.CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}},
+			origin:      "https://evil.com",
+			wantHeaders: http.Header{"Vary": {"Origin"}},
+		},
+		{
+			name:        "null origin",
+			policy:      &httptransport.CORSPolicy{AllowedOrigins: []string{"*"}},
+			origin:      "null",
+			wantHeaders: http.Header{"Vary": {"Origin"}},
+		},
+		{
+			name:        "same origin",
+			policy:      &httptransport.CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}},
+			wantHeaders: http.Header{"Vary": {"Origin"}},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			handler := corsServer(testcase.policy, func(context.Context, interface{}) (interface{}, error) {
+				return struct{}{}, testcase.err
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			if testcase.origin != "" {
+				req.Header.Set("Origin", testcase.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			have := rec.Header().Clone()
+			have.Del("Content-Type")
+			if want := testcase.wantHeaders; !reflect.DeepEqual(want, have) {
+				t.Errorf("Headers: want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestCORSCredentialsWithAnyOrigin(t *testing.T) {
+	policy := &httptransport.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	for name, build := range map[string]func(){
+		"ServerCORS":       func() { httptransport.ServerCORS(policy) },
+		"PreflightHandler": func() { policy.PreflightHandler() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want panic, have none", name)
+				}
+			}()
+			build()
+		}()
+	}
+}
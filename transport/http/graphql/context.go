@@ -0,0 +1,17 @@
+package graphql
+
+type contextKey int
+
+const (
+	// ContextKeyOperationName is populated in the context of field endpoints
+	// with the name of the operation, if any.
+	ContextKeyOperationName contextKey = iota
+
+	// ContextKeyOperationType is populated in the context of field endpoints
+	// with the type of the operation: "query" or "mutation".
+	ContextKeyOperationType
+
+	// ContextKeyFieldName is populated in the context of field endpoints
+	// with the name of the root field.
+	ContextKeyFieldName
+)
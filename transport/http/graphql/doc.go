@@ -0,0 +1,15 @@
+// Package graphql provides a GraphQL binding for the HTTP transport.
+//
+// The root fields of the Query and Mutation types are bound to endpoints,
+// with a FieldCodec which decodes the arguments of the field to the request
+// of the endpoint, and encodes its response to JSON. The selection set of a
+// field is then applied to that JSON: objects keep the selected members, and
+// lists have the selection applied to each of their elements. There's no
+// type system beyond that, so introspection isn't supported, and arguments
+// are only accepted on root fields.
+//
+// Errors are reported as GraphQL error objects, with their code in the
+// extensions. The occurrences of a field bound with Batch across an HTTP
+// request, including batches of operations, are loaded together by a
+// Loader, a dataloader.
+package graphql
@@ -0,0 +1,57 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Schema binds the root fields of the Query and Mutation types to endpoints.
+type Schema struct {
+	Query    FieldCodecMap
+	Mutation FieldCodecMap
+}
+
+// FieldCodecMap maps the names of root fields to their FieldCodec.
+type FieldCodecMap map[string]FieldCodec
+
+// FieldCodec defines the endpoint of a root field and its associated codecs.
+type FieldCodec struct {
+	Endpoint endpoint.Endpoint
+	Decode   DecodeArgumentsFunc
+	Encode   EncodeResultFunc
+
+	// Batch makes the occurrences of a Query field in an HTTP request load
+	// through a Loader: Endpoint is called once with a []interface{} of the
+	// requests, and must return a []interface{} of the responses, in the
+	// same order. A response which is an error fails its occurrence only.
+	// Occurrences with the same arguments are loaded once.
+	Batch bool
+}
+
+// DecodeArgumentsFunc extracts a user-domain request object from the
+// arguments of a field, as a JSON object, with variables substituted. It's
+// designed to be used in GraphQL servers, for server-side endpoints. One
+// straightforward DecodeArgumentsFunc could be something that unmarshals the
+// JSON object to the concrete request type.
+type DecodeArgumentsFunc func(context.Context, json.RawMessage) (request interface{}, err error)
+
+// EncodeResultFunc encodes the passed response object to the JSON result of
+// a field, to which the selection set of the field is applied. It's
+// designed to be used in GraphQL servers, for server-side endpoints. One
+// straightforward EncodeResultFunc could be something that JSON encodes the
+// object directly.
+type EncodeResultFunc func(context.Context, interface{}) (result json.RawMessage, err error)
+
+// NopArgumentsDecoder is a DecodeArgumentsFunc that can be used for fields
+// without arguments, and simply returns nil, nil.
+func NopArgumentsDecoder(context.Context, json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+// EncodeJSONResult is an EncodeResultFunc that serializes the response as
+// JSON.
+func EncodeJSONResult(_ context.Context, response interface{}) (json.RawMessage, error) {
+	return json.Marshal(response)
+}
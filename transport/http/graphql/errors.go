@@ -0,0 +1,109 @@
+package graphql
+
+import (
+	"encoding/json"
+)
+
+// Error is a GraphQL error object.
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Error implements error.
+func (e Error) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the code in the extensions of the error, if any.
+func (e Error) ErrorCode() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// Error codes, as used by common GraphQL servers.
+const (
+	// CodeParseFailed is the code of documents which aren't valid GraphQL.
+	CodeParseFailed = "GRAPHQL_PARSE_FAILED"
+
+	// CodeValidationFailed is the code of operations which can't be
+	// executed, like operations selecting unknown fields.
+	CodeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+
+	// CodeOperationResolutionFailure is the code of requests whose
+	// operation can't be determined.
+	CodeOperationResolutionFailure = "OPERATION_RESOLUTION_FAILURE"
+
+	// CodeBadRequest is the code of HTTP requests which aren't GraphQL
+	// requests.
+	CodeBadRequest = "BAD_REQUEST"
+
+	// CodeBadUserInput is the code of the errors returned by
+	// DecodeArgumentsFuncs, unless they implement ErrorCoder.
+	CodeBadUserInput = "BAD_USER_INPUT"
+
+	// CodeInternalServerError is the code of the other errors, unless they
+	// implement ErrorCoder.
+	CodeInternalServerError = "INTERNAL_SERVER_ERROR"
+)
+
+// ErrorCoder is checked by servers. If an error value implements ErrorCoder,
+// the result of ErrorCode() is used as the code in the extensions of the
+// GraphQL error.
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// Extensioner is checked by servers. If an error value implements
+// Extensioner, the extensions are added to the GraphQL error. The code set
+// by ErrorCoder takes precedence.
+type Extensioner interface {
+	Extensions() map[string]interface{}
+}
+
+// toError converts the error to a GraphQL error at the path. The code is
+// used unless the error implements ErrorCoder.
+func toError(err error, code string, path []interface{}, locations ...Location) Error {
+	if e, ok := err.(Error); ok {
+		if e.Path == nil {
+			e.Path = path
+		}
+		if e.Locations == nil {
+			e.Locations = locations
+		}
+		return e
+	}
+	e := Error{
+		Message:    err.Error(),
+		Locations:  locations,
+		Path:       path,
+		Extensions: map[string]interface{}{},
+	}
+	if extensioner, ok := err.(Extensioner); ok {
+		for k, v := range extensioner.Extensions() {
+			e.Extensions[k] = v
+		}
+	}
+	if coder, ok := err.(ErrorCoder); ok {
+		code = coder.ErrorCode()
+	}
+	e.Extensions["code"] = code
+	return e
+}
+
+// Request is a GraphQL request, as sent over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Response is a GraphQL response. Data is nil for requests which failed
+// before execution.
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []Error         `json:"errors,omitempty"`
+}
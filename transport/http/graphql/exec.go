@@ -0,0 +1,581 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// executor executes the GraphQL requests of an HTTP request against the
+// schema.
+type executor struct {
+	schema      Schema
+	concurrency int
+}
+
+// plan is a GraphQL request ready to be executed: its root fields are
+// validated, and their arguments decoded.
+type plan struct {
+	errors   []Error
+	serial   bool
+	vars     map[string]interface{}
+	doc      *document
+	fields   []*rootField
+	typeName string
+}
+
+type rootField struct {
+	key      string
+	field    *field
+	codec    FieldCodec
+	ctx      context.Context
+	thunk    Thunk
+	value    interface{} // for __typename
+	location Location
+}
+
+// execute executes the requests concurrently, resolving up to x.concurrency
+// root fields at once across all of them. Batched fields are loaded with a
+// Loader shared by every request; their loads are all scheduled before any
+// request is executed.
+func (x executor) execute(ctx context.Context, requests []Request, readOnly bool) []Response {
+	var (
+		loaders = map[string]*Loader{}
+		plans   = make([]*plan, len(requests))
+	)
+	for i, r := range requests {
+		plans[i] = x.prepare(ctx, r, readOnly, loaders)
+	}
+
+	// The semaphore is shared by every request, so that it bounds the
+	// number of root fields resolved at once for the whole HTTP request.
+	var (
+		responses = make([]Response, len(plans))
+		sem       = make(chan struct{}, x.concurrency)
+		wg        sync.WaitGroup
+	)
+	for i := range plans {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = plans[i].run(sem)
+		}(i)
+	}
+	wg.Wait()
+	return responses
+}
+
+func validationError(locations []Location, format string, args ...interface{}) Error {
+	return Error{
+		Message:    fmt.Sprintf(format, args...),
+		Locations:  locations,
+		Extensions: map[string]interface{}{"code": CodeValidationFailed},
+	}
+}
+
+// prepare parses and validates the request, decodes the arguments of its
+// root fields, and schedules their loads.
+func (x executor) prepare(ctx context.Context, r Request, readOnly bool, loaders map[string]*Loader) *plan {
+	p := &plan{}
+	if r.Query == "" {
+		p.errors = []Error{{Message: "GraphQL operations must contain a non-empty `query`.", Extensions: map[string]interface{}{"code": CodeBadRequest}}}
+		return p
+	}
+	doc, err := parse(r.Query)
+	if err != nil {
+		pe := err.(*parseError)
+		p.errors = []Error{{Message: pe.Error(), Locations: []Location{pe.location}, Extensions: map[string]interface{}{"code": CodeParseFailed}}}
+		return p
+	}
+	p.doc = doc
+
+	op, e := selectOperation(doc, r.OperationName)
+	if e != nil {
+		p.errors = []Error{*e}
+		return p
+	}
+
+	var fields FieldCodecMap
+	switch op.kind {
+	case "query":
+		fields, p.typeName = x.schema.Query, "Query"
+	case "mutation":
+		if readOnly {
+			p.errors = []Error{{Message: "Can only perform a mutation operation from a POST request.", Extensions: map[string]interface{}{"code": CodeBadRequest}}}
+			return p
+		}
+		fields, p.typeName, p.serial = x.schema.Mutation, "Mutation", true
+	default:
+		p.errors = []Error{validationError(nil, "Operations of type %s are not supported.", op.kind)}
+		return p
+	}
+
+	if p.errors = validate(doc, op, fields); len(p.errors) > 0 {
+		return p
+	}
+	if p.vars, p.errors = coerceVariables(op, r.Variables); len(p.errors) > 0 {
+		return p
+	}
+
+	ctx = context.WithValue(ctx, ContextKeyOperationName, op.name)
+	ctx = context.WithValue(ctx, ContextKeyOperationType, op.kind)
+	for _, group := range collectFields(doc, op.selections, p.vars) {
+		f := group[0]
+		rf := &rootField{key: f.responseKey(), field: merge(group), location: f.location}
+		p.fields = append(p.fields, rf)
+		if f.name == "__typename" {
+			rf.value = p.typeName
+			continue
+		}
+
+		rf.codec = fields[f.name]
+		rf.ctx = context.WithValue(ctx, ContextKeyFieldName, f.name)
+		args, err := json.Marshal(resolveArguments(f.arguments, p.vars))
+		if err != nil {
+			rf.thunk = failed(err)
+			continue
+		}
+		request, err := rf.codec.Decode(rf.ctx, args)
+		if err != nil {
+			e := toError(err, CodeBadUserInput, []interface{}{rf.key}, rf.location)
+			rf.thunk = failed(e)
+			continue
+		}
+
+		if rf.codec.Batch && !p.serial {
+			loader, ok := loaders[f.name]
+			if !ok {
+				loader = NewLoader(batchEndpoint(rf.codec))
+				loaders[f.name] = loader
+			}
+			rf.thunk = loader.Load(rf.ctx, string(args), request)
+			continue
+		}
+		e, fieldCtx := rf.codec.Endpoint, rf.ctx
+		if rf.codec.Batch {
+			e = unbatched(e)
+		}
+		rf.thunk = func() (interface{}, error) { return e(fieldCtx, request) }
+	}
+	return p
+}
+
+func failed(err error) Thunk {
+	return func() (interface{}, error) { return nil, err }
+}
+
+// batchEndpoint adapts the endpoint of a batched field to a BatchFunc.
+func batchEndpoint(codec FieldCodec) BatchFunc {
+	return func(ctx context.Context, requests []interface{}) ([]interface{}, error) {
+		response, err := codec.Endpoint(ctx, requests)
+		if err != nil {
+			return nil, err
+		}
+		responses, ok := response.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("batch endpoint returned %T, not []interface{}", response)
+		}
+		return responses, nil
+	}
+}
+
+// unbatched adapts the endpoint of a batched field to a single request, for
+// mutations, which are executed one at a time.
+func unbatched(e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		responses, err := batchEndpoint(FieldCodec{Endpoint: e})(ctx, []interface{}{request})
+		if err != nil {
+			return nil, err
+		}
+		if len(responses) != 1 {
+			return nil, fmt.Errorf("batch returned %d responses for 1 request", len(responses))
+		}
+		if err, ok := responses[0].(error); ok {
+			return nil, err
+		}
+		return responses[0], nil
+	}
+}
+
+func selectOperation(doc *document, name string) (*operation, *Error) {
+	fail := func(format string, args ...interface{}) (*operation, *Error) {
+		return nil, &Error{Message: fmt.Sprintf(format, args...), Extensions: map[string]interface{}{"code": CodeOperationResolutionFailure}}
+	}
+	if len(doc.operations) == 0 {
+		return fail("Must provide an operation.")
+	}
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return fail("Must provide operation name if query contains multiple operations.")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return fail("Unknown operation named %q.", name)
+}
+
+// validate checks that the root fields exist, and that the fragments,
+// directives and variables used by the operation are defined.
+func validate(doc *document, op *operation, fields FieldCodecMap) []Error {
+	var (
+		errs      []Error
+		variables = map[string]bool{}
+		visited   = map[string]bool{}
+	)
+	for _, def := range op.variables {
+		if variables[def.name] {
+			errs = append(errs, validationError(nil, "There can be only one variable named \"$%s\".", def.name))
+		}
+		variables[def.name] = true
+	}
+	var checkValue func(v interface{})
+	checkValue = func(v interface{}) {
+		switch v := v.(type) {
+		case variable:
+			if !variables[string(v)] {
+				errs = append(errs, validationError(nil, "Variable \"$%s\" is not defined.", v))
+			}
+		case []interface{}:
+			for _, item := range v {
+				checkValue(item)
+			}
+		case []objectField:
+			for _, f := range v {
+				checkValue(f.value)
+			}
+		}
+	}
+	checkDirectives := func(directives []directive) {
+		for _, d := range directives {
+			if d.name != "skip" && d.name != "include" {
+				errs = append(errs, validationError(nil, "Unknown directive \"@%s\".", d.name))
+			}
+			for _, arg := range d.arguments {
+				checkValue(arg.value)
+			}
+		}
+	}
+	var walk func(selections []selection, root bool)
+	walk = func(selections []selection, root bool) {
+		for _, s := range selections {
+			switch s := s.(type) {
+			case *field:
+				checkDirectives(s.directives)
+				for _, arg := range s.arguments {
+					checkValue(arg.value)
+				}
+				switch {
+				case s.name == "__schema" || s.name == "__type":
+					errs = append(errs, validationError([]Location{s.location}, "Introspection is not supported."))
+				case root && s.name != "__typename":
+					if _, ok := fields[s.name]; !ok {
+						typeName := "Query"
+						if op.kind == "mutation" {
+							typeName = "Mutation"
+						}
+						errs = append(errs, validationError([]Location{s.location}, "Cannot query field %q on type %q.", s.name, typeName))
+					}
+				case !root && len(s.arguments) > 0:
+					errs = append(errs, validationError([]Location{s.location}, "Arguments are only supported on root fields, not on %q.", s.name))
+				}
+				walk(s.selections, false)
+			case *inlineFragment:
+				checkDirectives(s.directives)
+				walk(s.selections, root)
+			case *fragmentSpread:
+				checkDirectives(s.directives)
+				f, ok := doc.fragments[s.name]
+				if !ok {
+					errs = append(errs, validationError(nil, "Unknown fragment %q.", s.name))
+					continue
+				}
+				if visited[s.name] {
+					continue
+				}
+				visited[s.name] = true
+				checkDirectives(f.directives)
+				walk(f.selections, root)
+			}
+		}
+	}
+	checkDirectives(op.directives)
+	walk(op.selections, true)
+	return errs
+}
+
+// coerceVariables returns the values of the variables of the operation,
+// with their defaults.
+func coerceVariables(op *operation, values map[string]interface{}) (map[string]interface{}, []Error) {
+	var (
+		vars = map[string]interface{}{}
+		errs []Error
+	)
+	for _, def := range op.variables {
+		v, ok := values[def.name]
+		switch {
+		case !ok && def.hasDefault:
+			vars[def.name] = resolveValue(def.defaultValue, nil)
+		case (!ok || v == nil) && def.nonNull:
+			errs = append(errs, Error{
+				Message:    fmt.Sprintf("Variable \"$%s\" of required type %q was not provided.", def.name, def.typ),
+				Extensions: map[string]interface{}{"code": CodeBadUserInput},
+			})
+		case ok:
+			vars[def.name] = v
+		}
+	}
+	return vars, errs
+}
+
+// resolveValue converts a parsed value to its JSON form, substituting
+// variables.
+func resolveValue(v interface{}, vars map[string]interface{}) interface{} {
+	switch v := v.(type) {
+	case variable:
+		return vars[string(v)]
+	case enumValue:
+		return string(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = resolveValue(item, vars)
+		}
+		return list
+	case []objectField:
+		object := make(map[string]interface{}, len(v))
+		for _, f := range v {
+			if name, ok := f.value.(variable); ok {
+				if _, provided := vars[string(name)]; !provided {
+					continue
+				}
+			}
+			object[f.name] = resolveValue(f.value, vars)
+		}
+		return object
+	default:
+		return v
+	}
+}
+
+// resolveArguments returns the arguments as a JSON object. Arguments set to
+// variables which weren't provided are left out.
+func resolveArguments(args []argument, vars map[string]interface{}) map[string]interface{} {
+	fields := make([]objectField, len(args))
+	for i, arg := range args {
+		fields[i] = objectField{name: arg.name, value: arg.value}
+	}
+	return resolveValue(fields, vars).(map[string]interface{})
+}
+
+// collectFields returns the fields of the selection set, grouped by response
+// key, in order. Fragments are expanded, and fields are skipped or included
+// according to their directives.
+func collectFields(doc *document, selections []selection, vars map[string]interface{}) [][]*field {
+	var (
+		groups  [][]*field
+		index   = map[string]int{}
+		visited = map[string]bool{}
+	)
+	var collect func(selections []selection)
+	collect = func(selections []selection) {
+		for _, s := range selections {
+			switch s := s.(type) {
+			case *field:
+				if !included(s.directives, vars) {
+					continue
+				}
+				key := s.responseKey()
+				if i, ok := index[key]; ok {
+					groups[i] = append(groups[i], s)
+					continue
+				}
+				index[key] = len(groups)
+				groups = append(groups, []*field{s})
+			case *inlineFragment:
+				if included(s.directives, vars) {
+					collect(s.selections)
+				}
+			case *fragmentSpread:
+				if visited[s.name] || !included(s.directives, vars) {
+					continue
+				}
+				visited[s.name] = true
+				if f, ok := doc.fragments[s.name]; ok && included(f.directives, vars) {
+					collect(f.selections)
+				}
+			}
+		}
+	}
+	collect(selections)
+	return groups
+}
+
+// included reports whether the directives @skip and @include let the
+// selection in.
+func included(directives []directive, vars map[string]interface{}) bool {
+	for _, d := range directives {
+		for _, arg := range d.arguments {
+			if arg.name != "if" {
+				continue
+			}
+			condition, _ := resolveValue(arg.value, vars).(bool)
+			if d.name == "skip" && condition || d.name == "include" && !condition {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// merge returns the first field of the group, with the selections of every
+// field of the group.
+func merge(group []*field) *field {
+	if len(group) == 1 {
+		return group[0]
+	}
+	merged := *group[0]
+	merged.selections = nil
+	for _, f := range group {
+		merged.selections = append(merged.selections, f.selections...)
+	}
+	return &merged
+}
+
+// run resolves the root fields, concurrently for queries and one at a time
+// for mutations, each holding a slot of sem while it's resolved, and returns
+// the response.
+func (p *plan) run(sem chan struct{}) Response {
+	if len(p.errors) > 0 {
+		return Response{Errors: p.errors}
+	}
+
+	var (
+		values = make([]interface{}, len(p.fields))
+		errs   = make([][]Error, len(p.fields))
+		wg     sync.WaitGroup
+	)
+	for i, rf := range p.fields {
+		if rf.thunk == nil {
+			values[i] = rf.value
+			continue
+		}
+		if p.serial {
+			sem <- struct{}{}
+			values[i], errs[i] = p.resolve(rf)
+			<-sem
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, rf *rootField) {
+			defer func() { <-sem; wg.Done() }()
+			values[i], errs[i] = p.resolve(rf)
+		}(i, rf)
+	}
+	wg.Wait()
+
+	var response Response
+	data := make(orderedObject, len(p.fields))
+	for i, rf := range p.fields {
+		data[i] = orderedMember{key: rf.key, value: values[i]}
+		response.Errors = append(response.Errors, errs[i]...)
+	}
+	response.Data, _ = json.Marshal(data)
+	return response
+}
+
+// resolve loads the value of the root field, encodes it, and applies the
+// selection set of the field to it.
+func (p *plan) resolve(rf *rootField) (interface{}, []Error) {
+	path := []interface{}{rf.key}
+	response, err := rf.thunk()
+	if err != nil {
+		return nil, []Error{toError(err, CodeInternalServerError, path, rf.location)}
+	}
+	raw, err := rf.codec.Encode(rf.ctx, response)
+	if err != nil {
+		return nil, []Error{toError(err, CodeInternalServerError, path, rf.location)}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var result interface{}
+	if err := dec.Decode(&result); err != nil {
+		return nil, []Error{toError(err, CodeInternalServerError, path, rf.location)}
+	}
+	var errs []Error
+	value := p.project(result, rf.field, path, &errs)
+	return value, errs
+}
+
+// project applies the selection set of the field to its JSON value.
+func (p *plan) project(value interface{}, f *field, path []interface{}, errs *[]Error) interface{} {
+	if f.selections == nil || value == nil {
+		return value
+	}
+	switch value := value.(type) {
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = p.project(item, f, append(path[:len(path):len(path)], i), errs)
+		}
+		return list
+	case map[string]interface{}:
+		groups := collectFields(p.doc, f.selections, p.vars)
+		object := make(orderedObject, len(groups))
+		for i, group := range groups {
+			sub := merge(group)
+			key := sub.responseKey()
+			object[i] = orderedMember{
+				key:   key,
+				value: p.project(value[sub.name], sub, append(path[:len(path):len(path)], key), errs),
+			}
+		}
+		return object
+	default:
+		*errs = append(*errs, Error{
+			Message:    fmt.Sprintf("Field %q is a scalar, and can't have a selection set.", f.name),
+			Locations:  []Location{f.location},
+			Path:       path,
+			Extensions: map[string]interface{}{"code": CodeInternalServerError},
+		})
+		return nil
+	}
+}
+
+// orderedObject is a JSON object which keeps the order of its members, as
+// GraphQL responses follow the order of the selection set.
+type orderedObject []orderedMember
+
+type orderedMember struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchFunc loads the responses of a batch of requests, in the same order. A
+// response which is an error fails its request only.
+type BatchFunc func(ctx context.Context, requests []interface{}) ([]interface{}, error)
+
+// Thunk returns the response of a load, once loaded.
+type Thunk func() (interface{}, error)
+
+// Loader is a dataloader. It batches the requests loaded until one of their
+// thunks is called, and caches the responses by key. Servers use a new
+// Loader for each batched field, in each HTTP request.
+type Loader struct {
+	batch BatchFunc
+
+	mtx     sync.Mutex
+	ctx     context.Context
+	cache   map[string]*load
+	pending []*load
+}
+
+type load struct {
+	request  interface{}
+	done     chan struct{}
+	response interface{}
+	err      error
+}
+
+// NewLoader returns a Loader loading batches with the BatchFunc.
+func NewLoader(batch BatchFunc) *Loader {
+	return &Loader{batch: batch, cache: map[string]*load{}}
+}
+
+// Load adds the request to the next batch, unless a request with the same key
+// was loaded already, and returns the thunk of its response. Batches are
+// loaded with the context of their first request.
+func (l *Loader) Load(ctx context.Context, key string, request interface{}) Thunk {
+	l.mtx.Lock()
+	ld, ok := l.cache[key]
+	if !ok {
+		ld = &load{request: request, done: make(chan struct{})}
+		l.cache[key] = ld
+		if len(l.pending) == 0 {
+			l.ctx = ctx
+		}
+		l.pending = append(l.pending, ld)
+	}
+	l.mtx.Unlock()
+
+	return func() (interface{}, error) {
+		l.dispatch()
+		<-ld.done
+		return ld.response, ld.err
+	}
+}
+
+// dispatch loads the pending batch, if any.
+func (l *Loader) dispatch() {
+	l.mtx.Lock()
+	ctx, pending := l.ctx, l.pending
+	l.ctx, l.pending = nil, nil
+	l.mtx.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	requests := make([]interface{}, len(pending))
+	for i, ld := range pending {
+		requests[i] = ld.request
+	}
+	responses, err := l.batch(ctx, requests)
+	if err == nil && len(responses) != len(requests) {
+		err = fmt.Errorf("batch returned %d responses for %d requests", len(responses), len(requests))
+	}
+	for i, ld := range pending {
+		switch {
+		case err != nil:
+			ld.err = err
+		default:
+			if e, ok := responses[i].(error); ok {
+				ld.err = e
+			} else {
+				ld.response = responses[i]
+			}
+		}
+		close(ld.done)
+	}
+}
@@ -0,0 +1,78 @@
+package graphql_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/transport/http/graphql"
+)
+
+func TestLoader(t *testing.T) {
+	var batches [][]interface{}
+	l := graphql.NewLoader(func(_ context.Context, requests []interface{}) ([]interface{}, error) {
+		batches = append(batches, requests)
+		responses := make([]interface{}, len(requests))
+		for i, request := range requests {
+			if request == "bad" {
+				responses[i] = errors.New("bad request")
+				continue
+			}
+			responses[i] = request.(string) + "!"
+		}
+		return responses, nil
+	})
+
+	ctx := context.Background()
+	a := l.Load(ctx, "a", "a")
+	bad := l.Load(ctx, "bad", "bad")
+	again := l.Load(ctx, "a", "a")
+	b := l.Load(ctx, "b", "b")
+
+	for _, testcase := range []struct {
+		thunk    graphql.Thunk
+		response interface{}
+		err      string
+	}{
+		{a, "a!", ""},
+		{bad, nil, "bad request"},
+		{again, "a!", ""},
+		{b, "b!", ""},
+	} {
+		response, err := testcase.thunk()
+		if want, have := testcase.response, response; want != have {
+			t.Errorf("response: want %v, have %v", want, have)
+		}
+		if err != nil && err.Error() != testcase.err || err == nil && testcase.err != "" {
+			t.Errorf("error: want %q, have %v", testcase.err, err)
+		}
+	}
+	if want, have := [][]interface{}{{"a", "bad", "b"}}, batches; !reflect.DeepEqual(want, have) {
+		t.Errorf("batches: want %v, have %v", want, have)
+	}
+
+	// Loads after a dispatch go in the next batch, and cached keys aren't
+	// loaded again.
+	c := l.Load(ctx, "c", "c")
+	l.Load(ctx, "a", "a")
+	if response, _ := c(); response != "c!" {
+		t.Errorf("want c!, have %v", response)
+	}
+	if want, have := [][]interface{}{{"a", "bad", "b"}, {"c"}}, batches; !reflect.DeepEqual(want, have) {
+		t.Errorf("batches: want %v, have %v", want, have)
+	}
+}
+
+func TestLoaderBatchError(t *testing.T) {
+	l := graphql.NewLoader(func(context.Context, []interface{}) ([]interface{}, error) {
+		return []interface{}{1}, nil
+	})
+	ctx := context.Background()
+	a, b := l.Load(ctx, "a", 1), l.Load(ctx, "b", 2)
+	for _, thunk := range []graphql.Thunk{a, b} {
+		if _, err := thunk(); err == nil {
+			t.Error("want error for a mismatched batch, have none")
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The parser covers the executable definitions of the GraphQL grammar:
+// operations, fragments, variables, arguments and directives. Type system
+// definitions are rejected.
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []variableDefinition
+	directives []directive
+	selections []selection
+}
+
+type variableDefinition struct {
+	name         string
+	typ          string
+	nonNull      bool
+	defaultValue interface{}
+	hasDefault   bool
+}
+
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []argument
+	directives []directive
+	selections []selection
+	location   Location
+}
+
+// responseKey is the key of the field in the response.
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []directive
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []directive
+	selections    []selection
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []directive
+	selections    []selection
+}
+
+type argument struct {
+	name  string
+	value interface{}
+}
+
+type directive struct {
+	name      string
+	arguments []argument
+}
+
+// Values are parsed into nil, bool, json.Number, string, enumValue,
+// variable, []interface{} and []objectField.
+type (
+	variable    string
+	enumValue   string
+	objectField struct {
+		name  string
+		value interface{}
+	}
+)
+
+// Location is a position in a GraphQL document, starting at 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind     tokenKind
+	value    string
+	location Location
+}
+
+type parser struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+	tok       token
+	depth     int
+}
+
+// maxDepth is the maximum nesting of selection sets and values in a
+// document. The parser and the executor recurse over that nesting, so deeper
+// documents are rejected rather than overflowing the stack.
+const maxDepth = 128
+
+// parseError is returned for documents which aren't valid GraphQL.
+type parseError struct {
+	message  string
+	location Location
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("Syntax Error: %s (%d:%d)", e.message, e.location.Line, e.location.Column)
+}
+
+func parse(src string) (doc *document, err error) {
+	p := &parser{src: src, line: 1}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(*parseError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, pe
+		}
+	}()
+	p.next()
+	return p.parseDocument(), nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&parseError{message: fmt.Sprintf(format, args...), location: p.tok.location})
+}
+
+// enter records a level of nesting, failing past maxDepth. It returns leave,
+// to be deferred.
+func (p *parser) enter() func() {
+	if p.depth++; p.depth > maxDepth {
+		p.fail("Document exceeds the maximum nesting depth of %d", maxDepth)
+	}
+	return p.leave
+}
+
+func (p *parser) leave() { p.depth-- }
+
+func (p *parser) location() Location {
+	return Location{Line: p.line, Column: p.pos - p.lineStart + 1}
+}
+
+// next scans the next token, skipping whitespace, commas and comments.
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.pos++
+			p.line++
+			p.lineStart = p.pos
+		case c == '\r':
+			p.pos++
+			if p.pos < len(p.src) && p.src[p.pos] == '\n' {
+				p.pos++
+			}
+			p.line++
+			p.lineStart = p.pos
+		case c == ' ' || c == '\t' || c == ',':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "\ufeff"):
+			p.pos += len("\ufeff")
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			p.scan()
+			return
+		}
+	}
+	p.tok = token{kind: tokenEOF, location: p.location()}
+}
+
+func (p *parser) scan() {
+	start := p.pos
+	p.tok = token{location: p.location()}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok.kind, p.tok.value = tokenPunctuator, "..."
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		p.pos++
+		p.tok.kind, p.tok.value = tokenPunctuator, string(c)
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok.kind, p.tok.value = tokenName, p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		p.scanNumber()
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		p.scanBlockString()
+	case c == '"':
+		p.scanString()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.fail("Unexpected character %q", r)
+	}
+}
+
+func (p *parser) scanNumber() {
+	start := p.pos
+	p.tok.kind = tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		n := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == n {
+			p.fail("Invalid number %q", p.src[start:p.pos])
+		}
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '0' {
+		p.pos++
+		if p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.fail("Invalid number, unexpected digit after 0")
+		}
+	} else {
+		digits()
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		p.tok.kind = tokenFloat
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		p.tok.kind = tokenFloat
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || p.src[p.pos] == '.') {
+		p.fail("Invalid number %q", p.src[start:p.pos+1])
+	}
+	p.tok.value = p.src[start:p.pos]
+}
+
+func (p *parser) scanString() {
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			p.fail("Unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			p.tok.kind, p.tok.value = tokenString, b.String()
+			return
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				p.fail("Unterminated string")
+			}
+			esc := p.src[p.pos+1]
+			p.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.fail("Invalid unicode escape sequence")
+				}
+				n, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.fail("Invalid unicode escape sequence %q", p.src[p.pos-2:p.pos+4])
+				}
+				p.pos += 4
+				b.WriteRune(rune(n))
+			default:
+				p.fail("Invalid escape sequence %q", p.src[p.pos-2:p.pos])
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) scanBlockString() {
+	p.pos += 3
+	var b strings.Builder
+	for {
+		switch {
+		case p.pos >= len(p.src):
+			p.fail("Unterminated string")
+		case strings.HasPrefix(p.src[p.pos:], `"""`):
+			p.pos += 3
+			p.tok.kind, p.tok.value = tokenString, blockStringValue(b.String())
+			return
+		case strings.HasPrefix(p.src[p.pos:], `\"""`):
+			b.WriteString(`"""`)
+			p.pos += 4
+		default:
+			if p.src[p.pos] == '\n' {
+				p.line++
+				p.lineStart = p.pos + 1
+			}
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+	}
+}
+
+// blockStringValue removes the common indentation, and the leading and
+// trailing blank lines, of a block string.
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(raw), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+func (p *parser) peek(punctuator string) bool {
+	return p.tok.kind == tokenPunctuator && p.tok.value == punctuator
+}
+
+func (p *parser) skip(punctuator string) bool {
+	if p.peek(punctuator) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punctuator string) {
+	if !p.skip(punctuator) {
+		p.fail("Expected %q, found %s", punctuator, p.describe())
+	}
+}
+
+func (p *parser) describe() string {
+	switch p.tok.kind {
+	case tokenEOF:
+		return "<EOF>"
+	case tokenString:
+		return strconv.Quote(p.tok.value)
+	default:
+		return fmt.Sprintf("%q", p.tok.value)
+	}
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokenName {
+		p.fail("Expected Name, found %s", p.describe())
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+func (p *parser) parseDocument() *document {
+	doc := &document{fragments: map[string]*fragment{}}
+	if p.tok.kind == tokenEOF {
+		p.fail("Unexpected <EOF>")
+	}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek("{"):
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: p.parseSelectionSet()})
+		case p.tok.kind == tokenName && p.tok.value == "fragment":
+			f := p.parseFragment()
+			if _, ok := doc.fragments[f.name]; ok {
+				p.fail("There can be only one fragment named %q", f.name)
+			}
+			doc.fragments[f.name] = f
+		case p.tok.kind == tokenName && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			doc.operations = append(doc.operations, p.parseOperation())
+		default:
+			p.fail("Unexpected %s", p.describe())
+		}
+	}
+	return doc
+}
+
+func (p *parser) parseOperation() *operation {
+	op := &operation{kind: p.name()}
+	if p.tok.kind == tokenName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			op.variables = append(op.variables, p.parseVariableDefinition())
+		}
+	}
+	op.directives = p.parseDirectives(false)
+	op.selections = p.parseSelectionSet()
+	return op
+}
+
+func (p *parser) parseVariableDefinition() variableDefinition {
+	p.expect("$")
+	def := variableDefinition{name: p.name()}
+	p.expect(":")
+	def.typ = p.parseType()
+	def.nonNull = strings.HasSuffix(def.typ, "!")
+	if p.skip("=") {
+		def.defaultValue = p.parseValue(true)
+		def.hasDefault = true
+	}
+	p.parseDirectives(true)
+	return def
+}
+
+func (p *parser) parseType() string {
+	var typ string
+	if p.skip("[") {
+		typ = "[" + p.parseType() + "]"
+		p.expect("]")
+	} else {
+		typ = p.name()
+	}
+	if p.skip("!") {
+		typ += "!"
+	}
+	return typ
+}
+
+func (p *parser) parseFragment() *fragment {
+	p.next()
+	f := &fragment{}
+	if f.name = p.name(); f.name == "on" {
+		p.fail("Unexpected Name \"on\"")
+	}
+	if p.tok.kind != tokenName || p.tok.value != "on" {
+		p.fail("Expected \"on\", found %s", p.describe())
+	}
+	p.next()
+	f.typeCondition = p.name()
+	f.directives = p.parseDirectives(false)
+	f.selections = p.parseSelectionSet()
+	return f
+}
+
+func (p *parser) parseSelectionSet() []selection {
+	defer p.enter()()
+	p.expect("{")
+	var selections []selection
+	for !p.skip("}") {
+		if p.tok.kind == tokenEOF {
+			p.fail("Expected Name, found <EOF>")
+		}
+		selections = append(selections, p.parseSelection())
+	}
+	if len(selections) == 0 {
+		p.fail("Selection sets must not be empty")
+	}
+	return selections
+}
+
+func (p *parser) parseSelection() selection {
+	if !p.skip("...") {
+		return p.parseField()
+	}
+	if p.tok.kind == tokenName && p.tok.value != "on" {
+		return &fragmentSpread{name: p.name(), directives: p.parseDirectives(false)}
+	}
+	f := &inlineFragment{}
+	if p.tok.kind == tokenName {
+		p.next()
+		f.typeCondition = p.name()
+	}
+	f.directives = p.parseDirectives(false)
+	f.selections = p.parseSelectionSet()
+	return f
+}
+
+func (p *parser) parseField() *field {
+	f := &field{location: p.tok.location}
+	f.name = p.name()
+	if p.skip(":") {
+		f.alias, f.name = f.name, p.name()
+	}
+	f.arguments = p.parseArguments(false)
+	f.directives = p.parseDirectives(false)
+	if p.peek("{") {
+		f.selections = p.parseSelectionSet()
+	}
+	return f
+}
+
+func (p *parser) parseArguments(constant bool) []argument {
+	if !p.skip("(") {
+		return nil
+	}
+	var args []argument
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		args = append(args, argument{name: name, value: p.parseValue(constant)})
+	}
+	return args
+}
+
+func (p *parser) parseDirectives(constant bool) []directive {
+	var directives []directive
+	for p.skip("@") {
+		name := p.name()
+		directives = append(directives, directive{name: name, arguments: p.parseArguments(constant)})
+	}
+	return directives
+}
+
+func (p *parser) parseValue(constant bool) interface{} {
+	tok := p.tok
+	switch tok.kind {
+	case tokenPunctuator:
+		switch tok.value {
+		case "$":
+			if constant {
+				p.fail("Unexpected variable in constant value")
+			}
+			p.next()
+			return variable(p.name())
+		case "[":
+			defer p.enter()()
+			p.next()
+			list := []interface{}{}
+			for !p.skip("]") {
+				if p.tok.kind == tokenEOF {
+					p.fail("Expected \"]\", found <EOF>")
+				}
+				list = append(list, p.parseValue(constant))
+			}
+			return list
+		case "{":
+			defer p.enter()()
+			p.next()
+			object := []objectField{}
+			for !p.skip("}") {
+				name := p.name()
+				p.expect(":")
+				object = append(object, objectField{name: name, value: p.parseValue(constant)})
+			}
+			return object
+		}
+	case tokenInt, tokenFloat:
+		p.next()
+		return json.Number(tok.value)
+	case tokenString:
+		p.next()
+		return tok.value
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		default:
+			return enumValue(tok.value)
+		}
+	}
+	p.fail("Unexpected %s", p.describe())
+	return nil
+}
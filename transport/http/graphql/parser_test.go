@@ -0,0 +1,116 @@
+package graphql
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		# A query.
+		query Users($first: Int = 10, $after: String!) @live {
+			list: users(first: $first, after: $after, filter: {role: ADMIN, tags: ["a", "b"]}) {
+				id
+				...Name @include(if: true)
+				... on User { email }
+			}
+		}
+
+		fragment Name on User { name }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(doc.operations); want != have {
+		t.Fatalf("operations: want %d, have %d", want, have)
+	}
+	op := doc.operations[0]
+	if want, have := "query Users", op.kind+" "+op.name; want != have {
+		t.Errorf("operation: want %q, have %q", want, have)
+	}
+	if want, have := []variableDefinition{
+		{name: "first", typ: "Int", defaultValue: json.Number("10"), hasDefault: true},
+		{name: "after", typ: "String!", nonNull: true},
+	}, op.variables; !reflect.DeepEqual(want, have) {
+		t.Errorf("variables: want %+v, have %+v", want, have)
+	}
+	if want, have := []directive{{name: "live"}}, op.directives; !reflect.DeepEqual(want, have) {
+		t.Errorf("directives: want %+v, have %+v", want, have)
+	}
+
+	f := op.selections[0].(*field)
+	if want, have := "list", f.responseKey(); want != have {
+		t.Errorf("response key: want %q, have %q", want, have)
+	}
+	if want, have := (Location{Line: 4, Column: 4}), f.location; want != have {
+		t.Errorf("location: want %+v, have %+v", want, have)
+	}
+	if want, have := []argument{
+		{name: "first", value: variable("first")},
+		{name: "after", value: variable("after")},
+		{name: "filter", value: []objectField{
+			{name: "role", value: enumValue("ADMIN")},
+			{name: "tags", value: []interface{}{"a", "b"}},
+		}},
+	}, f.arguments; !reflect.DeepEqual(want, have) {
+		t.Errorf("arguments: want %+v, have %+v", want, have)
+	}
+	if want, have := 3, len(f.selections); want != have {
+		t.Fatalf("selections: want %d, have %d", want, have)
+	}
+	if spread, ok := f.selections[1].(*fragmentSpread); !ok || spread.name != "Name" || len(spread.directives) != 1 {
+		t.Errorf("fragment spread: have %+v", f.selections[1])
+	}
+	if inline, ok := f.selections[2].(*inlineFragment); !ok || inline.typeCondition != "User" {
+		t.Errorf("inline fragment: have %+v", f.selections[2])
+	}
+	if fragment, ok := doc.fragments["Name"]; !ok || fragment.typeCondition != "User" {
+		t.Errorf("fragment: have %+v", doc.fragments)
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := parse(`{ a: hello(text: "é\n", block: """
+		  two
+		    lines
+		""") }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := doc.operations[0]
+	if want, have := "query", op.kind; want != have {
+		t.Errorf("kind: want %q, have %q", want, have)
+	}
+	args := op.selections[0].(*field).arguments
+	if want, have := "é\n", args[0].value; want != have {
+		t.Errorf("string: want %q, have %q", want, have)
+	}
+	if want, have := "two\n  lines", args[1].value; want != have {
+		t.Errorf("block string: want %q, have %q", want, have)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`{ a `:                         "Syntax Error: Expected Name, found <EOF> (1:5)",
+		`{ a(x: $v) }`:                 "",
+		`query ($v: Int = $w) { a }`:   "Syntax Error:",
+		`type Query { a: Int }`:        "Syntax Error:",
+		`{ a(x: 1.) }`:                 "Syntax Error:",
+		`{ a(x: "open) }`:              "Syntax Error:",
+		`{ a } fragment on on T { a }`: "Syntax Error:",
+		``:                             "Syntax Error:",
+	} {
+		_, err := parse(src)
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("%s: want no error, have %v", src, err)
+		case want != "" && err == nil:
+			t.Errorf("%s: want error, have none", src)
+		case want != "" && !strings.HasPrefix(err.Error(), want):
+			t.Errorf("%s: want %q, have %q", src, want, err)
+		}
+	}
+}
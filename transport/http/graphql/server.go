@@ -0,0 +1,244 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// DefaultMaxBodySize is the size of the largest request body a Server
+// reads, unless ServerMaxBodySize is used.
+const DefaultMaxBodySize = 1 << 20
+
+// DefaultBatchConcurrency is the number of root fields that a Server
+// resolves concurrently for each HTTP request, across the operations of a
+// batch, unless ServerBatchConcurrency is used.
+const DefaultBatchConcurrency = 8
+
+// Server executes GraphQL requests against a schema, and implements
+// http.Handler.
+//
+// Requests are accepted as POST, with an application/json body holding a
+// request or an array of requests, or an application/graphql body holding
+// the query, and as GET, with the query, operationName, variables and
+// extensions query parameters. Mutations aren't allowed over GET.
+type Server struct {
+	handler *httptransport.Server
+
+	options          []httptransport.ServerOption
+	maxBodySize      int64
+	batchMaxSize     int
+	batchConcurrency int
+}
+
+// NewServer constructs a new server, which implements http.Handler and
+// executes GraphQL requests against the schema.
+func NewServer(schema Schema, options ...ServerOption) *Server {
+	s := &Server{
+		options:          []httptransport.ServerOption{httptransport.ServerErrorEncoder(DefaultErrorEncoder)},
+		maxBodySize:      DefaultMaxBodySize,
+		batchConcurrency: DefaultBatchConcurrency,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.handler = httptransport.NewServer(
+		makeExecutorEndpoint(executor{schema: schema, concurrency: s.batchConcurrency}),
+		s.decodeHTTPRequest,
+		encodeHTTPResponse,
+		s.options...,
+	)
+	return s
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(*Server)
+
+// ServerHTTPOptions sets options of the underlying transport/http Server,
+// such as ServerBefore, ServerFinalizer, ServerCORS or ServerCompression. By
+// default, errors are encoded with the DefaultErrorEncoder.
+func ServerHTTPOptions(options ...httptransport.ServerOption) ServerOption {
+	return func(s *Server) { s.options = append(s.options, options...) }
+}
+
+// ServerMaxBodySize sets the size of the largest request body, in bytes.
+// Larger requests are rejected with StatusRequestEntityTooLarge (413). By
+// default, DefaultMaxBodySize is used.
+func ServerMaxBodySize(n int64) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxBodySize = n
+		}
+	}
+}
+
+// ServerBatchMaxSize sets the maximum number of operations in a batch.
+// Larger batches are rejected as a whole with StatusBadRequest (400). By
+// default, batches may be of any size the body size allows.
+func ServerBatchMaxSize(n int) ServerOption {
+	return func(s *Server) { s.batchMaxSize = n }
+}
+
+// ServerBatchConcurrency sets the maximum number of root fields resolved
+// concurrently for each HTTP request, across the operations of a batch, and
+// thus of their endpoints invoked concurrently. By default,
+// DefaultBatchConcurrency is used.
+func ServerBatchConcurrency(n int) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.batchConcurrency = n
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// httpRequest holds the GraphQL requests of an HTTP request.
+type httpRequest struct {
+	requests []Request
+	batch    bool
+	readOnly bool
+}
+
+// httpResponse holds the GraphQL responses to an HTTP request.
+type httpResponse struct {
+	responses []Response
+	batch     bool
+}
+
+func makeExecutorEndpoint(x executor) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(httpRequest)
+		return httpResponse{
+			responses: x.execute(ctx, req.requests, req.readOnly),
+			batch:     req.batch,
+		}, nil
+	}
+}
+
+// requestError is returned for HTTP requests which aren't GraphQL requests.
+type requestError struct {
+	message string
+	status  int
+}
+
+func (e requestError) Error() string     { return e.message }
+func (e requestError) StatusCode() int   { return e.status }
+func (e requestError) ErrorCode() string { return CodeBadRequest }
+
+func badRequest(message string) error {
+	return requestError{message: message, status: http.StatusBadRequest}
+}
+
+func (s Server) decodeHTTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req := Request{Query: q.Get("query"), OperationName: q.Get("operationName")}
+		for name, v := range map[string]*map[string]interface{}{
+			"variables":  &req.Variables,
+			"extensions": &req.Extensions,
+		} {
+			if s := q.Get(name); s != "" {
+				if err := unmarshal([]byte(s), v); err != nil {
+					return nil, badRequest(name + " must be a JSON object: " + err.Error())
+				}
+			}
+		}
+		return httpRequest{requests: []Request{req}, readOnly: true}, nil
+
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, s.maxBodySize+1))
+		if err != nil {
+			return nil, badRequest(err.Error())
+		}
+		if int64(len(body)) > s.maxBodySize {
+			return nil, requestError{
+				message: fmt.Sprintf("request body must not be larger than %d bytes", s.maxBodySize),
+				status:  http.StatusRequestEntityTooLarge,
+			}
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "application/graphql":
+			return httpRequest{requests: []Request{{Query: string(body)}}}, nil
+		case "application/json", "":
+			body = bytes.TrimSpace(body)
+			if len(body) > 0 && body[0] == '[' {
+				var requests []Request
+				if err := unmarshal(body, &requests); err != nil {
+					return nil, badRequest("invalid JSON body: " + err.Error())
+				}
+				if len(requests) == 0 {
+					return nil, badRequest("empty batch")
+				}
+				if s.batchMaxSize > 0 && len(requests) > s.batchMaxSize {
+					return nil, badRequest(fmt.Sprintf("batch must not contain more than %d operations", s.batchMaxSize))
+				}
+				return httpRequest{requests: requests, batch: true}, nil
+			}
+			var req Request
+			if err := unmarshal(body, &req); err != nil {
+				return nil, badRequest("invalid JSON body: " + err.Error())
+			}
+			return httpRequest{requests: []Request{req}}, nil
+		default:
+			return nil, requestError{message: "unsupported content type " + mediaType, status: http.StatusUnsupportedMediaType}
+		}
+
+	default:
+		return nil, requestError{message: "GraphQL only supports GET and POST requests", status: http.StatusMethodNotAllowed}
+	}
+}
+
+// unmarshal decodes JSON with numbers kept as json.Number, so that they're
+// passed to DecodeArgumentsFuncs as sent.
+func unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func encodeHTTPResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(httpResponse)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if resp.batch {
+		return json.NewEncoder(w).Encode(resp.responses)
+	}
+	return json.NewEncoder(w).Encode(resp.responses[0])
+}
+
+// DefaultErrorEncoder writes the error to the ResponseWriter as a GraphQL
+// response with a single error, with a status code of 500 by default. It's
+// used for the errors of HTTP requests which can't be executed, and of the
+// ServerBefore and ServerAfter funcs; the errors of operations and fields
+// are reported in their response. If the error implements Headerer, the
+// provided headers will be applied to the response. If the error implements
+// StatusCoder, the provided StatusCode will be used instead of 500.
+func DefaultErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if headerer, ok := err.(httptransport.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	code := http.StatusInternalServerError
+	if sc, ok := err.(httptransport.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(Response{Errors: []Error{toError(err, CodeInternalServerError, nil)}})
+}
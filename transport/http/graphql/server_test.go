@@ -0,0 +1,450 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/transport/http/graphql"
+)
+
+type user struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Friends []*user `json:"friends,omitempty"`
+}
+
+type notFoundError string
+
+func (e notFoundError) Error() string     { return "no user " + string(e) }
+func (e notFoundError) ErrorCode() string { return "NOT_FOUND" }
+
+type userService struct {
+	mtx     sync.Mutex
+	users   map[string]*user
+	batches [][]interface{}
+}
+
+func newUserService() *userService {
+	alice, bob := &user{ID: "1", Name: "alice"}, &user{ID: "2", Name: "bob"}
+	alice.Friends = []*user{{ID: bob.ID, Name: bob.Name}}
+	return &userService{users: map[string]*user{"1": alice, "2": bob}}
+}
+
+func (s *userService) schema() graphql.Schema {
+	decodeID := func(_ context.Context, args json.RawMessage) (interface{}, error) {
+		var req struct{ ID string }
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, err
+		}
+		if req.ID == "" {
+			return nil, errors.New("id is required")
+		}
+		return req.ID, nil
+	}
+	return graphql.Schema{
+		Query: graphql.FieldCodecMap{
+			"user": {
+				Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+					s.mtx.Lock()
+					defer s.mtx.Unlock()
+					ids := request.([]interface{})
+					s.batches = append(s.batches, ids)
+					responses := make([]interface{}, len(ids))
+					for i, id := range ids {
+						if u, ok := s.users[id.(string)]; ok {
+							responses[i] = u
+						} else {
+							responses[i] = notFoundError(id.(string))
+						}
+					}
+					return responses, nil
+				},
+				Decode: decodeID,
+				Encode: graphql.EncodeJSONResult,
+				Batch:  true,
+			},
+			"hello": {
+				Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+					name, _ := ctx.Value(graphql.ContextKeyOperationName).(string)
+					return "hello " + request.(string) + " from " + name, nil
+				},
+				Decode: func(_ context.Context, args json.RawMessage) (interface{}, error) {
+					var req struct{ Name string }
+					err := json.Unmarshal(args, &req)
+					return req.Name, err
+				},
+				Encode: graphql.EncodeJSONResult,
+			},
+			"fail": {
+				Endpoint: func(context.Context, interface{}) (interface{}, error) {
+					return nil, errors.New("boom")
+				},
+				Decode: graphql.NopArgumentsDecoder,
+				Encode: graphql.EncodeJSONResult,
+			},
+		},
+		Mutation: graphql.FieldCodecMap{
+			"rename": {
+				Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+					s.mtx.Lock()
+					defer s.mtx.Unlock()
+					req := request.(map[string]string)
+					u := s.users[req["id"]]
+					u.Name = req["name"]
+					return u, nil
+				},
+				Decode: func(_ context.Context, args json.RawMessage) (interface{}, error) {
+					var req map[string]string
+					err := json.Unmarshal(args, &req)
+					return req, err
+				},
+				Encode: graphql.EncodeJSONResult,
+			},
+		},
+	}
+}
+
+func newServer(t *testing.T, s *userService, options ...graphql.ServerOption) *httptest.Server {
+	server := httptest.NewServer(graphql.NewServer(s.schema(), options...))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, server *httptest.Server, contentType, body string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(server.URL, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func query(t *testing.T, server *httptest.Server, req graphql.Request) string {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	status, response := post(t, server, "application/json", string(body))
+	if want, have := http.StatusOK, status; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	return response
+}
+
+func TestQuery(t *testing.T) {
+	s := newUserService()
+	server := newServer(t, s)
+	for _, testcase := range []struct {
+		name     string
+		request  graphql.Request
+		response string
+	}{
+		{
+			name: "selection",
+			request: graphql.Request{Query: `{
+				__typename
+				me: user(id: "1") { name friends { id } }
+			}`},
+			response: `{"data":{"__typename":"Query","me":{"name":"alice","friends":[{"id":"2"}]}}}`,
+		},
+		{
+			name: "fragments and variables",
+			request: graphql.Request{
+				Query: `query Users($id: ID!, $withFriends: Boolean = false) {
+					user(id: $id) { ...Fields friends @include(if: $withFriends) { name } }
+				}
+				fragment Fields on User { id ... on User { name } }`,
+				Variables: map[string]interface{}{"id": "1"},
+			},
+			response: `{"data":{"user":{"id":"1","name":"alice"}}}`,
+		},
+		{
+			name: "operation name",
+			request: graphql.Request{
+				Query:         `query A { hello(name: "a") } query B { hello(name: "b") }`,
+				OperationName: "B",
+			},
+			response: `{"data":{"hello":"hello b from B"}}`,
+		},
+		{
+			name:    "field errors",
+			request: graphql.Request{Query: `{ a: user(id: "1") { id } b: user(id: "3") { id } fail }`},
+			response: `{"data":{"a":{"id":"1"},"b":null,"fail":null},"errors":[` +
+				`{"message":"no user 3","locations":[{"line":1,"column":27}],"path":["b"],"extensions":{"code":"NOT_FOUND"}},` +
+				`{"message":"boom","locations":[{"line":1,"column":51}],"path":["fail"],"extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`,
+		},
+		{
+			name:     "scalar selection",
+			request:  graphql.Request{Query: `{ user(id: "1") { name { first } } }`},
+			response: `{"data":{"user":{"name":null}},"errors":[{"message":"Field \"name\" is a scalar, and can't have a selection set.","locations":[{"line":1,"column":19}],"path":["user","name"],"extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`,
+		},
+	} {
+		if want, have := testcase.response, query(t, server, testcase.request); want != have {
+			t.Errorf("%s:\nwant %s\nhave %s", testcase.name, want, have)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	server := newServer(t, newUserService())
+	for query, code := range map[string]string{
+		`{ user(id: "1") `:                               graphql.CodeParseFailed,
+		`{ nope }`:                                       graphql.CodeValidationFailed,
+		`{ __schema { types { name } } }`:                graphql.CodeValidationFailed,
+		`{ user(id: $id) { id } }`:                       graphql.CodeValidationFailed,
+		`{ user(id: "1") { friends(first: 1) { id } } }`: graphql.CodeValidationFailed,
+		`{ hello @cached }`:                              graphql.CodeValidationFailed,
+		`{ ...Missing }`:                                 graphql.CodeValidationFailed,
+		`subscription { user }`:                          graphql.CodeValidationFailed,
+		`query A { hello } query B { hello }`:            graphql.CodeOperationResolutionFailure,
+		`query ($id: ID!) { user(id: $id) { id } }`:      graphql.CodeBadUserInput,
+		`{ user { id } }`:                                graphql.CodeBadUserInput,
+		``:                                               graphql.CodeBadRequest,
+	} {
+		var response graphql.Response
+		json.Unmarshal([]byte(queryRaw(t, server, query)), &response)
+		if len(response.Errors) == 0 {
+			t.Errorf("%s: want errors, have none", query)
+			continue
+		}
+		if want, have := code, response.Errors[0].ErrorCode(); want != have {
+			t.Errorf("%s: want %s, have %s (%s)", query, want, have, response.Errors[0].Message)
+		}
+	}
+}
+
+func queryRaw(t *testing.T, server *httptest.Server, q string) string {
+	return query(t, server, graphql.Request{Query: q})
+}
+
+func TestMutation(t *testing.T) {
+	s := newUserService()
+	server := newServer(t, s)
+	have := queryRaw(t, server, `mutation {
+		first: rename(id: "2", name: "robert") { name }
+		second: rename(id: "2", name: "bobby") { name }
+	}`)
+	if want := `{"data":{"first":{"name":"robert"},"second":{"name":"bobby"}}}`; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestBatching(t *testing.T) {
+	s := newUserService()
+	server := newServer(t, s)
+	status, have := post(t, server, "application/json", `[
+		{"query": "{ a: user(id: \"1\") { name } b: user(id: \"2\") { name } }"},
+		{"query": "query ($id: ID!) { user(id: $id) { name } }", "variables": {"id": "1"}}
+	]`)
+	if want, have := http.StatusOK, status; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if want := `[{"data":{"a":{"name":"alice"},"b":{"name":"bob"}}},{"data":{"user":{"name":"alice"}}}]`; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if want, have := 1, len(s.batches); want != have {
+		t.Fatalf("batches: want %d, have %d: %v", want, have, s.batches)
+	}
+	if want, have := 2, len(s.batches[0]); want != have {
+		t.Errorf("batch size: want %d, have %d: %v", want, have, s.batches[0])
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := newServer(t, newUserService())
+
+	v := url.Values{"query": {`query ($n: String) { hello(name: $n) }`}, "variables": {`{"n": "get"}`}}
+	resp, err := http.Get(server.URL + "?" + v.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want, have := `{"data":{"hello":"hello get from "}}`, strings.TrimSpace(string(b)); want != have {
+		t.Errorf("GET: want %s, have %s", want, have)
+	}
+	if want, have := "application/json; charset=utf-8", resp.Header.Get("Content-Type"); want != have {
+		t.Errorf("content type: want %q, have %q", want, have)
+	}
+
+	v = url.Values{"query": {`mutation { rename(id: "1", name: "x") { name } }`}}
+	resp, err = http.Get(server.URL + "?" + v.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response graphql.Response
+	json.NewDecoder(resp.Body).Decode(&response)
+	resp.Body.Close()
+	if len(response.Errors) != 1 || response.Errors[0].ErrorCode() != graphql.CodeBadRequest {
+		t.Errorf("GET mutation: want a %s error, have %+v", graphql.CodeBadRequest, response.Errors)
+	}
+
+	if _, have := post(t, server, "application/graphql", `{ hello(name: "raw") }`); have != `{"data":{"hello":"hello raw from "}}` {
+		t.Errorf("application/graphql: have %s", have)
+	}
+
+	for _, testcase := range []struct {
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{http.MethodPost, "application/json", `{"query": `, http.StatusBadRequest},
+		{http.MethodPost, "application/json", `[]`, http.StatusBadRequest},
+		{http.MethodPost, "text/plain", `{ hello }`, http.StatusUnsupportedMediaType},
+		{http.MethodPut, "application/json", `{"query": "{ hello }"}`, http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(testcase.method, server.URL, strings.NewReader(testcase.body))
+		req.Header.Set("Content-Type", testcase.contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response graphql.Response
+		json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if want, have := testcase.status, resp.StatusCode; want != have {
+			t.Errorf("%s %s: status: want %d, have %d", testcase.method, testcase.body, want, have)
+		}
+		if len(response.Errors) != 1 || response.Errors[0].ErrorCode() != graphql.CodeBadRequest {
+			t.Errorf("%s %s: want a %s error, have %+v", testcase.method, testcase.body, graphql.CodeBadRequest, response.Errors)
+		}
+	}
+}
+
+func TestServerHooks(t *testing.T) {
+	var (
+		before, after bool
+		code          int
+	)
+	server := newServer(t, newUserService(), graphql.ServerHTTPOptions(
+		httptransport.ServerBefore(func(ctx context.Context, _ *http.Request) context.Context {
+			before = true
+			return ctx
+		}),
+		httptransport.ServerAfter(func(ctx context.Context, w http.ResponseWriter) context.Context {
+			after = true
+			w.Header().Set("X-After", "yes")
+			return ctx
+		}),
+		httptransport.ServerFinalizer(func(_ context.Context, c int, _ *http.Request) {
+			code = c
+		}),
+		httptransport.ServerCORS(&httptransport.CORSPolicy{AllowedOrigins: []string{"https://example.com"}}),
+	))
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader(`{ hello(name: "x") }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/graphql")
+	req.Header.Set("Origin", "https://example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !before || !after {
+		t.Errorf("want before and after called, have %v and %v", before, after)
+	}
+	if want, have := "yes", resp.Header.Get("X-After"); want != have {
+		t.Errorf("header: want %q, have %q", want, have)
+	}
+	if want, have := http.StatusOK, code; want != have {
+		t.Errorf("finalizer code: want %d, have %d", want, have)
+	}
+	if want, have := "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"); want != have {
+		t.Errorf("CORS: want %q, have %q", want, have)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	server := newServer(t, newUserService(),
+		graphql.ServerMaxBodySize(1024),
+		graphql.ServerBatchMaxSize(2),
+		graphql.ServerBatchConcurrency(1),
+	)
+
+	for _, testcase := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"body size", `{"query": "{ hello(name: \"` + strings.Repeat("x", 1024) + `\") }"}`, http.StatusRequestEntityTooLarge},
+		{"batch size", `[{"query": "{ hello }"}, {"query": "{ hello }"}, {"query": "{ hello }"}]`, http.StatusBadRequest},
+		{"batch", `[{"query": "{ hello }"}, {"query": "{ hello }"}]`, http.StatusOK},
+	} {
+		status, _ := post(t, server, "application/json", testcase.body)
+		if want, have := testcase.status, status; want != have {
+			t.Errorf("%s: want %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestNestingDepth(t *testing.T) {
+	server := newServer(t, newUserService(), graphql.ServerMaxBodySize(1<<24))
+	for name, query := range map[string]string{
+		"values":         `{ hello(name: ` + strings.Repeat("[", 1<<20) + strings.Repeat("]", 1<<20) + `) }`,
+		"selection sets": strings.Repeat("{ a ", 1<<20) + strings.Repeat("}", 1<<20),
+	} {
+		_, have := post(t, server, "application/graphql", query)
+		var response graphql.Response
+		json.Unmarshal([]byte(have), &response)
+		if len(response.Errors) != 1 || response.Errors[0].ErrorCode() != graphql.CodeParseFailed {
+			t.Errorf("%s: want a %s error, have %+v", name, graphql.CodeParseFailed, response.Errors)
+		}
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	var (
+		mtx            sync.Mutex
+		inFlight, peak int
+	)
+	schema := graphql.Schema{
+		Query: graphql.FieldCodecMap{
+			"slow": {
+				Endpoint: func(context.Context, interface{}) (interface{}, error) {
+					mtx.Lock()
+					if inFlight++; inFlight > peak {
+						peak = inFlight
+					}
+					mtx.Unlock()
+					time.Sleep(10 * time.Millisecond)
+					mtx.Lock()
+					inFlight--
+					mtx.Unlock()
+					return "done", nil
+				},
+				Decode: graphql.NopArgumentsDecoder,
+				Encode: graphql.EncodeJSONResult,
+			},
+		},
+	}
+	server := httptest.NewServer(graphql.NewServer(schema, graphql.ServerBatchConcurrency(2)))
+	defer server.Close()
+
+	// The bound applies to the root fields of every operation of the batch.
+	operation := `{"query": "{ a: slow b: slow c: slow }"}`
+	status, body := post(t, server, "application/json", "["+strings.Repeat(operation+",", 3)+operation+"]")
+	if want, have := http.StatusOK, status; want != have {
+		t.Fatalf("want %d, have %d: %s", want, have, body)
+	}
+	if want, have := 4, strings.Count(body, `"c":"done"`); want != have {
+		t.Errorf("operations: want %d, have %d: %s", want, have, body)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := 2, peak; want != have {
+		t.Errorf("concurrent endpoint calls: want %d, have %d", want, have)
+	}
+}
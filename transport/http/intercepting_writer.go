@@ -32,12 +32,23 @@ func (w *interceptingWriter) Write(p []byte) (int, error) {
 // differently. This implementation is derived from
 // https://github.com/felixge/httpsnoop.
 func (w *interceptingWriter) reimplementInterfaces() http.ResponseWriter {
+	hj, _ := w.ResponseWriter.(http.Hijacker)
+	cn, _ := w.ResponseWriter.(http.CloseNotifier)
+	pu, _ := w.ResponseWriter.(http.Pusher)
+	fl, _ := w.ResponseWriter.(http.Flusher)
+	rf, _ := w.ResponseWriter.(io.ReaderFrom)
+	return withInterfaces(w, hj, cn, pu, fl, rf)
+}
+
+// withInterfaces returns w, implementing the additional interfaces which
+// aren't nil, and only those.
+func withInterfaces(w http.ResponseWriter, hj http.Hijacker, cn http.CloseNotifier, pu http.Pusher, fl http.Flusher, rf io.ReaderFrom) http.ResponseWriter {
 	var (
-		hj, i0 = w.ResponseWriter.(http.Hijacker)
-		cn, i1 = w.ResponseWriter.(http.CloseNotifier)
-		pu, i2 = w.ResponseWriter.(http.Pusher)
-		fl, i3 = w.ResponseWriter.(http.Flusher)
-		rf, i4 = w.ResponseWriter.(io.ReaderFrom)
+		i0 = hj != nil
+		i1 = cn != nil
+		i2 = pu != nil
+		i3 = fl != nil
+		i4 = rf != nil
 	)
 
 	switch {
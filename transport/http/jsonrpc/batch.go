@@ -0,0 +1,302 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// DefaultBatchConcurrency is the number of requests of a batch that a Server
+// processes concurrently, unless configured with ServerBatchConcurrency.
+const DefaultBatchConcurrency = 8
+
+// serveBatch processes every request of a batch, with at most
+// s.batchConcurrency of them in flight, and writes the array of responses to
+// w in the order of the requests. Notifications don't get a response.
+func (s Server) serveBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, body []byte) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		rpcerr := parseError("JSON could not be decoded: " + err.Error())
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+	if len(raw) == 0 {
+		rpcerr := invalidRequestError("Batch must contain at least one request.")
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+	if s.batchMaxSize > 0 && len(raw) > s.batchMaxSize {
+		rpcerr := invalidRequestError(fmt.Sprintf("Batch must not contain more than %d requests.", s.batchMaxSize))
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+
+	type entry struct {
+		id           *RequestID
+		notification bool
+		rec          *responseRecorder
+	}
+	var (
+		entries = make([]entry, len(raw))
+		sem     = make(chan struct{}, s.batchConcurrency)
+		wg      sync.WaitGroup
+	)
+	for i, msg := range raw {
+		entries[i].rec = newResponseRecorder()
+		req, notification, err := decodeRequest(msg)
+		if err != nil {
+			rpcerr := invalidRequestError("Batch entry is not a valid request object: " + err.Error())
+			s.logger.Log("err", rpcerr)
+			s.errorEncoder(context.WithValue(ctx, requestIDKey, (*RequestID)(nil)), rpcerr, entries[i].rec)
+			continue
+		}
+		entries[i].id, entries[i].notification = req.ID, notification
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(rec *responseRecorder, req Request) {
+			defer func() { <-sem; wg.Done() }()
+			s.serveRequest(ctx, rec, r, req)
+		}(entries[i].rec, req)
+	}
+	wg.Wait()
+
+	var responses []json.RawMessage
+	for _, e := range entries {
+		copyHeaders(w.Header(), e.rec.Header())
+		if e.notification {
+			continue
+		}
+		res := bytes.TrimSpace(e.rec.body.Bytes())
+		if len(res) == 0 || !json.Valid(res) {
+			// A custom ErrorEncoder may not have written a response object.
+			res, _ = json.Marshal(Response{
+				ID:      e.id,
+				JSONRPC: Version,
+				Error:   &Error{Code: InternalError, Message: ErrorMessage(InternalError)},
+			})
+		}
+		responses = append(responses, res)
+	}
+
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+// isBatch reports whether the body holds a JSON array.
+func isBatch(body []byte) bool {
+	body = bytes.TrimLeft(body, " \t\r\n")
+	return len(body) > 0 && body[0] == '['
+}
+
+// wireRequest is a Request as it's read from the wire, keeping the raw ID so
+// that a missing ID (a notification) can be told apart from a null one.
+type wireRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// decodeRequest decodes a single request object, and reports whether it's a
+// notification.
+func decodeRequest(msg []byte) (req Request, notification bool, err error) {
+	var wr wireRequest
+	if err := json.NewDecoder(bytes.NewReader(msg)).Decode(&wr); err != nil {
+		return Request{}, false, err
+	}
+	return wr.request()
+}
+
+// request converts wr to a Request, and reports whether it's a notification.
+func (wr wireRequest) request() (req Request, notification bool, err error) {
+	req = Request{JSONRPC: wr.JSONRPC, Method: wr.Method, Params: wr.Params}
+	switch {
+	case len(wr.ID) == 0:
+		notification = true
+	case string(wr.ID) != "null":
+		req.ID = &RequestID{}
+		if err := req.ID.UnmarshalJSON(wr.ID); err != nil {
+			return Request{}, false, err
+		}
+	}
+	return req, notification, nil
+}
+
+// responseRecorder is an http.ResponseWriter that captures the response to a
+// single request of a batch, or to a notification.
+type responseRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, code: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+func (r *responseRecorder) WriteHeader(code int)        { r.code = code }
+
+// copyHeaders copies the headers set while processing a single request to the
+// HTTP response, except for those that describe the body.
+func copyHeaders(dst, src http.Header) {
+	for k, v := range src {
+		if k == "Content-Type" || k == "Content-Length" {
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// BatchCall is a single call in a batch sent by Client.BatchEndpoint.
+type BatchCall struct {
+	// Method is the JSON RPC method to call.
+	Method string
+
+	// Request is the request object passed to Encode.
+	Request interface{}
+
+	// Notification marks the call as a notification: it's sent without an
+	// ID, and the server doesn't respond to it.
+	Notification bool
+
+	// Encode encodes Request to the params member. If nil, the client's
+	// request encoder is used.
+	Encode EncodeRequestFunc
+
+	// Decode decodes the response. If nil, the client's response decoder is
+	// used.
+	Decode DecodeResponseFunc
+}
+
+// BatchResult is the outcome of a single BatchCall.
+type BatchResult struct {
+	Response interface{}
+	Err      error
+}
+
+// BatchEndpoint returns an endpoint that sends a batch of calls to the remote
+// server in a single HTTP request. The endpoint's request must be a
+// []BatchCall, and its response is a []BatchResult with one element per call,
+// in the same order. Responses are mapped back to calls by their IDs, which
+// are generated with the client's RequestIDGenerator; the client's method is
+// ignored. Notifications always get an empty BatchResult.
+//
+// The returned error is only non-nil if the batch as a whole failed. If the
+// server answers the batch with a single error response, for example because
+// it couldn't be parsed, that error is reported in every result instead.
+func (c Client) BatchEndpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		calls, ok := request.([]BatchCall)
+		if !ok {
+			return nil, fmt.Errorf("batch request must be []jsonrpc.BatchCall, have %T", request)
+		}
+		if len(calls) == 0 {
+			return []BatchResult{}, nil
+		}
+
+		var (
+			rpcReqs = make([]interface{}, len(calls))
+			ids     = make([]string, len(calls))
+		)
+		for i, call := range calls {
+			enc := call.Encode
+			if enc == nil {
+				enc = c.enc
+			}
+			params, err := enc(context.WithValue(ctx, ContextKeyRequestMethod, call.Method), call.Request)
+			if err != nil {
+				return nil, err
+			}
+			if call.Notification {
+				rpcReqs[i] = clientNotification{JSONRPC: Version, Method: call.Method, Params: params}
+				continue
+			}
+			id := c.requestID.Generate()
+			key, err := json.Marshal(id)
+			if err != nil {
+				return nil, err
+			}
+			ids[i] = string(key)
+			rpcReqs[i] = clientRequest{JSONRPC: Version, Method: call.Method, Params: params, ID: id}
+		}
+
+		body, err := c.roundTrip(ctx, rpcReqs)
+		if err != nil {
+			return nil, err
+		}
+
+		results := make([]BatchResult, len(calls))
+		if !isBatch(body) {
+			// Either every call was a notification, or the batch was rejected.
+			if len(bytes.TrimSpace(body)) == 0 {
+				return results, nil
+			}
+			var rpcRes Response
+			if err := json.Unmarshal(body, &rpcRes); err != nil {
+				return nil, err
+			}
+			for i, call := range calls {
+				if !call.Notification {
+					results[i].Err = rpcErrorOrUnknown(rpcRes)
+				}
+			}
+			return results, nil
+		}
+
+		var rpcRess []Response
+		if err := json.Unmarshal(body, &rpcRess); err != nil {
+			return nil, err
+		}
+		byID := make(map[string]Response, len(rpcRess))
+		for _, rpcRes := range rpcRess {
+			if rpcRes.ID == nil {
+				continue
+			}
+			key, err := rpcRes.ID.MarshalJSON()
+			if err != nil {
+				continue
+			}
+			byID[string(key)] = rpcRes
+		}
+		for i, call := range calls {
+			if call.Notification {
+				continue
+			}
+			rpcRes, ok := byID[ids[i]]
+			if !ok {
+				results[i].Err = fmt.Errorf("no response for request ID %s", ids[i])
+				continue
+			}
+			dec := call.Decode
+			if dec == nil {
+				dec = c.dec
+			}
+			results[i].Response, results[i].Err = dec(context.WithValue(ctx, ContextKeyRequestMethod, call.Method), rpcRes)
+		}
+		return results, nil
+	}
+}
+
+// rpcErrorOrUnknown returns the error of a response that should have been an
+// array of responses.
+func rpcErrorOrUnknown(res Response) error {
+	if res.Error != nil {
+		return *res.Error
+	}
+	return Error{Code: InternalError, Message: "Server did not respond with a batch."}
+}
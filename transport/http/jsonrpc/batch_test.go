@@ -0,0 +1,279 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+)
+
+func batchHandler(calls *int32, options ...jsonrpc.ServerOption) http.Handler {
+	decodeInts := func(_ context.Context, params json.RawMessage) (interface{}, error) {
+		var ints []int
+		err := json.Unmarshal(params, &ints)
+		return ints, err
+	}
+	encodeInt := func(_ context.Context, response interface{}) (json.RawMessage, error) {
+		return json.Marshal(response)
+	}
+	return jsonrpc.NewServer(jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				atomic.AddInt32(calls, 1)
+				sum := 0
+				for _, i := range request.([]int) {
+					sum += i
+				}
+				return sum, nil
+			},
+			Decode: decodeInts,
+			Encode: encodeInt,
+		},
+		"fail": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) {
+				atomic.AddInt32(calls, 1)
+				return nil, errors.New("dang")
+			},
+			Decode: decodeInts,
+			Encode: encodeInt,
+		},
+	}, options...)
+}
+
+func TestServerBatch(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(batchHandler(&calls))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", body(`[
+		{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1},
+		{"jsonrpc": "2.0", "method": "add", "params": [3, 4]},
+		{"jsonrpc": "2.0", "method": "sub", "params": [5, 6], "id": "b"},
+		1,
+		{"jsonrpc": "2.0", "method": "fail", "params": [], "id": 3}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Fatalf("StatusCode: want %d, have %d (%s)", want, have, buf)
+	}
+
+	var responses []jsonrpc.Response
+	if err := json.Unmarshal(buf, &responses); err != nil {
+		t.Fatalf("Can't decode response: %v (%s)", err, buf)
+	}
+	if want, have := 4, len(responses); want != have {
+		t.Fatalf("responses: want %d, have %d (%s)", want, have, buf)
+	}
+	if want, have := `3`, string(responses[0].Result); want != have {
+		t.Errorf("add result: want %s, have %s", want, have)
+	}
+	for i, want := range []int{0, jsonrpc.MethodNotFoundError, jsonrpc.InvalidRequestError, jsonrpc.InternalError} {
+		if want == 0 {
+			if responses[i].Error != nil {
+				t.Errorf("response %d: unexpected error %v", i, responses[i].Error)
+			}
+			continue
+		}
+		if responses[i].Error == nil {
+			t.Errorf("response %d: want error %d, have none", i, want)
+			continue
+		}
+		if have := responses[i].Error.Code; want != have {
+			t.Errorf("response %d: want error %d, have %d", i, want, have)
+		}
+	}
+	if id, err := responses[1].ID.String(); err != nil || id != "b" {
+		t.Errorf("response 1 ID: want %q, have %q (%v)", "b", id, err)
+	}
+	if responses[2].ID != nil {
+		t.Errorf("response 2 ID: want nil, have %v", responses[2].ID)
+	}
+	if want, have := int32(3), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("endpoint calls: want %d, have %d", want, have)
+	}
+}
+
+func TestServerNotifications(t *testing.T) {
+	for _, testcase := range []struct {
+		name string
+		body string
+	}{
+		{"single", `{"jsonrpc": "2.0", "method": "add", "params": [1, 2]}`},
+		{"single error", `{"jsonrpc": "2.0", "method": "fail", "params": []}`},
+		{"batch", `[{"jsonrpc": "2.0", "method": "add", "params": [1]}, {"jsonrpc": "2.0", "method": "fail", "params": []}]`},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var calls int32
+			rec := httptest.NewRecorder()
+			batchHandler(&calls).ServeHTTP(rec, httptest.NewRequest("POST", "/", body(testcase.body)))
+
+			if want, have := http.StatusNoContent, rec.Code; want != have {
+				t.Errorf("StatusCode: want %d, have %d", want, have)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Body: want empty, have %s", rec.Body.Bytes())
+			}
+			if atomic.LoadInt32(&calls) == 0 {
+				t.Error("endpoint not called")
+			}
+		})
+	}
+}
+
+func TestServerInvalidBatch(t *testing.T) {
+	for _, testcase := range []struct {
+		name    string
+		body    string
+		options []jsonrpc.ServerOption
+		want    int
+	}{
+		{"empty", `[]`, nil, jsonrpc.InvalidRequestError},
+		{"malformed", `[{"jsonrpc": "2.0", "method": "add"`, nil, jsonrpc.ParseError},
+		{"too large", `[{"jsonrpc": "2.0", "method": "add", "params": [], "id": 1}, {"jsonrpc": "2.0", "method": "add", "params": [], "id": 2}]`, []jsonrpc.ServerOption{jsonrpc.ServerBatchMaxSize(1)}, jsonrpc.InvalidRequestError},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var calls int32
+			rec := httptest.NewRecorder()
+			batchHandler(&calls, testcase.options...).ServeHTTP(rec, httptest.NewRequest("POST", "/", body(testcase.body)))
+			expectErrorCode(t, testcase.want, rec.Body.Bytes())
+			expectNilRequestID(t, rec.Body.Bytes())
+			if want, have := int32(0), atomic.LoadInt32(&calls); want != have {
+				t.Errorf("endpoint calls: want %d, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestServerBatchConcurrency(t *testing.T) {
+	var (
+		mtx       sync.Mutex
+		inflight  int
+		maxFlight int
+	)
+	handler := jsonrpc.NewServer(jsonrpc.EndpointCodecMap{
+		"sleep": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) {
+				mtx.Lock()
+				inflight++
+				if inflight > maxFlight {
+					maxFlight = inflight
+				}
+				mtx.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mtx.Lock()
+				inflight--
+				mtx.Unlock()
+				return struct{}{}, nil
+			},
+			Decode: nopDecoder,
+			Encode: nopEncoder,
+		},
+	}, jsonrpc.ServerBatchConcurrency(2))
+
+	reqs := make([]string, 6)
+	for i := range reqs {
+		reqs[i] = `{"jsonrpc": "2.0", "method": "sleep", "params": [], "id": 1}`
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", body("["+strings.Join(reqs, ",")+"]")))
+
+	var responses []jsonrpc.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("Can't decode response: %v (%s)", err, rec.Body.Bytes())
+	}
+	if want, have := len(reqs), len(responses); want != have {
+		t.Errorf("responses: want %d, have %d", want, have)
+	}
+	if want, have := 2, maxFlight; want < have {
+		t.Errorf("concurrent requests: want at most %d, have %d", want, have)
+	}
+}
+
+func TestClientBatchEndpoint(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(batchHandler(&calls))
+	defer server.Close()
+
+	client := jsonrpc.NewClient(
+		mustParse(server.URL),
+		"",
+		jsonrpc.ClientRequestEncoder(func(_ context.Context, request interface{}) (json.RawMessage, error) {
+			return json.Marshal(request)
+		}),
+		jsonrpc.ClientResponseDecoder(func(_ context.Context, res jsonrpc.Response) (interface{}, error) {
+			if res.Error != nil {
+				return nil, *res.Error
+			}
+			var sum int
+			err := json.Unmarshal(res.Result, &sum)
+			return sum, err
+		}),
+	)
+
+	response, err := client.BatchEndpoint()(context.Background(), []jsonrpc.BatchCall{
+		{Method: "add", Request: []int{1, 2}},
+		{Method: "add", Request: []int{5}, Notification: true},
+		{Method: "sub", Request: []int{3, 4}},
+		{Method: "add", Request: []int{3, 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := response.([]jsonrpc.BatchResult)
+	if want, have := 4, len(results); want != have {
+		t.Fatalf("results: want %d, have %d", want, have)
+	}
+	if want, have := 3, results[0].Response; want != have || results[0].Err != nil {
+		t.Errorf("result 0: want %v, have %v (%v)", want, have, results[0].Err)
+	}
+	if results[1].Response != nil || results[1].Err != nil {
+		t.Errorf("notification result: want empty, have %+v", results[1])
+	}
+	if rpcerr, ok := results[2].Err.(jsonrpc.Error); !ok || rpcerr.Code != jsonrpc.MethodNotFoundError {
+		t.Errorf("result 2: want MethodNotFoundError, have %v", results[2].Err)
+	}
+	if want, have := 7, results[3].Response; want != have || results[3].Err != nil {
+		t.Errorf("result 3: want %v, have %v (%v)", want, have, results[3].Err)
+	}
+	if want, have := int32(3), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("endpoint calls: want %d, have %d", want, have)
+	}
+}
+
+func TestClientNotification(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(batchHandler(&calls))
+	defer server.Close()
+
+	client := jsonrpc.NewClient(
+		mustParse(server.URL),
+		"add",
+		jsonrpc.ClientRequestEncoder(func(_ context.Context, request interface{}) (json.RawMessage, error) {
+			return json.Marshal(request)
+		}),
+		jsonrpc.ClientNotification(true),
+	)
+	response, err := client.Endpoint()(context.Background(), []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != nil {
+		t.Errorf("response: want nil, have %v", response)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("endpoint calls: want %d, have %d", want, have)
+	}
+}
@@ -30,6 +30,7 @@ type Client struct {
 	finalizer      httptransport.ClientFinalizerFunc
 	requestID      RequestIDGenerator
 	bufferedStream bool
+	notification   bool
 }
 
 type clientRequest struct {
@@ -39,6 +40,14 @@ type clientRequest struct {
 	ID      interface{}     `json:"id"`
 }
 
+// clientNotification is a request without an ID, which the server doesn't
+// respond to.
+type clientNotification struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
 // NewClient constructs a usable Client for a single remote method.
 func NewClient(
 	tgt *url.URL,
@@ -139,6 +148,14 @@ func BufferedStream(buffered bool) ClientOption {
 	return func(c *Client) { c.bufferedStream = buffered }
 }
 
+// ClientNotification sets whether the client sends its requests as
+// notifications, that is, without an ID. The server doesn't respond to
+// notifications, so the endpoint returns a nil response and only reports
+// transport errors. By default, requests aren't notifications.
+func ClientNotification(notification bool) ClientOption {
+	return func(c *Client) { c.notification = notification }
+}
+
 // Endpoint returns a usable endpoint that invokes the remote endpoint.
 func (c Client) Endpoint() endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -165,12 +182,19 @@ func (c Client) Endpoint() endpoint.Endpoint {
 		if params, err = c.enc(ctx, request); err != nil {
 			return nil, err
 		}
-		rpcReq := clientRequest{
+		var rpcReq interface{} = clientRequest{
 			JSONRPC: Version,
 			Method:  c.method,
 			Params:  params,
 			ID:      c.requestID.Generate(),
 		}
+		if c.notification {
+			rpcReq = clientNotification{
+				JSONRPC: Version,
+				Method:  c.method,
+				Params:  params,
+			}
+		}
 
 		req, err := http.NewRequest("POST", c.tgt.String(), nil)
 		if err != nil {
@@ -202,6 +226,10 @@ func (c Client) Endpoint() endpoint.Endpoint {
 			ctx = f(ctx, resp)
 		}
 
+		if c.notification {
+			return nil, nil
+		}
+
 		// Decode the body into an object
 		var rpcRes Response
 		err = json.NewDecoder(resp.Body).Decode(&rpcRes)
@@ -218,6 +246,53 @@ func (c Client) Endpoint() endpoint.Endpoint {
 	}
 }
 
+// roundTrip posts the JSON encoding of rpcReq to the server, and returns the
+// response body. It applies the client's before, after and finalizer
+// functions, just like Endpoint.
+func (c Client) roundTrip(ctx context.Context, rpcReq interface{}) (body []byte, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var resp *http.Response
+	if c.finalizer != nil {
+		defer func() {
+			if resp != nil {
+				ctx = context.WithValue(ctx, httptransport.ContextKeyResponseHeaders, resp.Header)
+				ctx = context.WithValue(ctx, httptransport.ContextKeyResponseSize, resp.ContentLength)
+			}
+			c.finalizer(ctx, err)
+		}()
+	}
+
+	req, err := http.NewRequest("POST", c.tgt.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	var b bytes.Buffer
+	req.Body = ioutil.NopCloser(&b)
+	if err = json.NewEncoder(&b).Encode(rpcReq); err != nil {
+		return nil, err
+	}
+
+	for _, f := range c.before {
+		ctx = f(ctx, req)
+	}
+
+	resp, err = c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	for _, f := range c.after {
+		ctx = f(ctx, resp)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
 // ClientFinalizerFunc can be used to perform work at the end of a client HTTP
 // request, after the response is returned. The principal
 // intended use is for error logging. Additional response parameters are
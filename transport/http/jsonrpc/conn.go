@@ -0,0 +1,492 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// ErrConnClosed is returned by calls on a Conn that was closed, or whose
+// stream ended, before the response arrived.
+var ErrConnClosed = errors.New("jsonrpc: connection closed")
+
+// Conn is a JSON RPC connection over a long-lived Stream. It's symmetric:
+// both peers may serve requests with an EndpointCodecMap, and send requests and
+// notifications to the other peer. Concurrent calls are multiplexed on the
+// stream, and responses are matched to them by RequestID.
+type Conn struct {
+	stream       Stream
+	ecm          EndpointCodecMap
+	requestID    RequestIDGenerator
+	errorHandler transport.ErrorHandler
+	concurrency  int
+
+	writeMtx sync.Mutex
+
+	mtx     sync.Mutex
+	pending map[string]chan Response
+	closed  bool
+	done    chan struct{}
+}
+
+// NewConn constructs a connection over the stream, which serves requests from
+// the other peer with ecm once Serve is called. ecm may be nil for a
+// connection that only makes calls; requests from the other peer then get a
+// MethodNotFoundError.
+func NewConn(stream Stream, ecm EndpointCodecMap, options ...ConnOption) *Conn {
+	c := &Conn{
+		stream:       stream,
+		ecm:          ecm,
+		requestID:    NewAutoIncrementID(0),
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		concurrency:  DefaultBatchConcurrency,
+		pending:      map[string]chan Response{},
+		done:         make(chan struct{}),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ConnOption sets an optional parameter for connections.
+type ConnOption func(*Conn)
+
+// ConnRequestIDGenerator sets the generator of the IDs of outgoing requests.
+// The IDs must be unique among the requests in flight on the connection.
+// By default, NewAutoIncrementID(0) is used.
+func ConnRequestIDGenerator(g RequestIDGenerator) ConnOption {
+	return func(c *Conn) { c.requestID = g }
+}
+
+// ConnErrorHandler is used to handle non-terminal errors, such as endpoint
+// errors and malformed messages. By default, they're ignored.
+func ConnErrorHandler(errorHandler transport.ErrorHandler) ConnOption {
+	return func(c *Conn) { c.errorHandler = errorHandler }
+}
+
+// ConnConcurrency sets the maximum number of messages from the other peer
+// that are served concurrently, and of requests of each batch. Once that many
+// are in flight, the stream isn't read until one of them completes, except
+// that responses to calls are always delivered. By default,
+// DefaultBatchConcurrency is used.
+func ConnConcurrency(n int) ConnOption {
+	return func(c *Conn) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+type connKeyType struct{}
+
+var connKey connKeyType
+
+// ConnFromContext returns the connection that the request being served was
+// received on. Endpoints may use it to send notifications or requests back to
+// the other peer.
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	c, ok := ctx.Value(connKey).(*Conn)
+	return c, ok
+}
+
+// Serve reads messages from the stream until it ends, or until the connection
+// is closed. Requests are served concurrently, up to the limit set with
+// ConnConcurrency, so the order in which notifications are processed isn't
+// guaranteed. Serve must
+// be called exactly once, even by peers that only make calls, as it's what
+// delivers the responses. It waits for the requests being served to complete,
+// and returns nil if the stream ended with io.EOF or the connection was closed.
+func (c *Conn) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, connKey, c)
+
+	var (
+		sem = make(chan struct{}, c.concurrency)
+		wg  sync.WaitGroup
+	)
+	defer func() {
+		c.shutdown()
+		cancel()
+		wg.Wait()
+	}()
+
+	for {
+		msg, err := c.stream.ReadMessage()
+		if err != nil {
+			if err == io.EOF || c.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if isResponse(msg) {
+			// Responses are delivered without waiting for a slot, as the
+			// requests holding the slots may be waiting for them.
+			c.handleMessage(ctx, msg)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-c.done:
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			c.handleMessage(ctx, msg)
+		}()
+	}
+}
+
+// Close closes the connection and its stream. Calls in flight fail with
+// ErrConnClosed.
+func (c *Conn) Close() error {
+	c.shutdown()
+	return c.stream.Close()
+}
+
+// Done returns a channel that's closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Call sends a request to the other peer, and waits for its response, or for
+// the context to be done.
+func (c *Conn) Call(ctx context.Context, method string, params json.RawMessage) (Response, error) {
+	id := c.requestID.Generate()
+	key, err := json.Marshal(id)
+	if err != nil {
+		return Response{}, err
+	}
+
+	ch := make(chan Response, 1)
+	c.mtx.Lock()
+	if c.closed {
+		c.mtx.Unlock()
+		return Response{}, ErrConnClosed
+	}
+	if _, ok := c.pending[string(key)]; ok {
+		c.mtx.Unlock()
+		return Response{}, fmt.Errorf("jsonrpc: request ID %s is already in flight", key)
+	}
+	c.pending[string(key)] = ch
+	c.mtx.Unlock()
+
+	if err := c.send(clientRequest{JSONRPC: Version, Method: method, Params: params, ID: id}); err != nil {
+		c.forget(string(key))
+		return Response{}, err
+	}
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return Response{}, ErrConnClosed
+		}
+		return res, nil
+	case <-ctx.Done():
+		c.forget(string(key))
+		return Response{}, ctx.Err()
+	}
+}
+
+// Notify sends a notification to the other peer. It returns once the
+// notification is written to the stream.
+func (c *Conn) Notify(ctx context.Context, method string, params json.RawMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.isClosed() {
+		return ErrConnClosed
+	}
+	return c.send(clientNotification{JSONRPC: Version, Method: method, Params: params})
+}
+
+// Endpoint returns a usable endpoint that calls the method on the other peer.
+// A nil enc or dec defaults to DefaultRequestEncoder or
+// DefaultResponseDecoder, respectively.
+func (c *Conn) Endpoint(method string, enc EncodeRequestFunc, dec DecodeResponseFunc) endpoint.Endpoint {
+	if enc == nil {
+		enc = DefaultRequestEncoder
+	}
+	if dec == nil {
+		dec = DefaultResponseDecoder
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, method)
+
+		params, err := enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.Call(ctx, method, params)
+		if err != nil {
+			return nil, err
+		}
+
+		return dec(ctx, res)
+	}
+}
+
+func (c *Conn) isClosed() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.closed
+}
+
+// shutdown marks the connection as closed, and fails the calls in flight.
+func (c *Conn) shutdown() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	for key, ch := range c.pending {
+		close(ch)
+		delete(c.pending, key)
+	}
+}
+
+func (c *Conn) forget(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.pending, key)
+}
+
+func (c *Conn) send(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	return c.stream.WriteMessage(msg)
+}
+
+// reply sends a response or a batch of responses to the other peer.
+func (c *Conn) reply(ctx context.Context, v interface{}) {
+	if err := c.send(v); err != nil {
+		c.errorHandler.Handle(ctx, err)
+	}
+}
+
+// connMessage is any message read from the stream: a request, a notification
+// or a response.
+type connMessage struct {
+	wireRequest
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func (c *Conn) handleMessage(ctx context.Context, msg []byte) {
+	if !isBatch(msg) {
+		if res := c.handleObject(ctx, msg); res != nil {
+			c.reply(ctx, res)
+		}
+		return
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(msg, &raw); err != nil {
+		c.reply(ctx, c.errorResponse(ctx, nil, parseError("JSON could not be decoded: "+err.Error())))
+		return
+	}
+	if len(raw) == 0 {
+		c.reply(ctx, c.errorResponse(ctx, nil, invalidRequestError("Batch must contain at least one request.")))
+		return
+	}
+
+	var (
+		mtx       sync.Mutex
+		responses []*Response
+		sem       = make(chan struct{}, c.concurrency)
+		wg        sync.WaitGroup
+	)
+	for _, m := range raw {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m json.RawMessage) {
+			defer func() { <-sem; wg.Done() }()
+			if res := c.handleObject(ctx, m); res != nil {
+				mtx.Lock()
+				responses = append(responses, res)
+				mtx.Unlock()
+			}
+		}(m)
+	}
+	wg.Wait()
+	if len(responses) > 0 {
+		c.reply(ctx, responses)
+	}
+}
+
+// isResponse reports whether the message is a single response, as opposed to
+// a request, a notification or a batch.
+func isResponse(msg []byte) bool {
+	if isBatch(msg) {
+		return false
+	}
+	var m connMessage
+	return json.Unmarshal(msg, &m) == nil && m.Method == "" && len(m.ID) > 0 && (m.Result != nil || m.Error != nil)
+}
+
+// handleObject handles a single request or response, and returns the response
+// to send back, if any.
+func (c *Conn) handleObject(ctx context.Context, msg []byte) *Response {
+	var m connMessage
+	if err := json.Unmarshal(msg, &m); err != nil {
+		if !json.Valid(msg) {
+			return c.errorResponse(ctx, nil, parseError("JSON could not be decoded: "+err.Error()))
+		}
+		return c.errorResponse(ctx, nil, invalidRequestError("Message is not a valid request object: "+err.Error()))
+	}
+
+	if m.Method == "" {
+		if len(m.ID) > 0 && (m.Result != nil || m.Error != nil) {
+			c.deliver(ctx, m)
+			return nil
+		}
+		return c.errorResponse(ctx, nil, invalidRequestError("Message is neither a request nor a response."))
+	}
+
+	req, notification, err := m.request()
+	if err != nil {
+		return c.errorResponse(ctx, nil, invalidRequestError("Message is not a valid request object: "+err.Error()))
+	}
+	res := c.serveRequest(ctx, req)
+	if notification {
+		return nil
+	}
+	return &res
+}
+
+// deliver hands a response over to the call waiting for it.
+func (c *Conn) deliver(ctx context.Context, m connMessage) {
+	var key bytes.Buffer
+	if err := json.Compact(&key, m.ID); err != nil {
+		c.errorHandler.Handle(ctx, err)
+		return
+	}
+
+	c.mtx.Lock()
+	ch, ok := c.pending[key.String()]
+	delete(c.pending, key.String())
+	c.mtx.Unlock()
+	if !ok {
+		c.errorHandler.Handle(ctx, fmt.Errorf("jsonrpc: response to unknown request ID %s", key.String()))
+		return
+	}
+
+	res := Response{JSONRPC: m.JSONRPC, Result: m.Result, Error: m.Error}
+	if string(m.ID) != "null" {
+		res.ID = &RequestID{}
+		_ = res.ID.UnmarshalJSON(m.ID)
+	}
+	ch <- res
+}
+
+// serveRequest invokes the endpoint for a request, and returns the response.
+func (c *Conn) serveRequest(ctx context.Context, req Request) Response {
+	ctx = context.WithValue(ctx, requestIDKey, req.ID)
+	ctx = context.WithValue(ctx, ContextKeyRequestMethod, req.Method)
+
+	ecm, ok := c.ecm[req.Method]
+	if !ok {
+		return *c.errorResponse(ctx, req.ID, methodNotFoundError(fmt.Sprintf("Method %s was not found.", req.Method)))
+	}
+
+	request, err := ecm.Decode(ctx, req.Params)
+	if err != nil {
+		return *c.errorResponse(ctx, req.ID, err)
+	}
+
+	response, err := ecm.Endpoint(ctx, request)
+	if err != nil {
+		return *c.errorResponse(ctx, req.ID, err)
+	}
+
+	result, err := ecm.Encode(ctx, response)
+	if err != nil {
+		return *c.errorResponse(ctx, req.ID, err)
+	}
+
+	return Response{ID: req.ID, JSONRPC: Version, Result: result}
+}
+
+// errorResponse reports err to the error handler, and returns it as a
+// response. As with DefaultErrorEncoder, the error code is taken from
+// ErrorCoder, and defaults to InternalError.
+func (c *Conn) errorResponse(ctx context.Context, id *RequestID, err error) *Response {
+	c.errorHandler.Handle(ctx, err)
+
+	e := Error{
+		Code:    InternalError,
+		Message: err.Error(),
+	}
+	if rpcerr, ok := err.(Error); ok {
+		e.Data = rpcerr.Data
+	}
+	if sc, ok := err.(ErrorCoder); ok {
+		e.Code = sc.ErrorCode()
+	}
+	return &Response{ID: id, JSONRPC: Version, Error: &e}
+}
+
+// StreamServer serves an EndpointCodecMap on long-lived connections, such as
+// TCP connections, WebSockets, or the standard input and output of a process.
+type StreamServer struct {
+	ecm     EndpointCodecMap
+	options []ConnOption
+}
+
+// NewStreamServer constructs a new stream server. The options are applied to
+// every connection it serves.
+func NewStreamServer(ecm EndpointCodecMap, options ...ConnOption) *StreamServer {
+	return &StreamServer{ecm: ecm, options: options}
+}
+
+// ServeStream serves a single stream until it ends, and closes it.
+func (s *StreamServer) ServeStream(ctx context.Context, stream Stream) error {
+	conn := NewConn(stream, s.ecm, s.options...)
+	defer conn.Close()
+	return conn.Serve(ctx)
+}
+
+// Serve accepts connections on the listener, and serves each of them in its
+// own goroutine, with messages framed by newStream, for example NewLineStream
+// or NewHeaderStream, called without options. It returns when Accept fails.
+func (s *StreamServer) Serve(ctx context.Context, l net.Listener, newStream func(io.ReadWriteCloser, ...StreamOption) Stream) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			_ = s.ServeStream(ctx, newStream(nc))
+		}()
+	}
+}
+
+// WebSocketHandler returns an http.Handler that upgrades requests to
+// WebSockets, and serves them. It uses the default handshake of
+// golang.org/x/net/websocket, which requires a well-formed Origin header but
+// doesn't restrict its value; wrap the handler to check origins.
+func (s *StreamServer) WebSocketHandler() http.Handler {
+	return websocket.Handler(func(ws *websocket.Conn) {
+		_ = s.ServeStream(ws.Request().Context(), NewWebSocketStream(ws))
+	})
+}
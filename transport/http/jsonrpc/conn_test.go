@@ -0,0 +1,390 @@
+package jsonrpc_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+)
+
+func decodeString(_ context.Context, params json.RawMessage) (interface{}, error) {
+	var s string
+	err := json.Unmarshal(params, &s)
+	return s, err
+}
+
+func encodeJSON(_ context.Context, response interface{}) (json.RawMessage, error) {
+	return json.Marshal(response)
+}
+
+func decodeStringResponse(_ context.Context, res jsonrpc.Response) (interface{}, error) {
+	if res.Error != nil {
+		return nil, *res.Error
+	}
+	var s string
+	err := json.Unmarshal(res.Result, &s)
+	return s, err
+}
+
+// servedConn starts serving a connection over stream, and returns it.
+func servedConn(t *testing.T, stream jsonrpc.Stream, ecm jsonrpc.EndpointCodecMap) *jsonrpc.Conn {
+	t.Helper()
+	conn := jsonrpc.NewConn(stream, ecm)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := conn.Serve(context.Background()); err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		<-done
+	})
+	return conn
+}
+
+func streamServerECM() jsonrpc.EndpointCodecMap {
+	return jsonrpc.EndpointCodecMap{
+		"echo": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				return request, nil
+			},
+			Decode: decodeString,
+			Encode: encodeJSON,
+		},
+		"greet": jsonrpc.EndpointCodec{
+			Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				conn, ok := jsonrpc.ConnFromContext(ctx)
+				if !ok {
+					return nil, fmt.Errorf("no connection in context")
+				}
+				name, err := conn.Endpoint("name", nil, decodeStringResponse)(ctx, nil)
+				if err != nil {
+					return nil, err
+				}
+				greeting := request.(string) + ", " + name.(string)
+				if err := conn.Notify(ctx, "greeted", json.RawMessage(`"`+greeting+`"`)); err != nil {
+					return nil, err
+				}
+				return greeting, nil
+			},
+			Decode: decodeString,
+			Encode: encodeJSON,
+		},
+		"wait": jsonrpc.EndpointCodec{
+			Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				select {
+				case <-time.After(50 * time.Millisecond):
+					return request, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+			Decode: decodeString,
+			Encode: encodeJSON,
+		},
+	}
+}
+
+func TestConnBidirectional(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	servedConn(t, jsonrpc.NewLineStream(serverSide), streamServerECM())
+
+	greeted := make(chan string, 1)
+	client := servedConn(t, jsonrpc.NewLineStream(clientSide), jsonrpc.EndpointCodecMap{
+		"name": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return "Alice", nil },
+			Decode:   nopDecoder,
+			Encode:   encodeJSON,
+		},
+		"greeted": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				greeted <- request.(string)
+				return nil, nil
+			},
+			Decode: decodeString,
+			Encode: encodeJSON,
+		},
+	})
+
+	response, err := client.Endpoint("greet", nil, decodeStringResponse)(context.Background(), "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "Hello, Alice", response; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	select {
+	case have := <-greeted:
+		if want := "Hello, Alice"; want != have {
+			t.Errorf("notification: want %q, have %q", want, have)
+		}
+	case <-time.After(time.Second):
+		t.Error("timeout waiting for notification")
+	}
+
+	_, err = client.Endpoint("missing", nil, nil)(context.Background(), nil)
+	if rpcerr, ok := err.(jsonrpc.Error); !ok || rpcerr.Code != jsonrpc.MethodNotFoundError {
+		t.Errorf("want MethodNotFoundError, have %v", err)
+	}
+}
+
+func TestConnMultiplexing(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	servedConn(t, jsonrpc.NewHeaderStream(serverSide), streamServerECM())
+	client := servedConn(t, jsonrpc.NewHeaderStream(clientSide), nil)
+
+	type result struct {
+		response interface{}
+		err      error
+		at       time.Time
+	}
+	var (
+		wait = make(chan result, 1)
+		echo = make(chan result, 1)
+	)
+	go func() {
+		response, err := client.Endpoint("wait", nil, decodeStringResponse)(context.Background(), "slow")
+		wait <- result{response, err, time.Now()}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		response, err := client.Endpoint("echo", nil, decodeStringResponse)(context.Background(), "fast")
+		echo <- result{response, err, time.Now()}
+	}()
+
+	slow, fast := <-wait, <-echo
+	if slow.err != nil || fast.err != nil {
+		t.Fatalf("errors: %v, %v", slow.err, fast.err)
+	}
+	if slow.response != "slow" || fast.response != "fast" {
+		t.Errorf("responses: want slow and fast, have %v and %v", slow.response, fast.response)
+	}
+	if !fast.at.Before(slow.at) {
+		t.Error("fast call was blocked by slow call")
+	}
+}
+
+func TestConnCallAfterClose(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	client := jsonrpc.NewConn(jsonrpc.NewLineStream(clientSide), nil)
+	served := make(chan error, 1)
+	go func() { served <- client.Serve(context.Background()) }()
+
+	// The other peer reads the request, and hangs up without responding.
+	go func() {
+		bufio.NewReader(serverSide).ReadBytes('\n')
+		serverSide.Close()
+	}()
+	if _, err := client.Call(context.Background(), "echo", json.RawMessage(`"hi"`)); err != jsonrpc.ErrConnClosed {
+		t.Errorf("want %v, have %v", jsonrpc.ErrConnClosed, err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve: want nil, have %v", err)
+	}
+	if _, err := client.Call(context.Background(), "echo", json.RawMessage(`"hi"`)); err != jsonrpc.ErrConnClosed {
+		t.Errorf("want %v, have %v", jsonrpc.ErrConnClosed, err)
+	}
+}
+
+func TestStreamServerMalformedMessages(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	go jsonrpc.NewStreamServer(streamServerECM()).ServeStream(context.Background(), jsonrpc.NewLineStream(serverSide))
+
+	r := bufio.NewReader(clientSide)
+	for _, testcase := range []struct {
+		in   string
+		want int
+	}{
+		{`{"jsonrpc": "2.0", "method": "echo", "params": "hi", "id": 1`, jsonrpc.ParseError},
+		{`"hi"`, jsonrpc.InvalidRequestError},
+		{`{"jsonrpc": "2.0", "id": 1}`, jsonrpc.InvalidRequestError},
+		{`[]`, jsonrpc.InvalidRequestError},
+	} {
+		if _, err := io.WriteString(clientSide, testcase.in+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectErrorCode(t, testcase.want, line)
+		expectNilRequestID(t, line)
+	}
+}
+
+func TestStreamServerBatch(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	go jsonrpc.NewStreamServer(streamServerECM()).ServeStream(context.Background(), jsonrpc.NewLineStream(serverSide))
+
+	in := `[{"jsonrpc": "2.0", "method": "echo", "params": "a", "id": 1}, {"jsonrpc": "2.0", "method": "echo", "params": "b"}, {"jsonrpc": "2.0", "method": "echo", "params": "c", "id": 2}]`
+	if _, err := io.WriteString(clientSide, in+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(clientSide).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var responses []jsonrpc.Response
+	if err := json.Unmarshal(line, &responses); err != nil {
+		t.Fatalf("Can't decode response: %v (%s)", err, line)
+	}
+	results := map[string]bool{}
+	for _, res := range responses {
+		results[string(res.Result)] = true
+	}
+	if want, have := map[string]bool{`"a"`: true, `"c"`: true}, results; len(want) != len(have) || !have[`"a"`] || !have[`"c"`] {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestHeaderStreamFraming(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	go jsonrpc.NewStreamServer(streamServerECM()).ServeStream(context.Background(), jsonrpc.NewHeaderStream(serverSide))
+
+	msg := `{"jsonrpc": "2.0", "method": "echo", "params": "hi", "id": "x"}`
+	in := fmt.Sprintf("Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: %d\r\n\r\n%s", len(msg), msg)
+	go io.WriteString(clientSide, in)
+
+	want := `{"jsonrpc":"2.0","result":"hi","id":"x"}`
+	buf := make([]byte, len(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(want), want)))
+	if _, err := io.ReadFull(clientSide, buf); err != nil {
+		t.Fatal(err)
+	}
+	if have := string(buf); !strings.HasSuffix(have, "\r\n\r\n"+want) || !strings.HasPrefix(have, fmt.Sprintf("Content-Length: %d", len(want))) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestStreamServerWebSocket(t *testing.T) {
+	server := httptest.NewServer(jsonrpc.NewStreamServer(streamServerECM()).WebSocketHandler())
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := servedConn(t, jsonrpc.NewWebSocketStream(ws), nil)
+
+	response, err := client.Endpoint("echo", nil, decodeStringResponse)(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "hi", response; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestStreamMaxMessageSize(t *testing.T) {
+	for name, testcase := range map[string]struct {
+		newStream func(io.ReadWriteCloser, ...jsonrpc.StreamOption) jsonrpc.Stream
+		in        string
+	}{
+		"line":   {jsonrpc.NewLineStream, `"` + strings.Repeat("x", 2048) + `"` + "\n"},
+		"header": {jsonrpc.NewHeaderStream, "Content-Length: 9223372036854775807\r\n\r\n{}"},
+	} {
+		serverSide, clientSide := net.Pipe()
+		go io.WriteString(clientSide, testcase.in)
+		stream := testcase.newStream(serverSide, jsonrpc.StreamMaxMessageSize(1024))
+		if _, err := stream.ReadMessage(); err != jsonrpc.ErrMessageTooLarge {
+			t.Errorf("%s: want %v, have %v", name, jsonrpc.ErrMessageTooLarge, err)
+		}
+		clientSide.Close()
+		serverSide.Close()
+	}
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	go io.WriteString(clientSide, `"`+strings.Repeat("x", 1022)+`"`+"\r\n")
+	msg, err := jsonrpc.NewLineStream(serverSide, jsonrpc.StreamMaxMessageSize(1024)).ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1024, len(msg); want != have {
+		t.Errorf("want %d bytes, have %d", want, have)
+	}
+}
+
+func TestConnConcurrency(t *testing.T) {
+	var (
+		mtx               sync.Mutex
+		inFlight, maxSeen int
+	)
+	ecm := streamServerECM()
+	ecm["count"] = jsonrpc.EndpointCodec{
+		Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+			mtx.Lock()
+			if inFlight++; inFlight > maxSeen {
+				maxSeen = inFlight
+			}
+			mtx.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mtx.Lock()
+			inFlight--
+			mtx.Unlock()
+			return request, nil
+		},
+		Decode: decodeString,
+		Encode: encodeJSON,
+	}
+
+	serverSide, clientSide := net.Pipe()
+	server := jsonrpc.NewConn(jsonrpc.NewLineStream(serverSide), ecm, jsonrpc.ConnConcurrency(1))
+	go server.Serve(context.Background())
+	defer server.Close()
+	client := servedConn(t, jsonrpc.NewLineStream(clientSide), jsonrpc.EndpointCodecMap{
+		"name": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return "Alice", nil },
+			Decode:   nopDecoder,
+			Encode:   encodeJSON,
+		},
+		"greeted": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+			Decode:   nopDecoder,
+			Encode:   encodeJSON,
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Endpoint("count", nil, decodeStringResponse)(context.Background(), "x"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if want, have := 1, maxSeen; want != have {
+		t.Errorf("requests in flight: want %d, have %d", want, have)
+	}
+
+	// A request calling back the other peer holds the only slot, and still
+	// gets its response.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := client.Endpoint("greet", nil, decodeStringResponse)(ctx, "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "Hello, Alice", response; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
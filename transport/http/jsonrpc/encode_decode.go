@@ -15,6 +15,10 @@ type EndpointCodec struct {
 	Endpoint endpoint.Endpoint
 	Decode   DecodeRequestFunc
 	Encode   EncodeResponseFunc
+
+	// Doc optionally describes the method in the OpenRPC document published
+	// by rpc.discover.
+	Doc *MethodDoc
 }
 
 // EndpointCodecMap maps the Request.Method to the proper EndpointCodec
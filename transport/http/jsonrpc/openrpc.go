@@ -0,0 +1,479 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DiscoverMethod is the method reserved by OpenRPC for service discovery.
+	// It returns the OpenRPC document of the server.
+	DiscoverMethod = "rpc.discover"
+
+	// OpenRPCVersion is the version of the OpenRPC specification that the
+	// generated documents conform to.
+	OpenRPCVersion = "1.2.6"
+)
+
+// MethodDoc describes a method in the OpenRPC document of a server. It's set
+// on the EndpointCodec of the method.
+type MethodDoc struct {
+	Summary     string
+	Description string
+	Deprecated  bool
+
+	// Params is a value of the type that the method's params are decoded to,
+	// such as SumRequest{}. If it's a struct, or a pointer to one, the params
+	// are described by name, with one param per JSON field; otherwise, as a
+	// single positional param. Nil means the method takes no params.
+	Params interface{}
+
+	// Result is a value of the type of the method's result. Nil means that
+	// the result is unspecified.
+	Result interface{}
+
+	// Errors are the application errors that the method may return. An empty
+	// Message is filled in from ErrorMessage.
+	Errors []Error
+}
+
+// Schema is a JSON Schema, as used in OpenRPC documents.
+type Schema map[string]interface{}
+
+// OpenRPCDocument is an OpenRPC document describing the methods of a server.
+// See https://spec.open-rpc.org
+type OpenRPCDocument struct {
+	OpenRPC    string             `json:"openrpc"`
+	Info       OpenRPCInfo        `json:"info"`
+	Methods    []OpenRPCMethod    `json:"methods"`
+	Components *OpenRPCComponents `json:"components,omitempty"`
+}
+
+// OpenRPCInfo is the metadata of the API in an OpenRPC document.
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenRPCMethod describes a single method in an OpenRPC document.
+type OpenRPCMethod struct {
+	Name           string                     `json:"name"`
+	Summary        string                     `json:"summary,omitempty"`
+	Description    string                     `json:"description,omitempty"`
+	Deprecated     bool                       `json:"deprecated,omitempty"`
+	ParamStructure string                     `json:"paramStructure,omitempty"`
+	Params         []OpenRPCContentDescriptor `json:"params"`
+	Result         OpenRPCContentDescriptor   `json:"result"`
+	Errors         []Error                    `json:"errors,omitempty"`
+}
+
+// OpenRPCContentDescriptor describes a param or result of a method.
+type OpenRPCContentDescriptor struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Schema   Schema `json:"schema"`
+}
+
+// OpenRPCComponents holds the schemas of the named struct types referenced
+// by the methods of an OpenRPC document.
+type OpenRPCComponents struct {
+	Schemas map[string]Schema `json:"schemas,omitempty"`
+}
+
+// NewOpenRPCDocument generates the OpenRPC document of the methods in ecm,
+// sorted by name. Methods without a Doc are listed with unspecified params and
+// result. Methods in the reserved "rpc." namespace aren't listed.
+func NewOpenRPCDocument(info OpenRPCInfo, ecm EndpointCodecMap) OpenRPCDocument {
+	names := make([]string, 0, len(ecm))
+	for name := range ecm {
+		if !strings.HasPrefix(name, "rpc.") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	g := &schemaGenerator{defs: map[string]Schema{}, names: map[reflect.Type]string{}}
+	doc := OpenRPCDocument{
+		OpenRPC: OpenRPCVersion,
+		Info:    info,
+		Methods: make([]OpenRPCMethod, 0, len(names)),
+	}
+	for _, name := range names {
+		doc.Methods = append(doc.Methods, g.method(name, ecm[name].Doc))
+	}
+	if len(g.defs) > 0 {
+		doc.Components = &OpenRPCComponents{Schemas: g.defs}
+	}
+	return doc
+}
+
+// DiscoveryEndpointCodec returns an EndpointCodec that serves doc, to be
+// registered as DiscoverMethod. Servers configured with ServerDiscovery
+// register it automatically; use it to publish a document over a Conn, or
+// to publish a document that was edited after generation.
+func DiscoveryEndpointCodec(doc OpenRPCDocument) EndpointCodec {
+	return EndpointCodec{
+		Endpoint: func(context.Context, interface{}) (interface{}, error) {
+			return doc, nil
+		},
+		Decode: func(context.Context, json.RawMessage) (interface{}, error) {
+			return nil, nil
+		},
+		Encode: func(_ context.Context, response interface{}) (json.RawMessage, error) {
+			return json.Marshal(response)
+		},
+	}
+}
+
+// ServerDiscovery publishes the OpenRPC document of the server's methods
+// through DiscoverMethod, unless the EndpointCodecMap already has it. The
+// document is generated once, when the server is constructed.
+func ServerDiscovery(info OpenRPCInfo) ServerOption {
+	return func(s *Server) { s.discovery = &info }
+}
+
+// withDiscovery returns a copy of ecm that also serves the OpenRPC document
+// of ecm through DiscoverMethod.
+func withDiscovery(info OpenRPCInfo, ecm EndpointCodecMap) EndpointCodecMap {
+	if _, ok := ecm[DiscoverMethod]; ok {
+		return ecm
+	}
+	m := make(EndpointCodecMap, len(ecm)+1)
+	for name, ec := range ecm {
+		m[name] = ec
+	}
+	m[DiscoverMethod] = DiscoveryEndpointCodec(NewOpenRPCDocument(info, ecm))
+	return m
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaGenerator derives JSON Schemas from Go types, following the rules of
+// encoding/json. Named struct types are collected in defs, and referenced, so
+// that recursive types are supported.
+type schemaGenerator struct {
+	defs  map[string]Schema
+	names map[reflect.Type]string
+}
+
+func (g *schemaGenerator) method(name string, doc *MethodDoc) OpenRPCMethod {
+	m := OpenRPCMethod{
+		Name:   name,
+		Params: []OpenRPCContentDescriptor{},
+		Result: OpenRPCContentDescriptor{Name: "result", Schema: Schema{}},
+	}
+	if doc == nil {
+		return m
+	}
+
+	m.Summary, m.Description, m.Deprecated = doc.Summary, doc.Description, doc.Deprecated
+	if doc.Params != nil {
+		t := reflect.TypeOf(doc.Params)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct && !isOpaque(t) {
+			m.ParamStructure = "by-name"
+			for _, f := range jsonFields(t) {
+				m.Params = append(m.Params, OpenRPCContentDescriptor{
+					Name:     f.name,
+					Required: f.required,
+					Schema:   g.field(f),
+				})
+			}
+		} else {
+			m.ParamStructure = "by-position"
+			m.Params = append(m.Params, OpenRPCContentDescriptor{
+				Name:     "params",
+				Required: true,
+				Schema:   g.schema(t),
+			})
+		}
+	}
+	if doc.Result != nil {
+		m.Result.Schema = g.schema(reflect.TypeOf(doc.Result))
+	}
+	for _, e := range doc.Errors {
+		if e.Message == "" {
+			e.Message = ErrorMessage(e.Code)
+		}
+		m.Errors = append(m.Errors, e)
+	}
+	return m
+}
+
+// isOpaque reports whether values of t are encoded by a custom marshaler, so
+// that their structure can't be derived from the type.
+func isOpaque(t reflect.Type) bool {
+	return t == timeType || t == rawMessageType ||
+		t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Array:
+		return Schema{"type": "array", "items": g.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return Schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+		}
+		return Schema{"type": "object"}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + g.define(t)}
+	default:
+		return Schema{}
+	}
+}
+
+// define adds the schema of the named struct type t to g.defs, unless it's
+// already there, and returns its name.
+func (g *schemaGenerator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.defs[name]; taken {
+		// Qualify the name with the package, and then with a number.
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+		qualified := strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		name = qualified
+		for i := 2; ; i++ {
+			if _, taken := g.defs[name]; !taken {
+				break
+			}
+			name = qualified + strconv.Itoa(i)
+		}
+	}
+	g.names[t] = name
+	g.defs[name] = Schema{} // reserve the name while recursing
+	g.defs[name] = g.structSchema(t)
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) Schema {
+	var (
+		properties = Schema{}
+		required   []string
+	)
+	for _, f := range jsonFields(t) {
+		properties[f.name] = g.field(f)
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+	s := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGenerator) field(f jsonField) Schema {
+	if f.quoted {
+		return Schema{"type": "string"}
+	}
+	return g.schema(f.typ)
+}
+
+// jsonField is a field of a struct, as encoded by encoding/json.
+type jsonField struct {
+	name     string
+	typ      reflect.Type
+	required bool
+	quoted   bool
+
+	index  []int // the index sequence of the field, for reflect.Value.FieldByIndex
+	tagged bool  // whether the name comes from the json tag
+}
+
+// jsonFields returns the fields of the struct type t in the order
+// encoding/json encodes them, including the promoted fields of embedded
+// structs. A field is required unless it's tagged omitempty.
+//
+// Conflicting names are resolved like encoding/json does: the shallowest
+// field wins, then the one whose name comes from a tag, and fields that are
+// still ambiguous are dropped.
+func jsonFields(t reflect.Type) []jsonField {
+	var (
+		current []jsonField
+		next    = []jsonField{{typ: t}}
+
+		// The number of times each struct type is embedded at the current
+		// and next depth. A type embedded twice at the same depth has
+		// ambiguous fields.
+		count     map[reflect.Type]int
+		nextCount = map[reflect.Type]int{}
+
+		visited = map[reflect.Type]bool{}
+		fields  []jsonField
+	)
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+			visited[f.typ] = true
+			for i := 0; i < f.typ.NumField(); i++ {
+				sf := f.typ.Field(i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := tag, ""
+				if i := strings.Index(tag, ","); i >= 0 {
+					name, opts = tag[:i], tag[i:]
+				}
+				index := make([]int, len(f.index)+1)
+				copy(index, f.index)
+				index[len(f.index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					field := jsonField{
+						name:     name,
+						typ:      sf.Type,
+						required: !strings.Contains(opts, ",omitempty"),
+						quoted:   strings.Contains(opts, ",string") && isScalar(sf.Type),
+						index:    index,
+						tagged:   name != "",
+					}
+					if field.name == "" {
+						field.name = sf.Name
+					}
+					fields = append(fields, field)
+					if count[f.typ] > 1 {
+						// The field is ambiguous, and is dropped below,
+						// once a second copy of it is found.
+						fields = append(fields, field)
+					}
+					continue
+				}
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, jsonField{name: ft.Name(), typ: ft, index: index})
+				}
+			}
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		x := fields
+		if x[i].name != x[j].name {
+			return x[i].name < x[j].name
+		}
+		if len(x[i].index) != len(x[j].index) {
+			return len(x[i].index) < len(x[j].index)
+		}
+		if x[i].tagged != x[j].tagged {
+			return x[i].tagged
+		}
+		return lessIndex(x[i].index, x[j].index)
+	})
+
+	// Keep the dominant field of each name: the first one, unless the next
+	// one is just as deep and just as tagged.
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j-i == 1 || len(fields[i].index) < len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+
+	sort.Slice(out, func(i, j int) bool { return lessIndex(out[i].index, out[j].index) })
+	return out
+}
+
+// lessIndex reports whether the field with index sequence a comes before the
+// one with b in the struct.
+func lessIndex(a, b []int) bool {
+	for k, x := range a {
+		if k >= len(b) {
+			return false
+		}
+		if x != b[k] {
+			return x < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// isScalar reports whether the ",string" tag option applies to t.
+func isScalar(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
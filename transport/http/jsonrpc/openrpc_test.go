@@ -0,0 +1,224 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+)
+
+type sumRequest struct {
+	A int `json:"a"`
+	B int `json:"b,omitempty"`
+}
+
+type node struct {
+	Name     string    `json:"name"`
+	Children []*node   `json:"children,omitempty"`
+	Created  time.Time `json:"created"`
+	Count    int64     `json:"count,string"`
+	secret   string
+	Meta
+}
+
+type Meta struct {
+	Tags map[string]string `json:"tags,omitempty"`
+	Data []byte            `json:"-"`
+}
+
+func TestOpenRPCDocument(t *testing.T) {
+	ecm := jsonrpc.EndpointCodecMap{
+		"sum": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return 0, nil },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+			Doc: &jsonrpc.MethodDoc{
+				Summary: "Adds two numbers.",
+				Params:  sumRequest{},
+				Result:  0,
+				Errors:  []jsonrpc.Error{{Code: 1, Message: "overflow"}, {Code: jsonrpc.InvalidParamsError}},
+			},
+		},
+		"tree": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+			Doc: &jsonrpc.MethodDoc{
+				Params: []string{},
+				Result: &node{},
+			},
+		},
+		"undocumented": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+		},
+	}
+	doc := jsonrpc.NewOpenRPCDocument(jsonrpc.OpenRPCInfo{Title: "test", Version: "1.0.0"}, ecm)
+
+	have, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+		"openrpc": "1.2.6",
+		"info": {"title": "test", "version": "1.0.0"},
+		"methods": [
+			{
+				"name": "sum",
+				"summary": "Adds two numbers.",
+				"paramStructure": "by-name",
+				"params": [
+					{"name": "a", "required": true, "schema": {"type": "integer"}},
+					{"name": "b", "schema": {"type": "integer"}}
+				],
+				"result": {"name": "result", "schema": {"type": "integer"}},
+				"errors": [
+					{"code": 1, "message": "overflow"},
+					{"code": -32602, "message": "Invalid method parameter(s)."}
+				]
+			},
+			{
+				"name": "tree",
+				"paramStructure": "by-position",
+				"params": [{"name": "params", "required": true, "schema": {"type": "array", "items": {"type": "string"}}}],
+				"result": {"name": "result", "schema": {"$ref": "#/components/schemas/node"}}
+			},
+			{
+				"name": "undocumented",
+				"params": [],
+				"result": {"name": "result", "schema": {}}
+			}
+		],
+		"components": {
+			"schemas": {
+				"node": {
+					"type": "object",
+					"properties": {
+						"name": {"type": "string"},
+						"children": {"type": "array", "items": {"$ref": "#/components/schemas/node"}},
+						"created": {"type": "string", "format": "date-time"},
+						"count": {"type": "string"},
+						"tags": {"type": "object", "additionalProperties": {"type": "string"}}
+					},
+					"required": ["name", "created", "count"]
+				}
+			}
+		}
+	}`
+	var wantv, havev interface{}
+	if err := json.Unmarshal([]byte(want), &wantv); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(have, &havev); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantv, havev) {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestServerDiscovery(t *testing.T) {
+	ecm := jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return struct{}{}, nil },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+		},
+	}
+	handler := jsonrpc.NewServer(ecm, jsonrpc.ServerDiscovery(jsonrpc.OpenRPCInfo{Title: "adder", Version: "0.1.0"}))
+	if _, ok := ecm[jsonrpc.DiscoverMethod]; ok {
+		t.Error("ServerDiscovery modified the EndpointCodecMap")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", body(`{"jsonrpc": "2.0", "method": "rpc.discover", "id": 1}`)))
+	if want, have := http.StatusOK, rec.Code; want != have {
+		t.Fatalf("StatusCode: want %d, have %d", want, have)
+	}
+	res, err := unmarshalResponse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Can't decode response: %v (%s)", err, rec.Body.Bytes())
+	}
+	if res.Error != nil {
+		t.Fatalf("Unexpected error: %v", res.Error)
+	}
+	var doc jsonrpc.OpenRPCDocument
+	if err := json.Unmarshal(res.Result, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "adder", doc.Info.Title; want != have {
+		t.Errorf("Title: want %q, have %q", want, have)
+	}
+	if want, have := 1, len(doc.Methods); want != have {
+		t.Fatalf("Methods: want %d, have %d", want, have)
+	}
+	if want, have := "add", doc.Methods[0].Name; want != have {
+		t.Errorf("Method: want %q, have %q", want, have)
+	}
+}
+
+type shadowA struct {
+	Name string
+	Both string
+}
+
+type shadowB struct {
+	Name int `json:"Name"`
+	Both string
+}
+
+type shadowInner struct {
+	Top int `json:"top"`
+}
+
+type shadowDeep struct {
+	shadowInner
+}
+
+type shadowed struct {
+	shadowA
+	shadowB
+	Top string `json:"top"`
+	shadowDeep
+}
+
+func TestOpenRPCShadowedFields(t *testing.T) {
+	ecm := jsonrpc.EndpointCodecMap{
+		"shadowed": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+			Doc:      &jsonrpc.MethodDoc{Params: shadowed{}},
+		},
+	}
+	doc := jsonrpc.NewOpenRPCDocument(jsonrpc.OpenRPCInfo{Title: "test", Version: "1.0.0"}, ecm)
+
+	// The params are the fields encoding/json emits: the shallowest top,
+	// and the tagged Name; Both is ambiguous.
+	var have []string
+	for _, p := range doc.Methods[0].Params {
+		have = append(have, p.Name)
+	}
+	if want := []string{"Name", "top"}; !reflect.DeepEqual(want, have) {
+		t.Fatalf("params: want %v, have %v", want, have)
+	}
+	buf, err := json.Marshal(shadowed{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"Name":0,"top":""}`, string(buf); want != have {
+		t.Errorf("encoding/json: want %s, have %s", want, have)
+	}
+	for i, want := range []string{"integer", "string"} {
+		p := doc.Methods[0].Params[i]
+		if have := p.Schema["type"]; want != have {
+			t.Errorf("%s: want type %q, have %v", p.Name, want, have)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 
 	httptransport "github.com/go-kit/kit/transport/http"
@@ -24,6 +25,10 @@ type Server struct {
 	errorEncoder httptransport.ErrorEncoder
 	finalizer    httptransport.ServerFinalizerFunc
 	logger       log.Logger
+
+	batchConcurrency int
+	batchMaxSize     int
+	discovery        *OpenRPCInfo
 }
 
 // NewServer constructs a new server, which implements http.Server.
@@ -35,10 +40,15 @@ func NewServer(
 		ecm:          ecm,
 		errorEncoder: DefaultErrorEncoder,
 		logger:       log.NewNopLogger(),
+
+		batchConcurrency: DefaultBatchConcurrency,
 	}
 	for _, option := range options {
 		option(s)
 	}
+	if s.discovery != nil {
+		s.ecm = withDiscovery(*s.discovery, s.ecm)
+	}
 	return s
 }
 
@@ -88,7 +98,28 @@ func ServerFinalizer(f httptransport.ServerFinalizerFunc) ServerOption {
 	return func(s *Server) { s.finalizer = f }
 }
 
-// ServeHTTP implements http.Handler.
+// ServerBatchConcurrency sets the maximum number of requests of a batch that
+// are processed concurrently. By default, DefaultBatchConcurrency is used.
+func ServerBatchConcurrency(n int) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.batchConcurrency = n
+		}
+	}
+}
+
+// ServerBatchMaxSize sets the maximum number of requests in a batch. Larger
+// batches are rejected as a whole with an InvalidRequestError. By default,
+// batches may be of any size.
+func ServerBatchMaxSize(n int) ServerOption {
+	return func(s *Server) { s.batchMaxSize = n }
+}
+
+// ServeHTTP implements http.Handler. The request body may contain a single
+// request object or a batch, that is, an array of request objects. Requests
+// without an id member are notifications: their endpoints are invoked, but
+// nothing is written for them, and a body that consists only of notifications
+// results in StatusNoContent (204) without a body.
 func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -108,9 +139,21 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx = f(ctx, r)
 	}
 
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rpcerr := parseError("JSON could not be read: " + err.Error())
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+
+	if isBatch(body) {
+		s.serveBatch(ctx, w, r, body)
+		return
+	}
+
 	// Decode the body into an  object
-	var req Request
-	err := json.NewDecoder(r.Body).Decode(&req)
+	req, notification, err := decodeRequest(body)
 	if err != nil {
 		rpcerr := parseError("JSON could not be decoded: " + err.Error())
 		s.logger.Log("err", rpcerr)
@@ -118,6 +161,21 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The server must not reply to a notification, not even with an error.
+	if notification {
+		rec := newResponseRecorder()
+		s.serveRequest(ctx, rec, r, req)
+		copyHeaders(w.Header(), rec.Header())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.serveRequest(ctx, w, r, req)
+}
+
+// serveRequest invokes the endpoint for a single decoded request, and writes
+// the JSON RPC response or error to w.
+func (s Server) serveRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, req Request) {
 	ctx = context.WithValue(ctx, requestIDKey, req.ID)
 	ctx = context.WithValue(ctx, ContextKeyRequestMethod, req.Method)
 
@@ -0,0 +1,196 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// Stream is a bidirectional stream of JSON RPC messages, such as a TCP
+// connection, the standard input and output of a process, or a WebSocket.
+// Each message is a single request, response or batch.
+//
+// A Conn calls ReadMessage from a single goroutine, and never calls
+// WriteMessage concurrently, so implementations don't have to be safe for
+// concurrent use.
+type Stream interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage([]byte) error
+	Close() error
+}
+
+// DefaultMaxMessageSize is the size of the largest message a Stream reads,
+// unless configured with StreamMaxMessageSize.
+const DefaultMaxMessageSize = 4 << 20
+
+// ErrMessageTooLarge is returned by streams reading a message larger than
+// their maximum message size. A Conn stops serving its stream on it, as on
+// any other read error.
+var ErrMessageTooLarge = errors.New("jsonrpc: message too large")
+
+// StreamOption sets an optional parameter for streams.
+type StreamOption func(*streamConfig)
+
+type streamConfig struct {
+	maxMessageSize int
+}
+
+// StreamMaxMessageSize sets the size of the largest message a stream reads,
+// in bytes. Larger messages fail with ErrMessageTooLarge, before they're
+// buffered. By default, DefaultMaxMessageSize is used.
+func StreamMaxMessageSize(n int) StreamOption {
+	return func(c *streamConfig) {
+		if n > 0 {
+			c.maxMessageSize = n
+		}
+	}
+}
+
+func newStreamConfig(options []StreamOption) streamConfig {
+	c := streamConfig{maxMessageSize: DefaultMaxMessageSize}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// NewLineStream returns a Stream that separates messages with newlines. Empty
+// lines are ignored.
+func NewLineStream(rwc io.ReadWriteCloser, options ...StreamOption) Stream {
+	return &lineStream{r: bufio.NewReader(rwc), rwc: rwc, config: newStreamConfig(options)}
+}
+
+type lineStream struct {
+	r      *bufio.Reader
+	rwc    io.ReadWriteCloser
+	config streamConfig
+}
+
+func (s *lineStream) ReadMessage() ([]byte, error) {
+	for {
+		line, err := s.readLine()
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readLine reads up to and including the next newline, failing once the line
+// is larger than the maximum message size and a CRLF line ending.
+func (s *lineStream) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		if len(line)+len(chunk) > s.config.maxMessageSize+len("\r\n") {
+			return nil, ErrMessageTooLarge
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+func (s *lineStream) WriteMessage(msg []byte) error {
+	// The message must fit on a single line.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, msg); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := s.rwc.Write(buf.Bytes())
+	return err
+}
+
+func (s *lineStream) Close() error { return s.rwc.Close() }
+
+// NewHeaderStream returns a Stream that precedes each message with a
+// Content-Length header, followed by an empty line, as in the Language Server
+// Protocol. Other headers of incoming messages, such as Content-Type, are
+// ignored.
+func NewHeaderStream(rwc io.ReadWriteCloser, options ...StreamOption) Stream {
+	return &headerStream{r: textproto.NewReader(bufio.NewReader(rwc)), rwc: rwc, config: newStreamConfig(options)}
+}
+
+type headerStream struct {
+	r      *textproto.Reader
+	rwc    io.ReadWriteCloser
+	config streamConfig
+}
+
+func (s *headerStream) ReadMessage() ([]byte, error) {
+	header, err := s.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	v := header.Get("Content-Length")
+	if v == "" {
+		return nil, errors.New("missing Content-Length header")
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header %q", v)
+	}
+	if n > int64(s.config.maxMessageSize) {
+		return nil, ErrMessageTooLarge
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(s.r.R, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *headerStream) WriteMessage(msg []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(msg))
+	buf.Write(msg)
+	_, err := s.rwc.Write(buf.Bytes())
+	return err
+}
+
+func (s *headerStream) Close() error { return s.rwc.Close() }
+
+// NewWebSocketStream returns a Stream that sends every message in its own
+// WebSocket text frame. Both text and binary frames are accepted. The
+// maximum message size sets the MaxPayloadBytes of the WebSocket.
+func NewWebSocketStream(ws *websocket.Conn, options ...StreamOption) Stream {
+	ws.MaxPayloadBytes = newStreamConfig(options).maxMessageSize
+	return webSocketStream{ws: ws}
+}
+
+type webSocketStream struct {
+	ws *websocket.Conn
+}
+
+func (s webSocketStream) ReadMessage() ([]byte, error) {
+	var msg []byte
+	err := websocket.Message.Receive(s.ws, &msg)
+	if err == websocket.ErrFrameTooLarge {
+		err = ErrMessageTooLarge
+	}
+	return msg, err
+}
+
+func (s webSocketStream) WriteMessage(msg []byte) error {
+	return websocket.Message.Send(s.ws, string(msg))
+}
+
+func (s webSocketStream) Close() error { return s.ws.Close() }
@@ -0,0 +1,571 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default limits applied by MultipartDecoder when the corresponding field is
+// zero.
+const (
+	DefaultMultipartMaxPartSize  = 32 << 20
+	DefaultMultipartMaxTotalSize = 128 << 20
+	DefaultMultipartMaxMemory    = 10 << 20
+)
+
+// FormFile is a file part of a multipart/form-data body. In servers, it's
+// populated by MultipartDecoder and can be read like any other io.Reader
+// until the request is finalized. In clients, it's constructed with
+// NewFormFile and encoded by EncodeMultipartRequest.
+type FormFile struct {
+	// Filename is the filename parameter of the part's Content-Disposition.
+	Filename string
+
+	// Header is the MIME header of the part.
+	Header textproto.MIMEHeader
+
+	// Size is the length of the part's content in bytes. It's only known for
+	// decoded parts.
+	Size int64
+
+	r    io.Reader
+	file *os.File
+}
+
+// NewFormFile returns a FormFile that reads its content from r when encoded
+// by EncodeMultipartRequest. If contentType is empty,
+// application/octet-stream is used.
+func NewFormFile(filename, contentType string, r io.Reader) *FormFile {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &FormFile{
+		Filename: filename,
+		Header:   textproto.MIMEHeader{"Content-Type": {contentType}},
+		r:        r,
+	}
+}
+
+// Read implements io.Reader.
+func (f *FormFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, io.EOF
+	}
+	return f.r.Read(p)
+}
+
+// Seek implements io.Seeker for decoded parts, so the content may be read more
+// than once.
+func (f *FormFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("form file is not seekable")
+	}
+	return s.Seek(offset, whence)
+}
+
+// ContentType returns the Content-Type of the part.
+func (f *FormFile) ContentType() string {
+	return f.Header.Get("Content-Type")
+}
+
+// MultipartLimitError is returned by MultipartDecoder when a part, or the body
+// as a whole, exceeds the configured size limits. It implements StatusCoder,
+// reporting StatusRequestEntityTooLarge (413).
+type MultipartLimitError struct {
+	// Part is the form name of the offending part, or empty if the total size
+	// limit was exceeded.
+	Part string
+
+	// Limit is the limit that was exceeded, in bytes.
+	Limit int64
+}
+
+// Error implements the error interface.
+func (e MultipartLimitError) Error() string {
+	if e.Part == "" {
+		return fmt.Sprintf("multipart body exceeds %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("multipart part %q exceeds %d bytes", e.Part, e.Limit)
+}
+
+// StatusCode implements StatusCoder.
+func (e MultipartLimitError) StatusCode() int { return http.StatusRequestEntityTooLarge }
+
+// errNotMultipart is returned when the request isn't multipart/form-data.
+type errNotMultipart string
+
+func (e errNotMultipart) Error() string {
+	return fmt.Sprintf("content type %q is not multipart/form-data", string(e))
+}
+
+func (e errNotMultipart) StatusCode() int { return http.StatusUnsupportedMediaType }
+
+// ErrMultipartCleanupMissing is returned by MultipartDecoder when a file part
+// has to be spooled to disk, but the Server wasn't constructed with
+// ServerMultipartCleanup, so the temporary file could never be removed.
+var ErrMultipartCleanupMissing = errors.New("multipart: temporary files require the ServerMultipartCleanup option")
+
+// MultipartDecoder streams multipart/form-data request bodies into the fields
+// of a struct. Fields are matched to parts by their `form` struct tag, or by
+// their name if the tag is missing; a tag of "-" skips the field.
+//
+// Form values may be decoded into fields of type string, bool, any integer or
+// floating point type, or slices thereof. File parts may be decoded into
+// fields of type *FormFile or []*FormFile. Parts without a matching field are
+// discarded, but still count towards the total size limit.
+//
+// File parts are kept in memory up to MaxMemory bytes across the request and
+// spooled to temporary files after that. Temporary files are removed when the
+// request is finalized, which requires the ServerMultipartCleanup option.
+type MultipartDecoder struct {
+	// MaxPartSize limits the size of every part, in bytes. By default,
+	// DefaultMultipartMaxPartSize is used. A negative value disables the limit.
+	MaxPartSize int64
+
+	// MaxTotalSize limits the combined size of all parts, in bytes. By
+	// default, DefaultMultipartMaxTotalSize is used. A negative value disables
+	// the limit.
+	MaxTotalSize int64
+
+	// MaxMemory is the number of bytes of file content that may be kept in
+	// memory before further parts are spooled to disk. By default,
+	// DefaultMultipartMaxMemory is used. A negative value spools every file.
+	MaxMemory int64
+
+	// TempDir is the directory for temporary files. By default, os.TempDir is
+	// used.
+	TempDir string
+}
+
+// DecodeRequestFunc returns a DecodeRequestFunc that decodes the request body
+// into the value returned by newRequest, which must be a pointer to a struct,
+// and returns that value as the request.
+func (d MultipartDecoder) DecodeRequestFunc(newRequest func() interface{}) DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		request := newRequest()
+		if err := d.Decode(ctx, r, request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+}
+
+// Decode reads the multipart/form-data body of r into dst, which must be a
+// pointer to a struct. Query parameters aren't considered.
+func (d MultipartDecoder) Decode(ctx context.Context, r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("multipart: decode destination must be a pointer to a struct, have %T", dst)
+	}
+	fields := map[string]formField{}
+	for _, field := range formFields(v.Elem()) {
+		fields[field.name] = field
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return errNotMultipart(r.Header.Get("Content-Type"))
+	}
+
+	var (
+		maxPart   = limitOrDefault(d.MaxPartSize, DefaultMultipartMaxPartSize)
+		maxTotal  = limitOrDefault(d.MaxTotalSize, DefaultMultipartMaxTotalSize)
+		maxMemory = limitOrDefault(d.MaxMemory, DefaultMultipartMaxMemory)
+		total     int64
+		mr        = multipart.NewReader(r.Body, params["boundary"])
+	)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Read at most one byte more than either limit allows, which is
+		// enough to tell that a limit was exceeded.
+		var content io.Reader = part
+		if limit := remainingLimit(maxPart, maxTotal, total); limit >= 0 {
+			content = io.LimitReader(part, limit+1)
+		}
+
+		name := part.FormName()
+		field, ok := fields[name]
+		var n int64
+		switch {
+		case !ok:
+			n, err = io.Copy(ioutil.Discard, content)
+		case part.FileName() != "" || field.isFile():
+			if !field.isFile() {
+				return fmt.Errorf("multipart: file part %q can't be decoded into %s", name, field.Type())
+			}
+			f := &FormFile{Filename: part.FileName(), Header: part.Header}
+			err = d.spool(ctx, f, content, &maxMemory)
+			n = f.Size
+			if err == nil {
+				err = field.setFile(f)
+			}
+		default:
+			var buf bytes.Buffer
+			n, err = io.Copy(&buf, content)
+			if err == nil {
+				err = field.setValue(buf.String())
+			}
+		}
+		part.Close()
+		if err != nil {
+			return fmt.Errorf("multipart: part %q: %w", name, err)
+		}
+
+		total += n
+		if maxPart >= 0 && n > maxPart {
+			return MultipartLimitError{Part: name, Limit: maxPart}
+		}
+		if maxTotal >= 0 && total > maxTotal {
+			return MultipartLimitError{Limit: maxTotal}
+		}
+	}
+}
+
+// spool reads a file part into memory, or into a temporary file once the
+// memory budget is exhausted.
+func (d MultipartDecoder) spool(ctx context.Context, f *FormFile, content io.Reader, maxMemory *int64) error {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, content, *maxMemory+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n <= *maxMemory {
+		*maxMemory -= n
+		f.Size = n
+		f.r = bytes.NewReader(buf.Bytes())
+		return nil
+	}
+
+	files, ok := ctx.Value(multipartFilesKey{}).(*multipartFiles)
+	if !ok {
+		return ErrMultipartCleanupMissing
+	}
+	file, err := os.CreateTemp(d.TempDir, "multipart-")
+	if err != nil {
+		return err
+	}
+	files.add(file)
+	size, err := io.Copy(file, io.MultiReader(&buf, content))
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	*maxMemory = 0
+	f.Size = size
+	f.r = file
+	f.file = file
+	return nil
+}
+
+// remainingLimit returns the number of bytes the next part may have, or -1 if
+// it's unlimited.
+func remainingLimit(maxPart, maxTotal, total int64) int64 {
+	limit := maxPart
+	if maxTotal >= 0 && (limit < 0 || maxTotal-total < limit) {
+		limit = maxTotal - total
+	}
+	return limit
+}
+
+func limitOrDefault(limit, def int64) int64 {
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
+
+// ServerMultipartCleanup registers a ServerBefore function and a
+// ServerFinalizer with the server, which together remove the temporary files
+// created by MultipartDecoder once the response has been written.
+func ServerMultipartCleanup() ServerOption {
+	return func(s *Server) {
+		ServerBefore(func(ctx context.Context, _ *http.Request) context.Context {
+			return context.WithValue(ctx, multipartFilesKey{}, &multipartFiles{})
+		})(s)
+		ServerFinalizer(func(ctx context.Context, _ int, _ *http.Request) {
+			if files, ok := ctx.Value(multipartFilesKey{}).(*multipartFiles); ok {
+				files.removeAll()
+			}
+		})(s)
+	}
+}
+
+type multipartFilesKey struct{}
+
+// multipartFiles tracks the temporary files created while decoding a single
+// request.
+type multipartFiles struct {
+	mtx   sync.Mutex
+	files []*os.File
+}
+
+func (m *multipartFiles) add(f *os.File) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.files = append(m.files, f)
+}
+
+func (m *multipartFiles) removeAll() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, f := range m.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	m.files = nil
+}
+
+// EncodeMultipartRequest is an EncodeRequestFunc that serializes the request,
+// which must be a struct or a pointer to one, as a multipart/form-data body.
+// Fields are mapped to parts with the same rules that MultipartDecoder uses;
+// *FormFile and []*FormFile fields become file parts, and zero values are
+// skipped. If the request implements Headerer, the provided headers will be
+// applied to the request.
+//
+// The body is streamed as it's read by the HTTP client, so file contents are
+// never buffered in memory.
+func EncodeMultipartRequest(_ context.Context, r *http.Request, request interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(request))
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("multipart: request must be a struct, have %T", request)
+	}
+	if headerer, ok := request.(Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Body = pr
+	r.ContentLength = -1
+	go func() {
+		err := writeMultipart(mw, v)
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return nil
+}
+
+func writeMultipart(mw *multipart.Writer, v reflect.Value) error {
+	for _, field := range formFields(v) {
+		if field.IsZero() {
+			continue
+		}
+		if field.isFile() {
+			var files []*FormFile
+			if field.Kind() == reflect.Slice {
+				files = field.Interface().([]*FormFile)
+			} else {
+				files = append(files, field.Interface().(*FormFile))
+			}
+			for _, f := range files {
+				if err := writeFormFile(mw, field.name, f); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		values, err := field.values()
+		if err != nil {
+			return fmt.Errorf("multipart: field %q: %w", field.name, err)
+		}
+		for _, value := range values {
+			if err := mw.WriteField(field.name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeFormFile(mw *multipart.Writer, name string, f *FormFile) error {
+	if f == nil {
+		return nil
+	}
+	h := make(textproto.MIMEHeader, len(f.Header)+1)
+	for k, v := range f.Header {
+		h[k] = v
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+		"name":     name,
+		"filename": f.Filename,
+	}))
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/octet-stream")
+	}
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+var formFileType = reflect.TypeOf((*FormFile)(nil))
+
+// formField is a settable struct field that's mapped to a form part.
+type formField struct {
+	reflect.Value
+	name string
+}
+
+// formFields returns the fields of the struct v that are mapped to form parts,
+// in declaration order.
+func formFields(v reflect.Value) []formField {
+	var fields []formField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("form"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag = strings.Split(tag, ",")[0]; tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, formField{v.Field(i), name})
+	}
+	return fields
+}
+
+func (f formField) isFile() bool {
+	return f.Type() == formFileType || f.Kind() == reflect.Slice && f.Type().Elem() == formFileType
+}
+
+func (f formField) setFile(file *FormFile) error {
+	if f.Kind() == reflect.Slice {
+		f.Set(reflect.Append(f.Value, reflect.ValueOf(file)))
+		return nil
+	}
+	f.Set(reflect.ValueOf(file))
+	return nil
+}
+
+// setValue parses s into the field. Slice fields accumulate every value; other
+// fields keep the last one.
+func (f formField) setValue(s string) error {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		elem := reflect.New(f.Type().Elem()).Elem()
+		if err := parseFormValue(elem, s); err != nil {
+			return err
+		}
+		f.Set(reflect.Append(f.Value, elem))
+		return nil
+	}
+	return parseFormValue(f.Value, s)
+}
+
+// values formats the field as a list of form values.
+func (f formField) values() ([]string, error) {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]string, f.Len())
+		for i := range values {
+			s, err := formatFormValue(f.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = s
+		}
+		return values, nil
+	}
+	s, err := formatFormValue(f.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+func parseFormValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(fl)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+func formatFormValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return "", fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		return string(v.Bytes()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported field type %s", v.Type())
+	}
+}
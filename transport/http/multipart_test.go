@@ -0,0 +1,213 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+type uploadRequest struct {
+	Title       string                    `form:"title"`
+	Tags        []string                  `form:"tag"`
+	Count       int                       `form:"count"`
+	Public      bool                      `form:"public"`
+	Avatar      *httptransport.FormFile   `form:"avatar"`
+	Attachments []*httptransport.FormFile `form:"attachment"`
+	Ignored     string                    `form:"-"`
+}
+
+type uploadSummary struct {
+	Title       string
+	Tags        []string
+	Count       int
+	Public      bool
+	Avatar      string
+	Attachments []string
+	TempFiles   int
+}
+
+func newUploadRequest(t *testing.T, request uploadRequest) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", nil)
+	if err := httptransport.EncodeMultipartRequest(context.Background(), req, request); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func uploadServer(t *testing.T, dir string, dec httptransport.MultipartDecoder, summary *uploadSummary, options ...httptransport.ServerOption) *httptransport.Server {
+	t.Helper()
+	dec.TempDir = dir
+	return httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			req := request.(*uploadRequest)
+			summary.Title, summary.Tags, summary.Count, summary.Public = req.Title, req.Tags, req.Count, req.Public
+			if req.Avatar != nil {
+				buf, err := ioutil.ReadAll(req.Avatar)
+				if err != nil {
+					return nil, err
+				}
+				summary.Avatar = req.Avatar.Filename + ":" + string(buf)
+			}
+			for _, f := range req.Attachments {
+				buf, err := ioutil.ReadAll(f)
+				if err != nil {
+					return nil, err
+				}
+				summary.Attachments = append(summary.Attachments, f.Filename+":"+f.ContentType()+":"+string(buf))
+			}
+			entries, _ := os.ReadDir(dir)
+			summary.TempFiles = len(entries)
+			return struct{}{}, nil
+		},
+		dec.DecodeRequestFunc(func() interface{} { return &uploadRequest{} }),
+		func(context.Context, http.ResponseWriter, interface{}) error { return nil },
+		options...,
+	)
+}
+
+func TestMultipartRoundTrip(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		large   = strings.Repeat("x", 2048)
+		summary uploadSummary
+	)
+	handler := uploadServer(t, dir, httptransport.MultipartDecoder{MaxMemory: 1024}, &summary,
+		httptransport.ServerMultipartCleanup(),
+	)
+	req := newUploadRequest(t, uploadRequest{
+		Title:  "holiday",
+		Tags:   []string{"beach", "sun"},
+		Count:  3,
+		Public: true,
+		Avatar: httptransport.NewFormFile("me.png", "image/png", strings.NewReader("png")),
+		Attachments: []*httptransport.FormFile{
+			httptransport.NewFormFile("a.txt", "text/plain", strings.NewReader("aaa")),
+			httptransport.NewFormFile("b.bin", "", strings.NewReader(large)),
+		},
+		Ignored: "ignored",
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if want, have := http.StatusOK, rec.Code; want != have {
+		t.Fatalf("StatusCode: want %d, have %d (%s)", want, have, rec.Body.String())
+	}
+	want := uploadSummary{
+		Title:  "holiday",
+		Tags:   []string{"beach", "sun"},
+		Count:  3,
+		Public: true,
+		Avatar: "me.png:png",
+		Attachments: []string{
+			"a.txt:text/plain:aaa",
+			"b.bin:application/octet-stream:" + large,
+		},
+		TempFiles: 1,
+	}
+	if !reflect.DeepEqual(want, summary) {
+		t.Errorf("want %+v, have %+v", want, summary)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("want temporary files removed, have %d", len(entries))
+	}
+}
+
+func TestMultipartLimits(t *testing.T) {
+	for _, testcase := range []struct {
+		name    string
+		decoder httptransport.MultipartDecoder
+		want    httptransport.MultipartLimitError
+	}{
+		{"part", httptransport.MultipartDecoder{MaxPartSize: 10}, httptransport.MultipartLimitError{Part: "avatar", Limit: 10}},
+		{"total", httptransport.MultipartDecoder{MaxTotalSize: 15}, httptransport.MultipartLimitError{Limit: 15}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				dir     = t.TempDir()
+				summary uploadSummary
+				have    error
+			)
+			handler := uploadServer(t, dir, testcase.decoder, &summary,
+				httptransport.ServerMultipartCleanup(),
+				httptransport.ServerErrorEncoder(func(ctx context.Context, err error, w http.ResponseWriter) {
+					have = err
+					httptransport.DefaultErrorEncoder(ctx, err, w)
+				}),
+			)
+			req := newUploadRequest(t, uploadRequest{
+				Title:  "holiday",
+				Avatar: httptransport.NewFormFile("me.png", "image/png", strings.NewReader(strings.Repeat("x", 11))),
+			})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if want, have := http.StatusRequestEntityTooLarge, rec.Code; want != have {
+				t.Errorf("StatusCode: want %d, have %d (%s)", want, have, rec.Body.String())
+			}
+			if want := testcase.want; !errors.Is(have, want) {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestMultipartCleanupMissing(t *testing.T) {
+	var (
+		summary uploadSummary
+		have    error
+	)
+	handler := uploadServer(t, t.TempDir(), httptransport.MultipartDecoder{MaxMemory: -1}, &summary,
+		httptransport.ServerErrorEncoder(func(ctx context.Context, err error, w http.ResponseWriter) {
+			have = err
+			httptransport.DefaultErrorEncoder(ctx, err, w)
+		}),
+	)
+	req := newUploadRequest(t, uploadRequest{
+		Avatar: httptransport.NewFormFile("me.png", "image/png", strings.NewReader("png")),
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if want := httptransport.ErrMultipartCleanupMissing; !errors.Is(have, want) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+type headeredUploadRequest struct {
+	uploadRequest
+}
+
+func (headeredUploadRequest) Headers() http.Header {
+	return http.Header{"X-Tag": {"beach", "sun"}}
+}
+
+func TestMultipartRequestHeaders(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	if err := httptransport.EncodeMultipartRequest(context.Background(), req, headeredUploadRequest{uploadRequest{Title: "holiday"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := []string{"beach", "sun"}, req.Header.Values("X-Tag"); !reflect.DeepEqual(want, have) {
+		t.Errorf("X-Tag: want %v, have %v", want, have)
+	}
+}
+
+func TestMultipartNotMultipart(t *testing.T) {
+	var summary uploadSummary
+	handler := uploadServer(t, t.TempDir(), httptransport.MultipartDecoder{}, &summary)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"title":"holiday"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if want, have := http.StatusUnsupportedMediaType, rec.Code; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// ProblemContentType is the media type of an RFC 9457 problem details object
+// serialized as JSON.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details object. It implements error, so it
+// may be returned directly from endpoints, and StatusCoder, so it's also
+// understood by DefaultErrorEncoder.
+//
+// Members of the problem object that aren't defined by the RFC are collected
+// in Extensions. Extension members can't override the standard members.
+type Problem struct {
+	// Type is a URI reference identifying the problem type. When empty, the
+	// member is omitted, which clients treat as "about:blank".
+	Type string
+
+	// Title is a short, human-readable summary of the problem type.
+	Title string
+
+	// Status is the HTTP status code generated by the origin server.
+	Status int
+
+	// Detail is a human-readable explanation specific to this occurrence of
+	// the problem.
+	Detail string
+
+	// Instance is a URI reference identifying this specific occurrence of the
+	// problem.
+	Instance string
+
+	// Errors lists individual validation errors, if any. It's serialized as
+	// the "errors" extension member.
+	Errors []ProblemError
+
+	// Extensions holds any additional members of the problem object.
+	Extensions map[string]interface{}
+}
+
+// ProblemError describes a single validation error within a Problem.
+type ProblemError struct {
+	// Detail describes what is wrong with the offending value.
+	Detail string `json:"detail"`
+
+	// Pointer is a JSON Pointer (RFC 6901) to the offending member of the
+	// request body, e.g. "#/items/0/quantity".
+	Pointer string `json:"pointer,omitempty"`
+
+	// Parameter names the offending query or path parameter.
+	Parameter string `json:"parameter,omitempty"`
+
+	// Header names the offending request header.
+	Header string `json:"header,omitempty"`
+}
+
+// ProblemDetailer is checked by ProblemErrorEncoder. If an error value
+// implements ProblemDetailer, the returned Problem is used as the basis of the
+// response instead of one derived from the error string.
+type ProblemDetailer interface {
+	ProblemDetails() Problem
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	switch {
+	case p.Detail != "" && p.Title != "":
+		return p.Title + ": " + p.Detail
+	case p.Detail != "":
+		return p.Detail
+	case p.Title != "":
+		return p.Title
+	default:
+		return fmt.Sprintf("problem (status %d)", p.StatusCode())
+	}
+}
+
+// StatusCode implements StatusCoder. If Status is unset, it returns
+// StatusInternalServerError (500).
+func (p *Problem) StatusCode() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+// ProblemDetails implements ProblemDetailer.
+func (p *Problem) ProblemDetails() Problem {
+	return *p
+}
+
+// MarshalJSON implements json.Marshaler, flattening Errors and Extensions
+// into the top-level object.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+6)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if len(p.Errors) > 0 {
+		m["errors"] = p.Errors
+	}
+	for k, v := range map[string]string{
+		"type":     p.Type,
+		"title":    p.Title,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+	} {
+		delete(m, k)
+		if v != "" {
+			m[k] = v
+		}
+	}
+	delete(m, "status")
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Members with an unexpected type
+// are ignored, as required by RFC 9457.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for k, v := range raw {
+		switch k {
+		case "type":
+			json.Unmarshal(v, &p.Type)
+		case "title":
+			json.Unmarshal(v, &p.Title)
+		case "status":
+			json.Unmarshal(v, &p.Status)
+		case "detail":
+			json.Unmarshal(v, &p.Detail)
+		case "instance":
+			json.Unmarshal(v, &p.Instance)
+		case "errors":
+			if err := json.Unmarshal(v, &p.Errors); err == nil {
+				break
+			}
+			p.Errors = nil
+			fallthrough
+		default:
+			var ext interface{}
+			if err := json.Unmarshal(v, &ext); err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = map[string]interface{}{}
+			}
+			p.Extensions[k] = ext
+		}
+	}
+	return nil
+}
+
+// ProblemErrorEncoder is an ErrorEncoder that writes the error as an RFC 9457
+// problem details object, with a content type of application/problem+json.
+//
+// If the error implements ProblemDetailer (as *Problem does), the returned
+// Problem is used as is. Otherwise, the error string becomes the detail
+// member. If the error implements StatusCoder, the provided StatusCode is used
+// as both the response status and the status member; by default,
+// StatusInternalServerError (500) is used. If the error implements Headerer,
+// the provided headers will be applied to the response. A missing title is
+// filled in with the standard status text whenever the problem type is
+// "about:blank".
+func ProblemErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	var p Problem
+	if pd, ok := err.(ProblemDetailer); ok {
+		p = pd.ProblemDetails()
+	} else {
+		p = Problem{Detail: err.Error()}
+	}
+
+	code := http.StatusInternalServerError
+	if p.Status != 0 {
+		code = p.Status
+	}
+	if sc, ok := err.(StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	p.Status = code
+	if p.Title == "" && (p.Type == "" || p.Type == "about:blank") {
+		p.Title = http.StatusText(code)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	if headerer, ok := err.(Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	body, marshalErr := json.Marshal(p)
+	if marshalErr != nil {
+		body, _ = json.Marshal(Problem{Title: p.Title, Status: p.Status, Detail: p.Detail})
+	}
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// DecodeProblemResponse returns a DecodeResponseFunc that checks whether the
+// response carries a problem details object. If it does, the body is decoded
+// into a *Problem, which is returned as the error. Otherwise, the response is
+// passed to the next DecodeResponseFunc unchanged.
+//
+// The returned Problem's Status is taken from the response status code if the
+// object doesn't specify one.
+func DecodeProblemResponse(next DecodeResponseFunc) DecodeResponseFunc {
+	return func(ctx context.Context, r *http.Response) (interface{}, error) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != ProblemContentType {
+			return next(ctx, r)
+		}
+		var p Problem
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			return nil, fmt.Errorf("decoding problem details: %w", err)
+		}
+		if p.Status == 0 {
+			p.Status = r.StatusCode
+		}
+		return nil, &p
+	}
+}
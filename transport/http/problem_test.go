@@ -0,0 +1,191 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func TestProblemErrorEncoderPlainError(t *testing.T) {
+	w := httptest.NewRecorder()
+	httptransport.ProblemErrorEncoder(context.Background(), errors.New("dang"), w)
+
+	if want, have := http.StatusInternalServerError, w.Code; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	if want, have := httptransport.ProblemContentType, w.Header().Get("Content-Type"); want != have {
+		t.Errorf("Content-Type: want %q, have %q", want, have)
+	}
+	var have map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"title":  "Internal Server Error",
+		"status": float64(500),
+		"detail": "dang",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Body: want %v, have %v", want, have)
+	}
+}
+
+func TestProblemErrorEncoderEnhancedError(t *testing.T) {
+	w := httptest.NewRecorder()
+	httptransport.ProblemErrorEncoder(context.Background(), enhancedError{}, w)
+
+	if want, have := http.StatusTeapot, w.Code; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	if want, have := "1", w.Header().Get("X-Enhanced"); want != have {
+		t.Errorf("X-Enhanced: want %q, have %q", want, have)
+	}
+	var p httptransport.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusTeapot, p.Status; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if want, have := "enhanced error", p.Detail; want != have {
+		t.Errorf("detail: want %q, have %q", want, have)
+	}
+}
+
+func TestProblemErrorEncoderProblem(t *testing.T) {
+	problem := &httptransport.Problem{
+		Type:     "https://example.com/probs/out-of-credit",
+		Title:    "You do not have enough credit.",
+		Status:   http.StatusForbidden,
+		Detail:   "Your current balance is 30, but that costs 50.",
+		Instance: "/account/12345/msgs/abc",
+		Extensions: map[string]interface{}{
+			"balance": 30,
+			"status":  "ignored",
+		},
+	}
+
+	w := httptest.NewRecorder()
+	httptransport.ProblemErrorEncoder(context.Background(), problem, w)
+
+	if want, have := http.StatusForbidden, w.Code; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	var have map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"type":     "https://example.com/probs/out-of-credit",
+		"title":    "You do not have enough credit.",
+		"status":   float64(403),
+		"detail":   "Your current balance is 30, but that costs 50.",
+		"instance": "/account/12345/msgs/abc",
+		"balance":  float64(30),
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Body: want %v, have %v", want, have)
+	}
+}
+
+func TestProblemRoundTrip(t *testing.T) {
+	problem := &httptransport.Problem{
+		Type:   "https://example.com/probs/validation",
+		Title:  "Your request is not valid.",
+		Status: http.StatusUnprocessableEntity,
+		Errors: []httptransport.ProblemError{
+			{Detail: "must be a positive integer", Pointer: "#/age"},
+			{Detail: "must be 'green', 'red' or 'blue'", Pointer: "#/profile/color"},
+		},
+		Extensions: map[string]interface{}{"trace": "abc123"},
+	}
+
+	server := httptest.NewServer(httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return nil, problem },
+		func(context.Context, *http.Request) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerErrorEncoder(httptransport.ProblemErrorEncoder),
+	))
+	defer server.Close()
+
+	client := httptransport.NewClient(
+		"GET",
+		mustParse(server.URL),
+		func(context.Context, *http.Request, interface{}) error { return nil },
+		httptransport.DecodeProblemResponse(func(context.Context, *http.Response) (interface{}, error) {
+			t.Error("next decoder called for problem response")
+			return nil, nil
+		}),
+	)
+
+	_, err := client.Endpoint()(context.Background(), struct{}{})
+	var have *httptransport.Problem
+	if !errors.As(err, &have) {
+		t.Fatalf("want *Problem, have %T (%v)", err, err)
+	}
+	if !reflect.DeepEqual(problem, have) {
+		t.Errorf("want %+v, have %+v", problem, have)
+	}
+}
+
+func TestDecodeProblemResponsePassthrough(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"foo":"bar"}`))
+	}))
+	defer server.Close()
+
+	client := httptransport.NewClient(
+		"GET",
+		mustParse(server.URL),
+		func(context.Context, *http.Request, interface{}) error { return nil },
+		httptransport.DecodeProblemResponse(func(_ context.Context, r *http.Response) (interface{}, error) {
+			buf, err := ioutil.ReadAll(r.Body)
+			return string(buf), err
+		}),
+	)
+
+	response, err := client.Endpoint()(context.Background(), struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"foo":"bar"}`, strings.TrimSpace(response.(string)); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestDecodeProblemResponseStatusFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"title":"Not Found","status":"bogus"}`))
+	}))
+	defer server.Close()
+
+	client := httptransport.NewClient(
+		"GET",
+		mustParse(server.URL),
+		func(context.Context, *http.Request, interface{}) error { return nil },
+		httptransport.DecodeProblemResponse(nil),
+	)
+
+	_, err := client.Endpoint()(context.Background(), struct{}{})
+	var p *httptransport.Problem
+	if !errors.As(err, &p) {
+		t.Fatalf("want *Problem, have %T (%v)", err, err)
+	}
+	if want, have := http.StatusNotFound, p.StatusCode(); want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	if want, have := "Not Found", err.Error(); want != have {
+		t.Errorf("Error: want %q, have %q", want, have)
+	}
+}
@@ -20,6 +20,11 @@ type Server struct {
 	errorEncoder ErrorEncoder
 	finalizer    []ServerFinalizerFunc
 	errorHandler transport.ErrorHandler
+
+	compression          *compression
+	decompression        bool
+	decompressionMaxSize int64
+	cors                 *CORSPolicy
 }
 
 // NewServer constructs a new server, which implements http.Handler and wraps
@@ -107,6 +112,29 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w = iw.reimplementInterfaces()
 	}
 
+	if s.compression != nil {
+		if cw, ok := s.compression.wrap(w, r); ok {
+			defer cw.Close()
+			w = cw.reimplementInterfaces()
+		}
+	}
+
+	if s.cors != nil {
+		if isPreflight(r) {
+			s.cors.servePreflight(w, r)
+			return
+		}
+		s.cors.setHeaders(w.Header(), r)
+	}
+
+	if s.decompression {
+		if err := decompressBody(r, s.decompressionMaxSize); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			s.errorEncoder(ctx, err, w)
+			return
+		}
+	}
+
 	for _, f := range s.before {
 		ctx = f(ctx, r)
 	}
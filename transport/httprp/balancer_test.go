@@ -0,0 +1,283 @@
+package httprp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kit/kit/sd"
+	httptransport "github.com/go-kit/kit/transport/httprp"
+)
+
+// countingTransport counts the requests sent to the upstreams.
+type countingTransport struct {
+	n int64
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func deadInstance() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.URL
+}
+
+func TestLoadBalancedServerRoundRobin(t *testing.T) {
+	var hits [2]int64
+	var instances sd.FixedInstancer
+	for i := range hits {
+		i := i
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&hits[i], 1)
+			w.Write([]byte("hey"))
+		}))
+		defer origin.Close()
+		instances = append(instances, strings.TrimPrefix(origin.URL, "http://"))
+	}
+
+	proxyServer := httptest.NewServer(httptransport.NewLoadBalancedServer(instances))
+	defer proxyServer.Close()
+
+	for i := 0; i < 4; i++ {
+		resp, err := http.Get(proxyServer.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want, have := "hey", string(body); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+	for i := range hits {
+		if want, have := int64(2), atomic.LoadInt64(&hits[i]); want != have {
+			t.Errorf("instance %d: want %d requests, have %d", i, want, have)
+		}
+	}
+}
+
+func TestLoadBalancedServerRetriesIdempotentRequests(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer origin.Close()
+
+	proxyServer := httptest.NewServer(httptransport.NewLoadBalancedServer(
+		sd.FixedInstancer{deadInstance(), origin.URL},
+	))
+	defer proxyServer.Close()
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodPut, proxyServer.URL, strings.NewReader("payload"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want, have := http.StatusOK, resp.StatusCode; want != have {
+			t.Errorf("want %d, have %d", want, have)
+		}
+		if want, have := "payload", string(body); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
+
+func TestLoadBalancedServerAttempts(t *testing.T) {
+	for _, testcase := range []struct {
+		method   string
+		attempts int64
+	}{
+		{http.MethodGet, 3},
+		{http.MethodPost, 1},
+	} {
+		rt := &countingTransport{}
+		proxyServer := httptest.NewServer(httptransport.NewLoadBalancedServer(
+			sd.FixedInstancer{deadInstance()},
+			httptransport.ServerTransport(rt),
+		))
+
+		req, _ := http.NewRequest(testcase.method, proxyServer.URL, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		proxyServer.Close()
+
+		if want, have := http.StatusBadGateway, resp.StatusCode; want != have {
+			t.Errorf("%s: want %d, have %d", testcase.method, want, have)
+		}
+		if want, have := testcase.attempts, atomic.LoadInt64(&rt.n); want != have {
+			t.Errorf("%s: want %d attempts, have %d", testcase.method, want, have)
+		}
+	}
+}
+
+func TestLoadBalancedServerNoInstances(t *testing.T) {
+	proxyServer := httptest.NewServer(httptransport.NewLoadBalancedServer(sd.FixedInstancer{}))
+	defer proxyServer.Close()
+
+	resp, err := http.Get(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusServiceUnavailable, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+type contextKey struct{}
+
+func TestLoadBalancedServerRewrite(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, have := "/base/v2/users", r.URL.Path; want != have {
+			t.Errorf("path: want %q, have %q", want, have)
+		}
+		if want, have := "tenant-1", r.Header.Get("X-Tenant"); want != have {
+			t.Errorf("header: want %q, have %q", want, have)
+		}
+		w.Header().Set("Server", "origin")
+	}))
+	defer origin.Close()
+
+	proxyServer := httptest.NewServer(httptransport.NewLoadBalancedServer(
+		sd.FixedInstancer{origin.URL + "/base"},
+		httptransport.ServerBefore(func(ctx context.Context, r *http.Request) context.Context {
+			return context.WithValue(ctx, contextKey{}, "tenant-1")
+		}),
+		httptransport.ServerRewrite(func(r *http.Request) {
+			r.URL.Path = strings.Replace(r.URL.Path, "/v1/", "/v2/", 1)
+			r.Header.Set("X-Tenant", r.Context().Value(contextKey{}).(string))
+		}),
+		httptransport.ServerModifyResponse(func(resp *http.Response) error {
+			resp.Header.Del("Server")
+			return nil
+		}),
+	))
+	defer proxyServer.Close()
+
+	resp, err := http.Get(proxyServer.URL + "/v1/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if have := resp.Header.Get("Server"); have != "" {
+		t.Errorf("Server header wasn't removed: %q", have)
+	}
+}
+
+func TestServerErrorEncoder(t *testing.T) {
+	originURL, _ := url.Parse(deadInstance())
+	var encoded error
+	handler := httptransport.NewServer(
+		originURL,
+		httptransport.ServerErrorEncoder(func(_ context.Context, err error, w http.ResponseWriter) {
+			encoded = err
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	)
+	proxyServer := httptest.NewServer(handler)
+	defer proxyServer.Close()
+
+	resp, err := http.Get(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusTeapot, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if encoded == nil {
+		t.Error("error encoder wasn't called")
+	}
+}
+
+func TestLoadBalancedServerRetryBodySize(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer origin.Close()
+
+	for _, testcase := range []struct {
+		instances sd.FixedInstancer
+		status    int
+		attempts  int64
+	}{
+		{sd.FixedInstancer{origin.URL}, http.StatusOK, 1},
+		{sd.FixedInstancer{deadInstance()}, http.StatusBadGateway, 1},
+	} {
+		rt := &countingTransport{}
+		proxyServer := httptest.NewServer(httptransport.NewLoadBalancedServer(
+			testcase.instances,
+			httptransport.ServerTransport(rt),
+			httptransport.ServerRetryBodySize(4),
+		))
+
+		req, _ := http.NewRequest(http.MethodPut, proxyServer.URL, strings.NewReader("payload"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		proxyServer.Close()
+
+		if want, have := testcase.status, resp.StatusCode; want != have {
+			t.Errorf("%v: want %d, have %d", testcase.instances, want, have)
+		}
+		if want, have := testcase.attempts, atomic.LoadInt64(&rt.n); want != have {
+			t.Errorf("%v: want %d attempts, have %d", testcase.instances, want, have)
+		}
+		if testcase.status == http.StatusOK && string(body) != "payload" {
+			t.Errorf("%v: want %q, have %q", testcase.instances, "payload", body)
+		}
+	}
+}
+
+// registryInstancer is an sd.Instancer which records its registrations.
+type registryInstancer struct {
+	registered int64
+}
+
+func (i *registryInstancer) Register(ch chan<- sd.Event) {
+	atomic.AddInt64(&i.registered, 1)
+	ch <- sd.Event{}
+}
+func (i *registryInstancer) Deregister(chan<- sd.Event) { atomic.AddInt64(&i.registered, -1) }
+func (i *registryInstancer) Stop()                      {}
+
+func TestLoadBalancedServerClose(t *testing.T) {
+	instancer := &registryInstancer{}
+	server := httptransport.NewLoadBalancedServer(instancer)
+	if want, have := int64(1), atomic.LoadInt64(&instancer.registered); want != have {
+		t.Errorf("registrations: want %d, have %d", want, have)
+	}
+	server.Close()
+	if want, have := int64(0), atomic.LoadInt64(&instancer.registered); want != have {
+		t.Errorf("registrations after Close: want %d, have %d", want, have)
+	}
+
+	// Close does nothing for servers of a single upstream.
+	httptransport.NewServer(mustParseURL(t, "http://localhost")).Close()
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
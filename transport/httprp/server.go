@@ -1,10 +1,21 @@
 package httprp
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
 )
 
 // RequestFunc may take information from an HTTP request and put it into a
@@ -12,11 +23,36 @@ import (
 // endpoint.
 type RequestFunc func(context.Context, *http.Request) context.Context
 
+// RewriteFunc may modify the outgoing request to the upstream, typically its
+// path or headers. Its context is the one returned by the RequestFuncs. With
+// NewServer, its URL already points to the upstream; with
+// NewLoadBalancedServer, the scheme, host and base path of the picked
+// upstream are applied afterwards.
+type RewriteFunc func(*http.Request)
+
+// ResponseFunc may modify the response of the upstream before it's copied to
+// the client. Returning an error aborts the response, and the error is passed
+// to the ErrorEncoder.
+type ResponseFunc func(*http.Response) error
+
+// ErrorEncoder is responsible for encoding an error to the ResponseWriter,
+// when the upstream couldn't be reached, or its response was rejected by a
+// ResponseFunc.
+type ErrorEncoder func(ctx context.Context, err error, w http.ResponseWriter)
+
 // Server is a proxying request handler.
 type Server struct {
 	proxy        http.Handler
 	before       []RequestFunc
-	errorEncoder func(w http.ResponseWriter, err error)
+	rewrite      []RewriteFunc
+	modify       []ResponseFunc
+	errorEncoder ErrorEncoder
+	errorHandler transport.ErrorHandler
+	transport    http.RoundTripper
+	newBalancer  func(sd.Endpointer) lb.Balancer
+	retryMax     int
+	retryBody    int64
+	close        func()
 }
 
 // NewServer constructs a new server that implements http.Server and will proxy
@@ -27,8 +63,56 @@ func NewServer(
 	baseURL *url.URL,
 	options ...ServerOption,
 ) *Server {
+	s := newServer(options)
+	proxy := httputil.NewSingleHostReverseProxy(baseURL)
+	proxy.Transport = s.transport
+	s.configure(proxy)
+	return s
+}
+
+// NewLoadBalancedServer constructs a new server that proxies each request to
+// an upstream picked among the instances of the Instancer. Instances are
+// base URLs, like for NewServer, or host:port pairs, which are proxied to
+// over plain HTTP.
+//
+// Requests with an idempotent method are retried on other instances when
+// the upstream can't be reached, up to the number of attempts set by
+// ServerRetry. Their body is buffered to be replayed, up to the size set by
+// ServerRetryBodySize. Close the server to stop tracking the instances.
+func NewLoadBalancedServer(
+	instancer sd.Instancer,
+	options ...ServerOption,
+) *Server {
+	s := newServer(options)
+	endpointer := sd.NewEndpointer(instancer, s.factory, log.NewNopLogger())
+	s.close = endpointer.Close
+	balancer := s.newBalancer(endpointer)
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			// The URL is set for each attempt by the balanced transport.
+			if _, ok := r.Header["User-Agent"]; !ok {
+				r.Header.Set("User-Agent", "")
+			}
+		},
+		Transport: balancedTransport{
+			balancer:  balancer,
+			retryMax:  s.retryMax,
+			retryBody: s.retryBody,
+		},
+	}
+	s.configure(proxy)
+	return s
+}
+
+func newServer(options []ServerOption) *Server {
 	s := &Server{
-		proxy: httputil.NewSingleHostReverseProxy(baseURL),
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		transport:    http.DefaultTransport,
+		newBalancer:  func(e sd.Endpointer) lb.Balancer { return lb.NewRoundRobin(e) },
+		retryMax:     3,
+		retryBody:    DefaultRetryBodySize,
+		close:        func() {},
 	}
 	for _, option := range options {
 		option(s)
@@ -36,6 +120,31 @@ func NewServer(
 	return s
 }
 
+func (s *Server) configure(proxy *httputil.ReverseProxy) {
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		for _, f := range s.rewrite {
+			f(r)
+		}
+	}
+	if len(s.modify) > 0 {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			for _, f := range s.modify {
+				if err := f(resp); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		s.errorHandler.Handle(r.Context(), err)
+		s.errorEncoder(r.Context(), err, w)
+	}
+	s.proxy = proxy
+}
+
 // ServerOption sets an optional parameter for servers.
 type ServerOption func(*Server)
 
@@ -45,6 +154,69 @@ func ServerBefore(before ...RequestFunc) ServerOption {
 	return func(s *Server) { s.before = append(s.before, before...) }
 }
 
+// ServerRewrite functions are executed on the outgoing request to the
+// upstream, to rewrite its path or headers.
+func ServerRewrite(rewrite ...RewriteFunc) ServerOption {
+	return func(s *Server) { s.rewrite = append(s.rewrite, rewrite...) }
+}
+
+// ServerModifyResponse functions are executed on the response of the
+// upstream before it's copied to the client.
+func ServerModifyResponse(modify ...ResponseFunc) ServerOption {
+	return func(s *Server) { s.modify = append(s.modify, modify...) }
+}
+
+// ServerErrorEncoder is used to encode errors to the http.ResponseWriter
+// whenever the upstream can't be proxied to. By default, errors are written
+// with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *Server) { s.errorEncoder = ee }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default,
+// non-terminal errors are ignored. This is intended as a diagnostic measure.
+func ServerErrorHandler(errorHandler transport.ErrorHandler) ServerOption {
+	return func(s *Server) { s.errorHandler = errorHandler }
+}
+
+// ServerTransport sets the http.RoundTripper used to send requests to the
+// upstreams. By default, http.DefaultTransport is used.
+func ServerTransport(rt http.RoundTripper) ServerOption {
+	return func(s *Server) { s.transport = rt }
+}
+
+// ServerBalancer sets how a load-balanced server picks an upstream among the
+// endpoints of its instances. By default, lb.NewRoundRobin is used.
+func ServerBalancer(newBalancer func(sd.Endpointer) lb.Balancer) ServerOption {
+	return func(s *Server) { s.newBalancer = newBalancer }
+}
+
+// ServerRetry sets how many times in total a load-balanced server tries to
+// proxy an idempotent request. By default, it's 3.
+func ServerRetry(max int) ServerOption {
+	return func(s *Server) { s.retryMax = max }
+}
+
+// DefaultRetryBodySize is the size of the largest request body a
+// load-balanced server buffers to retry the request, unless configured with
+// ServerRetryBodySize.
+const DefaultRetryBodySize = 1 << 20
+
+// ServerRetryBodySize sets the size of the largest request body, in bytes, a
+// load-balanced server buffers to retry the request. Requests with a larger
+// body are tried once, with their body streamed. By default,
+// DefaultRetryBodySize is used.
+func ServerRetryBodySize(n int64) ServerOption {
+	return func(s *Server) { s.retryBody = n }
+}
+
+// Close stops a server constructed with NewLoadBalancedServer from tracking
+// the instances of its Instancer. It does nothing for servers constructed
+// with NewServer.
+func (s Server) Close() {
+	s.close()
+}
+
 // ServeHTTP implements http.Handler.
 func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -53,5 +225,162 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx = f(ctx, r)
 	}
 
-	s.proxy.ServeHTTP(w, r)
+	s.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DefaultErrorEncoder writes the status code matching the error: 503 Service
+// Unavailable if there's no upstream, 504 Gateway Timeout if it didn't answer
+// in time, and 502 Bad Gateway otherwise.
+func DefaultErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	if retryErr, ok := err.(lb.RetryError); ok {
+		err = retryErr.Final
+	}
+	switch {
+	case errors.Is(err, lb.ErrNoEndpoints):
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(http.StatusGatewayTimeout)
+	default:
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+// factory is an sd.Factory, whose endpoints send an *http.Request to the
+// instance, and return its *http.Response.
+func (s *Server) factory(instance string) (endpoint.Endpoint, io.Closer, error) {
+	if !strings.Contains(instance, "://") {
+		instance = "http://" + instance
+	}
+	target, err := url.Parse(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*http.Request)
+		out := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out.Body = body
+		}
+		out.URL.Scheme = target.Scheme
+		out.URL.Host = target.Host
+		out.URL.Path, out.URL.RawPath = joinURLPath(target, req.URL)
+		if target.RawQuery != "" && out.URL.RawQuery != "" {
+			out.URL.RawQuery = target.RawQuery + "&" + out.URL.RawQuery
+		} else if target.RawQuery != "" {
+			out.URL.RawQuery = target.RawQuery
+		}
+		return s.transport.RoundTrip(out)
+	}, nil, nil
+}
+
+// balancedTransport is an http.RoundTripper that sends each request to an
+// upstream picked by the balancer. The attempts aren't bound by a timeout,
+// like lb.Retry's: it would also apply to reading the response body.
+type balancedTransport struct {
+	balancer  lb.Balancer
+	retryMax  int
+	retryBody int64
+}
+
+func (t balancedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	max := 1
+	if idempotent(req.Method) {
+		max = t.retryMax
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			replayable, err := bufferBody(req, t.retryBody)
+			if err != nil {
+				return nil, err
+			}
+			if !replayable {
+				max = 1
+			}
+		}
+	}
+
+	var final lb.RetryError
+	for i := 1; ; i++ {
+		e, err := t.balancer.Endpoint()
+		if err != nil {
+			final.RawErrors = append(final.RawErrors, err)
+			final.Final = err
+			return nil, final
+		}
+		response, err := e(req.Context(), req)
+		if err == nil {
+			return response.(*http.Response), nil
+		}
+		final.RawErrors = append(final.RawErrors, err)
+		if i >= max || req.Context().Err() != nil {
+			final.Final = err
+			return nil, final
+		}
+	}
+}
+
+// bufferBody reads the body of the request, up to max bytes, so that it can
+// be replayed with GetBody. If the body is larger, the request is left with
+// a body streaming the rest, and can't be replayed.
+func bufferBody(req *http.Request, max int64) (replayable bool, err error) {
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil {
+		req.Body.Close()
+		return false, err
+	}
+	if int64(len(body)) > max {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return false, nil
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return true, nil
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// joinURLPath joins the paths of the base URL and of the request, like
+// httputil.NewSingleHostReverseProxy does.
+func joinURLPath(base, u *url.URL) (path, rawpath string) {
+	if base.RawPath == "" && u.RawPath == "" {
+		return singleJoiningSlash(base.Path, u.Path), ""
+	}
+	basepath := base.EscapedPath()
+	upath := u.EscapedPath()
+
+	switch {
+	case strings.HasSuffix(basepath, "/") && strings.HasPrefix(upath, "/"):
+		return base.Path + u.Path[1:], basepath + upath[1:]
+	case !strings.HasSuffix(basepath, "/") && !strings.HasPrefix(upath, "/"):
+		return base.Path + "/" + u.Path, basepath + "/" + upath
+	}
+	return base.Path + u.Path, basepath + upath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
 }
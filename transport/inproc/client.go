@@ -0,0 +1,125 @@
+package inproc
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Client wraps a Handler and provides a method that implements
+// endpoint.Endpoint.
+type Client struct {
+	handler   Handler
+	enc       EncodeRequestFunc
+	dec       DecodeResponseFunc
+	codec     Codec
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	finalizer []ClientFinalizerFunc
+}
+
+// NewClient constructs a usable Client for the handler, typically a Server.
+func NewClient(
+	handler Handler,
+	enc EncodeRequestFunc,
+	dec DecodeResponseFunc,
+	options ...ClientOption,
+) *Client {
+	c := &Client{
+		handler: handler,
+		enc:     enc,
+		dec:     dec,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(*Client)
+
+// ClientBefore sets the RequestFuncs that are applied to the headers of the
+// outgoing Request before the handler is invoked.
+func ClientBefore(before ...ClientRequestFunc) ClientOption {
+	return func(c *Client) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter sets the ClientResponseFuncs that are applied to the headers of
+// the incoming Response prior to it being decoded.
+func ClientAfter(after ...ClientResponseFunc) ClientOption {
+	return func(c *Client) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer is executed at the end of every request.
+// By default, no finalizer is registered.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *Client) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// ClientCodec round-trips the payloads of requests and responses through the
+// codec, as a network transport would, to catch serialization bugs. By
+// default, payloads are passed as is.
+func ClientCodec(codec Codec) ClientOption {
+	return func(c *Client) { c.codec = codec }
+}
+
+// Endpoint returns a usable endpoint that invokes the handler.
+func (c Client) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		if c.finalizer != nil {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		payload, err := c.enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = c.roundTrip(payload); err != nil {
+			return nil, err
+		}
+
+		header := map[string]string{}
+		for _, f := range c.before {
+			ctx = f(ctx, header)
+		}
+
+		resp, err := c.handler.ServeInProc(ctx, Request{Header: header, Payload: payload})
+		if err != nil {
+			return nil, err
+		}
+		if resp.Payload, err = c.roundTrip(resp.Payload); err != nil {
+			return nil, err
+		}
+
+		if resp.Header == nil {
+			resp.Header = map[string]string{}
+		}
+		for _, f := range c.after {
+			ctx = f(ctx, resp.Header)
+		}
+
+		response, err = c.dec(ctx, resp.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+func (c Client) roundTrip(payload interface{}) (interface{}, error) {
+	if c.codec == nil || payload == nil {
+		return payload, nil
+	}
+	return RoundTrip(c.codec, payload)
+}
+
+// ClientFinalizerFunc can be used to perform work at the end of a client
+// request, after the response is returned. The principal intended use is for
+// error logging.
+// Note: err may be nil.
+type ClientFinalizerFunc func(ctx context.Context, err error)
@@ -0,0 +1,154 @@
+package inproc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/kit/transport/inproc"
+)
+
+type upperRequest struct {
+	S      string
+	secret string
+}
+
+type upperResponse struct {
+	V   string
+	Err string
+}
+
+func upperEndpoint(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(upperRequest)
+	if req.S == "" {
+		return nil, errors.New("empty string")
+	}
+	v := []byte(req.S + req.secret)
+	for i, c := range v {
+		if 'a' <= c && c <= 'z' {
+			v[i] = c - 'a' + 'A'
+		}
+	}
+	return upperResponse{V: string(v)}, nil
+}
+
+type ctxKey struct{}
+
+func TestClientServer(t *testing.T) {
+	var (
+		requestID string
+		servedBy  string
+		finalized = []string{}
+	)
+	server := inproc.NewServer(
+		upperEndpoint, inproc.Nop, inproc.Nop,
+		inproc.ServerBefore(func(ctx context.Context, header map[string]string) context.Context {
+			return context.WithValue(ctx, ctxKey{}, header["request-id"])
+		}),
+		inproc.ServerAfter(func(ctx context.Context, header map[string]string) context.Context {
+			requestID, _ = ctx.Value(ctxKey{}).(string)
+			header["served-by"] = "upper"
+			return ctx
+		}),
+		inproc.ServerFinalizer(func(context.Context, error) { finalized = append(finalized, "server") }),
+	)
+	client := inproc.NewClient(
+		server, inproc.Nop, inproc.Nop,
+		inproc.ClientBefore(inproc.SetRequestHeader("request-id", "abc")),
+		inproc.ClientAfter(func(ctx context.Context, header map[string]string) context.Context {
+			servedBy = header["served-by"]
+			return ctx
+		}),
+		inproc.ClientFinalizer(func(context.Context, error) { finalized = append(finalized, "client") }),
+	)
+
+	response, err := client.Endpoint()(context.Background(), upperRequest{S: "hi", secret: "!x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "HI!X", response.(upperResponse).V; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := "abc", requestID; want != have {
+		t.Errorf("request header: want %q, have %q", want, have)
+	}
+	if want, have := "upper", servedBy; want != have {
+		t.Errorf("response header: want %q, have %q", want, have)
+	}
+	if want, have := "server client", strings.Join(finalized, " "); want != have {
+		t.Errorf("finalizers: want %q, have %q", want, have)
+	}
+}
+
+func TestClientCodec(t *testing.T) {
+	for name, codec := range map[string]inproc.Codec{
+		"json": inproc.JSONCodec,
+		"gob":  inproc.GobCodec,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := inproc.NewClient(
+				inproc.NewServer(upperEndpoint, inproc.Nop, inproc.Nop),
+				inproc.Nop, inproc.Nop,
+				inproc.ClientCodec(codec),
+			)
+			// The unexported field isn't serialized, as over a network.
+			response, err := client.Endpoint()(context.Background(), upperRequest{S: "hi", secret: "!x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := "HI", response.(upperResponse).V; want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestClientCodecError(t *testing.T) {
+	client := inproc.NewClient(
+		inproc.NewServer(upperEndpoint, inproc.Nop, inproc.Nop),
+		inproc.Nop, inproc.Nop,
+		inproc.ClientCodec(inproc.JSONCodec),
+	)
+	if _, err := client.Endpoint()(context.Background(), func() {}); err == nil {
+		t.Error("want an error for a payload that can't be marshaled")
+	}
+}
+
+func TestServerErrorEncoder(t *testing.T) {
+	var handled error
+	endpointErr := errors.New("empty string")
+	for _, testcase := range []struct {
+		name    string
+		options []inproc.ServerOption
+		want    interface{}
+		err     error
+	}{
+		{"default", nil, nil, endpointErr},
+		{
+			"payload",
+			[]inproc.ServerOption{inproc.ServerErrorEncoder(func(_ context.Context, err error) (interface{}, error) {
+				return upperResponse{Err: err.Error()}, nil
+			})},
+			upperResponse{Err: "empty string"},
+			nil,
+		},
+	} {
+		server := inproc.NewServer(
+			func(context.Context, interface{}) (interface{}, error) { return nil, endpointErr },
+			inproc.Nop, inproc.Nop,
+			append(testcase.options, inproc.ServerErrorHandler(transport.ErrorHandlerFunc(func(_ context.Context, err error) { handled = err })))...,
+		)
+		response, err := inproc.NewClient(server, inproc.Nop, inproc.Nop).Endpoint()(context.Background(), upperRequest{})
+		if want, have := testcase.err, err; want != have {
+			t.Errorf("%s: error: want %v, have %v", testcase.name, want, have)
+		}
+		if want, have := testcase.want, response; want != have {
+			t.Errorf("%s: response: want %v, have %v", testcase.name, want, have)
+		}
+		if want, have := endpointErr, handled; want != have {
+			t.Errorf("%s: handled error: want %v, have %v", testcase.name, want, have)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package inproc provides an in-process transport for endpoints.
+//
+// Clients invoke servers with a direct function call, which is useful to
+// compose endpoints of services running in the same binary, and in tests.
+// Servers and clients have the same hooks as the network transports, and a
+// codec may round-trip payloads to catch serialization bugs.
+package inproc
@@ -0,0 +1,35 @@
+package inproc
+
+import "context"
+
+// DecodeRequestFunc extracts a user-domain request object from the payload of
+// a Request. It's designed to be used in in-process servers, for server-side
+// endpoints. The identity function is fine when clients pass user-domain
+// requests as payloads.
+type DecodeRequestFunc func(ctx context.Context, payload interface{}) (request interface{}, err error)
+
+// EncodeResponseFunc encodes the passed response object into the payload of
+// a Response. It's designed to be used in in-process servers, for
+// server-side endpoints.
+type EncodeResponseFunc func(ctx context.Context, response interface{}) (payload interface{}, err error)
+
+// EncodeRequestFunc encodes the passed request object into the payload of a
+// Request. It's designed to be used in in-process clients, for client-side
+// endpoints.
+type EncodeRequestFunc func(ctx context.Context, request interface{}) (payload interface{}, err error)
+
+// DecodeResponseFunc extracts a user-domain response object from the payload
+// of a Response. It's designed to be used in in-process clients, for
+// client-side endpoints.
+type DecodeResponseFunc func(ctx context.Context, payload interface{}) (response interface{}, err error)
+
+// ErrorEncoder is responsible for encoding an error returned by a server. It
+// may turn the error into the payload of a Response, or return an error to
+// the client.
+type ErrorEncoder func(ctx context.Context, err error) (payload interface{}, encodedErr error)
+
+// Nop is a DecodeRequestFunc, EncodeResponseFunc, EncodeRequestFunc and
+// DecodeResponseFunc that returns its argument as is.
+func Nop(_ context.Context, v interface{}) (interface{}, error) {
+	return v, nil
+}
@@ -0,0 +1,158 @@
+package inproc
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// Request is passed by clients to handlers.
+type Request struct {
+	Header  map[string]string
+	Payload interface{}
+}
+
+// Response is returned by handlers to clients.
+type Response struct {
+	Header  map[string]string
+	Payload interface{}
+}
+
+// Handler serves in-process requests. It's implemented by Server.
+type Handler interface {
+	ServeInProc(ctx context.Context, req Request) (Response, error)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as
+// Handlers.
+type HandlerFunc func(ctx context.Context, req Request) (Response, error)
+
+// ServeInProc calls f(ctx, req).
+func (f HandlerFunc) ServeInProc(ctx context.Context, req Request) (Response, error) {
+	return f(ctx, req)
+}
+
+// Server wraps an endpoint and implements Handler.
+type Server struct {
+	e            endpoint.Endpoint
+	dec          DecodeRequestFunc
+	enc          EncodeResponseFunc
+	before       []ServerRequestFunc
+	after        []ServerResponseFunc
+	errorEncoder ErrorEncoder
+	finalizer    []ServerFinalizerFunc
+	errorHandler transport.ErrorHandler
+}
+
+// NewServer constructs a new server, which implements Handler and wraps the
+// provided endpoint.
+func NewServer(
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	enc EncodeResponseFunc,
+	options ...ServerOption,
+) *Server {
+	s := &Server{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(*Server)
+
+// ServerBefore functions are executed on the headers of the Request before
+// the request is decoded.
+func ServerBefore(before ...ServerRequestFunc) ServerOption {
+	return func(s *Server) { s.before = append(s.before, before...) }
+}
+
+// ServerAfter functions are executed on the headers of the Response after
+// the endpoint is invoked, but before the response is encoded.
+func ServerAfter(after ...ServerResponseFunc) ServerOption {
+	return func(s *Server) { s.after = append(s.after, after...) }
+}
+
+// ServerErrorEncoder is used to encode errors returned to clients. By
+// default, errors are returned as is, with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *Server) { s.errorEncoder = ee }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored.
+func ServerErrorHandler(errorHandler transport.ErrorHandler) ServerOption {
+	return func(s *Server) { s.errorHandler = errorHandler }
+}
+
+// ServerFinalizer is executed at the end of every request.
+// By default, no finalizer is registered.
+func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
+	return func(s *Server) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// ServeInProc implements Handler. The context is the one of the client, so
+// its deadline and cancellation apply to the endpoint.
+func (s Server) ServeInProc(ctx context.Context, req Request) (resp Response, err error) {
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	header := req.Header
+	if header == nil {
+		header = map[string]string{}
+	}
+	for _, f := range s.before {
+		ctx = f(ctx, header)
+	}
+
+	request, err := s.dec(ctx, req.Payload)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return s.encodeError(ctx, err)
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return s.encodeError(ctx, err)
+	}
+
+	resp.Header = map[string]string{}
+	for _, f := range s.after {
+		ctx = f(ctx, resp.Header)
+	}
+
+	if resp.Payload, err = s.enc(ctx, response); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return s.encodeError(ctx, err)
+	}
+	return resp, nil
+}
+
+func (s Server) encodeError(ctx context.Context, err error) (Response, error) {
+	payload, err := s.errorEncoder(ctx, err)
+	return Response{Header: map[string]string{}, Payload: payload}, err
+}
+
+// DefaultErrorEncoder returns the error to the client as is.
+func DefaultErrorEncoder(_ context.Context, err error) (interface{}, error) {
+	return nil, err
+}
+
+// ServerFinalizerFunc can be used to perform work at the end of a request,
+// after the response has been returned to the client.
+type ServerFinalizerFunc func(ctx context.Context, err error)
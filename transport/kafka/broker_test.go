@@ -0,0 +1,194 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	kafkatransport "github.com/go-kit/kit/transport/kafka"
+)
+
+// memBroker is an in-memory Kafka broker, with a single consumer group of a
+// single member, which is assigned every partition.
+type memBroker struct {
+	partitions int32
+
+	mtx       sync.Mutex
+	logs      map[string][][]*kafkatransport.Record
+	committed map[string][]int64
+	rebalance chan struct{}
+	failures  int
+}
+
+func newMemBroker(partitions int32) *memBroker {
+	return &memBroker{
+		partitions: partitions,
+		logs:       map[string][][]*kafkatransport.Record{},
+		committed:  map[string][]int64{},
+		rebalance:  make(chan struct{}, 1),
+	}
+}
+
+// Produce implements kafkatransport.Producer. Records are partitioned by the
+// hash of their key.
+func (b *memBroker) Produce(ctx context.Context, record *kafkatransport.Record) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("broker unavailable")
+	}
+
+	b.createTopic(record.Topic)
+	h := fnv.New32a()
+	h.Write(record.Key)
+	record.Partition = int32(h.Sum32() % uint32(b.partitions))
+	record.Offset = int64(len(b.logs[record.Topic][record.Partition]))
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	stored := *record
+	b.logs[record.Topic][record.Partition] = append(b.logs[record.Topic][record.Partition], &stored)
+	return nil
+}
+
+func (b *memBroker) createTopic(topic string) {
+	if _, ok := b.logs[topic]; !ok {
+		b.logs[topic] = make([][]*kafkatransport.Record, b.partitions)
+		b.committed[topic] = make([]int64, b.partitions)
+	}
+}
+
+func (b *memBroker) records(topic string) []*kafkatransport.Record {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	var records []*kafkatransport.Record
+	for _, log := range b.logs[topic] {
+		records = append(records, log...)
+	}
+	return records
+}
+
+func (b *memBroker) committedOffset(topic string, partition int32) int64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.createTopic(topic)
+	return b.committed[topic][partition]
+}
+
+// triggerRebalance ends the current session.
+func (b *memBroker) triggerRebalance() {
+	b.rebalance <- struct{}{}
+}
+
+// Consume implements kafkatransport.ConsumerGroup.
+func (b *memBroker) Consume(ctx context.Context, topics []string, handler kafkatransport.GroupHandler) error {
+	for ctx.Err() == nil {
+		if err := b.session(ctx, topics, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memBroker) session(ctx context.Context, topics []string, handler kafkatransport.GroupHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.rebalance:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	sess := &memSession{ctx: ctx, broker: b, claims: map[string][]int32{}}
+	for _, topic := range topics {
+		for p := int32(0); p < b.partitions; p++ {
+			sess.claims[topic] = append(sess.claims[topic], p)
+		}
+	}
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for topic, partitions := range sess.claims {
+		for _, partition := range partitions {
+			claim := &memClaim{topic: topic, partition: partition, records: make(chan *kafkatransport.Record)}
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				b.feed(ctx, claim)
+			}()
+			go func() {
+				defer wg.Done()
+				handler.ConsumeClaim(sess, claim)
+				// Like client libraries, drain the claim of a stopped handler
+				// until the session ends.
+				for range claim.records {
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return handler.Cleanup(sess)
+}
+
+// feed sends the records of the claim from the committed offset, until the
+// session ends.
+func (b *memBroker) feed(ctx context.Context, claim *memClaim) {
+	defer close(claim.records)
+	offset := b.committedOffset(claim.topic, claim.partition)
+	for {
+		b.mtx.Lock()
+		var record *kafkatransport.Record
+		if log := b.logs[claim.topic][claim.partition]; offset < int64(len(log)) {
+			r := *log[offset]
+			record = &r
+		}
+		b.mtx.Unlock()
+
+		if record == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Millisecond):
+				continue
+			}
+		}
+		select {
+		case claim.records <- record:
+			offset++
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type memSession struct {
+	ctx    context.Context
+	broker *memBroker
+	claims map[string][]int32
+}
+
+func (s *memSession) Context() context.Context   { return s.ctx }
+func (s *memSession) Claims() map[string][]int32 { return s.claims }
+
+func (s *memSession) Commit(record *kafkatransport.Record) {
+	s.broker.mtx.Lock()
+	defer s.broker.mtx.Unlock()
+	s.broker.committed[record.Topic][record.Partition] = record.Offset + 1
+}
+
+type memClaim struct {
+	topic     string
+	partition int32
+	records   chan *kafkatransport.Record
+}
+
+func (c *memClaim) Topic() string                          { return c.topic }
+func (c *memClaim) Partition() int32                       { return c.partition }
+func (c *memClaim) Records() <-chan *kafkatransport.Record { return c.records }
@@ -0,0 +1,7 @@
+// Package kafka provides a Kafka transport.
+//
+// The package doesn't depend on a Kafka client library: Publisher produces
+// through the Producer interface, and Subscriber is a GroupHandler, run by
+// a ConsumerGroup. Adapting a client library to these interfaces takes a few
+// lines, and they're easily faked in tests.
+package kafka
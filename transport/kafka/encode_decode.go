@@ -0,0 +1,22 @@
+package kafka
+
+import (
+	"context"
+)
+
+// DecodeRequestFunc extracts a user-domain request object from a consumed
+// record. It's designed to be used in Kafka subscribers, for subscriber-side
+// endpoints. One straightforward DecodeRequestFunc could be something that
+// JSON decodes from the record value to the concrete request type.
+type DecodeRequestFunc func(context.Context, *Record) (request interface{}, err error)
+
+// EncodeRequestFunc encodes the passed request object into the record to be
+// produced. It's designed to be used in Kafka publishers, for publisher-side
+// endpoints. One straightforward EncodeRequestFunc could be something that
+// JSON encodes the object directly to the record value.
+type EncodeRequestFunc func(context.Context, *Record, interface{}) error
+
+// DecodeResponseFunc extracts a user-domain response object from a produced
+// record, once the broker assigned it a partition and an offset. It's
+// designed to be used in Kafka publishers, for publisher-side endpoints.
+type DecodeResponseFunc func(context.Context, *Record) (response interface{}, err error)
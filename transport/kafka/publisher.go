@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Publisher wraps a Producer and a topic, and provides a method that
+// implements endpoint.Endpoint.
+type Publisher struct {
+	producer Producer
+	topic    string
+	enc      EncodeRequestFunc
+	dec      DecodeResponseFunc
+	before   []RequestFunc
+	after    []PublisherResponseFunc
+	timeout  time.Duration
+}
+
+// NewPublisher constructs a usable Publisher for a single topic.
+func NewPublisher(
+	producer Producer,
+	topic string,
+	enc EncodeRequestFunc,
+	dec DecodeResponseFunc,
+	options ...PublisherOption,
+) *Publisher {
+	p := &Publisher{
+		producer: producer,
+		topic:    topic,
+		enc:      enc,
+		dec:      dec,
+		timeout:  10 * time.Second,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// PublisherOption sets an optional parameter for publishers.
+type PublisherOption func(*Publisher)
+
+// PublisherBefore sets the RequestFuncs that are applied to the outgoing
+// record before it's produced.
+func PublisherBefore(before ...RequestFunc) PublisherOption {
+	return func(p *Publisher) { p.before = append(p.before, before...) }
+}
+
+// PublisherAfter sets the PublisherResponseFuncs applied to the produced
+// record, once acknowledged by the broker, prior to it being decoded.
+func PublisherAfter(after ...PublisherResponseFunc) PublisherOption {
+	return func(p *Publisher) { p.after = append(p.after, after...) }
+}
+
+// PublisherTimeout sets the available timeout for the broker to acknowledge
+// the record.
+func PublisherTimeout(timeout time.Duration) PublisherOption {
+	return func(p *Publisher) { p.timeout = timeout }
+}
+
+// Endpoint returns a usable endpoint that produces the request to the topic.
+func (p Publisher) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		record := Record{Topic: p.topic}
+
+		if err := p.enc(ctx, &record, request); err != nil {
+			return nil, err
+		}
+
+		for _, f := range p.before {
+			ctx = f(ctx, &record)
+		}
+
+		if err := p.producer.Produce(ctx, &record); err != nil {
+			return nil, err
+		}
+
+		for _, f := range p.after {
+			ctx = f(ctx, &record)
+		}
+
+		response, err := p.dec(ctx, &record)
+		if err != nil {
+			return nil, err
+		}
+
+		return response, nil
+	}
+}
+
+// Keyer is implemented by requests that set the key of their record, which
+// determines its partition.
+type Keyer interface {
+	Key() []byte
+}
+
+// EncodeJSONRequest is an EncodeRequestFunc that serializes the request as a
+// JSON object to the value of the record. If the request implements Keyer,
+// it also sets the key of the record. Many JSON-over-Kafka services can use
+// it as a sensible default.
+func EncodeJSONRequest(_ context.Context, record *Record, request interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	record.Value = b
+
+	if keyer, ok := request.(Keyer); ok {
+		record.Key = keyer.Key()
+	}
+
+	return nil
+}
+
+// RecordMetadata locates a produced record.
+type RecordMetadata struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// DecodeRecordMetadata is a DecodeResponseFunc that returns the
+// RecordMetadata of the produced record.
+func DecodeRecordMetadata(_ context.Context, record *Record) (interface{}, error) {
+	return RecordMetadata{
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Offset:    record.Offset,
+	}, nil
+}
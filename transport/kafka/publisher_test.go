@@ -0,0 +1,81 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+
+	kafkatransport "github.com/go-kit/kit/transport/kafka"
+)
+
+type orderCreated struct {
+	OrderID string `json:"order_id"`
+}
+
+func (o orderCreated) Key() []byte { return []byte(o.OrderID) }
+
+func TestPublisher(t *testing.T) {
+	broker := newMemBroker(1)
+	publisher := kafkatransport.NewPublisher(
+		broker,
+		"orders",
+		kafkatransport.EncodeJSONRequest,
+		kafkatransport.DecodeRecordMetadata,
+		kafkatransport.PublisherBefore(kafkatransport.SetHeader("X-Source", "test")),
+	)
+
+	for i := int64(0); i < 2; i++ {
+		response, err := publisher.Endpoint()(context.Background(), orderCreated{OrderID: "42"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata := response.(kafkatransport.RecordMetadata)
+		if want, have := (kafkatransport.RecordMetadata{Topic: "orders", Partition: 0, Offset: i}), metadata; want != have {
+			t.Errorf("want %+v, have %+v", want, have)
+		}
+	}
+
+	record := broker.records("orders")[0]
+	if want, have := `{"order_id":"42"}`, string(record.Value); want != have {
+		t.Errorf("value: want %s, have %s", want, have)
+	}
+	if want, have := "42", string(record.Key); want != have {
+		t.Errorf("key: want %q, have %q", want, have)
+	}
+	if value, _ := record.Header("X-Source"); string(value) != "test" {
+		t.Errorf("header: want %q, have %q", "test", value)
+	}
+}
+
+func TestPublisherProduceError(t *testing.T) {
+	broker := newMemBroker(1)
+	broker.failures = 1
+	publisher := kafkatransport.NewPublisher(
+		broker,
+		"orders",
+		kafkatransport.EncodeJSONRequest,
+		kafkatransport.DecodeRecordMetadata,
+	)
+
+	if _, err := publisher.Endpoint()(context.Background(), orderCreated{}); err == nil {
+		t.Error("want error, have nil")
+	}
+	if want, have := 0, len(broker.records("orders")); want != have {
+		t.Errorf("records: want %d, have %d", want, have)
+	}
+}
+
+func TestRecordSetHeader(t *testing.T) {
+	record := kafkatransport.Record{Headers: []kafkatransport.Header{
+		{Key: "a", Value: []byte("1")},
+		{Key: "b", Value: []byte("2")},
+		{Key: "a", Value: []byte("3")},
+	}}
+	record.SetHeader("a", []byte("4"))
+
+	if want, have := 2, len(record.Headers); want != have {
+		t.Fatalf("headers: want %d, have %d", want, have)
+	}
+	if value, ok := record.Header("a"); !ok || string(value) != "4" {
+		t.Errorf("want %q, have %q", "4", value)
+	}
+}
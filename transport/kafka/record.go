@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"context"
+	"time"
+)
+
+// Record is a Kafka record, either produced or consumed.
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	Timestamp time.Time
+}
+
+// Header is a record header. Kafka allows several headers with the same key.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Header returns the value of the last header of the record with the key,
+// and whether there's one.
+func (r *Record) Header(key string) ([]byte, bool) {
+	for i := len(r.Headers) - 1; i >= 0; i-- {
+		if r.Headers[i].Key == key {
+			return r.Headers[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetHeader replaces the headers of the record with the key by a single one.
+func (r *Record) SetHeader(key string, value []byte) {
+	headers := r.Headers[:0]
+	for _, h := range r.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	r.Headers = append(headers, Header{Key: key, Value: value})
+}
+
+// Producer produces records. It's implemented by adapting the producer of a
+// Kafka client library.
+type Producer interface {
+	// Produce sends the record to the broker, and waits for it to be
+	// acknowledged. It sets the partition and the offset of the record.
+	Produce(ctx context.Context, record *Record) error
+}
+
+// ConsumerGroup consumes topics as a member of a consumer group. It's
+// implemented by adapting the consumer group of a Kafka client library.
+type ConsumerGroup interface {
+	// Consume joins the group, and consumes the topics with the handler
+	// until the context is done. Every time the partitions are rebalanced,
+	// it starts a new session: it calls Setup, then ConsumeClaim for each
+	// assigned partition, concurrently, and Cleanup once every ConsumeClaim
+	// returned.
+	Consume(ctx context.Context, topics []string, handler GroupHandler) error
+}
+
+// GroupHandler handles the sessions of a ConsumerGroup. Subscriber is a
+// GroupHandler.
+type GroupHandler interface {
+	Setup(Session) error
+	Cleanup(Session) error
+	ConsumeClaim(Session, Claim) error
+}
+
+// Session is a generation of a consumer group, which lasts until the next
+// rebalance.
+type Session interface {
+	// Context is done when the session ends, typically because the
+	// partitions are being rebalanced.
+	Context() context.Context
+	// Claims returns the partitions of each topic assigned to the member.
+	Claims() map[string][]int32
+	// Commit marks the record as consumed, so that the offset after it is
+	// committed to the group.
+	Commit(*Record)
+}
+
+// Claim is a partition assigned to the member of a consumer group for a
+// session.
+type Claim interface {
+	Topic() string
+	Partition() int32
+	// Records is closed when the session ends.
+	Records() <-chan *Record
+}
@@ -0,0 +1,77 @@
+package kafka
+
+import (
+	"context"
+)
+
+// RequestFunc may take information from a record and put it into a request
+// context. In Subscribers, RequestFuncs are executed prior to invoking the
+// endpoint. In Publishers, they're executed after encoding the request, and
+// may add headers to the record.
+type RequestFunc func(context.Context, *Record) context.Context
+
+// SubscriberResponseFunc may take information from the response of the
+// endpoint and use it. SubscriberResponseFuncs are only executed in
+// subscribers, after invoking the endpoint, but before the offset of the
+// record is committed.
+type SubscriberResponseFunc func(ctx context.Context, record *Record, response interface{}) context.Context
+
+// PublisherResponseFunc may take information from the produced record and
+// make the response available for consumption. PublisherResponseFuncs are
+// only executed in publishers, after the broker acknowledged the record, but
+// prior to it being decoded.
+type PublisherResponseFunc func(context.Context, *Record) context.Context
+
+// SetHeader returns a RequestFunc that sets the header of the record.
+func SetHeader(key, value string) RequestFunc {
+	return func(ctx context.Context, record *Record) context.Context {
+		record.SetHeader(key, []byte(value))
+		return ctx
+	}
+}
+
+// PopulateRequestContext is a RequestFunc that populates several values into
+// the context from the consumed record. Those values may be extracted using
+// the corresponding ContextKey type in this package.
+func PopulateRequestContext(ctx context.Context, record *Record) context.Context {
+	headers := make(map[string][]byte, len(record.Headers))
+	for _, h := range record.Headers {
+		headers[h.Key] = h.Value
+	}
+	for k, v := range map[contextKey]interface{}{
+		ContextKeyTopic:     record.Topic,
+		ContextKeyPartition: record.Partition,
+		ContextKeyOffset:    record.Offset,
+		ContextKeyKey:       record.Key,
+		ContextKeyHeaders:   headers,
+	} {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	return ctx
+}
+
+type contextKey int
+
+const (
+	// ContextKeyTopic is populated in the context by PopulateRequestContext.
+	// Its value is the topic of the record, as a string.
+	ContextKeyTopic contextKey = iota
+
+	// ContextKeyPartition is populated in the context by
+	// PopulateRequestContext. Its value is the partition of the record, as
+	// an int32.
+	ContextKeyPartition
+
+	// ContextKeyOffset is populated in the context by PopulateRequestContext.
+	// Its value is the offset of the record, as an int64.
+	ContextKeyOffset
+
+	// ContextKeyKey is populated in the context by PopulateRequestContext. Its
+	// value is the key of the record, as a []byte.
+	ContextKeyKey
+
+	// ContextKeyHeaders is populated in the context by
+	// PopulateRequestContext. Its value is a map[string][]byte of the last
+	// value of each record header.
+	ContextKeyHeaders
+)
@@ -0,0 +1,254 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// Subscriber wraps an endpoint and provides a GroupHandler, which consumes
+// the records of the claimed partitions one at a time, and commits the
+// offset of each record once it's been handled.
+type Subscriber struct {
+	e            endpoint.Endpoint
+	dec          DecodeRequestFunc
+	before       []RequestFunc
+	after        []SubscriberResponseFunc
+	errorEncoder ErrorEncoder
+	errorHandler transport.ErrorHandler
+	assigned     []RebalanceFunc
+	revoked      []RebalanceFunc
+}
+
+// NewSubscriber constructs a new subscriber, which provides a GroupHandler
+// and wraps the provided endpoint.
+func NewSubscriber(
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	options ...SubscriberOption,
+) *Subscriber {
+	s := &Subscriber{
+		e:            e,
+		dec:          dec,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// SubscriberOption sets an optional parameter for subscribers.
+type SubscriberOption func(*Subscriber)
+
+// SubscriberBefore functions are executed on the consumed record before the
+// request is decoded.
+func SubscriberBefore(before ...RequestFunc) SubscriberOption {
+	return func(s *Subscriber) { s.before = append(s.before, before...) }
+}
+
+// SubscriberAfter functions are executed on the endpoint response, before the
+// offset of the record is committed.
+func SubscriberAfter(after ...SubscriberResponseFunc) SubscriberOption {
+	return func(s *Subscriber) { s.after = append(s.after, after...) }
+}
+
+// SubscriberErrorEncoder is used to decide what to do with a record whose
+// processing failed. By default, the DefaultErrorEncoder is used.
+func SubscriberErrorEncoder(ee ErrorEncoder) SubscriberOption {
+	return func(s *Subscriber) { s.errorEncoder = ee }
+}
+
+// SubscriberErrorHandler is used to handle non-terminal errors. By default,
+// non-terminal errors are ignored. This is intended as a diagnostic measure.
+// Finer-grained control of error handling, including logging in more detail,
+// should be performed in a custom SubscriberErrorEncoder which has access to
+// the context.
+func SubscriberErrorHandler(errorHandler transport.ErrorHandler) SubscriberOption {
+	return func(s *Subscriber) { s.errorHandler = errorHandler }
+}
+
+// RebalanceFunc is called with the partitions of each topic assigned to, or
+// revoked from, the member of a consumer group.
+type RebalanceFunc func(ctx context.Context, claims map[string][]int32)
+
+// SubscriberPartitionsAssigned functions are executed at the beginning of
+// every session, with the partitions assigned to the member.
+func SubscriberPartitionsAssigned(f ...RebalanceFunc) SubscriberOption {
+	return func(s *Subscriber) { s.assigned = append(s.assigned, f...) }
+}
+
+// SubscriberPartitionsRevoked functions are executed at the end of every
+// session, once the records of its partitions are handled, and before they're
+// rebalanced.
+func SubscriberPartitionsRevoked(f ...RebalanceFunc) SubscriberOption {
+	return func(s *Subscriber) { s.revoked = append(s.revoked, f...) }
+}
+
+// Setup implements GroupHandler.
+func (s Subscriber) Setup(sess Session) error {
+	for _, f := range s.assigned {
+		f(sess.Context(), sess.Claims())
+	}
+	return nil
+}
+
+// Cleanup implements GroupHandler.
+func (s Subscriber) Cleanup(sess Session) error {
+	for _, f := range s.revoked {
+		f(sess.Context(), sess.Claims())
+	}
+	return nil
+}
+
+// ConsumeClaim implements GroupHandler. It handles the records of the claim
+// until the session ends. If the ErrorEncoder stops on a record, it returns
+// the error without committing the record, which is consumed again in a later
+// session.
+func (s Subscriber) ConsumeClaim(sess Session, claim Claim) error {
+	for {
+		select {
+		case record, ok := <-claim.Records():
+			if !ok {
+				return nil
+			}
+			if err := s.serve(sess.Context(), record); err != nil {
+				return err
+			}
+			sess.Commit(record)
+
+		case <-sess.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s Subscriber) serve(ctx context.Context, record *Record) error {
+	for attempt := 1; ; attempt++ {
+		reqCtx, err := s.handle(ctx, record)
+		if err == nil {
+			return nil
+		}
+
+		s.errorHandler.Handle(reqCtx, err)
+		switch s.errorEncoder(reqCtx, err, record, attempt) {
+		case Retry:
+			continue
+		case Stop:
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+func (s Subscriber) handle(ctx context.Context, record *Record) (context.Context, error) {
+	for _, f := range s.before {
+		ctx = f(ctx, record)
+	}
+
+	request, err := s.dec(ctx, record)
+	if err != nil {
+		return ctx, err
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		return ctx, err
+	}
+
+	for _, f := range s.after {
+		ctx = f(ctx, record, response)
+	}
+
+	return ctx, nil
+}
+
+// ErrorAction is what a Subscriber does with a record whose processing
+// failed.
+type ErrorAction int
+
+const (
+	// Skip commits the record, and moves on to the next one.
+	Skip ErrorAction = iota
+	// Retry processes the record again.
+	Retry
+	// Stop leaves the record uncommitted, and stops consuming its partition
+	// until the next session.
+	Stop
+)
+
+// ErrorEncoder decides what to do with a record whose processing failed, for
+// the attempt-th time, starting at 1. It's named after the ErrorEncoders of
+// other transports, which encode errors to replies: Kafka records have none,
+// so it may instead produce the record to another topic.
+type ErrorEncoder func(ctx context.Context, err error, record *Record, attempt int) ErrorAction
+
+// DefaultErrorEncoder skips the record.
+func DefaultErrorEncoder(context.Context, error, *Record, int) ErrorAction {
+	return Skip
+}
+
+// StopErrorEncoder stops consuming the partition of the record.
+func StopErrorEncoder(context.Context, error, *Record, int) ErrorAction {
+	return Stop
+}
+
+// RetryErrorEncoder returns an ErrorEncoder that retries a record up to
+// attempts times in total, waiting for backoff before each retry. Once every
+// attempt failed, it delegates to next.
+func RetryErrorEncoder(attempts int, backoff time.Duration, next ErrorEncoder) ErrorEncoder {
+	return func(ctx context.Context, err error, record *Record, attempt int) ErrorAction {
+		if attempt >= attempts {
+			return next(ctx, err, record, attempt)
+		}
+		timer := time.NewTimer(backoff)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return Retry
+		case <-ctx.Done():
+			// The session ended: leave the record to the next one.
+			return Stop
+		}
+	}
+}
+
+// Headers set by DeadLetterErrorEncoder on dead-lettered records.
+const (
+	DeadLetterErrorHeader     = "x-dead-letter-error"
+	DeadLetterTopicHeader     = "x-dead-letter-topic"
+	DeadLetterPartitionHeader = "x-dead-letter-partition"
+	DeadLetterOffsetHeader    = "x-dead-letter-offset"
+	DeadLetterAttemptsHeader  = "x-dead-letter-attempts"
+)
+
+// DeadLetterErrorEncoder returns an ErrorEncoder that produces the record to
+// the dead-letter topic, with headers describing the failure, and skips it.
+// If the record can't be produced, it stops instead.
+func DeadLetterErrorEncoder(producer Producer, topic string) ErrorEncoder {
+	return func(ctx context.Context, err error, record *Record, attempt int) ErrorAction {
+		dead := Record{
+			Topic:     topic,
+			Key:       record.Key,
+			Value:     record.Value,
+			Headers:   append([]Header(nil), record.Headers...),
+			Timestamp: record.Timestamp,
+		}
+		dead.SetHeader(DeadLetterErrorHeader, []byte(err.Error()))
+		dead.SetHeader(DeadLetterTopicHeader, []byte(record.Topic))
+		dead.SetHeader(DeadLetterPartitionHeader, []byte(strconv.FormatInt(int64(record.Partition), 10)))
+		dead.SetHeader(DeadLetterOffsetHeader, []byte(strconv.FormatInt(record.Offset, 10)))
+		dead.SetHeader(DeadLetterAttemptsHeader, []byte(strconv.Itoa(attempt)))
+
+		if err := producer.Produce(ctx, &dead); err != nil {
+			return Stop
+		}
+		return Skip
+	}
+}
@@ -0,0 +1,194 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kafkatransport "github.com/go-kit/kit/transport/kafka"
+)
+
+func produce(t *testing.T, broker *memBroker, values ...string) {
+	t.Helper()
+	for _, value := range values {
+		if err := broker.Produce(context.Background(), &kafkatransport.Record{Topic: "orders", Value: []byte(value)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func eventually(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !f(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+	}
+}
+
+func consume(broker *memBroker, handler kafkatransport.GroupHandler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broker.Consume(ctx, []string{"orders"}, handler)
+	}()
+	return func() { cancel(); <-done }
+}
+
+func TestSubscriberCommitsHandledRecords(t *testing.T) {
+	var (
+		broker  = newMemBroker(1)
+		mtx     sync.Mutex
+		handled []string
+		topics  []string
+	)
+	subscriber := kafkatransport.NewSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			handled = append(handled, request.(string))
+			topics = append(topics, ctx.Value(kafkatransport.ContextKeyTopic).(string))
+			return nil, nil
+		},
+		func(_ context.Context, record *kafkatransport.Record) (interface{}, error) {
+			return string(record.Value), nil
+		},
+		kafkatransport.SubscriberBefore(kafkatransport.PopulateRequestContext),
+	)
+	produce(t, broker, "a", "b", "c")
+	stop := consume(broker, subscriber)
+	defer stop()
+
+	eventually(t, "committed offset", func() bool { return broker.committedOffset("orders", 0) == 3 })
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := "a b c", strings.Join(handled, " "); want != have {
+		t.Errorf("handled: want %q, have %q", want, have)
+	}
+	if want, have := "orders orders orders", strings.Join(topics, " "); want != have {
+		t.Errorf("topics: want %q, have %q", want, have)
+	}
+}
+
+func TestSubscriberStopRedeliversAfterRebalance(t *testing.T) {
+	var (
+		broker   = newMemBroker(1)
+		mtx      sync.Mutex
+		handled  []string
+		failed   bool
+		assigned int
+		revoked  int
+	)
+	subscriber := kafkatransport.NewSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			if request.(string) == "b" && !failed {
+				failed = true
+				return nil, errors.New("transient")
+			}
+			handled = append(handled, request.(string))
+			return nil, nil
+		},
+		func(_ context.Context, record *kafkatransport.Record) (interface{}, error) {
+			return string(record.Value), nil
+		},
+		kafkatransport.SubscriberErrorEncoder(kafkatransport.StopErrorEncoder),
+		kafkatransport.SubscriberPartitionsAssigned(func(_ context.Context, claims map[string][]int32) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			assigned += len(claims["orders"])
+		}),
+		kafkatransport.SubscriberPartitionsRevoked(func(context.Context, map[string][]int32) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			revoked++
+		}),
+	)
+	produce(t, broker, "a", "b", "c")
+	stop := consume(broker, subscriber)
+	defer stop()
+
+	eventually(t, "failure", func() bool { mtx.Lock(); defer mtx.Unlock(); return failed })
+	time.Sleep(10 * time.Millisecond)
+	if want, have := int64(1), broker.committedOffset("orders", 0); want != have {
+		t.Errorf("committed offset after stop: want %d, have %d", want, have)
+	}
+
+	broker.triggerRebalance()
+	eventually(t, "committed offset", func() bool { return broker.committedOffset("orders", 0) == 3 })
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := "a b c", strings.Join(handled, " "); want != have {
+		t.Errorf("handled: want %q, have %q", want, have)
+	}
+	if want, have := 2, assigned; want != have {
+		t.Errorf("assigned partitions: want %d, have %d", want, have)
+	}
+	if want, have := 1, revoked; want != have {
+		t.Errorf("revocations: want %d, have %d", want, have)
+	}
+}
+
+func TestSubscriberRetryThenDeadLetter(t *testing.T) {
+	var (
+		broker   = newMemBroker(1)
+		mtx      sync.Mutex
+		attempts int
+	)
+	subscriber := kafkatransport.NewSubscriber(
+		func(context.Context, interface{}) (interface{}, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			attempts++
+			return nil, errors.New("poison")
+		},
+		func(context.Context, *kafkatransport.Record) (interface{}, error) { return nil, nil },
+		kafkatransport.SubscriberErrorEncoder(kafkatransport.RetryErrorEncoder(
+			3, time.Millisecond,
+			kafkatransport.DeadLetterErrorEncoder(broker, "orders.dead"),
+		)),
+	)
+	produce(t, broker, "a")
+	stop := consume(broker, subscriber)
+	defer stop()
+
+	eventually(t, "committed offset", func() bool { return broker.committedOffset("orders", 0) == 1 })
+	mtx.Lock()
+	if want, have := 3, attempts; want != have {
+		t.Errorf("attempts: want %d, have %d", want, have)
+	}
+	mtx.Unlock()
+
+	dead := broker.records("orders.dead")
+	if want, have := 1, len(dead); want != have {
+		t.Fatalf("dead-lettered records: want %d, have %d", want, have)
+	}
+	if want, have := "a", string(dead[0].Value); want != have {
+		t.Errorf("value: want %q, have %q", want, have)
+	}
+	for k, want := range map[string]string{
+		kafkatransport.DeadLetterErrorHeader:     "poison",
+		kafkatransport.DeadLetterTopicHeader:     "orders",
+		kafkatransport.DeadLetterPartitionHeader: "0",
+		kafkatransport.DeadLetterOffsetHeader:    "0",
+		kafkatransport.DeadLetterAttemptsHeader:  "3",
+	} {
+		if have, _ := dead[0].Header(k); want != string(have) {
+			t.Errorf("%s: want %q, have %q", k, want, have)
+		}
+	}
+}
+
+func TestDeadLetterErrorEncoderProduceError(t *testing.T) {
+	broker := newMemBroker(1)
+	broker.failures = 1
+	ee := kafkatransport.DeadLetterErrorEncoder(broker, "orders.dead")
+	if want, have := kafkatransport.Stop, ee(context.Background(), errors.New("poison"), &kafkatransport.Record{}, 1); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,104 @@
+package mqtt_test
+
+import (
+	"context"
+	"sync"
+
+	mqtttransport "github.com/go-kit/kit/transport/mqtt"
+)
+
+// memBroker is an in-memory MQTT broker, which is also its only client.
+// Messages are delivered asynchronously, as by client libraries.
+type memBroker struct {
+	mtx           sync.Mutex
+	subscriptions map[string]subscription
+	retained      map[string]*mqtttransport.Message
+	acks          int
+	unacked       int
+	delivered     sync.WaitGroup
+}
+
+type subscription struct {
+	qos     mqtttransport.QoS
+	handler mqtttransport.MessageHandler
+}
+
+func newMemBroker() *memBroker {
+	return &memBroker{
+		subscriptions: map[string]subscription{},
+		retained:      map[string]*mqtttransport.Message{},
+	}
+}
+
+// Publish implements mqtttransport.Client.
+func (b *memBroker) Publish(ctx context.Context, msg *mqtttransport.Message) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if msg.Retained {
+		b.retained[msg.Topic] = msg
+	}
+	for filter, sub := range b.subscriptions {
+		if mqtttransport.Match(filter, msg.Topic) {
+			b.deliver(msg, sub, false)
+		}
+	}
+	return nil
+}
+
+// Subscribe implements mqtttransport.Client.
+func (b *memBroker) Subscribe(ctx context.Context, filter string, qos mqtttransport.QoS, handler mqtttransport.MessageHandler) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	sub := subscription{qos: qos, handler: handler}
+	b.subscriptions[filter] = sub
+	for topic, msg := range b.retained {
+		if mqtttransport.Match(filter, topic) {
+			b.deliver(msg, sub, true)
+		}
+	}
+	return nil
+}
+
+// Unsubscribe implements mqtttransport.Client.
+func (b *memBroker) Unsubscribe(ctx context.Context, filter string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.subscriptions, filter)
+	return nil
+}
+
+func (b *memBroker) deliver(msg *mqtttransport.Message, sub subscription, retained bool) {
+	delivered := *msg
+	delivered.Retained = retained
+	delivered.UserProperties = append([]mqtttransport.UserProperty(nil), msg.UserProperties...)
+	if sub.qos < delivered.QoS {
+		delivered.QoS = sub.qos
+	}
+	if delivered.QoS > mqtttransport.AtMostOnce {
+		b.unacked++
+		var once sync.Once
+		delivered.Ack = func() error {
+			once.Do(func() {
+				b.mtx.Lock()
+				defer b.mtx.Unlock()
+				b.acks++
+				b.unacked--
+			})
+			return nil
+		}
+	}
+	b.delivered.Add(1)
+	go func() {
+		defer b.delivered.Done()
+		sub.handler(&delivered)
+	}()
+}
+
+// counts waits for the delivered messages to be handled, and returns the
+// number of acknowledged and unacknowledged messages.
+func (b *memBroker) counts() (acks, unacked int) {
+	b.delivered.Wait()
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.acks, b.unacked
+}
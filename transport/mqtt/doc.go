@@ -0,0 +1,11 @@
+// Package mqtt provides an MQTT transport.
+//
+// The package doesn't depend on an MQTT client library: Publisher and
+// Subscriber talk to the broker through the Client interface. Adapting a
+// client library to it takes a few lines, and it's easily faked in tests.
+//
+// Request/response uses the response topic and correlation data properties
+// of MQTT v5: a Subscriber replies to messages with a response topic, and a
+// Publisher configured with PublisherResponseTopic waits for the reply
+// carrying the correlation data of its request.
+package mqtt
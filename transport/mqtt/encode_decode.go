@@ -0,0 +1,30 @@
+package mqtt
+
+import (
+	"context"
+)
+
+// DecodeRequestFunc extracts a user-domain request object from a delivered
+// message. It's designed to be used in MQTT subscribers, for subscriber-side
+// endpoints. One straightforward DecodeRequestFunc could be something that
+// JSON decodes from the message payload to the concrete request type.
+type DecodeRequestFunc func(context.Context, *Message) (request interface{}, err error)
+
+// EncodeRequestFunc encodes the passed request object into the message to be
+// published. It's designed to be used in MQTT publishers, for publisher-side
+// endpoints. One straightforward EncodeRequestFunc could be something that
+// JSON encodes the object directly to the message payload.
+type EncodeRequestFunc func(context.Context, *Message, interface{}) error
+
+// EncodeResponseFunc encodes the passed response object into the reply to a
+// message with a response topic. It's designed to be used in MQTT
+// subscribers, for subscriber-side endpoints. One straightforward
+// EncodeResponseFunc could be something that JSON encodes the object
+// directly to the reply payload.
+type EncodeResponseFunc func(context.Context, *Message, interface{}) error
+
+// DecodeResponseFunc extracts a user-domain response object from the reply
+// to a published request or, for publishers without a response topic, from
+// the published message itself. It's designed to be used in MQTT publishers,
+// for publisher-side endpoints.
+type DecodeResponseFunc func(context.Context, *Message) (response interface{}, err error)
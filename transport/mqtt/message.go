@@ -0,0 +1,89 @@
+package mqtt
+
+import (
+	"context"
+)
+
+// QoS is the quality of service of the delivery of a message.
+type QoS byte
+
+const (
+	// AtMostOnce messages are delivered once at most, and aren't
+	// acknowledged.
+	AtMostOnce QoS = iota
+	// AtLeastOnce messages are delivered until acknowledged.
+	AtLeastOnce
+	// ExactlyOnce messages are delivered once, through a two-step
+	// acknowledgement.
+	ExactlyOnce
+)
+
+// Message is an MQTT message, either published or delivered.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	QoS      QoS
+	Retained bool
+
+	// Properties of MQTT v5. Clients of earlier versions of the protocol
+	// ignore them.
+	ResponseTopic   string
+	CorrelationData []byte
+	ContentType     string
+	UserProperties  []UserProperty
+
+	// Ack acknowledges a delivered message of QoS 1 or 2 to the broker. It's
+	// set by Client implementations which acknowledge messages manually, and
+	// is nil otherwise.
+	Ack func() error
+}
+
+// UserProperty is a user property of a message. MQTT allows several
+// properties with the same key.
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// UserProperty returns the value of the last user property of the message
+// with the key, and whether there's one.
+func (m *Message) UserProperty(key string) (string, bool) {
+	for i := len(m.UserProperties) - 1; i >= 0; i-- {
+		if m.UserProperties[i].Key == key {
+			return m.UserProperties[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// SetUserProperty replaces the user properties of the message with the key
+// by a single one.
+func (m *Message) SetUserProperty(key, value string) {
+	properties := m.UserProperties[:0]
+	for _, p := range m.UserProperties {
+		if p.Key != key {
+			properties = append(properties, p)
+		}
+	}
+	m.UserProperties = append(properties, UserProperty{Key: key, Value: value})
+}
+
+// MessageHandler handles the messages delivered to a subscription.
+type MessageHandler func(*Message)
+
+// Client is a connection to an MQTT broker. It's implemented by adapting the
+// client of an MQTT client library, which should be configured to
+// acknowledge messages manually, through Message.Ack, if it supports it.
+type Client interface {
+	// Publish sends the message to the broker, and waits for it to be
+	// acknowledged according to its QoS.
+	Publish(ctx context.Context, msg *Message) error
+
+	// Subscribe subscribes to the topic filter, which may contain
+	// wildcards, with the maximum QoS. Messages delivered to the
+	// subscription are passed to the handler.
+	Subscribe(ctx context.Context, filter string, qos QoS, handler MessageHandler) error
+
+	// Unsubscribe removes the subscription to the topic filter.
+	Unsubscribe(ctx context.Context, filter string) error
+}
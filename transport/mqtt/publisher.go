@@ -0,0 +1,231 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Publisher wraps a Client and a topic, and provides a method that
+// implements endpoint.Endpoint.
+type Publisher struct {
+	client  Client
+	topic   string
+	enc     EncodeRequestFunc
+	dec     DecodeResponseFunc
+	before  []RequestFunc
+	after   []PublisherResponseFunc
+	timeout time.Duration
+	qos     QoS
+	retain  bool
+	replies *replies
+}
+
+// NewPublisher constructs a usable Publisher for a single topic.
+func NewPublisher(
+	client Client,
+	topic string,
+	enc EncodeRequestFunc,
+	dec DecodeResponseFunc,
+	options ...PublisherOption,
+) *Publisher {
+	p := &Publisher{
+		client:  client,
+		topic:   topic,
+		enc:     enc,
+		dec:     dec,
+		timeout: 10 * time.Second,
+		qos:     AtLeastOnce,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// PublisherOption sets an optional parameter for publishers.
+type PublisherOption func(*Publisher)
+
+// PublisherBefore sets the RequestFuncs that are applied to the outgoing
+// message before it's published.
+func PublisherBefore(before ...RequestFunc) PublisherOption {
+	return func(p *Publisher) { p.before = append(p.before, before...) }
+}
+
+// PublisherAfter sets the PublisherResponseFuncs applied to the reply, or to
+// the published message for publishers without a response topic, prior to it
+// being decoded.
+func PublisherAfter(after ...PublisherResponseFunc) PublisherOption {
+	return func(p *Publisher) { p.after = append(p.after, after...) }
+}
+
+// PublisherTimeout sets the available timeout for the broker to acknowledge
+// the message, and for the reply to be received.
+func PublisherTimeout(timeout time.Duration) PublisherOption {
+	return func(p *Publisher) { p.timeout = timeout }
+}
+
+// PublisherQoS sets the QoS of published messages. By default, messages are
+// published with AtLeastOnce.
+func PublisherQoS(qos QoS) PublisherOption {
+	return func(p *Publisher) { p.qos = qos }
+}
+
+// PublisherRetain sets whether published messages are retained by the
+// broker. By default, they aren't.
+func PublisherRetain(retain bool) PublisherOption {
+	return func(p *Publisher) { p.retain = retain }
+}
+
+// PublisherResponseTopic makes the publisher wait for a reply to each
+// request, on the response topic, which should be unique to the publisher.
+// The publisher subscribes to it with the client on the first request, and
+// matches replies to requests by their correlation data.
+func PublisherResponseTopic(topic string) PublisherOption {
+	return func(p *Publisher) { p.replies = &replies{topic: topic, pending: map[string]chan *Message{}} }
+}
+
+// Endpoint returns a usable endpoint that publishes the request to the topic.
+func (p Publisher) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		msg := Message{Topic: p.topic, QoS: p.qos, Retained: p.retain}
+
+		if err := p.enc(ctx, &msg, request); err != nil {
+			return nil, err
+		}
+
+		for _, f := range p.before {
+			ctx = f(ctx, &msg)
+		}
+
+		response := &msg
+		if p.replies != nil {
+			if err := p.replies.subscribe(ctx, p.client, p.qos); err != nil {
+				return nil, err
+			}
+			correlationData, reply, done := p.replies.await()
+			defer done()
+			msg.ResponseTopic = p.replies.topic
+			msg.CorrelationData = correlationData
+
+			if err := p.client.Publish(ctx, &msg); err != nil {
+				return nil, err
+			}
+			select {
+			case response = <-reply:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		} else if err := p.client.Publish(ctx, &msg); err != nil {
+			return nil, err
+		}
+
+		for _, f := range p.after {
+			ctx = f(ctx, response)
+		}
+
+		return p.dec(ctx, response)
+	}
+}
+
+// replies dispatches the messages delivered to the response topic of a
+// publisher to the requests awaiting them.
+type replies struct {
+	topic string
+
+	mtx        sync.Mutex
+	subscribed bool
+	pending    map[string]chan *Message
+}
+
+// subscribe subscribes the client to the response topic, unless it already
+// is.
+func (r *replies) subscribe(ctx context.Context, client Client, qos QoS) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.subscribed {
+		return nil
+	}
+	if err := client.Subscribe(ctx, r.topic, qos, r.deliver); err != nil {
+		return err
+	}
+	r.subscribed = true
+	return nil
+}
+
+// await returns new correlation data, the channel receiving the reply
+// carrying it, and a function to call once done waiting.
+func (r *replies) await() ([]byte, <-chan *Message, func()) {
+	correlationData := make([]byte, 16)
+	rand.Read(correlationData)
+	key := string(correlationData)
+	reply := make(chan *Message, 1)
+
+	r.mtx.Lock()
+	r.pending[key] = reply
+	r.mtx.Unlock()
+
+	return correlationData, reply, func() {
+		r.mtx.Lock()
+		delete(r.pending, key)
+		r.mtx.Unlock()
+	}
+}
+
+func (r *replies) deliver(msg *Message) {
+	r.mtx.Lock()
+	reply, ok := r.pending[string(msg.CorrelationData)]
+	delete(r.pending, string(msg.CorrelationData))
+	r.mtx.Unlock()
+
+	if ok {
+		reply <- msg
+	}
+	// Replies to requests which timed out are dropped, but acknowledged
+	// regardless, so that they're not redelivered.
+	if msg.Ack != nil && msg.QoS > AtMostOnce {
+		msg.Ack()
+	}
+}
+
+// EncodeJSONRequest is an EncodeRequestFunc that serializes the request as a
+// JSON object to the payload of the message. Many JSON-over-MQTT services
+// can use it as a sensible default.
+func EncodeJSONRequest(_ context.Context, msg *Message, request interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	msg.ContentType = "application/json"
+	msg.Payload = b
+	return nil
+}
+
+// ReplyError is the error reported by a reply with an ErrorProperty.
+type ReplyError struct {
+	Description string
+}
+
+// Error implements error.
+func (e ReplyError) Error() string {
+	return e.Description
+}
+
+// DecodeReplyError returns a DecodeResponseFunc that returns a ReplyError for
+// replies with an ErrorProperty, as written by DefaultErrorEncoder, and
+// otherwise calls next.
+func DecodeReplyError(next DecodeResponseFunc) DecodeResponseFunc {
+	return func(ctx context.Context, msg *Message) (interface{}, error) {
+		if description, ok := msg.UserProperty(ErrorProperty); ok {
+			return nil, ReplyError{Description: description}
+		}
+		return next(ctx, msg)
+	}
+}
@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"context"
+)
+
+// RequestFunc may take information from a message and put it into a request
+// context. In Subscribers, RequestFuncs are executed prior to invoking the
+// endpoint. In Publishers, they're executed after encoding the request, and
+// may add user properties to the message.
+type RequestFunc func(context.Context, *Message) context.Context
+
+// SubscriberResponseFunc may take information from a request context and use
+// it to manipulate the reply. SubscriberResponseFuncs are only executed in
+// subscribers, after invoking the endpoint, and are passed the reply to
+// messages with a response topic, or nil.
+type SubscriberResponseFunc func(ctx context.Context, reply *Message) context.Context
+
+// PublisherResponseFunc may take information from the reply, or from the
+// published message for publishers without a response topic, and make the
+// response available for consumption. PublisherResponseFuncs are only
+// executed in publishers, prior to decoding the response.
+type PublisherResponseFunc func(context.Context, *Message) context.Context
+
+// SetUserProperty returns a RequestFunc that sets the user property of the
+// message.
+func SetUserProperty(key, value string) RequestFunc {
+	return func(ctx context.Context, msg *Message) context.Context {
+		msg.SetUserProperty(key, value)
+		return ctx
+	}
+}
+
+// SetReplyUserProperty returns a SubscriberResponseFunc that sets the user
+// property of the reply, if any.
+func SetReplyUserProperty(key, value string) SubscriberResponseFunc {
+	return func(ctx context.Context, reply *Message) context.Context {
+		if reply != nil {
+			reply.SetUserProperty(key, value)
+		}
+		return ctx
+	}
+}
+
+// PopulateRequestContext is a RequestFunc that populates several values into
+// the context from the delivered message. Those values may be extracted
+// using the corresponding ContextKey type in this package.
+func PopulateRequestContext(ctx context.Context, msg *Message) context.Context {
+	properties := make(map[string]string, len(msg.UserProperties))
+	for _, p := range msg.UserProperties {
+		properties[p.Key] = p.Value
+	}
+	for k, v := range map[contextKey]interface{}{
+		ContextKeyTopic:          msg.Topic,
+		ContextKeyQoS:            msg.QoS,
+		ContextKeyRetained:       msg.Retained,
+		ContextKeyResponseTopic:  msg.ResponseTopic,
+		ContextKeyUserProperties: properties,
+	} {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	return ctx
+}
+
+type contextKey int
+
+const (
+	// ContextKeyTopic is populated in the context by PopulateRequestContext.
+	// Its value is the topic of the message, as a string.
+	ContextKeyTopic contextKey = iota
+
+	// ContextKeyQoS is populated in the context by PopulateRequestContext.
+	// Its value is the QoS of the message.
+	ContextKeyQoS
+
+	// ContextKeyRetained is populated in the context by
+	// PopulateRequestContext. Its value is whether the message was retained,
+	// as a bool.
+	ContextKeyRetained
+
+	// ContextKeyResponseTopic is populated in the context by
+	// PopulateRequestContext. Its value is the response topic of the
+	// message, as a string.
+	ContextKeyResponseTopic
+
+	// ContextKeyUserProperties is populated in the context by
+	// PopulateRequestContext. Its value is a map[string]string of the last
+	// value of each user property.
+	ContextKeyUserProperties
+
+	// ContextKeyFilter is populated in the context by Subscriber.Subscribe.
+	// Its value is the topic filter of the subscription, as a string.
+	ContextKeyFilter
+
+	// ContextKeyWildcards is populated in the context by
+	// Subscriber.Subscribe. Its value is the []string of the topic levels
+	// matched by the wildcards of the filter, as returned by Wildcards.
+	ContextKeyWildcards
+)
@@ -0,0 +1,232 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// Subscriber wraps an endpoint and provides a MessageHandler. Messages with a
+// response topic are replied to, with their correlation data.
+type Subscriber struct {
+	e            endpoint.Endpoint
+	dec          DecodeRequestFunc
+	enc          EncodeResponseFunc
+	before       []RequestFunc
+	after        []SubscriberResponseFunc
+	errorEncoder ErrorEncoder
+	errorHandler transport.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+	ackOnError   bool
+}
+
+// NewSubscriber constructs a new subscriber, which provides a MessageHandler
+// and wraps the provided endpoint.
+func NewSubscriber(
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	enc EncodeResponseFunc,
+	options ...SubscriberOption,
+) *Subscriber {
+	s := &Subscriber{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		ackOnError:   true,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// SubscriberOption sets an optional parameter for subscribers.
+type SubscriberOption func(*Subscriber)
+
+// SubscriberBefore functions are executed on the delivered message before the
+// request is decoded.
+func SubscriberBefore(before ...RequestFunc) SubscriberOption {
+	return func(s *Subscriber) { s.before = append(s.before, before...) }
+}
+
+// SubscriberAfter functions are executed on the reply after the endpoint is
+// invoked, but before the reply is published.
+func SubscriberAfter(after ...SubscriberResponseFunc) SubscriberOption {
+	return func(s *Subscriber) { s.after = append(s.after, after...) }
+}
+
+// SubscriberErrorEncoder is used to encode errors to the reply, for messages
+// with a response topic. By default, the DefaultErrorEncoder is used.
+func SubscriberErrorEncoder(ee ErrorEncoder) SubscriberOption {
+	return func(s *Subscriber) { s.errorEncoder = ee }
+}
+
+// SubscriberErrorHandler is used to handle non-terminal errors. By default,
+// non-terminal errors are ignored. This is intended as a diagnostic measure.
+// Finer-grained control of error handling, including logging in more detail,
+// should be performed in a custom SubscriberErrorEncoder which has access to
+// the context.
+func SubscriberErrorHandler(errorHandler transport.ErrorHandler) SubscriberOption {
+	return func(s *Subscriber) { s.errorHandler = errorHandler }
+}
+
+// SubscriberFinalizer is executed at the end of every message.
+// By default, no finalizer is registered.
+func SubscriberFinalizer(f ...SubscriberFinalizerFunc) SubscriberOption {
+	return func(s *Subscriber) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// SubscriberAckOnError sets whether messages of QoS 1 or 2 whose processing
+// failed are acknowledged. By default, they are: brokers only redeliver
+// unacknowledged messages when the session is resumed, and count them
+// against the receive maximum of the client until then.
+func SubscriberAckOnError(ack bool) SubscriberOption {
+	return func(s *Subscriber) { s.ackOnError = ack }
+}
+
+// Subscribe subscribes the client to the topic filter, which may contain
+// wildcards, with the maximum QoS. The context of each request carries the
+// filter and the topic levels matched by its wildcards.
+func (s Subscriber) Subscribe(ctx context.Context, client Client, filter string, qos QoS) error {
+	serve := s.ServeMessage(client)
+	return client.Subscribe(ctx, filter, qos, func(msg *Message) {
+		ctx := context.WithValue(context.Background(), ContextKeyFilter, filter)
+		if wildcards, ok := Wildcards(filter, msg.Topic); ok {
+			ctx = context.WithValue(ctx, ContextKeyWildcards, wildcards)
+		}
+		serve(ctx, msg)
+	})
+}
+
+// ServeMessage returns a function handling the messages delivered to the
+// client, for use with client libraries which route messages themselves.
+// Messages of QoS 1 or 2 are acknowledged once handled.
+func (s Subscriber) ServeMessage(client Client) func(ctx context.Context, msg *Message) {
+	return func(ctx context.Context, msg *Message) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var err error
+		defer func() {
+			if msg.Ack != nil && msg.QoS > AtMostOnce && (err == nil || s.ackOnError) {
+				if ackErr := msg.Ack(); ackErr != nil {
+					s.errorHandler.Handle(ctx, ackErr)
+				}
+			}
+		}()
+
+		if len(s.finalizer) > 0 {
+			defer func() {
+				for _, f := range s.finalizer {
+					f(ctx, msg, err)
+				}
+			}()
+		}
+
+		var reply *Message
+		if msg.ResponseTopic != "" {
+			reply = &Message{
+				Topic:           msg.ResponseTopic,
+				QoS:             msg.QoS,
+				CorrelationData: msg.CorrelationData,
+			}
+		}
+
+		for _, f := range s.before {
+			ctx = f(ctx, msg)
+		}
+
+		request, err := s.dec(ctx, msg)
+		if err != nil {
+			s.handleError(ctx, err, reply, client)
+			return
+		}
+
+		response, err := s.e(ctx, request)
+		if err != nil {
+			s.handleError(ctx, err, reply, client)
+			return
+		}
+
+		for _, f := range s.after {
+			ctx = f(ctx, reply)
+		}
+
+		if reply == nil {
+			return
+		}
+
+		if err = s.enc(ctx, reply, response); err != nil {
+			s.handleError(ctx, err, reply, client)
+			return
+		}
+
+		if err = client.Publish(ctx, reply); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			return
+		}
+	}
+}
+
+func (s Subscriber) handleError(ctx context.Context, err error, reply *Message, client Client) {
+	s.errorHandler.Handle(ctx, err)
+	if reply == nil {
+		return
+	}
+	s.errorEncoder(ctx, err, reply)
+	if err := client.Publish(ctx, reply); err != nil {
+		s.errorHandler.Handle(ctx, err)
+	}
+}
+
+// ErrorEncoder is responsible for encoding an error to the reply, which is
+// published once it returns. Users are encouraged to use custom ErrorEncoders
+// to encode errors to their replies, and will likely want to pass and check
+// for their own error types.
+type ErrorEncoder func(ctx context.Context, err error, reply *Message)
+
+// SubscriberFinalizerFunc can be used to perform work at the end of a
+// message, after the reply, if any, has been published. The principal
+// intended use is for request logging.
+// Note: err may be nil.
+type SubscriberFinalizerFunc func(ctx context.Context, msg *Message, err error)
+
+// NopRequestDecoder is a DecodeRequestFunc that can be used for requests that
+// do not need to be decoded, and simply returns nil, nil.
+func NopRequestDecoder(context.Context, *Message) (interface{}, error) {
+	return nil, nil
+}
+
+// EncodeJSONResponse is an EncodeResponseFunc that serializes the response
+// as a JSON object to the payload of the reply. Many JSON-over-MQTT services
+// can use it as a sensible default.
+func EncodeJSONResponse(_ context.Context, reply *Message, response interface{}) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	reply.ContentType = "application/json"
+	reply.Payload = b
+	return nil
+}
+
+// ErrorProperty is the user property of the replies written by
+// DefaultErrorEncoder, which carries the description of the error.
+const ErrorProperty = "error"
+
+// DefaultErrorEncoder writes the error to the reply, as a JSON object with an
+// "err" field, and in the ErrorProperty user property.
+func DefaultErrorEncoder(_ context.Context, err error, reply *Message) {
+	type Response struct {
+		Error string `json:"err"`
+	}
+	b, _ := json.Marshal(Response{Error: err.Error()})
+	reply.ContentType = "application/json"
+	reply.Payload = b
+	reply.SetUserProperty(ErrorProperty, err.Error())
+}
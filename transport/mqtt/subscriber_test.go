@@ -0,0 +1,230 @@
+package mqtt_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	mqtttransport "github.com/go-kit/kit/transport/mqtt"
+)
+
+type command struct {
+	Name string `json:"name"`
+}
+
+type status struct {
+	Device string `json:"device"`
+	State  string `json:"state"`
+}
+
+func decodeCommand(_ context.Context, msg *mqtttransport.Message) (interface{}, error) {
+	var c command
+	err := json.Unmarshal(msg.Payload, &c)
+	return c, err
+}
+
+func decodeStatus(_ context.Context, msg *mqtttransport.Message) (interface{}, error) {
+	var s status
+	err := json.Unmarshal(msg.Payload, &s)
+	return s, err
+}
+
+func deviceEndpoint(ctx context.Context, request interface{}) (interface{}, error) {
+	c := request.(command)
+	if c.Name == "explode" {
+		return nil, errors.New("unsupported command")
+	}
+	device := ctx.Value(mqtttransport.ContextKeyWildcards).([]string)[0]
+	return status{Device: device, State: c.Name + "ed"}, nil
+}
+
+func TestRequestResponse(t *testing.T) {
+	broker := newMemBroker()
+	sub := mqtttransport.NewSubscriber(deviceEndpoint, decodeCommand, mqtttransport.EncodeJSONResponse,
+		mqtttransport.SubscriberAfter(mqtttransport.SetReplyUserProperty("served-by", "test")),
+	)
+	if err := sub.Subscribe(context.Background(), broker, "devices/+/commands", mqtttransport.ExactlyOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mtx      sync.Mutex
+		servedBy string
+	)
+	pub := mqtttransport.NewPublisher(
+		broker, "devices/lamp-1/commands",
+		mqtttransport.EncodeJSONRequest,
+		mqtttransport.DecodeReplyError(decodeStatus),
+		mqtttransport.PublisherResponseTopic("replies/test"),
+		mqtttransport.PublisherAfter(func(ctx context.Context, msg *mqtttransport.Message) context.Context {
+			mtx.Lock()
+			defer mtx.Unlock()
+			servedBy, _ = msg.UserProperty("served-by")
+			return ctx
+		}),
+	)
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"switch", "dimm", "blink"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			response, err := pub.Endpoint()(context.Background(), command{Name: name})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want, have := (status{Device: "lamp-1", State: name + "ed"}), response; want != have {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		}(name)
+	}
+	wg.Wait()
+	if want, have := "test", servedBy; want != have {
+		t.Errorf("served-by: want %q, have %q", want, have)
+	}
+
+	_, err := pub.Endpoint()(context.Background(), command{Name: "explode"})
+	if want, have := (mqtttransport.ReplyError{Description: "unsupported command"}), err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// Four requests and four replies.
+	acks, unacked := broker.counts()
+	if want, have := 8, acks; want != have {
+		t.Errorf("acks: want %d, have %d", want, have)
+	}
+	if want, have := 0, unacked; want != have {
+		t.Errorf("unacked: want %d, have %d", want, have)
+	}
+}
+
+func TestSubscriberAcks(t *testing.T) {
+	for _, testcase := range []struct {
+		name       string
+		qos        mqtttransport.QoS
+		ackOnError bool
+		acks       int
+		unacked    int
+	}{
+		{"at most once", mqtttransport.AtMostOnce, true, 0, 0},
+		{"ack on error", mqtttransport.AtLeastOnce, true, 2, 0},
+		{"no ack on error", mqtttransport.AtLeastOnce, false, 1, 1},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			broker := newMemBroker()
+			var (
+				mtx   sync.Mutex
+				final []error
+			)
+			sub := mqtttransport.NewSubscriber(deviceEndpoint, decodeCommand, mqtttransport.EncodeJSONResponse,
+				mqtttransport.SubscriberAckOnError(testcase.ackOnError),
+				mqtttransport.SubscriberFinalizer(func(_ context.Context, _ *mqtttransport.Message, err error) {
+					mtx.Lock()
+					defer mtx.Unlock()
+					final = append(final, err)
+				}),
+			)
+			if err := sub.Subscribe(context.Background(), broker, "devices/+/commands", testcase.qos); err != nil {
+				t.Fatal(err)
+			}
+
+			pub := mqtttransport.NewPublisher(broker, "devices/lamp-1/commands",
+				mqtttransport.EncodeJSONRequest,
+				func(_ context.Context, msg *mqtttransport.Message) (interface{}, error) { return msg.Topic, nil },
+			)
+			for _, name := range []string{"switch", "explode"} {
+				topic, err := pub.Endpoint()(context.Background(), command{Name: name})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, have := "devices/lamp-1/commands", topic; want != have {
+					t.Errorf("want %q, have %q", want, have)
+				}
+			}
+
+			acks, unacked := broker.counts()
+			if want, have := testcase.acks, acks; want != have {
+				t.Errorf("acks: want %d, have %d", want, have)
+			}
+			if want, have := testcase.unacked, unacked; want != have {
+				t.Errorf("unacked: want %d, have %d", want, have)
+			}
+			if want, have := 2, len(final); want != have {
+				t.Fatalf("finalizer: want %d calls, have %d", want, have)
+			}
+			var failed int
+			for _, err := range final {
+				if err != nil {
+					failed++
+				}
+			}
+			if want, have := 1, failed; want != have {
+				t.Errorf("finalizer: want %d errors, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestPopulateRequestContext(t *testing.T) {
+	broker := newMemBroker()
+	pub := mqtttransport.NewPublisher(broker, "devices/lamp-1/status",
+		mqtttransport.EncodeJSONRequest,
+		func(context.Context, *mqtttransport.Message) (interface{}, error) { return nil, nil },
+		mqtttransport.PublisherRetain(true),
+		mqtttransport.PublisherBefore(mqtttransport.SetUserProperty("firmware", "1.2")),
+	)
+	if _, err := pub.Endpoint()(context.Background(), status{State: "on"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctxs := make(chan context.Context, 1)
+	sub := mqtttransport.NewSubscriber(
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			ctxs <- ctx
+			return nil, nil
+		},
+		mqtttransport.NopRequestDecoder,
+		mqtttransport.EncodeJSONResponse,
+		mqtttransport.SubscriberBefore(mqtttransport.PopulateRequestContext),
+	)
+	if err := sub.Subscribe(context.Background(), broker, "devices/#", mqtttransport.AtLeastOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx context.Context
+	select {
+	case ctx = <-ctxs:
+	case <-time.After(time.Second):
+		t.Fatal("retained message wasn't delivered")
+	}
+	for key, want := range map[interface{}]interface{}{
+		mqtttransport.ContextKeyTopic:          "devices/lamp-1/status",
+		mqtttransport.ContextKeyQoS:            mqtttransport.AtLeastOnce,
+		mqtttransport.ContextKeyRetained:       true,
+		mqtttransport.ContextKeyUserProperties: map[string]string{"firmware": "1.2"},
+		mqtttransport.ContextKeyFilter:         "devices/#",
+		mqtttransport.ContextKeyWildcards:      []string{"lamp-1/status"},
+	} {
+		if have := ctx.Value(key); !reflect.DeepEqual(want, have) {
+			t.Errorf("%v: want %v, have %v", key, want, have)
+		}
+	}
+}
+
+func TestPublisherTimeout(t *testing.T) {
+	pub := mqtttransport.NewPublisher(newMemBroker(), "devices/lamp-1/commands",
+		mqtttransport.EncodeJSONRequest,
+		decodeStatus,
+		mqtttransport.PublisherResponseTopic("replies/test"),
+		mqtttransport.PublisherTimeout(50*time.Millisecond),
+	)
+	_, err := pub.Endpoint()(context.Background(), command{Name: "switch"})
+	if want, have := context.DeadlineExceeded, err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,63 @@
+package mqtt
+
+import (
+	"strings"
+)
+
+// sharePrefix prefixes shared subscriptions, as in $share/group/filter.
+const sharePrefix = "$share/"
+
+// Match reports whether the topic matches the topic filter. The single-level
+// wildcard + matches one level of the topic, and the multi-level wildcard #
+// matches any number of trailing levels. As in MQTT, wildcards at the start
+// of a filter don't match topics starting with $, and the group of shared
+// subscriptions is ignored.
+func Match(filter, topic string) bool {
+	_, ok := Wildcards(filter, topic)
+	return ok
+}
+
+// Wildcards returns the levels of the topic matched by the wildcards of the
+// topic filter, in order, and whether the topic matches the filter. The
+// levels matched by a multi-level wildcard are returned as a single string.
+func Wildcards(filter, topic string) ([]string, bool) {
+	filter = unshare(filter)
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return nil, false
+	}
+
+	var (
+		filterLevels = strings.Split(filter, "/")
+		topicLevels  = strings.Split(topic, "/")
+		wildcards    []string
+	)
+	for i, f := range filterLevels {
+		switch {
+		case f == "#":
+			// # also matches the parent level: sport/# matches sport.
+			return append(wildcards, strings.Join(topicLevels[i:], "/")), i == len(filterLevels)-1
+		case i >= len(topicLevels):
+			return nil, false
+		case f == "+":
+			wildcards = append(wildcards, topicLevels[i])
+		case f != topicLevels[i]:
+			return nil, false
+		}
+	}
+	if len(filterLevels) != len(topicLevels) {
+		return nil, false
+	}
+	return wildcards, true
+}
+
+// unshare returns the filter of a shared subscription.
+func unshare(filter string) string {
+	if !strings.HasPrefix(filter, sharePrefix) {
+		return filter
+	}
+	group := strings.TrimPrefix(filter, sharePrefix)
+	if i := strings.IndexByte(group, '/'); i >= 0 {
+		return group[i+1:]
+	}
+	return filter
+}
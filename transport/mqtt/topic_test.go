@@ -0,0 +1,42 @@
+package mqtt_test
+
+import (
+	"reflect"
+	"testing"
+
+	mqtttransport "github.com/go-kit/kit/transport/mqtt"
+)
+
+func TestWildcards(t *testing.T) {
+	for _, testcase := range []struct {
+		filter    string
+		topic     string
+		match     bool
+		wildcards []string
+	}{
+		{"sport/tennis", "sport/tennis", true, nil},
+		{"sport/tennis", "sport/golf", false, nil},
+		{"sport/+/player", "sport/tennis/player", true, []string{"tennis"}},
+		{"sport/+/player", "sport/tennis/coach", false, nil},
+		{"sport/+", "sport/tennis/player", false, nil},
+		{"sport/+", "sport/", true, []string{""}},
+		{"+/+", "sport/tennis", true, []string{"sport", "tennis"}},
+		{"sport/#", "sport/tennis/player/1", true, []string{"tennis/player/1"}},
+		{"sport/#", "sport", true, []string{""}},
+		{"sport/+/#", "sport/tennis/player/1", true, []string{"tennis", "player/1"}},
+		{"#", "sport/tennis", true, []string{"sport/tennis"}},
+		{"#", "$SYS/uptime", false, nil},
+		{"+/uptime", "$SYS/uptime", false, nil},
+		{"$SYS/#", "$SYS/uptime", true, []string{"uptime"}},
+		{"$share/workers/jobs/+", "jobs/1", true, []string{"1"}},
+	} {
+		wildcards, match := mqtttransport.Wildcards(testcase.filter, testcase.topic)
+		if want, have := testcase.match, match; want != have {
+			t.Errorf("%s %s: match: want %v, have %v", testcase.filter, testcase.topic, want, have)
+			continue
+		}
+		if match && !reflect.DeepEqual(testcase.wildcards, wildcards) {
+			t.Errorf("%s %s: wildcards: want %q, have %q", testcase.filter, testcase.topic, testcase.wildcards, wildcards)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package nats
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// ServiceErrorHeader carries the description of the error reported by
+	// HeaderErrorEncoder.
+	ServiceErrorHeader = "Nats-Service-Error"
+
+	// ServiceErrorCodeHeader carries the code of the error reported by
+	// HeaderErrorEncoder.
+	ServiceErrorCodeHeader = "Nats-Service-Error-Code"
+)
+
+// Headerer is checked by EncodeJSONResponse, DefaultErrorEncoder and
+// HeaderErrorEncoder. If a response or error value implements Headerer, the
+// provided headers will be set on the reply.
+type Headerer interface {
+	Headers() nats.Header
+}
+
+// StatusCoder is checked by HeaderErrorEncoder. If an error value implements
+// StatusCoder, the StatusCode will be reported in ServiceErrorCodeHeader.
+// By default, 500 is used.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// HeaderErrorEncoder is an ErrorEncoder that reports the error through the
+// ServiceErrorHeader and ServiceErrorCodeHeader headers of a reply with an
+// empty body, as NATS services conventionally do, rather than in a JSON body.
+// Publishers can turn such replies back into errors with DecodeHeaderError.
+func HeaderErrorEncoder(ctx context.Context, err error, reply string, nc *nats.Conn) {
+	msg := NewReplyMsg(ctx, reply)
+	if headerer, ok := err.(Headerer); ok {
+		copyHeader(msg.Header, headerer.Headers())
+	}
+	code := 500
+	if sc, ok := err.(StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	// Header values can't span lines.
+	msg.Header.Set(ServiceErrorHeader, strings.Join(strings.Fields(err.Error()), " "))
+	msg.Header.Set(ServiceErrorCodeHeader, strconv.Itoa(code))
+
+	_ = nc.PublishMsg(msg)
+}
+
+// ServiceError is the error reported by a reply with a ServiceErrorHeader.
+type ServiceError struct {
+	Code        int
+	Description string
+}
+
+// Error implements error.
+func (e ServiceError) Error() string {
+	return e.Description
+}
+
+// StatusCode implements StatusCoder.
+func (e ServiceError) StatusCode() int {
+	return e.Code
+}
+
+// DecodeHeaderError returns a DecodeResponseFunc that returns a ServiceError
+// for replies with a ServiceErrorHeader, and otherwise calls next.
+func DecodeHeaderError(next DecodeResponseFunc) DecodeResponseFunc {
+	return func(ctx context.Context, msg *nats.Msg) (interface{}, error) {
+		description := msg.Header.Get(ServiceErrorHeader)
+		if description == "" {
+			return next(ctx, msg)
+		}
+		code, err := strconv.Atoi(msg.Header.Get(ServiceErrorCodeHeader))
+		if err != nil {
+			code = 500
+		}
+		return nil, ServiceError{Code: code, Description: description}
+	}
+}
@@ -0,0 +1,115 @@
+package nats_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	natstransport "github.com/go-kit/kit/transport/nats"
+)
+
+type headeredResponse struct {
+	Name string `json:"name"`
+}
+
+func (headeredResponse) Headers() nats.Header { return nats.Header{"Cache-Control": {"no-store"}} }
+
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "I'm a\nteapot" }
+func (teapotError) StatusCode() int { return 418 }
+
+func TestHeadersEndToEnd(t *testing.T) {
+	s, c := newNATSConn(t)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	handler := natstransport.NewSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			h, _ := ctx.Value(natstransport.ContextKeyRequestHeader).(nats.Header)
+			return headeredResponse{Name: h.Get("X-Name")}, nil
+		},
+		natstransport.NopRequestDecoder,
+		natstransport.EncodeJSONResponse,
+		natstransport.SubscriberBefore(natstransport.PopulateRequestContext),
+		natstransport.SubscriberAfter(natstransport.SetReplyHeader("X-Served-By", "test")),
+	)
+	sub, err := c.QueueSubscribe("natstransport.test", "natstransport", handler.ServeMsg(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	var replyHeader nats.Header
+	publisher := natstransport.NewPublisher(
+		c,
+		"natstransport.test",
+		natstransport.EncodeJSONRequest,
+		func(_ context.Context, msg *nats.Msg) (interface{}, error) {
+			var response headeredResponse
+			err := json.Unmarshal(msg.Data, &response)
+			return response, err
+		},
+		natstransport.PublisherBefore(natstransport.SetRequestHeader("X-Name", "gopher")),
+		natstransport.PublisherAfter(func(ctx context.Context, msg *nats.Msg) context.Context {
+			replyHeader = msg.Header
+			return ctx
+		}),
+	)
+
+	response, err := publisher.Endpoint()(context.Background(), struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "gopher", response.(headeredResponse).Name; want != have {
+		t.Errorf("request header: want %q, have %q", want, have)
+	}
+	for k, want := range map[string]string{"X-Served-By": "test", "Cache-Control": "no-store"} {
+		if have := replyHeader.Get(k); want != have {
+			t.Errorf("reply header %s: want %q, have %q", k, want, have)
+		}
+	}
+}
+
+func TestHeaderErrorEncoder(t *testing.T) {
+	s, c := newNATSConn(t)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	handler := natstransport.NewSubscriber(
+		func(context.Context, interface{}) (interface{}, error) { return nil, teapotError{} },
+		natstransport.NopRequestDecoder,
+		natstransport.EncodeJSONResponse,
+		natstransport.SubscriberErrorEncoder(natstransport.HeaderErrorEncoder),
+	)
+	sub, err := c.QueueSubscribe("natstransport.test", "natstransport", handler.ServeMsg(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	publisher := natstransport.NewPublisher(
+		c,
+		"natstransport.test",
+		natstransport.EncodeJSONRequest,
+		natstransport.DecodeHeaderError(func(context.Context, *nats.Msg) (interface{}, error) {
+			t.Error("decoder called for error reply")
+			return nil, nil
+		}),
+	)
+
+	_, err = publisher.Endpoint()(context.Background(), struct{}{})
+	var serviceErr natstransport.ServiceError
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("want ServiceError, have %v", err)
+	}
+	if want, have := 418, serviceErr.StatusCode(); want != have {
+		t.Errorf("code: want %d, have %d", want, have)
+	}
+	if want, have := "I'm a teapot", serviceErr.Error(); want != have {
+		t.Errorf("description: want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/nats-io/nats.go"
+)
+
+// DecodePubAckFunc extracts a user-domain response object from the
+// acknowledgement of a message published to a JetStream stream. It's designed
+// to be used in JetStream publishers, for publisher-side endpoints.
+type DecodePubAckFunc func(context.Context, *nats.PubAck) (response interface{}, err error)
+
+// MsgIDFunc returns the ID of a message published to a JetStream stream.
+// JetStream discards messages whose ID was already published within the
+// stream's duplicate window, so retrying a publish with the same ID is safe.
+type MsgIDFunc func(ctx context.Context, msg *nats.Msg, request interface{}) string
+
+// JetStreamPublisher wraps a JetStream subject and provides a method that
+// implements endpoint.Endpoint. Unlike Publisher, it doesn't wait for a reply
+// from a subscriber, but for the acknowledgement that the stream persisted the
+// message.
+type JetStreamPublisher struct {
+	js      nats.JetStreamContext
+	subject string
+	enc     EncodeRequestFunc
+	dec     DecodePubAckFunc
+	before  []RequestFunc
+	msgID   MsgIDFunc
+	pubOpts []nats.PubOpt
+	timeout time.Duration
+}
+
+// NewJetStreamPublisher constructs a usable JetStreamPublisher for a single
+// subject.
+func NewJetStreamPublisher(
+	js nats.JetStreamContext,
+	subject string,
+	enc EncodeRequestFunc,
+	dec DecodePubAckFunc,
+	options ...JetStreamPublisherOption,
+) *JetStreamPublisher {
+	p := &JetStreamPublisher{
+		js:      js,
+		subject: subject,
+		enc:     enc,
+		dec:     dec,
+		timeout: 10 * time.Second,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// JetStreamPublisherOption sets an optional parameter for JetStream publishers.
+type JetStreamPublisherOption func(*JetStreamPublisher)
+
+// JetStreamPublisherBefore sets the RequestFuncs that are applied to the
+// outgoing NATS message before it's published.
+func JetStreamPublisherBefore(before ...RequestFunc) JetStreamPublisherOption {
+	return func(p *JetStreamPublisher) { p.before = append(p.before, before...) }
+}
+
+// JetStreamPublisherMsgID sets the function that computes the ID of each
+// published message, for deduplication. By default, messages have no ID.
+func JetStreamPublisherMsgID(f MsgIDFunc) JetStreamPublisherOption {
+	return func(p *JetStreamPublisher) { p.msgID = f }
+}
+
+// JetStreamPublisherPubOpts sets additional options passed to PublishMsg, such
+// as nats.ExpectStream or nats.ExpectLastSequence.
+func JetStreamPublisherPubOpts(opts ...nats.PubOpt) JetStreamPublisherOption {
+	return func(p *JetStreamPublisher) { p.pubOpts = append(p.pubOpts, opts...) }
+}
+
+// JetStreamPublisherTimeout sets the time to wait for the acknowledgement.
+// By default, it's 10 seconds.
+func JetStreamPublisherTimeout(timeout time.Duration) JetStreamPublisherOption {
+	return func(p *JetStreamPublisher) { p.timeout = timeout }
+}
+
+// Endpoint returns a usable endpoint that publishes the request to the stream,
+// and returns once the stream acknowledged it.
+func (p JetStreamPublisher) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		msg := nats.Msg{Subject: p.subject}
+
+		if err := p.enc(ctx, &msg, request); err != nil {
+			return nil, err
+		}
+
+		for _, f := range p.before {
+			ctx = f(ctx, &msg)
+		}
+
+		opts := append([]nats.PubOpt{nats.Context(ctx)}, p.pubOpts...)
+		if p.msgID != nil {
+			if id := p.msgID(ctx, &msg, request); id != "" {
+				opts = append(opts, nats.MsgId(id))
+			}
+		}
+
+		ack, err := p.js.PublishMsg(&msg, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.dec(ctx, ack)
+	}
+}
+
+// DecodePubAck is a DecodePubAckFunc that returns the *nats.PubAck itself.
+func DecodePubAck(_ context.Context, ack *nats.PubAck) (interface{}, error) {
+	return ack, nil
+}
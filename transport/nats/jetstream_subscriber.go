@@ -0,0 +1,276 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// JetStreamSubscriber wraps an endpoint and processes messages delivered by
+// a JetStream consumer, with at-least-once semantics: a message is
+// acknowledged once the endpoint succeeded, and otherwise negatively
+// acknowledged or terminated by the error encoder, so that it's redelivered or
+// not.
+//
+// Push consumers deliver to ServeMsg, which must be subscribed with
+// nats.ManualAck. Pull consumers are served by ServePull.
+type JetStreamSubscriber struct {
+	e            endpoint.Endpoint
+	dec          DecodeRequestFunc
+	before       []RequestFunc
+	errorEncoder JetStreamErrorEncoder
+	finalizer    []SubscriberFinalizerFunc
+	errorHandler transport.ErrorHandler
+	inProgress   time.Duration
+	fetchWait    time.Duration
+}
+
+// NewJetStreamSubscriber constructs a new JetStream subscriber, which wraps the
+// provided endpoint. The endpoint's response is discarded.
+func NewJetStreamSubscriber(
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	options ...JetStreamSubscriberOption,
+) *JetStreamSubscriber {
+	s := &JetStreamSubscriber{
+		e:            e,
+		dec:          dec,
+		errorEncoder: DefaultJetStreamErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		fetchWait:    DefaultFetchWait,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// JetStreamSubscriberOption sets an optional parameter for JetStream
+// subscribers.
+type JetStreamSubscriberOption func(*JetStreamSubscriber)
+
+// JetStreamSubscriberBefore functions are executed on the message before it's
+// decoded.
+func JetStreamSubscriberBefore(before ...RequestFunc) JetStreamSubscriberOption {
+	return func(s *JetStreamSubscriber) { s.before = append(s.before, before...) }
+}
+
+// JetStreamSubscriberErrorEncoder is used to acknowledge messages whose
+// processing failed. By default, DefaultJetStreamErrorEncoder is used.
+func JetStreamSubscriberErrorEncoder(ee JetStreamErrorEncoder) JetStreamSubscriberOption {
+	return func(s *JetStreamSubscriber) { s.errorEncoder = ee }
+}
+
+// JetStreamSubscriberErrorHandler is used to handle non-terminal errors. By
+// default, non-terminal errors are ignored.
+func JetStreamSubscriberErrorHandler(errorHandler transport.ErrorHandler) JetStreamSubscriberOption {
+	return func(s *JetStreamSubscriber) { s.errorHandler = errorHandler }
+}
+
+// JetStreamSubscriberFinalizer is executed at the end of the processing of
+// every message, after it was acknowledged. By default, no finalizer is
+// registered.
+func JetStreamSubscriberFinalizer(f ...SubscriberFinalizerFunc) JetStreamSubscriberOption {
+	return func(s *JetStreamSubscriber) { s.finalizer = f }
+}
+
+// JetStreamSubscriberInProgress makes the subscriber tell the server that the
+// message is still being processed, at the given interval, for as long as it's
+// decoded or handled by the endpoint. This keeps long handlers from exceeding
+// the consumer's AckWait, and the message from being redelivered. The interval
+// should be well below AckWait. By default, no such heartbeats are sent.
+func JetStreamSubscriberInProgress(interval time.Duration) JetStreamSubscriberOption {
+	return func(s *JetStreamSubscriber) { s.inProgress = interval }
+}
+
+// DefaultFetchWait is the default time ServePull waits for each batch of
+// messages.
+const DefaultFetchWait = 5 * time.Second
+
+// JetStreamSubscriberFetchWait sets how long ServePull waits for each batch of
+// messages, before fetching again. By default, it's DefaultFetchWait.
+func JetStreamSubscriberFetchWait(d time.Duration) JetStreamSubscriberOption {
+	return func(s *JetStreamSubscriber) { s.fetchWait = d }
+}
+
+// ServeMsg provides nats.MsgHandler, for push consumers.
+func (s JetStreamSubscriber) ServeMsg() nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		s.serve(context.Background(), msg)
+	}
+}
+
+// ServePull fetches messages from the pull consumer subscription in batches of
+// up to batch messages, and processes them one by one, until the context is
+// canceled. It returns the context's error, or the first error other than a
+// timeout returned by Fetch.
+func (s JetStreamSubscriber) ServePull(ctx context.Context, sub *nats.Subscription, batch int) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Each fetch has its own deadline, since Fetch rejects contexts
+		// without one.
+		fetchCtx, cancel := context.WithTimeout(ctx, s.fetchWait)
+		msgs, err := sub.Fetch(batch, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+				continue
+			}
+			return err
+		}
+		for _, msg := range msgs {
+			s.serve(ctx, msg)
+		}
+	}
+}
+
+func (s JetStreamSubscriber) serve(ctx context.Context, msg *nats.Msg) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, msg)
+			}
+		}()
+	}
+
+	if md, err := msg.Metadata(); err == nil {
+		ctx = context.WithValue(ctx, ContextKeyMsgMetadata, md)
+	}
+
+	// The heartbeat is stopped before the message is acknowledged, so that it
+	// never reports a message that's already acknowledged as in progress.
+	stopInProgress := func() {}
+	if s.inProgress > 0 {
+		stopInProgress = s.startInProgress(ctx, msg)
+		defer stopInProgress()
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, msg)
+	}
+
+	request, err := s.dec(ctx, msg)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		stopInProgress()
+		s.encodeError(ctx, err, msg)
+		return
+	}
+
+	if _, err := s.e(ctx, request); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		stopInProgress()
+		s.encodeError(ctx, err, msg)
+		return
+	}
+
+	stopInProgress()
+	if err := msg.Ack(); err != nil {
+		s.errorHandler.Handle(ctx, err)
+	}
+}
+
+// startInProgress periodically tells the server that msg is being processed,
+// until the returned function is called. That function returns once the last
+// InProgress call has returned, and may be called more than once.
+func (s JetStreamSubscriber) startInProgress(ctx context.Context, msg *nats.Msg) func() {
+	var (
+		done   = make(chan struct{})
+		exited = make(chan struct{})
+		once   sync.Once
+	)
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(s.inProgress)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					s.errorHandler.Handle(ctx, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+func (s JetStreamSubscriber) encodeError(ctx context.Context, err error, msg *nats.Msg) {
+	if err := s.errorEncoder(ctx, err, msg); err != nil {
+		s.errorHandler.Handle(ctx, err)
+	}
+}
+
+// JetStreamErrorEncoder acknowledges a message whose processing failed with
+// err, typically by calling Nak, NakWithDelay or Term on it.
+type JetStreamErrorEncoder func(ctx context.Context, err error, msg *nats.Msg) error
+
+// DefaultJetStreamErrorEncoder terminates the message if err was wrapped by
+// Term, so that it's never redelivered, and negatively acknowledges it
+// otherwise, with the delay of NakWithDelay if err was wrapped by it.
+func DefaultJetStreamErrorEncoder(_ context.Context, err error, msg *nats.Msg) error {
+	var term termError
+	if errors.As(err, &term) {
+		return msg.Term()
+	}
+	var nak nakDelayError
+	if errors.As(err, &nak) {
+		return msg.NakWithDelay(nak.delay)
+	}
+	return msg.Nak()
+}
+
+// Term wraps err so that DefaultJetStreamErrorEncoder terminates the message
+// that failed with it: it won't be redelivered, even if the consumer's
+// MaxDeliver isn't reached.
+func Term(err error) error {
+	return termError{err}
+}
+
+// NakWithDelay wraps err so that DefaultJetStreamErrorEncoder asks for the
+// message that failed with it to be redelivered after the delay.
+func NakWithDelay(err error, delay time.Duration) error {
+	return nakDelayError{err, delay}
+}
+
+type termError struct {
+	err error
+}
+
+func (e termError) Error() string { return e.err.Error() }
+func (e termError) Unwrap() error { return e.err }
+
+type nakDelayError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e nakDelayError) Error() string { return e.err.Error() }
+func (e nakDelayError) Unwrap() error { return e.err }
+
+// MsgMetadataFromContext returns the metadata of the JetStream message being
+// processed.
+func MsgMetadataFromContext(ctx context.Context) (*nats.MsgMetadata, bool) {
+	md, ok := ctx.Value(ContextKeyMsgMetadata).(*nats.MsgMetadata)
+	return md, ok
+}
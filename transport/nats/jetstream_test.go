@@ -0,0 +1,333 @@
+package nats_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"github.com/go-kit/kit/transport"
+	natstransport "github.com/go-kit/kit/transport/nats"
+)
+
+func newJetStream(t *testing.T, consumer *nats.ConsumerConfig) (*server.Server, *nats.Conn, nats.JetStreamContext) {
+	s, err := server.NewServer(&server.Options{
+		Host:      "localhost",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if ok := s.ReadyForConnections(5 * time.Second); !ok {
+		t.Fatal("not ready for connections")
+	}
+
+	c, err := nats.Connect("nats://"+s.Addr().String(), nats.Name(t.Name()))
+	if err != nil {
+		t.Fatalf("failed to connect to NATS server: %s", err)
+	}
+	js, err := c.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}}); err != nil {
+		t.Fatal(err)
+	}
+	if consumer != nil {
+		if _, err := js.AddConsumer("ORDERS", consumer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, c, js
+}
+
+func TestJetStreamPublisherDeduplication(t *testing.T) {
+	s, c, js := newJetStream(t, nil)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	publisher := natstransport.NewJetStreamPublisher(
+		js,
+		"orders.created",
+		natstransport.EncodeJSONRequest,
+		natstransport.DecodePubAck,
+		natstransport.JetStreamPublisherMsgID(func(_ context.Context, _ *nats.Msg, request interface{}) string {
+			return request.(map[string]string)["id"]
+		}),
+	)
+
+	var acks []*nats.PubAck
+	for _, id := range []string{"a", "a", "b"} {
+		response, err := publisher.Endpoint()(context.Background(), map[string]string{"id": id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		acks = append(acks, response.(*nats.PubAck))
+	}
+	if want, have := false, acks[0].Duplicate; want != have {
+		t.Errorf("first publish Duplicate: want %v, have %v", want, have)
+	}
+	if want, have := true, acks[1].Duplicate; want != have {
+		t.Errorf("second publish Duplicate: want %v, have %v", want, have)
+	}
+	info, err := js.StreamInfo("ORDERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := uint64(2), info.State.Msgs; want != have {
+		t.Errorf("messages in stream: want %d, have %d", want, have)
+	}
+}
+
+func TestJetStreamSubscriberPush(t *testing.T) {
+	s, c, js := newJetStream(t, nil)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		mtx        sync.Mutex
+		deliveries = map[string][]uint64{}
+		done       = make(chan struct{}, 1)
+	)
+	subscriber := natstransport.NewJetStreamSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			md, ok := natstransport.MsgMetadataFromContext(ctx)
+			if !ok {
+				t.Error("no metadata in context")
+				return nil, nil
+			}
+			kind := request.(string)
+			mtx.Lock()
+			deliveries[kind] = append(deliveries[kind], md.NumDelivered)
+			mtx.Unlock()
+
+			switch {
+			case kind == "retry" && md.NumDelivered == 1:
+				return nil, natstransport.NakWithDelay(errors.New("try again"), 50*time.Millisecond)
+			case kind == "poison":
+				return nil, natstransport.Term(errors.New("can't process"))
+			case kind == "done":
+				done <- struct{}{}
+			}
+			return nil, nil
+		},
+		func(_ context.Context, msg *nats.Msg) (interface{}, error) {
+			var kind string
+			err := json.Unmarshal(msg.Data, &kind)
+			return kind, err
+		},
+	)
+	sub, err := js.Subscribe("orders.>", subscriber.ServeMsg(), nats.Durable("push"), nats.ManualAck(), nats.AckWait(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	for _, kind := range []string{"retry", "poison", "ok"} {
+		if _, err := js.Publish("orders.created", []byte(`"`+kind+`"`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Give the retried message time to be redelivered before finishing.
+	time.Sleep(200 * time.Millisecond)
+	if _, err := js.Publish("orders.created", []byte(`"done"`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for messages")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	for kind, want := range map[string][]uint64{
+		"retry":  {1, 2},
+		"poison": {1},
+		"ok":     {1},
+	} {
+		if have := deliveries[kind]; len(want) != len(have) || (len(have) > 1 && have[1] != want[1]) {
+			t.Errorf("%s deliveries: want %v, have %v", kind, want, have)
+		}
+	}
+}
+
+func TestJetStreamSubscriberPullInProgress(t *testing.T) {
+	s, c, js := newJetStream(t, &nats.ConsumerConfig{
+		Durable:   "pull",
+		AckPolicy: nats.AckExplicitPolicy,
+		AckWait:   300 * time.Millisecond,
+	})
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		mtx        sync.Mutex
+		deliveries int
+		processed  = make(chan struct{}, 1)
+	)
+	subscriber := natstransport.NewJetStreamSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			mtx.Lock()
+			deliveries++
+			mtx.Unlock()
+			time.Sleep(time.Second)
+			processed <- struct{}{}
+			return nil, nil
+		},
+		natstransport.NopRequestDecoder,
+		natstransport.JetStreamSubscriberInProgress(50*time.Millisecond),
+	)
+	sub, err := js.PullSubscribe("orders.>", "pull", nats.Bind("ORDERS", "pull"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- subscriber.ServePull(ctx, sub, 10) }()
+
+	if _, err := js.Publish("orders.created", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	// Leave time for a redelivery, which the heartbeats should have prevented.
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+	if err := <-served; err != context.Canceled {
+		t.Errorf("ServePull: want %v, have %v", context.Canceled, err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := 1, deliveries; want != have {
+		t.Errorf("deliveries: want %d, have %d", want, have)
+	}
+}
+
+func TestJetStreamSubscriberInProgressStopsBeforeAck(t *testing.T) {
+	s, c, js := newJetStream(t, &nats.ConsumerConfig{
+		Durable:   "pull",
+		AckPolicy: nats.AckExplicitPolicy,
+	})
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		mtx       sync.Mutex
+		errs      []error
+		processed = make(chan struct{}, 1)
+	)
+	subscriber := natstransport.NewJetStreamSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			return nil, errors.New("failed")
+		},
+		natstransport.NopRequestDecoder,
+		natstransport.JetStreamSubscriberInProgress(time.Millisecond),
+		natstransport.JetStreamSubscriberErrorEncoder(func(_ context.Context, _ error, msg *nats.Msg) error {
+			err := msg.Term()
+			// Leave time for heartbeats that outlive the acknowledgement.
+			time.Sleep(20 * time.Millisecond)
+			return err
+		}),
+		natstransport.JetStreamSubscriberErrorHandler(transport.ErrorHandlerFunc(func(_ context.Context, err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err.Error() != "failed" {
+				errs = append(errs, err)
+			}
+		})),
+		natstransport.JetStreamSubscriberFinalizer(func(context.Context, *nats.Msg) {
+			processed <- struct{}{}
+		}),
+	)
+	sub, err := js.PullSubscribe("orders.>", "pull", nats.Bind("ORDERS", "pull"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- subscriber.ServePull(ctx, sub, 10) }()
+
+	if _, err := js.Publish("orders.created", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	cancel()
+	<-served
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(errs) > 0 {
+		t.Errorf("want no errors, have %v", errs)
+	}
+}
+
+func TestJetStreamSubscriberPullWithoutDeadline(t *testing.T) {
+	s, c, js := newJetStream(t, &nats.ConsumerConfig{
+		Durable:   "pull",
+		AckPolicy: nats.AckExplicitPolicy,
+	})
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	processed := make(chan struct{}, 1)
+	subscriber := natstransport.NewJetStreamSubscriber(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			processed <- struct{}{}
+			return nil, nil
+		},
+		natstransport.NopRequestDecoder,
+		natstransport.JetStreamSubscriberFetchWait(20*time.Millisecond),
+	)
+	sub, err := js.PullSubscribe("orders.>", "pull", nats.Bind("ORDERS", "pull"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- subscriber.ServePull(context.Background(), sub, 10) }()
+
+	// Let a few fetches time out before a message arrives.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := js.Publish("orders.created", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-processed:
+	case err := <-served:
+		t.Fatalf("ServePull: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	// Without a deadline, ServePull only returns once fetching fails.
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		if err == nil || errors.Is(err, nats.ErrNoDeadlineContext) {
+			t.Errorf("ServePull: want the subscription's error, have %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for ServePull to return")
+	}
+}
@@ -0,0 +1,283 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrQueueRunnerClosed is returned by QueueRunner.Subscribe once the runner
+// is shut down.
+var ErrQueueRunnerClosed = errors.New("queue runner is shut down")
+
+// QueueRunner manages queue-group subscriptions, and processes their messages
+// on a fixed pool of workers, rather than on the callback goroutine of each
+// subscription, so that a slow handler doesn't block its whole subscription.
+//
+// When every worker is busy, messages wait in a small internal queue, and
+// then in the pending buffer of their subscription, whose limits are set with
+// QueueRunnerPendingLimits. Once that's full, the NATS client drops messages,
+// and reports the subscription as a slow consumer. Other members of the queue
+// group get the messages that the server hasn't sent yet.
+type QueueRunner struct {
+	nc            *nats.Conn
+	workers       int
+	buffer        int
+	pendingMsgs   int
+	pendingBytes  int
+	queueDepth    metrics.Gauge
+	processing    metrics.Histogram
+	dropped       metrics.Counter
+	errorHandler  transport.ErrorHandler
+	asyncErrorsCB nats.ErrHandler
+
+	jobs    chan queueJob
+	drained sync.Once
+	done    chan struct{}
+
+	mtx     sync.Mutex
+	subs    []*nats.Subscription
+	dropCnt map[*nats.Subscription]int
+	closed  bool
+}
+
+type queueJob struct {
+	msg     *nats.Msg
+	handler nats.MsgHandler
+}
+
+// NewQueueRunner constructs a QueueRunner, and starts its workers. It installs
+// an asynchronous error handler on the connection to observe slow consumer
+// events, which calls the previously installed handler for every error, so
+// that the application's handler, and those of other runners on the same
+// connection, keep being called. It must not be called concurrently with the
+// connection's SetErrorHandler.
+func NewQueueRunner(nc *nats.Conn, options ...QueueRunnerOption) *QueueRunner {
+	r := &QueueRunner{
+		nc:           nc,
+		workers:      runtime.GOMAXPROCS(0),
+		pendingMsgs:  nats.DefaultSubPendingMsgsLimit,
+		pendingBytes: nats.DefaultSubPendingBytesLimit,
+		queueDepth:   discard.NewGauge(),
+		processing:   discard.NewHistogram(),
+		dropped:      discard.NewCounter(),
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		dropCnt:      map[*nats.Subscription]int{},
+	}
+	for _, option := range options {
+		option(r)
+	}
+	if r.workers < 1 {
+		r.workers = 1
+	}
+	if r.buffer < 1 {
+		r.buffer = r.workers
+	}
+
+	r.asyncErrorsCB = nc.Opts.AsyncErrorCB
+	nc.SetErrorHandler(r.handleAsyncError)
+
+	r.jobs = make(chan queueJob, r.buffer)
+	r.done = make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(r.workers)
+	for i := 0; i < r.workers; i++ {
+		go func() {
+			defer wg.Done()
+			r.work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(r.done)
+	}()
+	return r
+}
+
+// QueueRunnerOption sets an optional parameter for queue runners.
+type QueueRunnerOption func(*QueueRunner)
+
+// QueueRunnerWorkers sets the number of messages processed concurrently,
+// across all subscriptions. By default, it's GOMAXPROCS.
+func QueueRunnerWorkers(n int) QueueRunnerOption {
+	return func(r *QueueRunner) { r.workers = n }
+}
+
+// QueueRunnerBuffer sets the number of messages that may wait for a worker in
+// the runner's internal queue. By default, it's the number of workers.
+func QueueRunnerBuffer(n int) QueueRunnerOption {
+	return func(r *QueueRunner) { r.buffer = n }
+}
+
+// QueueRunnerPendingLimits sets the pending limits of each subscription: the
+// number of messages and bytes that the NATS client buffers for it before
+// dropping messages. By default, the limits of the NATS client are used.
+func QueueRunnerPendingLimits(msgs, bytes int) QueueRunnerOption {
+	return func(r *QueueRunner) { r.pendingMsgs, r.pendingBytes = msgs, bytes }
+}
+
+// QueueRunnerQueueDepth sets the gauge that's set to the number of messages
+// waiting to be processed: those in the runner's queue, and those pending in
+// the buffers of its subscriptions.
+func QueueRunnerQueueDepth(g metrics.Gauge) QueueRunnerOption {
+	return func(r *QueueRunner) { r.queueDepth = g }
+}
+
+// QueueRunnerProcessingTime sets the histogram that observes how long the
+// handler took to process each message, in seconds.
+func QueueRunnerProcessingTime(h metrics.Histogram) QueueRunnerOption {
+	return func(r *QueueRunner) { r.processing = h }
+}
+
+// QueueRunnerDropped sets the counter of the messages dropped by the NATS
+// client because a subscription was a slow consumer.
+func QueueRunnerDropped(c metrics.Counter) QueueRunnerOption {
+	return func(r *QueueRunner) { r.dropped = c }
+}
+
+// QueueRunnerErrorHandler is used to handle non-terminal errors, such as slow
+// consumer events of the runner's subscriptions. By default, they're ignored.
+func QueueRunnerErrorHandler(errorHandler transport.ErrorHandler) QueueRunnerOption {
+	return func(r *QueueRunner) { r.errorHandler = errorHandler }
+}
+
+// Subscribe subscribes the handler to the subject as a member of the queue
+// group, and processes its messages on the runner's workers. The handler is
+// typically Subscriber.ServeMsg.
+func (r *QueueRunner) Subscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.closed {
+		return nil, ErrQueueRunnerClosed
+	}
+
+	sub, err := r.nc.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		// Blocking here leaves the next messages in the pending buffer of the
+		// subscription, which is what its pending limits apply to.
+		r.jobs <- queueJob{msg: msg, handler: handler}
+		r.updateQueueDepth()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := sub.SetPendingLimits(r.pendingMsgs, r.pendingBytes); err != nil {
+		_ = sub.Unsubscribe()
+		return nil, err
+	}
+	r.subs = append(r.subs, sub)
+	return sub, nil
+}
+
+// Shutdown drains the runner's subscriptions, so that no new messages are
+// delivered to them, and waits for the messages already delivered to be
+// processed, or for the context to be done. It's safe to call more than once,
+// so a Shutdown whose context is done may be followed by another one that
+// keeps waiting.
+func (r *QueueRunner) Shutdown(ctx context.Context) error {
+	r.mtx.Lock()
+	subs := r.subs
+	first := !r.closed
+	r.closed = true
+	r.mtx.Unlock()
+
+	if first {
+		for _, sub := range subs {
+			if err := sub.Drain(); err != nil && err != nats.ErrBadSubscription && err != nats.ErrConnectionClosed {
+				r.errorHandler.Handle(ctx, err)
+			}
+		}
+	}
+
+	// The NATS client doesn't signal the end of a subscription's drain, so
+	// it's polled for, but only while the caller is waiting. Once every
+	// subscription is drained, nothing sends jobs anymore.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for _, sub := range subs {
+		for sub.IsValid() {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	r.drained.Do(func() { close(r.jobs) })
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *QueueRunner) work() {
+	for job := range r.jobs {
+		r.updateQueueDepth()
+		begin := time.Now()
+		job.handler(job.msg)
+		r.processing.Observe(time.Since(begin).Seconds())
+	}
+}
+
+func (r *QueueRunner) updateQueueDepth() {
+	depth := len(r.jobs)
+	r.mtx.Lock()
+	for _, sub := range r.subs {
+		if msgs, _, err := sub.Pending(); err == nil {
+			depth += msgs
+		}
+	}
+	r.mtx.Unlock()
+	r.queueDepth.Set(float64(depth))
+}
+
+func (r *QueueRunner) handleAsyncError(nc *nats.Conn, sub *nats.Subscription, err error) {
+	if sub != nil && r.owns(sub) {
+		if err == nats.ErrSlowConsumer {
+			r.countDropped(sub)
+		}
+		r.errorHandler.Handle(context.Background(), fmt.Errorf("subject %s, queue %s: %w", sub.Subject, sub.Queue, err))
+	}
+	if r.asyncErrorsCB != nil {
+		r.asyncErrorsCB(nc, sub, err)
+	}
+}
+
+func (r *QueueRunner) owns(sub *nats.Subscription) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, s := range r.subs {
+		if s == sub {
+			return true
+		}
+	}
+	return false
+}
+
+// countDropped adds the messages dropped by sub since the last slow consumer
+// event to the dropped counter.
+func (r *QueueRunner) countDropped(sub *nats.Subscription) {
+	dropped, err := sub.Dropped()
+	if err != nil {
+		return
+	}
+	r.mtx.Lock()
+	delta := dropped - r.dropCnt[sub]
+	r.dropCnt[sub] = dropped
+	r.mtx.Unlock()
+	if delta > 0 {
+		r.dropped.Add(float64(delta))
+	}
+}
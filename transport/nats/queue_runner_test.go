@@ -0,0 +1,230 @@
+package nats_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/go-kit/kit/transport"
+	natstransport "github.com/go-kit/kit/transport/nats"
+)
+
+func TestQueueRunnerWorkers(t *testing.T) {
+	s, c := newNATSConn(t)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		processing = generic.NewHistogram("processing", 10)
+		depth      = generic.NewGauge("depth")
+		runner     = natstransport.NewQueueRunner(c,
+			natstransport.QueueRunnerWorkers(4),
+			natstransport.QueueRunnerProcessingTime(processing),
+			natstransport.QueueRunnerQueueDepth(depth),
+		)
+		mtx       sync.Mutex
+		inflight  int
+		maxFlight int
+		wg        sync.WaitGroup
+	)
+	_, err := runner.Subscribe("natstransport.test", "workers", func(msg *nats.Msg) {
+		defer wg.Done()
+		mtx.Lock()
+		inflight++
+		if inflight > maxFlight {
+			maxFlight = inflight
+		}
+		mtx.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mtx.Lock()
+		inflight--
+		mtx.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 12
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		if err := c.Publish("natstransport.test", []byte("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	begin := time.Now()
+	wg.Wait()
+
+	if want, have := 4, maxFlight; want != have {
+		t.Errorf("concurrent messages: want %d, have %d", want, have)
+	}
+	if elapsed := time.Since(begin); elapsed > n*50*time.Millisecond/2 {
+		t.Errorf("messages weren't processed concurrently: took %v", elapsed)
+	}
+	if err := runner.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if have := processing.Quantile(0.5); have < 0.05 {
+		t.Errorf("median processing time: want at least 0.05s, have %vs", have)
+	}
+	if want, have := 0.0, depth.Value(); want != have {
+		t.Errorf("queue depth: want %v, have %v", want, have)
+	}
+}
+
+func TestQueueRunnerShutdownDrains(t *testing.T) {
+	s, c := newNATSConn(t)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		runner    = natstransport.NewQueueRunner(c, natstransport.QueueRunnerWorkers(2))
+		mtx       sync.Mutex
+		processed int
+	)
+	_, err := runner.Subscribe("natstransport.test", "drain", func(msg *nats.Msg) {
+		time.Sleep(10 * time.Millisecond)
+		mtx.Lock()
+		processed++
+		mtx.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		if err := c.Publish("natstransport.test", []byte("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := runner.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mtx.Lock()
+	if want, have := n, processed; want != have {
+		t.Errorf("processed: want %d, have %d", want, have)
+	}
+	mtx.Unlock()
+
+	if _, err := runner.Subscribe("natstransport.test", "drain", func(*nats.Msg) {}); err != natstransport.ErrQueueRunnerClosed {
+		t.Errorf("Subscribe after Shutdown: want %v, have %v", natstransport.ErrQueueRunnerClosed, err)
+	}
+}
+
+func TestQueueRunnerShutdownTimeout(t *testing.T) {
+	s, c := newNATSConn(t)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		runner  = natstransport.NewQueueRunner(c, natstransport.QueueRunnerWorkers(1))
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	_, err := runner.Subscribe("natstransport.test", "timeout", func(*nats.Msg) {
+		close(started)
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("natstransport.test", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if want, have := context.DeadlineExceeded, runner.Shutdown(ctx); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// A later Shutdown keeps waiting for the message being processed.
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := runner.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueRunnerSlowConsumer(t *testing.T) {
+	s, c := newNATSConn(t)
+	defer func() { s.Shutdown(); s.WaitForShutdown() }()
+	defer c.Close()
+
+	var (
+		dropped  = generic.NewCounter("dropped")
+		slow     = make(chan error, 1)
+		release  = make(chan struct{})
+		previous = make(chan error, 1)
+	)
+	c.SetErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+		select {
+		case previous <- err:
+		default:
+		}
+	})
+	runner := natstransport.NewQueueRunner(c,
+		natstransport.QueueRunnerWorkers(1),
+		natstransport.QueueRunnerBuffer(1),
+		natstransport.QueueRunnerPendingLimits(2, 1024),
+		natstransport.QueueRunnerDropped(dropped),
+		natstransport.QueueRunnerErrorHandler(transport.ErrorHandlerFunc(func(_ context.Context, err error) {
+			select {
+			case slow <- err:
+			default:
+			}
+		})),
+	)
+	// Another runner on the same connection stacks its handler on top.
+	other := natstransport.NewQueueRunner(c)
+	defer other.Shutdown(context.Background())
+
+	_, err := runner.Subscribe("natstransport.test", "slow", func(*nats.Msg) { <-release })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := c.Publish("natstransport.test", []byte("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-slow:
+		if !errors.Is(err, nats.ErrSlowConsumer) {
+			t.Errorf("want %v, have %v", nats.ErrSlowConsumer, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for slow consumer event")
+	}
+	select {
+	case <-previous:
+	case <-time.After(time.Second):
+		t.Error("previous error handler wasn't called")
+	}
+	if have := dropped.Value(); have <= 0 {
+		t.Errorf("dropped: want more than 0, have %v", have)
+	}
+
+	close(release)
+	if err := runner.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -20,3 +20,68 @@ type SubscriberResponseFunc func(context.Context, *nats.Conn) context.Context
 // response available for consumption. ClientResponseFuncs are only executed in
 // clients, after a request has been made, but prior to it being decoded.
 type PublisherResponseFunc func(context.Context, *nats.Msg) context.Context
+
+// SetRequestHeader returns a RequestFunc that sets the given header on the
+// NATS message. In Publishers, it's applied to the request message.
+func SetRequestHeader(key, val string) RequestFunc {
+	return func(ctx context.Context, msg *nats.Msg) context.Context {
+		if msg.Header == nil {
+			msg.Header = nats.Header{}
+		}
+		msg.Header.Set(key, val)
+		return ctx
+	}
+}
+
+// PopulateRequestContext is a RequestFunc that populates the context with the
+// headers of the NATS message, under ContextKeyRequestHeader.
+func PopulateRequestContext(ctx context.Context, msg *nats.Msg) context.Context {
+	return context.WithValue(ctx, ContextKeyRequestHeader, msg.Header)
+}
+
+// SetReplyHeader returns a SubscriberResponseFunc that sets the given header on
+// the reply. It's honored by the encoders in this package, and by custom
+// encoders that publish messages created with NewReplyMsg.
+func SetReplyHeader(key, val string) SubscriberResponseFunc {
+	return func(ctx context.Context, _ *nats.Conn) context.Context {
+		if h, ok := ctx.Value(ContextKeyReplyHeader).(nats.Header); ok {
+			h.Set(key, val)
+		}
+		return ctx
+	}
+}
+
+// NewReplyMsg returns a message to the reply subject, carrying a copy of the
+// headers set with SetReplyHeader. Custom EncodeResponseFuncs and
+// ErrorEncoders can fill in its Data, and publish it with nc.PublishMsg.
+func NewReplyMsg(ctx context.Context, reply string) *nats.Msg {
+	msg := nats.NewMsg(reply)
+	if h, ok := ctx.Value(ContextKeyReplyHeader).(nats.Header); ok {
+		copyHeader(msg.Header, h)
+	}
+	return msg
+}
+
+func copyHeader(dst, src nats.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+}
+
+type contextKey int
+
+const (
+	// ContextKeyRequestHeader is populated in the context by
+	// PopulateRequestContext. Its value is the nats.Header of the message.
+	ContextKeyRequestHeader contextKey = iota
+
+	// ContextKeyReplyHeader is populated in the context by Subscriber with
+	// the nats.Header that SetReplyHeader adds to, and that NewReplyMsg copies
+	// to the reply.
+	ContextKeyReplyHeader
+
+	// ContextKeyMsgMetadata is populated in the context by JetStreamSubscriber
+	// with the *nats.MsgMetadata of the message being processed: its stream and
+	// consumer sequences, delivery count, timestamp and pending count.
+	ContextKeyMsgMetadata
+)
@@ -96,6 +96,8 @@ func (s Subscriber) ServeMsg(nc *nats.Conn) func(msg *nats.Msg) {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		ctx = context.WithValue(ctx, ContextKeyReplyHeader, nats.Header{})
+
 		if len(s.finalizer) > 0 {
 			defer func() {
 				for _, f := range s.finalizer {
@@ -163,20 +165,34 @@ func NopRequestDecoder(_ context.Context, _ *nats.Msg) (interface{}, error) {
 
 // EncodeJSONResponse is a EncodeResponseFunc that serializes the response as a
 // JSON object to the subscriber reply. Many JSON-over services can use it as
-// a sensible default.
-func EncodeJSONResponse(_ context.Context, reply string, nc *nats.Conn, response interface{}) error {
+// a sensible default. If the response implements Headerer, the provided
+// headers will be set on the reply, along with those set by SetReplyHeader.
+func EncodeJSONResponse(ctx context.Context, reply string, nc *nats.Conn, response interface{}) error {
 	b, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
 
-	return nc.Publish(reply, b)
+	msg := NewReplyMsg(ctx, reply)
+	if headerer, ok := response.(Headerer); ok {
+		copyHeader(msg.Header, headerer.Headers())
+	}
+	msg.Data = b
+
+	return nc.PublishMsg(msg)
 }
 
-// DefaultErrorEncoder writes the error to the subscriber reply.
-func DefaultErrorEncoder(_ context.Context, err error, reply string, nc *nats.Conn) {
+// DefaultErrorEncoder writes the error to the subscriber reply. If the error
+// implements Headerer, the provided headers will be set on the reply, along
+// with those set by SetReplyHeader.
+func DefaultErrorEncoder(ctx context.Context, err error, reply string, nc *nats.Conn) {
 	logger := log.NewNopLogger()
 
+	msg := NewReplyMsg(ctx, reply)
+	if headerer, ok := err.(Headerer); ok {
+		copyHeader(msg.Header, headerer.Headers())
+	}
+
 	type Response struct {
 		Error string `json:"err"`
 	}
@@ -191,7 +207,9 @@ func DefaultErrorEncoder(_ context.Context, err error, reply string, nc *nats.Co
 		return
 	}
 
-	if err := nc.Publish(reply, b); err != nil {
+	msg.Data = b
+
+	if err := nc.PublishMsg(msg); err != nil {
 		logger.Log("err", err)
 	}
 }
@@ -0,0 +1,138 @@
+package netrpc
+
+import (
+	"context"
+	"net/rpc"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Client wraps a net/rpc client and provides a method that implements
+// endpoint.Endpoint, for a single remote method.
+type Client struct {
+	client        *rpc.Client
+	serviceMethod string
+	enc           EncodeRequestFunc
+	newReply      func() interface{}
+	dec           DecodeResponseFunc
+	before        []ClientRequestFunc
+	after         []ClientResponseFunc
+	finalizer     []ClientFinalizerFunc
+}
+
+// NewClient constructs a usable Client for a single remote method, like
+// "Sum.Call" for a Server registered as "Sum", or "Arith.Multiply" for the
+// method of another service. newReply returns a pointer to a new reply of the
+// method, which is passed to the DecodeResponseFunc: a *Response for servers.
+func NewClient(
+	client *rpc.Client,
+	serviceMethod string,
+	enc EncodeRequestFunc,
+	newReply func() interface{},
+	dec DecodeResponseFunc,
+	options ...ClientOption,
+) *Client {
+	c := &Client{
+		client:        client,
+		serviceMethod: serviceMethod,
+		enc:           enc,
+		newReply:      newReply,
+		dec:           dec,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(*Client)
+
+// ClientBefore sets the RequestFuncs that are applied to the headers of the
+// outgoing Request before the method is invoked.
+func ClientBefore(before ...ClientRequestFunc) ClientOption {
+	return func(c *Client) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter sets the ClientResponseFuncs that are applied to the headers of
+// the incoming Response prior to it being decoded.
+func ClientAfter(after ...ClientResponseFunc) ClientOption {
+	return func(c *Client) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer is executed at the end of every net/rpc call.
+// By default, no finalizer is registered.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *Client) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// Endpoint returns a usable endpoint that will invoke the remote method
+// specified by the client. When the context is canceled before the reply is
+// received, the endpoint returns the error of the context, and the reply is
+// discarded.
+func (c Client) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		if c.finalizer != nil {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		args, err := c.enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		header := map[string]string{}
+		for _, f := range c.before {
+			ctx = f(ctx, header)
+		}
+		if req, ok := args.(*Request); ok {
+			if req.Header == nil {
+				req.Header = map[string]string{}
+			}
+			for key, val := range header {
+				req.Header[key] = val
+			}
+			if deadline, ok := ctx.Deadline(); ok {
+				req.Deadline = deadline
+			}
+		}
+
+		reply := c.newReply()
+		call := c.client.Go(c.serviceMethod, args, reply, make(chan *rpc.Call, 1))
+		select {
+		case <-call.Done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.Error != nil {
+			return nil, call.Error
+		}
+
+		header = map[string]string{}
+		if resp, ok := reply.(*Response); ok && resp.Header != nil {
+			header = resp.Header
+		}
+		for _, f := range c.after {
+			ctx = f(ctx, header)
+		}
+
+		response, err = c.dec(ctx, reply)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+// ClientFinalizerFunc can be used to perform work at the end of a client
+// net/rpc call, after the response is returned. The principal intended use is
+// for error logging.
+// Note: err may be nil.
+type ClientFinalizerFunc func(ctx context.Context, err error)
@@ -0,0 +1,228 @@
+package netrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/netrpc"
+)
+
+type sumRequest struct{ A, B int }
+
+type sumResponse struct{ V int }
+
+func sumEndpoint(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(sumRequest)
+	if req.A < 0 {
+		return nil, errors.New("negative a")
+	}
+	return sumResponse{V: req.A + req.B}, nil
+}
+
+func decodeSumRequest(_ context.Context, body []byte) (interface{}, error) {
+	var req sumRequest
+	err := json.Unmarshal(body, &req)
+	return req, err
+}
+
+func encodeSumResponse(_ context.Context, response interface{}) ([]byte, error) {
+	return json.Marshal(response)
+}
+
+func encodeSumRequest(_ context.Context, request interface{}) (interface{}, error) {
+	body, err := json.Marshal(request)
+	return &netrpc.Request{Body: body}, err
+}
+
+func decodeSumResponse(_ context.Context, reply interface{}) (interface{}, error) {
+	var resp sumResponse
+	err := json.Unmarshal(reply.(*netrpc.Response).Body, &resp)
+	return resp, err
+}
+
+func newResponse() interface{} { return &netrpc.Response{} }
+
+// Arith is a net/rpc service that isn't built with go kit.
+type Arith struct{}
+
+type MultiplyArgs struct{ A, B int }
+
+func (Arith) Multiply(args *MultiplyArgs, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+// Sleep replies after the duration.
+func (Arith) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	return nil
+}
+
+func serve(t *testing.T, codec netrpc.Codec, register func(*rpc.Server)) (client *rpc.Client, stop func()) {
+	t.Helper()
+	server := rpc.NewServer()
+	register(server)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go netrpc.Serve(server, l, codec)
+
+	client, err = netrpc.Dial("tcp", l.Addr().String(), codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, func() {
+		client.Close()
+		l.Close()
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	for name, codec := range map[string]netrpc.Codec{
+		"gob":  netrpc.GobCodec,
+		"json": netrpc.JSONCodec,
+	} {
+		t.Run(name, func(t *testing.T) {
+			type ctxKey struct{}
+			var (
+				requestID string
+				deadline  time.Time
+				finalized error = errors.New("not finalized")
+			)
+			server := netrpc.NewServer(
+				func(ctx context.Context, request interface{}) (interface{}, error) {
+					requestID, _ = ctx.Value(ctxKey{}).(string)
+					deadline, _ = ctx.Deadline()
+					return sumEndpoint(ctx, request)
+				},
+				decodeSumRequest,
+				encodeSumResponse,
+				netrpc.ServerBefore(func(ctx context.Context, header map[string]string) context.Context {
+					return context.WithValue(ctx, ctxKey{}, header["X-Request-ID"])
+				}),
+				netrpc.ServerAfter(netrpc.SetResponseHeader("X-Served-By", "sum-1")),
+				netrpc.ServerFinalizer(func(_ context.Context, err error) { finalized = err }),
+			)
+			client, stop := serve(t, codec, func(s *rpc.Server) { s.RegisterName("Sum", server) })
+			defer stop()
+
+			var servedBy string
+			e := netrpc.NewClient(
+				client, "Sum.Call", encodeSumRequest, newResponse, decodeSumResponse,
+				netrpc.ClientBefore(netrpc.SetRequestHeader("X-Request-ID", "abc")),
+				netrpc.ClientAfter(func(ctx context.Context, header map[string]string) context.Context {
+					servedBy = header["X-Served-By"]
+					return ctx
+				}),
+			).Endpoint()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			want, _ := ctx.Deadline()
+
+			response, err := e(ctx, sumRequest{A: 1, B: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := 3, response.(sumResponse).V; want != have {
+				t.Errorf("want %d, have %d", want, have)
+			}
+			if want, have := "abc", requestID; want != have {
+				t.Errorf("request header: want %q, have %q", want, have)
+			}
+			if want, have := "sum-1", servedBy; want != have {
+				t.Errorf("response header: want %q, have %q", want, have)
+			}
+			if !deadline.Equal(want) {
+				t.Errorf("deadline: want %v, have %v", want, deadline)
+			}
+			if finalized != nil {
+				t.Errorf("finalizer: want nil error, have %v", finalized)
+			}
+		})
+	}
+}
+
+func TestServerError(t *testing.T) {
+	var finalized error
+	server := netrpc.NewServer(
+		sumEndpoint, decodeSumRequest, encodeSumResponse,
+		netrpc.ServerFinalizer(func(_ context.Context, err error) { finalized = err }),
+	)
+	client, stop := serve(t, netrpc.GobCodec, func(s *rpc.Server) { s.RegisterName("Sum", server) })
+	defer stop()
+
+	e := netrpc.NewClient(client, "Sum.Call", encodeSumRequest, newResponse, decodeSumResponse).Endpoint()
+	_, err := e(context.Background(), sumRequest{A: -1})
+	if want, have := rpc.ServerError("negative a"), err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := "negative a", finalized.Error(); want != have {
+		t.Errorf("finalizer: want %q, have %q", want, have)
+	}
+}
+
+func TestClientOtherService(t *testing.T) {
+	client, stop := serve(t, netrpc.JSONCodec, func(s *rpc.Server) { s.Register(Arith{}) })
+	defer stop()
+
+	var header map[string]string
+	e := netrpc.NewClient(
+		client,
+		"Arith.Multiply",
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			req := request.([2]int)
+			return &MultiplyArgs{A: req[0], B: req[1]}, nil
+		},
+		func() interface{} { return new(int) },
+		func(_ context.Context, reply interface{}) (interface{}, error) {
+			return *reply.(*int), nil
+		},
+		netrpc.ClientAfter(func(ctx context.Context, h map[string]string) context.Context {
+			header = h
+			return ctx
+		}),
+	).Endpoint()
+
+	response, err := e(context.Background(), [2]int{6, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 42, response; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if header == nil || len(header) != 0 {
+		t.Errorf("want empty header, have %v", header)
+	}
+}
+
+func TestClientContextCanceled(t *testing.T) {
+	client, stop := serve(t, netrpc.GobCodec, func(s *rpc.Server) { s.Register(Arith{}) })
+	defer stop()
+
+	var finalized error
+	e := netrpc.NewClient(
+		client,
+		"Arith.Sleep",
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		func() interface{} { return new(int) },
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+		netrpc.ClientFinalizer(func(_ context.Context, err error) { finalized = err }),
+	).Endpoint()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := e(ctx, time.Second)
+	if want, have := context.DeadlineExceeded, err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := context.DeadlineExceeded, finalized; want != have {
+		t.Errorf("finalizer: want %v, have %v", want, have)
+	}
+}
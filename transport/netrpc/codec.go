@@ -0,0 +1,65 @@
+package netrpc
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+// Codec is the codec of net/rpc connections. Servers and clients must agree
+// on it.
+type Codec int
+
+const (
+	// GobCodec is the default codec of net/rpc, which encodes messages with
+	// encoding/gob.
+	GobCodec Codec = iota
+
+	// JSONCodec is the JSON-RPC 1.0 codec of net/rpc/jsonrpc.
+	JSONCodec
+)
+
+// ServeConn serves a single connection with the codec, until the client
+// hangs up.
+func ServeConn(server *rpc.Server, conn io.ReadWriteCloser, codec Codec) {
+	switch codec {
+	case JSONCodec:
+		server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	default:
+		server.ServeConn(conn)
+	}
+}
+
+// Serve accepts connections on the listener and serves each of them with the
+// codec, in a new goroutine. It returns the error of the listener, when it's
+// closed.
+func Serve(server *rpc.Server, l net.Listener, codec Codec) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go ServeConn(server, conn, codec)
+	}
+}
+
+// NewClientWithCodec returns a net/rpc client for the connection, with the
+// codec.
+func NewClientWithCodec(conn io.ReadWriteCloser, codec Codec) *rpc.Client {
+	switch codec {
+	case JSONCodec:
+		return jsonrpc.NewClient(conn)
+	default:
+		return rpc.NewClient(conn)
+	}
+}
+
+// Dial connects to the net/rpc server at the address, with the codec.
+func Dial(network, address string, codec Codec) (*rpc.Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithCodec(conn, codec), nil
+}
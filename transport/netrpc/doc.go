@@ -0,0 +1,8 @@
+// Package netrpc provides a net/rpc binding for endpoints.
+//
+// Servers expose endpoints as net/rpc services, which take a Request envelope
+// carrying the encoded request along with headers and the deadline of the
+// caller. Clients invoke any net/rpc method, including the ones of older
+// services which take their own args, as endpoints. Connections use either
+// the gob or the JSON-RPC 1.0 codec.
+package netrpc
@@ -0,0 +1,25 @@
+package netrpc
+
+import "context"
+
+// DecodeRequestFunc extracts a user-domain request object from the body of a
+// Request. It's designed to be used in net/rpc servers, for server-side
+// endpoints.
+type DecodeRequestFunc func(ctx context.Context, body []byte) (request interface{}, err error)
+
+// EncodeResponseFunc encodes the passed response object into the body of a
+// Response. It's designed to be used in net/rpc servers, for server-side
+// endpoints.
+type EncodeResponseFunc func(ctx context.Context, response interface{}) (body []byte, err error)
+
+// EncodeRequestFunc encodes the passed request object into the args of a
+// net/rpc method: a *Request for the methods of servers, or the args of the
+// methods of other services. It's designed to be used in net/rpc clients, for
+// client-side endpoints.
+type EncodeRequestFunc func(ctx context.Context, request interface{}) (args interface{}, err error)
+
+// DecodeResponseFunc extracts a user-domain response object from the reply of
+// a net/rpc method: a *Response for the methods of servers, or the reply of
+// the methods of other services. It's designed to be used in net/rpc clients,
+// for client-side endpoints.
+type DecodeResponseFunc func(ctx context.Context, reply interface{}) (response interface{}, err error)
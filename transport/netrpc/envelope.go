@@ -0,0 +1,27 @@
+package netrpc
+
+import "time"
+
+// Request is the args of the Call method of servers. It carries the encoded
+// request along with the context of the caller.
+type Request struct {
+	// Header is read by ServerRequestFuncs, and set by ClientRequestFuncs.
+	Header map[string]string
+
+	// Deadline is the deadline of the context of the caller, if any. Servers
+	// apply it to the context of the request, so it assumes the clocks of the
+	// hosts are synchronized.
+	Deadline time.Time
+
+	// Body is the request, as encoded by the client.
+	Body []byte
+}
+
+// Response is the reply of the Call method of servers.
+type Response struct {
+	// Header is set by ServerResponseFuncs, and read by ClientResponseFuncs.
+	Header map[string]string
+
+	// Body is the response, as encoded by the server.
+	Body []byte
+}
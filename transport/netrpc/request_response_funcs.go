@@ -0,0 +1,42 @@
+package netrpc
+
+import "context"
+
+// ClientRequestFunc may take information from context and use it to construct
+// headers to be transported to the server. ClientRequestFuncs are executed
+// after encoding the request but prior to invoking the method. Headers are
+// only transported to servers, whose args are a *Request.
+type ClientRequestFunc func(ctx context.Context, header map[string]string) context.Context
+
+// ServerRequestFunc may take information from the headers of the Request and
+// use it to place items in the request scoped context. ServerRequestFuncs are
+// executed prior to invoking the endpoint.
+type ServerRequestFunc func(ctx context.Context, header map[string]string) context.Context
+
+// ServerResponseFunc may take information from a request context and use it
+// to set the headers of the Response. ServerResponseFuncs are only executed
+// in servers, after invoking the endpoint but prior to replying.
+type ServerResponseFunc func(ctx context.Context, header map[string]string) context.Context
+
+// ClientResponseFunc may take information from the headers of the Response
+// and make them available for consumption. ClientResponseFuncs are only
+// executed in clients, after a method has been invoked, but prior to decoding
+// its reply. The headers are empty for replies which aren't a *Response.
+type ClientResponseFunc func(ctx context.Context, header map[string]string) context.Context
+
+// SetRequestHeader returns a ClientRequestFunc that sets the specified header.
+func SetRequestHeader(key, val string) ClientRequestFunc {
+	return func(ctx context.Context, header map[string]string) context.Context {
+		header[key] = val
+		return ctx
+	}
+}
+
+// SetResponseHeader returns a ServerResponseFunc that sets the specified
+// header.
+func SetResponseHeader(key, val string) ServerResponseFunc {
+	return func(ctx context.Context, header map[string]string) context.Context {
+		header[key] = val
+		return ctx
+	}
+}
@@ -0,0 +1,127 @@
+package netrpc
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// Server wraps an endpoint and exposes it as a net/rpc service, whose single
+// method is Call. Register it under the name of the endpoint:
+//
+//	rpcServer.RegisterName("Sum", sumServer)
+//
+// Clients then invoke the endpoint through the "Sum.Call" method.
+type Server struct {
+	e            endpoint.Endpoint
+	dec          DecodeRequestFunc
+	enc          EncodeResponseFunc
+	before       []ServerRequestFunc
+	after        []ServerResponseFunc
+	finalizer    []ServerFinalizerFunc
+	errorHandler transport.ErrorHandler
+}
+
+// NewServer constructs a new server, which implements the Call method of a
+// net/rpc service, and wraps the provided endpoint.
+func NewServer(
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	enc EncodeResponseFunc,
+	options ...ServerOption,
+) *Server {
+	s := &Server{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(*Server)
+
+// ServerBefore functions are executed on the headers of the Request before
+// the request is decoded.
+func ServerBefore(before ...ServerRequestFunc) ServerOption {
+	return func(s *Server) { s.before = append(s.before, before...) }
+}
+
+// ServerAfter functions are executed on the headers of the Response after the
+// endpoint is invoked, but before the response is encoded.
+func ServerAfter(after ...ServerResponseFunc) ServerOption {
+	return func(s *Server) { s.after = append(s.after, after...) }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored.
+func ServerErrorHandler(errorHandler transport.ErrorHandler) ServerOption {
+	return func(s *Server) { s.errorHandler = errorHandler }
+}
+
+// ServerFinalizer is executed at the end of every net/rpc call.
+// By default, no finalizer is registered.
+func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
+	return func(s *Server) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// Call implements the method of the net/rpc service. Errors are returned to
+// the client as an rpc.ServerError, with the message of the error.
+func (s Server) Call(req *Request, resp *Response) (err error) {
+	ctx := context.Background()
+	if !req.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, req.Deadline)
+		defer cancel()
+	}
+
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	header := req.Header
+	if header == nil {
+		header = map[string]string{}
+	}
+	for _, f := range s.before {
+		ctx = f(ctx, header)
+	}
+
+	request, err := s.dec(ctx, req.Body)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return err
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return err
+	}
+
+	resp.Header = map[string]string{}
+	for _, f := range s.after {
+		ctx = f(ctx, resp.Header)
+	}
+
+	resp.Body, err = s.enc(ctx, response)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// ServerFinalizerFunc can be used to perform work at the end of a net/rpc
+// call, after the endpoint has been invoked and the response encoded.
+type ServerFinalizerFunc func(ctx context.Context, err error)
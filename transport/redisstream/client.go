@@ -0,0 +1,61 @@
+package redisstream
+
+import (
+	"context"
+	"time"
+)
+
+// Entry is an entry of a stream, either added or read.
+type Entry struct {
+	Stream string
+	ID     string
+	Values map[string]string
+
+	// Deliveries is the number of times the entry was delivered to the
+	// consumer group, including the current one. It's set by subscribers.
+	Deliveries int64
+}
+
+// PendingEntry describes an entry delivered to a consumer of a group, and
+// not acknowledged yet, as returned by XPENDING.
+type PendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int64
+}
+
+// Client sends stream commands to Redis. It's implemented by adapting the
+// client of a Redis client library.
+type Client interface {
+	// XAdd adds an entry with the values to the stream, and returns its ID.
+	// If maxLen is positive, the stream is trimmed to approximately maxLen
+	// entries, as with MAXLEN ~.
+	XAdd(ctx context.Context, stream string, maxLen int64, values map[string]string) (id string, err error)
+
+	// XGroupCreateMkStream creates the consumer group of the stream, which
+	// starts consuming at the ID, creating the stream if needed. It returns
+	// nil if the group already exists.
+	XGroupCreateMkStream(ctx context.Context, stream, group, id string) error
+
+	// XReadGroup reads up to count entries of the stream as the consumer of
+	// the group: new entries for the ID ">", and the entries pending for
+	// the consumer after the ID otherwise. If block is positive and there's
+	// no new entry, it waits up to block for one.
+	XReadGroup(ctx context.Context, stream, group, consumer, id string, count int64, block time.Duration) ([]Entry, error)
+
+	// XAck acknowledges the entries of the stream for the group.
+	XAck(ctx context.Context, stream, group string, ids ...string) error
+
+	// XAutoClaim transfers up to count entries of the stream pending for
+	// the group, which have been idle for minIdle at least, to the
+	// consumer, starting at the ID. It returns the claimed entries, and
+	// the ID to start at to claim more, which is "0-0" once every pending
+	// entry was scanned. Entries deleted from the stream are left out.
+	XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) (entries []Entry, next string, err error)
+
+	// XPending returns up to count entries of the stream pending for the
+	// consumer of the group, between the start and end IDs, inclusive, as
+	// with XPENDING and the consumer argument.
+	XPending(ctx context.Context, stream, group, consumer, start, end string, count int64) ([]PendingEntry, error)
+}
@@ -0,0 +1,12 @@
+// Package redisstream provides a Redis Streams transport.
+//
+// Subscriber consumes a stream as a member of a consumer group: it reads
+// entries with XREADGROUP, acknowledges them with XACK once handled, claims
+// the entries left pending by dead consumers with XAUTOCLAIM, and can move
+// entries delivered too many times to a dead-letter stream. Publisher adds
+// entries to a stream with XADD.
+//
+// The package doesn't depend on a Redis client library: Publisher and
+// Subscriber send their commands through the Client interface. Adapting a
+// client library to it takes a few lines, and it's easily faked in tests.
+package redisstream
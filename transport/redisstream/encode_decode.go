@@ -0,0 +1,24 @@
+package redisstream
+
+import (
+	"context"
+)
+
+// DecodeRequestFunc extracts a user-domain request object from an entry read
+// from a stream. It's designed to be used in Redis Streams subscribers, for
+// subscriber-side endpoints. One straightforward DecodeRequestFunc could be
+// something that JSON decodes from a field of the entry to the concrete
+// request type.
+type DecodeRequestFunc func(context.Context, *Entry) (request interface{}, err error)
+
+// EncodeRequestFunc encodes the passed request object into the values of the
+// entry to be added. It's designed to be used in Redis Streams publishers,
+// for publisher-side endpoints. One straightforward EncodeRequestFunc could
+// be something that JSON encodes the object directly to a field of the
+// entry.
+type EncodeRequestFunc func(context.Context, *Entry, interface{}) error
+
+// DecodeResponseFunc extracts a user-domain response object from an added
+// entry, once Redis assigned it an ID. It's designed to be used in Redis
+// Streams publishers, for publisher-side endpoints.
+type DecodeResponseFunc func(context.Context, *Entry) (response interface{}, err error)
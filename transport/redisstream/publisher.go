@@ -0,0 +1,126 @@
+package redisstream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Publisher wraps a Client and a stream, and provides a method that
+// implements endpoint.Endpoint.
+type Publisher struct {
+	client  Client
+	stream  string
+	enc     EncodeRequestFunc
+	dec     DecodeResponseFunc
+	before  []RequestFunc
+	after   []PublisherResponseFunc
+	timeout time.Duration
+	maxLen  int64
+}
+
+// NewPublisher constructs a usable Publisher for a single stream.
+func NewPublisher(
+	client Client,
+	stream string,
+	enc EncodeRequestFunc,
+	dec DecodeResponseFunc,
+	options ...PublisherOption,
+) *Publisher {
+	p := &Publisher{
+		client:  client,
+		stream:  stream,
+		enc:     enc,
+		dec:     dec,
+		timeout: 10 * time.Second,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// PublisherOption sets an optional parameter for publishers.
+type PublisherOption func(*Publisher)
+
+// PublisherBefore sets the RequestFuncs that are applied to the outgoing
+// entry before it's added.
+func PublisherBefore(before ...RequestFunc) PublisherOption {
+	return func(p *Publisher) { p.before = append(p.before, before...) }
+}
+
+// PublisherAfter sets the PublisherResponseFuncs applied to the added entry,
+// prior to it being decoded.
+func PublisherAfter(after ...PublisherResponseFunc) PublisherOption {
+	return func(p *Publisher) { p.after = append(p.after, after...) }
+}
+
+// PublisherTimeout sets the available timeout for Redis to add the entry.
+func PublisherTimeout(timeout time.Duration) PublisherOption {
+	return func(p *Publisher) { p.timeout = timeout }
+}
+
+// PublisherMaxLen caps the stream to approximately maxLen entries, trimming
+// the oldest ones as entries are added. By default, the stream isn't capped.
+func PublisherMaxLen(maxLen int64) PublisherOption {
+	return func(p *Publisher) { p.maxLen = maxLen }
+}
+
+// Endpoint returns a usable endpoint that adds the request to the stream.
+func (p Publisher) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		entry := Entry{Stream: p.stream, Values: map[string]string{}}
+
+		if err := p.enc(ctx, &entry, request); err != nil {
+			return nil, err
+		}
+
+		for _, f := range p.before {
+			ctx = f(ctx, &entry)
+		}
+
+		id, err := p.client.XAdd(ctx, p.stream, p.maxLen, entry.Values)
+		if err != nil {
+			return nil, err
+		}
+		entry.ID = id
+
+		for _, f := range p.after {
+			ctx = f(ctx, &entry)
+		}
+
+		response, err := p.dec(ctx, &entry)
+		if err != nil {
+			return nil, err
+		}
+
+		return response, nil
+	}
+}
+
+// PayloadField is the field of the entries holding the request, as encoded by
+// EncodeJSONRequest.
+const PayloadField = "payload"
+
+// EncodeJSONRequest is an EncodeRequestFunc that serializes the request as a
+// JSON object to the PayloadField of the entry. Many JSON-over-Redis services
+// can use it as a sensible default.
+func EncodeJSONRequest(_ context.Context, entry *Entry, request interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	entry.Values[PayloadField] = string(b)
+	return nil
+}
+
+// DecodeEntryID is a DecodeResponseFunc that returns the ID of the added
+// entry, as a string.
+func DecodeEntryID(_ context.Context, entry *Entry) (interface{}, error) {
+	return entry.ID, nil
+}
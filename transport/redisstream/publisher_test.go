@@ -0,0 +1,46 @@
+package redisstream_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/transport/redisstream"
+)
+
+func TestPublisher(t *testing.T) {
+	redis := newMemRedis()
+	var after string
+	pub := redisstream.NewPublisher(redis, "jobs", redisstream.EncodeJSONRequest, redisstream.DecodeEntryID,
+		redisstream.PublisherBefore(redisstream.SetValue("source", "test")),
+		redisstream.PublisherAfter(func(ctx context.Context, entry *redisstream.Entry) context.Context {
+			after = entry.Stream + "/" + entry.ID
+			return ctx
+		}),
+		redisstream.PublisherMaxLen(2),
+	)
+	var id interface{}
+	for _, name := range []string{"a", "b", "c"} {
+		var err error
+		if id, err = pub.Endpoint()(context.Background(), job{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := "jobs/"+id.(string), after; want != have {
+		t.Errorf("after: want %q, have %q", want, have)
+	}
+
+	entries := redis.entries("jobs")
+	if want, have := 2, len(entries); want != have {
+		t.Fatalf("entries: want %d, have %d", want, have)
+	}
+	last := entries[1]
+	if want, have := id, last.ID; want != have {
+		t.Errorf("id: want %v, have %v", want, have)
+	}
+	if want, have := `{"name":"c"}`, last.Values[redisstream.PayloadField]; want != have {
+		t.Errorf("payload: want %q, have %q", want, have)
+	}
+	if want, have := "test", last.Values["source"]; want != have {
+		t.Errorf("source: want %q, have %q", want, have)
+	}
+}
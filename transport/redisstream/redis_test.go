@@ -0,0 +1,287 @@
+package redisstream_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/transport/redisstream"
+)
+
+// memRedis is an in-memory implementation of the stream commands of Redis.
+// Entry IDs are sequence numbers, formatted as "<n>-0".
+type memRedis struct {
+	mtx     sync.Mutex
+	seq     int64
+	streams map[string]*memStream
+	added   chan struct{} // closed, and replaced, whenever an entry is added
+}
+
+type memStream struct {
+	entries []redisstream.Entry
+	groups  map[string]*memGroup
+}
+
+type memGroup struct {
+	last    int64
+	pending map[int64]*memPending
+}
+
+type memPending struct {
+	consumer   string
+	delivered  time.Time
+	deliveries int64
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{streams: map[string]*memStream{}, added: make(chan struct{})}
+}
+
+func formatID(n int64) string { return strconv.FormatInt(n, 10) + "-0" }
+
+func parseID(id string) int64 {
+	n, _ := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return n
+}
+
+func (r *memRedis) stream(name string) *memStream {
+	s, ok := r.streams[name]
+	if !ok {
+		s = &memStream{groups: map[string]*memGroup{}}
+		r.streams[name] = s
+	}
+	return s
+}
+
+func (r *memRedis) group(stream, group string) (*memStream, *memGroup, error) {
+	s, ok := r.streams[stream]
+	if !ok || s.groups[group] == nil {
+		return nil, nil, fmt.Errorf("NOGROUP no such key '%s' or consumer group '%s'", stream, group)
+	}
+	return s, s.groups[group], nil
+}
+
+func (s *memStream) entry(n int64) (redisstream.Entry, bool) {
+	i := sort.Search(len(s.entries), func(i int) bool { return parseID(s.entries[i].ID) >= n })
+	if i < len(s.entries) && parseID(s.entries[i].ID) == n {
+		return s.entries[i], true
+	}
+	return redisstream.Entry{}, false
+}
+
+func copyEntry(e redisstream.Entry) redisstream.Entry {
+	values := make(map[string]string, len(e.Values))
+	for k, v := range e.Values {
+		values[k] = v
+	}
+	return redisstream.Entry{ID: e.ID, Values: values}
+}
+
+func (g *memGroup) sortedPending() []int64 {
+	ids := make([]int64, 0, len(g.pending))
+	for n := range g.pending {
+		ids = append(ids, n)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// XAdd implements redisstream.Client.
+func (r *memRedis) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]string) (string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.seq++
+	s := r.stream(stream)
+	s.entries = append(s.entries, copyEntry(redisstream.Entry{ID: formatID(r.seq), Values: values}))
+	if maxLen > 0 && int64(len(s.entries)) > maxLen {
+		s.entries = s.entries[int64(len(s.entries))-maxLen:]
+	}
+	close(r.added)
+	r.added = make(chan struct{})
+	return formatID(r.seq), nil
+}
+
+// XGroupCreateMkStream implements redisstream.Client.
+func (r *memRedis) XGroupCreateMkStream(ctx context.Context, stream, group, id string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	s := r.stream(stream)
+	if _, ok := s.groups[group]; ok {
+		return nil
+	}
+	var last int64
+	if id == "$" {
+		last = r.seq
+	} else {
+		last = parseID(id)
+	}
+	s.groups[group] = &memGroup{last: last, pending: map[int64]*memPending{}}
+	return nil
+}
+
+// XReadGroup implements redisstream.Client.
+func (r *memRedis) XReadGroup(ctx context.Context, stream, group, consumer, id string, count int64, block time.Duration) ([]redisstream.Entry, error) {
+	var deadline <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		r.mtx.Lock()
+		entries, err := r.readGroup(stream, group, consumer, id, count)
+		added := r.added
+		r.mtx.Unlock()
+		if err != nil || len(entries) > 0 || id != ">" || deadline == nil {
+			return entries, err
+		}
+		select {
+		case <-added:
+		case <-deadline:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (r *memRedis) readGroup(stream, group, consumer, id string, count int64) ([]redisstream.Entry, error) {
+	s, g, err := r.group(stream, group)
+	if err != nil {
+		return nil, err
+	}
+	var entries []redisstream.Entry
+	if id == ">" {
+		for _, e := range s.entries {
+			if int64(len(entries)) == count {
+				break
+			}
+			if n := parseID(e.ID); n > g.last {
+				g.last = n
+				g.pending[n] = &memPending{consumer: consumer, delivered: time.Now(), deliveries: 1}
+				entries = append(entries, copyEntry(e))
+			}
+		}
+		return entries, nil
+	}
+	start := parseID(id)
+	for _, n := range g.sortedPending() {
+		p := g.pending[n]
+		if n <= start || p.consumer != consumer {
+			continue
+		}
+		if int64(len(entries)) == count {
+			break
+		}
+		p.delivered = time.Now()
+		p.deliveries++
+		e, _ := s.entry(n)
+		entries = append(entries, copyEntry(e))
+	}
+	return entries, nil
+}
+
+// XAck implements redisstream.Client.
+func (r *memRedis) XAck(ctx context.Context, stream, group string, ids ...string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, g, err := r.group(stream, group)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(g.pending, parseID(id))
+	}
+	return nil
+}
+
+// XAutoClaim implements redisstream.Client.
+func (r *memRedis) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redisstream.Entry, string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	s, g, err := r.group(stream, group)
+	if err != nil {
+		return nil, "", err
+	}
+	var entries []redisstream.Entry
+	from := parseID(start)
+	for _, n := range g.sortedPending() {
+		if n < from {
+			continue
+		}
+		if int64(len(entries)) == count {
+			return entries, formatID(n), nil
+		}
+		p := g.pending[n]
+		if time.Since(p.delivered) < minIdle {
+			continue
+		}
+		p.consumer = consumer
+		p.delivered = time.Now()
+		p.deliveries++
+		e, ok := s.entry(n)
+		if !ok {
+			delete(g.pending, n)
+			continue
+		}
+		entries = append(entries, copyEntry(e))
+	}
+	return entries, "0-0", nil
+}
+
+// XPending implements redisstream.Client.
+func (r *memRedis) XPending(ctx context.Context, stream, group, consumer, start, end string, count int64) ([]redisstream.PendingEntry, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, g, err := r.group(stream, group)
+	if err != nil {
+		return nil, err
+	}
+	var pending []redisstream.PendingEntry
+	from, to := parseID(start), parseID(end)
+	if !strings.HasSuffix(start, "-0") {
+		// The fake only adds IDs with a sequence number of 0, so n-1 is
+		// the successor of n-0.
+		from++
+	}
+	for _, n := range g.sortedPending() {
+		p := g.pending[n]
+		if n < from || n > to || p.consumer != consumer || int64(len(pending)) == count {
+			continue
+		}
+		pending = append(pending, redisstream.PendingEntry{
+			ID:         formatID(n),
+			Consumer:   p.consumer,
+			Idle:       time.Since(p.delivered),
+			Deliveries: p.deliveries,
+		})
+	}
+	return pending, nil
+}
+
+func (r *memRedis) entries(stream string) []redisstream.Entry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]redisstream.Entry(nil), r.stream(stream).entries...)
+}
+
+func (r *memRedis) pendingCount(stream, group string) int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, g, err := r.group(stream, group)
+	if err != nil {
+		return 0
+	}
+	return len(g.pending)
+}
+
+func (r *memRedis) hasGroup(stream, group string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, _, err := r.group(stream, group)
+	return err == nil
+}
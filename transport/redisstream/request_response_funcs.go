@@ -0,0 +1,67 @@
+package redisstream
+
+import (
+	"context"
+)
+
+// RequestFunc may take information from an entry and put it into a request
+// context. In Subscribers, RequestFuncs are executed prior to invoking the
+// endpoint. In Publishers, they're executed after encoding the request, and
+// may add values to the entry.
+type RequestFunc func(context.Context, *Entry) context.Context
+
+// SubscriberResponseFunc may take information from the response of the
+// endpoint and use it. SubscriberResponseFuncs are only executed in
+// subscribers, after invoking the endpoint, but before the entry is
+// acknowledged.
+type SubscriberResponseFunc func(ctx context.Context, entry *Entry, response interface{}) context.Context
+
+// PublisherResponseFunc may take information from the added entry and make
+// the response available for consumption. PublisherResponseFuncs are only
+// executed in publishers, after the entry is added, but prior to it being
+// decoded.
+type PublisherResponseFunc func(context.Context, *Entry) context.Context
+
+// SetValue returns a RequestFunc that sets the value of the field of the
+// entry.
+func SetValue(field, value string) RequestFunc {
+	return func(ctx context.Context, entry *Entry) context.Context {
+		if entry.Values == nil {
+			entry.Values = map[string]string{}
+		}
+		entry.Values[field] = value
+		return ctx
+	}
+}
+
+// PopulateRequestContext is a RequestFunc that populates several values into
+// the context from the entry read from the stream. Those values may be
+// extracted using the corresponding ContextKey type in this package.
+func PopulateRequestContext(ctx context.Context, entry *Entry) context.Context {
+	for k, v := range map[contextKey]interface{}{
+		ContextKeyStream:     entry.Stream,
+		ContextKeyID:         entry.ID,
+		ContextKeyDeliveries: entry.Deliveries,
+	} {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	return ctx
+}
+
+type contextKey int
+
+const (
+	// ContextKeyStream is populated in the context by
+	// PopulateRequestContext. Its value is the stream of the entry, as a
+	// string.
+	ContextKeyStream contextKey = iota
+
+	// ContextKeyID is populated in the context by PopulateRequestContext.
+	// Its value is the ID of the entry, as a string.
+	ContextKeyID
+
+	// ContextKeyDeliveries is populated in the context by
+	// PopulateRequestContext. Its value is the number of times the entry
+	// was delivered, as an int64.
+	ContextKeyDeliveries
+)
@@ -0,0 +1,342 @@
+package redisstream
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// Subscriber wraps an endpoint, and consumes a stream with it as a member of
+// a consumer group. Entries are handled one at a time, and acknowledged once
+// handled successfully. Entries whose processing failed are left pending, to
+// be claimed again once idle.
+type Subscriber struct {
+	client        Client
+	stream        string
+	group         string
+	consumer      string
+	e             endpoint.Endpoint
+	dec           DecodeRequestFunc
+	before        []RequestFunc
+	after         []SubscriberResponseFunc
+	errorHandler  transport.ErrorHandler
+	finalizer     []SubscriberFinalizerFunc
+	count         int64
+	block         time.Duration
+	claimIdle     time.Duration
+	deadLetter    string
+	maxDeliveries int64
+}
+
+// NewSubscriber constructs a new subscriber of the stream, as the consumer of
+// the group, which wraps the provided endpoint. Consumer names must be
+// unique within the group, and stable across restarts, so that a consumer
+// resumes the entries it left pending.
+func NewSubscriber(
+	client Client,
+	stream, group, consumer string,
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	options ...SubscriberOption,
+) *Subscriber {
+	s := &Subscriber{
+		client:       client,
+		stream:       stream,
+		group:        group,
+		consumer:     consumer,
+		e:            e,
+		dec:          dec,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		count:        10,
+		block:        5 * time.Second,
+		claimIdle:    time.Minute,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// SubscriberOption sets an optional parameter for subscribers.
+type SubscriberOption func(*Subscriber)
+
+// SubscriberBefore functions are executed on the entry before the request is
+// decoded.
+func SubscriberBefore(before ...RequestFunc) SubscriberOption {
+	return func(s *Subscriber) { s.before = append(s.before, before...) }
+}
+
+// SubscriberAfter functions are executed on the endpoint response, before the
+// entry is acknowledged.
+func SubscriberAfter(after ...SubscriberResponseFunc) SubscriberOption {
+	return func(s *Subscriber) { s.after = append(s.after, after...) }
+}
+
+// SubscriberErrorHandler is used to handle non-terminal errors. By default,
+// non-terminal errors are ignored. This is intended as a diagnostic measure.
+func SubscriberErrorHandler(errorHandler transport.ErrorHandler) SubscriberOption {
+	return func(s *Subscriber) { s.errorHandler = errorHandler }
+}
+
+// SubscriberFinalizer is executed at the end of every entry.
+// By default, no finalizer is registered.
+func SubscriberFinalizer(f ...SubscriberFinalizerFunc) SubscriberOption {
+	return func(s *Subscriber) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// SubscriberBatch sets the maximum number of entries read, or claimed, at
+// once. By default, it's 10.
+func SubscriberBatch(count int64) SubscriberOption {
+	return func(s *Subscriber) { s.count = count }
+}
+
+// SubscriberBlock sets how long XREADGROUP waits for new entries, which is
+// also how long the subscriber may take to stop or to claim idle entries.
+// By default, it's 5 seconds.
+func SubscriberBlock(block time.Duration) SubscriberOption {
+	return func(s *Subscriber) { s.block = block }
+}
+
+// SubscriberClaimIdle sets how long entries stay pending for another
+// consumer before the subscriber claims them with XAUTOCLAIM. It should be
+// well above the time it takes to handle an entry. The subscriber looks for
+// idle entries at the same interval. By default, it's a minute. A zero
+// duration disables claiming.
+func SubscriberClaimIdle(minIdle time.Duration) SubscriberOption {
+	return func(s *Subscriber) { s.claimIdle = minIdle }
+}
+
+// SubscriberDeadLetter makes the subscriber move entries which were delivered
+// more than maxDeliveries times to the dead-letter stream, along with fields
+// describing them, instead of handling them again. By default, entries are
+// handled until they succeed.
+func SubscriberDeadLetter(stream string, maxDeliveries int64) SubscriberOption {
+	return func(s *Subscriber) {
+		s.deadLetter = stream
+		s.maxDeliveries = maxDeliveries
+	}
+}
+
+// Run creates the consumer group if needed, which then starts at new
+// entries, and consumes the stream until the context is done. It first
+// handles the entries left pending for the consumer by a previous run, and
+// then alternates between new entries and the idle entries of other
+// consumers. It returns the first error of Redis, or nil once the context is
+// done.
+func (s Subscriber) Run(ctx context.Context) error {
+	if err := s.client.XGroupCreateMkStream(ctx, s.stream, s.group, "$"); err != nil {
+		return s.stopped(ctx, err)
+	}
+
+	// Entries pending for the consumer are returned from the start, and
+	// removed as they're acknowledged. Failed ones stay pending, so move
+	// past them.
+	for start := "0"; ; {
+		entries, err := s.client.XReadGroup(ctx, s.stream, s.group, s.consumer, start, s.count, 0)
+		if err != nil {
+			return s.stopped(ctx, err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		if err := s.serveAll(ctx, entries, true); err != nil {
+			return s.stopped(ctx, err)
+		}
+		start = entries[len(entries)-1].ID
+	}
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if s.claimIdle > 0 && time.Since(lastClaim) >= s.claimIdle {
+			lastClaim = time.Now()
+			if err := s.claim(ctx); err != nil {
+				return s.stopped(ctx, err)
+			}
+		}
+
+		entries, err := s.client.XReadGroup(ctx, s.stream, s.group, s.consumer, ">", s.count, s.block)
+		if err != nil {
+			return s.stopped(ctx, err)
+		}
+		for i := range entries {
+			entries[i].Deliveries = 1
+		}
+		if err := s.serveAll(ctx, entries, false); err != nil {
+			return s.stopped(ctx, err)
+		}
+	}
+	return nil
+}
+
+// stopped returns the error, unless the context is done.
+func (s Subscriber) stopped(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// claim claims and handles the idle entries of other consumers.
+func (s Subscriber) claim(ctx context.Context) error {
+	for start := "0-0"; ; {
+		entries, next, err := s.client.XAutoClaim(ctx, s.stream, s.group, s.consumer, s.claimIdle, start, s.count)
+		if err != nil {
+			return err
+		}
+		if err := s.serveAll(ctx, entries, true); err != nil {
+			return err
+		}
+		if next == "0-0" || next == "" || ctx.Err() != nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// serveAll handles the entries, in order. Redelivered entries have their
+// delivery count looked up first.
+func (s Subscriber) serveAll(ctx context.Context, entries []Entry, redelivered bool) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if redelivered {
+		if err := s.lookupDeliveries(ctx, entries); err != nil {
+			return err
+		}
+	}
+	for i := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		entry := &entries[i]
+		entry.Stream = s.stream
+		if s.deadLetter != "" && entry.Deliveries > s.maxDeliveries {
+			if err := s.moveToDeadLetter(ctx, entry); err != nil {
+				return err
+			}
+			continue
+		}
+		s.serve(ctx, entry)
+	}
+	return nil
+}
+
+// lookupDeliveries sets the delivery counts of the entries, which are pending
+// for the consumer, in order. The range of their IDs may hold other entries
+// pending for the consumer, so it's paged through until every entry is
+// found.
+func (s Subscriber) lookupDeliveries(ctx context.Context, entries []Entry) error {
+	missing := make(map[string]*Entry, len(entries))
+	for i := range entries {
+		missing[entries[i].ID] = &entries[i]
+	}
+	count := int64(len(entries))
+	for start, end := entries[0].ID, entries[len(entries)-1].ID; len(missing) > 0; {
+		pending, err := s.client.XPending(ctx, s.stream, s.group, s.consumer, start, end, count)
+		if err != nil {
+			return err
+		}
+		for _, p := range pending {
+			if entry, ok := missing[p.ID]; ok {
+				entry.Deliveries = p.Deliveries
+				delete(missing, p.ID)
+			}
+		}
+		if int64(len(pending)) < count {
+			return nil
+		}
+		next, ok := nextID(pending[len(pending)-1].ID)
+		if !ok {
+			return nil
+		}
+		start = next
+	}
+	return nil
+}
+
+// nextID returns the smallest stream ID greater than the ID.
+func nextID(id string) (string, bool) {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return "", false
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil || seq == math.MaxUint64 {
+		return "", false
+	}
+	return id[:i+1] + strconv.FormatUint(seq+1, 10), true
+}
+
+func (s Subscriber) serve(ctx context.Context, entry *Entry) {
+	var err error
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, entry, err)
+			}
+		}()
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, entry)
+	}
+
+	request, err := s.dec(ctx, entry)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return
+	}
+
+	for _, f := range s.after {
+		ctx = f(ctx, entry, response)
+	}
+
+	if err = s.client.XAck(ctx, s.stream, s.group, entry.ID); err != nil {
+		s.errorHandler.Handle(ctx, err)
+	}
+}
+
+// Fields added by subscribers to the entries they move to their dead-letter
+// stream.
+const (
+	DeadLetterStreamField     = "dead-letter-stream"
+	DeadLetterIDField         = "dead-letter-id"
+	DeadLetterGroupField      = "dead-letter-group"
+	DeadLetterDeliveriesField = "dead-letter-deliveries"
+)
+
+// moveToDeadLetter adds the entry to the dead-letter stream, and acknowledges
+// it.
+func (s Subscriber) moveToDeadLetter(ctx context.Context, entry *Entry) error {
+	values := make(map[string]string, len(entry.Values)+4)
+	for k, v := range entry.Values {
+		values[k] = v
+	}
+	values[DeadLetterStreamField] = s.stream
+	values[DeadLetterIDField] = entry.ID
+	values[DeadLetterGroupField] = s.group
+	values[DeadLetterDeliveriesField] = strconv.FormatInt(entry.Deliveries, 10)
+
+	if _, err := s.client.XAdd(ctx, s.deadLetter, 0, values); err != nil {
+		return err
+	}
+	return s.client.XAck(ctx, s.stream, s.group, entry.ID)
+}
+
+// SubscriberFinalizerFunc can be used to perform work at the end of an
+// entry, once it's been handled. The principal intended use is for request
+// logging.
+// Note: err may be nil.
+type SubscriberFinalizerFunc func(ctx context.Context, entry *Entry, err error)
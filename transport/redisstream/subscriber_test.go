@@ -0,0 +1,291 @@
+package redisstream_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/redisstream"
+)
+
+type job struct {
+	Name string `json:"name"`
+}
+
+func decodeJob(_ context.Context, entry *redisstream.Entry) (interface{}, error) {
+	var j job
+	err := json.Unmarshal([]byte(entry.Values[redisstream.PayloadField]), &j)
+	return j, err
+}
+
+// recorder is an endpoint recording the jobs it's passed, and the delivery
+// count of their entries. It fails the jobs named "fail".
+type recorder struct {
+	mtx        sync.Mutex
+	jobs       []string
+	deliveries []int64
+}
+
+func (r *recorder) endpoint(ctx context.Context, request interface{}) (interface{}, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	name := request.(job).Name
+	r.jobs = append(r.jobs, name)
+	r.deliveries = append(r.deliveries, ctx.Value(redisstream.ContextKeyDeliveries).(int64))
+	if name == "fail" {
+		return nil, errors.New("failed")
+	}
+	return nil, nil
+}
+
+func (r *recorder) handled() ([]string, []int64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]string(nil), r.jobs...), append([]int64(nil), r.deliveries...)
+}
+
+// run runs the subscriber until the condition holds, and stops it.
+func run(t *testing.T, s *redisstream.Subscriber, condition func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Error("condition not met in time")
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func publish(t *testing.T, redis *memRedis, names ...string) []string {
+	t.Helper()
+	pub := redisstream.NewPublisher(redis, "jobs", redisstream.EncodeJSONRequest, redisstream.DecodeEntryID)
+	var ids []string
+	for _, name := range names {
+		id, err := pub.Endpoint()(context.Background(), job{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id.(string))
+	}
+	return ids
+}
+
+func TestSubscriber(t *testing.T) {
+	redis := newMemRedis()
+	var r recorder
+	sub := redisstream.NewSubscriber(redis, "jobs", "workers", "worker-1", r.endpoint, decodeJob,
+		redisstream.SubscriberBefore(redisstream.PopulateRequestContext),
+		redisstream.SubscriberBlock(10*time.Millisecond),
+	)
+	// The group is created by the subscriber, and starts at new entries.
+	publish(t, redis, "before")
+	var published bool
+	run(t, sub, func() bool {
+		if !published && redis.hasGroup("jobs", "workers") {
+			publish(t, redis, "a", "fail", "b")
+			published = true
+		}
+		jobs, _ := r.handled()
+		return len(jobs) == 3
+	})
+
+	jobs, deliveries := r.handled()
+	if want, have := []string{"a", "fail", "b"}, jobs; !equalStrings(want, have) {
+		t.Errorf("jobs: want %v, have %v", want, have)
+	}
+	for _, d := range deliveries {
+		if want, have := int64(1), d; want != have {
+			t.Errorf("deliveries: want %d, have %d", want, have)
+		}
+	}
+	// The failed job is left pending.
+	if want, have := 1, redis.pendingCount("jobs", "workers"); want != have {
+		t.Errorf("pending: want %d, have %d", want, have)
+	}
+}
+
+func TestSubscriberResumesPending(t *testing.T) {
+	redis := newMemRedis()
+	redis.XGroupCreateMkStream(context.Background(), "jobs", "workers", "0")
+	publish(t, redis, "a", "fail", "b")
+	// A previous run of the consumer read the entries, and died.
+	if _, err := redis.XReadGroup(context.Background(), "jobs", "workers", "worker-1", ">", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var r recorder
+	sub := redisstream.NewSubscriber(redis, "jobs", "workers", "worker-1", r.endpoint, decodeJob,
+		redisstream.SubscriberBefore(redisstream.PopulateRequestContext),
+		redisstream.SubscriberBlock(10*time.Millisecond),
+		redisstream.SubscriberClaimIdle(0),
+	)
+	run(t, sub, func() bool {
+		jobs, _ := r.handled()
+		return len(jobs) == 3
+	})
+
+	jobs, deliveries := r.handled()
+	if want, have := []string{"a", "fail", "b"}, jobs; !equalStrings(want, have) {
+		t.Errorf("jobs: want %v, have %v", want, have)
+	}
+	for _, d := range deliveries {
+		if want, have := int64(2), d; want != have {
+			t.Errorf("deliveries: want %d, have %d", want, have)
+		}
+	}
+	if want, have := 1, redis.pendingCount("jobs", "workers"); want != have {
+		t.Errorf("pending: want %d, have %d", want, have)
+	}
+}
+
+func TestSubscriberClaimsIdleEntries(t *testing.T) {
+	redis := newMemRedis()
+	redis.XGroupCreateMkStream(context.Background(), "jobs", "workers", "0")
+	publish(t, redis, "a", "b")
+	// Another consumer read the entries, and died.
+	if _, err := redis.XReadGroup(context.Background(), "jobs", "workers", "worker-2", ">", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var r recorder
+	sub := redisstream.NewSubscriber(redis, "jobs", "workers", "worker-1", r.endpoint, decodeJob,
+		redisstream.SubscriberBefore(redisstream.PopulateRequestContext),
+		redisstream.SubscriberBlock(10*time.Millisecond),
+		redisstream.SubscriberClaimIdle(20*time.Millisecond),
+	)
+	run(t, sub, func() bool { return redis.pendingCount("jobs", "workers") == 0 })
+
+	jobs, deliveries := r.handled()
+	if want, have := []string{"a", "b"}, jobs; !equalStrings(want, have) {
+		t.Errorf("jobs: want %v, have %v", want, have)
+	}
+	for _, d := range deliveries {
+		if want, have := int64(2), d; want != have {
+			t.Errorf("deliveries: want %d, have %d", want, have)
+		}
+	}
+}
+
+func TestSubscriberDeadLetter(t *testing.T) {
+	redis := newMemRedis()
+	var (
+		r     recorder
+		mtx   sync.Mutex
+		final []error
+	)
+	sub := redisstream.NewSubscriber(redis, "jobs", "workers", "worker-1", r.endpoint, decodeJob,
+		redisstream.SubscriberBefore(redisstream.PopulateRequestContext),
+		redisstream.SubscriberBlock(5*time.Millisecond),
+		redisstream.SubscriberClaimIdle(10*time.Millisecond),
+		redisstream.SubscriberDeadLetter("jobs-dead", 3),
+		redisstream.SubscriberFinalizer(func(_ context.Context, _ *redisstream.Entry, err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			final = append(final, err)
+		}),
+	)
+	var ids []string
+	run(t, sub, func() bool {
+		if ids == nil && redis.hasGroup("jobs", "workers") {
+			ids = publish(t, redis, "fail")
+		}
+		return len(redis.entries("jobs-dead")) == 1
+	})
+
+	_, deliveries := r.handled()
+	if want, have := []int64{1, 2, 3}, deliveries; !equalInts(want, have) {
+		t.Errorf("deliveries: want %v, have %v", want, have)
+	}
+	mtx.Lock()
+	if want, have := 3, len(final); want != have {
+		t.Errorf("finalizer: want %d calls, have %d", want, have)
+	}
+	mtx.Unlock()
+	if want, have := 0, redis.pendingCount("jobs", "workers"); want != have {
+		t.Errorf("pending: want %d, have %d", want, have)
+	}
+
+	dead := redis.entries("jobs-dead")[0]
+	for field, want := range map[string]string{
+		redisstream.PayloadField:              `{"name":"fail"}`,
+		redisstream.DeadLetterStreamField:     "jobs",
+		redisstream.DeadLetterIDField:         ids[0],
+		redisstream.DeadLetterGroupField:      "workers",
+		redisstream.DeadLetterDeliveriesField: "4",
+	} {
+		if have := dead.Values[field]; want != have {
+			t.Errorf("%s: want %q, have %q", field, want, have)
+		}
+	}
+}
+
+func TestSubscriberDeadLetterInterleavedConsumers(t *testing.T) {
+	redis := newMemRedis()
+	redis.XGroupCreateMkStream(context.Background(), "jobs", "workers", "0")
+	publish(t, redis, "a", "b", "c", "d")
+	// The entries of two consumers which died are interleaved: worker-1 has
+	// a and c pending, and worker-2 has b and d.
+	for _, consumer := range []string{"worker-1", "worker-2", "worker-1", "worker-2"} {
+		if _, err := redis.XReadGroup(context.Background(), "jobs", "workers", consumer, ">", 1, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var r recorder
+	sub := redisstream.NewSubscriber(redis, "jobs", "workers", "worker-1", r.endpoint, decodeJob,
+		redisstream.SubscriberBlock(5*time.Millisecond),
+		redisstream.SubscriberClaimIdle(time.Hour),
+		redisstream.SubscriberDeadLetter("jobs-dead", 1),
+	)
+	run(t, sub, func() bool { return len(redis.entries("jobs-dead")) == 2 })
+
+	if jobs, _ := r.handled(); len(jobs) != 0 {
+		t.Errorf("jobs: want none, have %v", jobs)
+	}
+	var dead []string
+	for _, e := range redis.entries("jobs-dead") {
+		dead = append(dead, e.Values[redisstream.PayloadField])
+	}
+	if want, have := []string{`{"name":"a"}`, `{"name":"c"}`}, dead; !equalStrings(want, have) {
+		t.Errorf("dead letters: want %v, have %v", want, have)
+	}
+	if want, have := 2, redis.pendingCount("jobs", "workers"); want != have {
+		t.Errorf("pending: want %d, have %d", want, have)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalInts(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
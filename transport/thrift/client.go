@@ -0,0 +1,132 @@
+package thrift
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Client wraps a Thrift client and provides a method that implements
+// endpoint.Endpoint, for a single method of a Thrift service.
+type Client struct {
+	client    thrift.TClient
+	method    string
+	enc       EncodeRequestFunc
+	newResult func() thrift.TStruct
+	dec       DecodeResponseFunc
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	finalizer []ClientFinalizerFunc
+}
+
+// NewClient constructs a usable Client for a single remote method. newResult
+// returns a new result struct of the method, which is generated by the Thrift
+// compiler; for a method sum of the service Add, it's typically
+// func() thrift.TStruct { return &addsvc.AddSumResult{} }.
+//
+// Calls through a single thrift.TClient, like the one returned by Dial, must
+// not be made concurrently.
+func NewClient(
+	client thrift.TClient,
+	method string,
+	enc EncodeRequestFunc,
+	newResult func() thrift.TStruct,
+	dec DecodeResponseFunc,
+	options ...ClientOption,
+) *Client {
+	c := &Client{
+		client:    client,
+		method:    method,
+		enc:       enc,
+		newResult: newResult,
+		dec:       dec,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(*Client)
+
+// ClientBefore sets the RequestFuncs that are applied to the outgoing Thrift
+// request before it's invoked.
+func ClientBefore(before ...ClientRequestFunc) ClientOption {
+	return func(c *Client) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter sets the ClientResponseFuncs that are applied to the incoming
+// Thrift response prior to it being decoded. This is useful for obtaining
+// response headers and adding onto the context prior to decoding.
+func ClientAfter(after ...ClientResponseFunc) ClientOption {
+	return func(c *Client) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer is executed at the end of every Thrift request.
+// By default, no finalizer is registered.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *Client) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// Endpoint returns a usable endpoint that will invoke the Thrift method
+// specified by the client.
+func (c Client) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		if c.finalizer != nil {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, c.method)
+
+		args, err := c.enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		headers := thrift.THeaderMap{}
+		for _, f := range c.before {
+			ctx = f(ctx, headers)
+		}
+		keys := make([]string, 0, len(headers))
+		for key, value := range headers {
+			ctx = thrift.SetHeader(ctx, key, value)
+			keys = append(keys, key)
+		}
+		ctx = thrift.SetWriteHeaderList(ctx, keys)
+
+		result := c.newResult()
+		meta, err := c.client.Call(ctx, c.method, args, result)
+		if err != nil {
+			return nil, err
+		}
+
+		if meta.Headers == nil {
+			meta.Headers = thrift.THeaderMap{}
+		}
+		for _, f := range c.after {
+			ctx = f(ctx, meta.Headers)
+		}
+
+		response, err = c.dec(ctx, result)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+// ClientFinalizerFunc can be used to perform work at the end of a client
+// Thrift request, after the response is returned. The principal intended use
+// is for error logging.
+// Note: err may be nil.
+type ClientFinalizerFunc func(ctx context.Context, err error)
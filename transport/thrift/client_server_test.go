@@ -0,0 +1,212 @@
+package thrift_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/go-kit/kit/transport"
+	thrifttransport "github.com/go-kit/kit/transport/thrift"
+)
+
+type concatRequest struct{ A, B string }
+
+func concatEndpoint(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(concatRequest)
+	if req.A == "" {
+		return nil, errors.New("empty a")
+	}
+	return req.A + req.B, nil
+}
+
+func decodeConcatRequest(_ context.Context, args thrift.TStruct) (interface{}, error) {
+	a := args.(*concatArgs)
+	return concatRequest{A: a.A, B: a.B}, nil
+}
+
+func encodeConcatResponse(_ context.Context, response interface{}) (thrift.TStruct, error) {
+	s := response.(string)
+	return &concatResult{Success: &s}, nil
+}
+
+func encodeConcatRequest(_ context.Context, request interface{}) (thrift.TStruct, error) {
+	req := request.(concatRequest)
+	return &concatArgs{A: req.A, B: req.B}, nil
+}
+
+func decodeConcatResponse(_ context.Context, result thrift.TStruct) (interface{}, error) {
+	r := result.(*concatResult)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return *r.Success, nil
+}
+
+// serve starts a listener serving the server, and returns a client endpoint
+// connected to it.
+func serve(t *testing.T, config thrifttransport.Config, server *thrifttransport.Server, options ...thrifttransport.ClientOption) (call func(concatRequest) (interface{}, error), stop func()) {
+	t.Helper()
+	listener, err := thrifttransport.NewListener("127.0.0.1:0", processor{"concat": server}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.AcceptLoop()
+	}()
+
+	client, trans, err := thrifttransport.Dial(listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := thrifttransport.NewClient(client, "concat", encodeConcatRequest, newConcatResult, decodeConcatResponse, options...).Endpoint()
+	return func(req concatRequest) (interface{}, error) {
+			return e(context.Background(), req)
+		}, func() {
+			trans.Close()
+			listener.Stop()
+			<-done
+		}
+}
+
+func TestClientServer(t *testing.T) {
+	for name, config := range map[string]thrifttransport.Config{
+		"binary buffered":  {Protocol: thrifttransport.BinaryProtocol, Transport: thrifttransport.BufferedTransport},
+		"binary framed":    {Protocol: thrifttransport.BinaryProtocol, Transport: thrifttransport.FramedTransport},
+		"compact buffered": {Protocol: thrifttransport.CompactProtocol, Transport: thrifttransport.BufferedTransport},
+		"compact framed":   {Protocol: thrifttransport.CompactProtocol, Transport: thrifttransport.FramedTransport},
+		"header":           {Protocol: thrifttransport.HeaderProtocol},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mtx     sync.Mutex
+				methods []string
+			)
+			server := thrifttransport.NewServer(
+				"concat", concatEndpoint, newConcatArgs, decodeConcatRequest, encodeConcatResponse,
+				thrifttransport.ServerFinalizer(func(ctx context.Context, err error) {
+					mtx.Lock()
+					defer mtx.Unlock()
+					methods = append(methods, ctx.Value(thrifttransport.ContextKeyRequestMethod).(string))
+				}),
+			)
+			call, stop := serve(t, config, server)
+			defer stop()
+
+			for _, req := range []concatRequest{{"a", "b"}, {"c", "d"}} {
+				response, err := call(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, have := req.A+req.B, response; want != have {
+					t.Errorf("want %q, have %q", want, have)
+				}
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			if want, have := 2, len(methods); want != have {
+				t.Fatalf("finalized requests: want %d, have %d", want, have)
+			}
+			if want, have := "concat", methods[0]; want != have {
+				t.Errorf("method: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+type headerKey struct{}
+
+func TestHeaders(t *testing.T) {
+	var requestID string
+	server := thrifttransport.NewServer(
+		"concat",
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			requestID, _ = ctx.Value(headerKey{}).(string)
+			return concatEndpoint(ctx, request)
+		},
+		newConcatArgs, decodeConcatRequest, encodeConcatResponse,
+		thrifttransport.ServerBefore(func(ctx context.Context, headers thrift.THeaderMap) context.Context {
+			return context.WithValue(ctx, headerKey{}, headers["x-request-id"])
+		}),
+		thrifttransport.ServerAfter(thrifttransport.SetResponseHeader("x-served-by", "concat-1")),
+	)
+	var servedBy string
+	call, stop := serve(t, thrifttransport.Config{Protocol: thrifttransport.HeaderProtocol}, server,
+		thrifttransport.ClientBefore(thrifttransport.SetRequestHeader("x-request-id", "abc")),
+		thrifttransport.ClientAfter(func(ctx context.Context, headers thrift.THeaderMap) context.Context {
+			servedBy = headers["x-served-by"]
+			return ctx
+		}),
+	)
+	defer stop()
+
+	if _, err := call(concatRequest{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "abc", requestID; want != have {
+		t.Errorf("request header: want %q, have %q", want, have)
+	}
+	if want, have := "concat-1", servedBy; want != have {
+		t.Errorf("response header: want %q, have %q", want, have)
+	}
+}
+
+func TestDeclaredException(t *testing.T) {
+	server := thrifttransport.NewServer(
+		"concat", concatEndpoint, newConcatArgs, decodeConcatRequest, encodeConcatResponse,
+		thrifttransport.ServerErrorEncoder(func(_ context.Context, err error) thrift.TStruct {
+			return &concatResult{Err: &concatError{Message: err.Error()}}
+		}),
+	)
+	call, stop := serve(t, thrifttransport.Config{}, server)
+	defer stop()
+
+	_, err := call(concatRequest{"", "b"})
+	var concatErr *concatError
+	if !errors.As(err, &concatErr) {
+		t.Fatalf("want *concatError, have %v", err)
+	}
+	if want, have := "empty a", concatErr.Message; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestUndeclaredError(t *testing.T) {
+	var handled []error
+	server := thrifttransport.NewServer(
+		"concat", concatEndpoint, newConcatArgs, decodeConcatRequest, encodeConcatResponse,
+		thrifttransport.ServerErrorHandler(transport.ErrorHandlerFunc(func(_ context.Context, err error) {
+			handled = append(handled, err)
+		})),
+	)
+	call, stop := serve(t, thrifttransport.Config{Protocol: thrifttransport.CompactProtocol}, server)
+	defer stop()
+
+	_, err := call(concatRequest{"", "b"})
+	var x thrift.TApplicationException
+	if !errors.As(err, &x) {
+		t.Fatalf("want thrift.TApplicationException, have %v", err)
+	}
+	if want, have := int32(thrift.INTERNAL_ERROR), x.TypeId(); want != have {
+		t.Errorf("type: want %d, have %d", want, have)
+	}
+	if want, have := "empty a", x.Error(); want != have {
+		t.Errorf("message: want %q, have %q", want, have)
+	}
+	if want, have := 1, len(handled); want != have {
+		t.Errorf("handled errors: want %d, have %d", want, have)
+	}
+
+	// The connection is still usable.
+	response, err := call(concatRequest{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "ab", response; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,7 @@
+// Package thrift provides a Thrift transport.
+//
+// Servers implement thrift.TProcessorFunction, and replace the functions of a
+// processor generated by the Thrift compiler, whose args and result structs
+// they decode from and encode to. Clients invoke a method through a
+// thrift.TClient, typically one returned by Dial.
+package thrift
@@ -0,0 +1,28 @@
+package thrift
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// DecodeRequestFunc extracts a user-domain request object from the generated
+// args struct of a Thrift method. It's designed to be used in Thrift servers,
+// for server-side endpoints.
+type DecodeRequestFunc func(ctx context.Context, args thrift.TStruct) (request interface{}, err error)
+
+// EncodeResponseFunc encodes the passed response object into the generated
+// result struct of a Thrift method. It's designed to be used in Thrift
+// servers, for server-side endpoints.
+type EncodeResponseFunc func(ctx context.Context, response interface{}) (result thrift.TStruct, err error)
+
+// EncodeRequestFunc encodes the passed request object into the generated args
+// struct of a Thrift method. It's designed to be used in Thrift clients, for
+// client-side endpoints.
+type EncodeRequestFunc func(ctx context.Context, request interface{}) (args thrift.TStruct, err error)
+
+// DecodeResponseFunc extracts a user-domain response object from the
+// generated result struct of a Thrift method, which may hold one of the
+// exceptions declared by the method. It's designed to be used in Thrift
+// clients, for client-side endpoints.
+type DecodeResponseFunc func(ctx context.Context, result thrift.TStruct) (response interface{}, err error)
@@ -0,0 +1,161 @@
+package thrift
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// Protocol is the Thrift protocol used to serialize messages. Servers and
+// clients must agree on it.
+type Protocol int
+
+const (
+	// BinaryProtocol is the Thrift binary protocol.
+	BinaryProtocol Protocol = iota
+
+	// CompactProtocol is the Thrift compact protocol.
+	CompactProtocol
+
+	// HeaderProtocol is the THeader protocol, which transports headers along
+	// with messages serialized with the binary protocol. It's the only
+	// protocol that carries the headers of ServerRequestFuncs,
+	// ServerResponseFuncs, ClientRequestFuncs and ClientResponseFuncs. It
+	// frames messages itself, so the Transport is ignored.
+	HeaderProtocol
+)
+
+// Transport is the Thrift transport used to frame messages on connections.
+// Servers and clients must agree on it.
+type Transport int
+
+const (
+	// BufferedTransport writes messages unframed, through a buffer.
+	BufferedTransport Transport = iota
+
+	// FramedTransport prefixes messages with their length. It's required by
+	// non-blocking Thrift servers.
+	FramedTransport
+)
+
+// bufferSize is the size of the buffers of BufferedTransport.
+const bufferSize = 8192
+
+// Config is the Thrift protocol and transport of connections, along with
+// their configuration, like timeouts and maximum message sizes. A nil
+// TConfiguration uses the defaults of the Thrift library.
+type Config struct {
+	Protocol       Protocol
+	Transport      Transport
+	TConfiguration *thrift.TConfiguration
+}
+
+func (c Config) protocolFactory() (thrift.TProtocolFactory, error) {
+	switch c.Protocol {
+	case BinaryProtocol:
+		return thrift.NewTBinaryProtocolFactoryConf(c.TConfiguration), nil
+	case CompactProtocol:
+		return thrift.NewTCompactProtocolFactoryConf(c.TConfiguration), nil
+	case HeaderProtocol:
+		return thrift.NewTHeaderProtocolFactoryConf(c.TConfiguration), nil
+	default:
+		return nil, fmt.Errorf("unknown Thrift protocol %d", c.Protocol)
+	}
+}
+
+func (c Config) transportFactory() (thrift.TTransportFactory, error) {
+	if c.Protocol == HeaderProtocol {
+		return thrift.NewTTransportFactory(), nil
+	}
+	switch c.Transport {
+	case BufferedTransport:
+		return thrift.NewTBufferedTransportFactory(bufferSize), nil
+	case FramedTransport:
+		return thrift.NewTFramedTransportFactoryConf(thrift.NewTTransportFactory(), c.TConfiguration), nil
+	default:
+		return nil, fmt.Errorf("unknown Thrift transport %d", c.Transport)
+	}
+}
+
+// Listener serves the methods of a Thrift processor, typically generated by
+// the Thrift compiler, whose functions are replaced by Servers. Call Serve to
+// accept connections, and Stop to close the listener and wait for the
+// connections to be closed by clients.
+type Listener struct {
+	*thrift.TSimpleServer
+	socket *thrift.TServerSocket
+}
+
+// NewListener listens on the TCP address, and returns a Listener that serves
+// the processor with the protocol and transport of the config.
+func NewListener(addr string, processor thrift.TProcessor, config Config) (*Listener, error) {
+	protocolFactory, err := config.protocolFactory()
+	if err != nil {
+		return nil, err
+	}
+	transportFactory, err := config.transportFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	socket, err := thrift.NewTServerSocket(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := socket.Listen(); err != nil {
+		return nil, err
+	}
+
+	return &Listener{
+		TSimpleServer: thrift.NewTSimpleServer4(processor, socket, transportFactory, protocolFactory),
+		socket:        socket,
+	}, nil
+}
+
+// Addr returns the address the listener listens on, which is useful when
+// it's been created with port 0.
+func (l *Listener) Addr() net.Addr {
+	return l.socket.Addr()
+}
+
+// Dial connects to the Thrift server at the TCP address, with the protocol
+// and transport of the config. It returns a client for NewClient, and the
+// transport to close when the client isn't used anymore.
+func Dial(addr string, config Config) (*thrift.TStandardClient, thrift.TTransport, error) {
+	var (
+		socket = thrift.NewTSocketConf(addr, config.TConfiguration)
+		trans  thrift.TTransport
+	)
+	switch {
+	case config.Protocol == HeaderProtocol:
+		trans = socket
+	case config.Transport == BufferedTransport:
+		trans = thrift.NewTBufferedTransport(socket, bufferSize)
+	case config.Transport == FramedTransport:
+		trans = thrift.NewTFramedTransportConf(socket, config.TConfiguration)
+	default:
+		return nil, nil, fmt.Errorf("unknown Thrift transport %d", config.Transport)
+	}
+	if err := trans.Open(); err != nil {
+		return nil, nil, err
+	}
+
+	var protocol thrift.TProtocol
+	switch config.Protocol {
+	case BinaryProtocol:
+		protocol = thrift.NewTBinaryProtocolConf(trans, config.TConfiguration)
+	case CompactProtocol:
+		protocol = thrift.NewTCompactProtocolConf(trans, config.TConfiguration)
+	case HeaderProtocol:
+		// The THeader protocol must be shared by requests and responses,
+		// since it reads the headers of responses into its transport.
+		header := thrift.NewTHeaderProtocolConf(trans, config.TConfiguration)
+		trans = header.Transport()
+		protocol = header
+	default:
+		trans.Close()
+		return nil, nil, fmt.Errorf("unknown Thrift protocol %d", config.Protocol)
+	}
+	return thrift.NewTStandardClient(protocol, protocol), trans, nil
+}
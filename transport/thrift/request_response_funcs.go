@@ -0,0 +1,54 @@
+package thrift
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// ClientRequestFunc may take information from context and use it to construct
+// headers to be transported to the server as part of the request. Headers are
+// only transported by the THeader protocol.
+type ClientRequestFunc func(context.Context, thrift.THeaderMap) context.Context
+
+// ServerRequestFunc may take information from the request headers and use it
+// to place items in the request scoped context. ServerRequestFuncs are
+// executed prior to invoking the endpoint.
+type ServerRequestFunc func(context.Context, thrift.THeaderMap) context.Context
+
+// ServerResponseFunc may take information from a request context and use it
+// to set the headers of the response. ServerResponseFuncs are only executed
+// in servers, after invoking the endpoint but prior to writing a response.
+type ServerResponseFunc func(context.Context, thrift.THeaderMap) context.Context
+
+// ClientResponseFunc may take information from the response headers and make
+// the response available for consumption. ClientResponseFuncs are only
+// executed in clients, after a request has been made, but prior to it being
+// decoded.
+type ClientResponseFunc func(context.Context, thrift.THeaderMap) context.Context
+
+// SetRequestHeader returns a ClientRequestFunc that sets the specified
+// header.
+func SetRequestHeader(key, val string) ClientRequestFunc {
+	return func(ctx context.Context, headers thrift.THeaderMap) context.Context {
+		headers[key] = val
+		return ctx
+	}
+}
+
+// SetResponseHeader returns a ServerResponseFunc that sets the specified
+// header.
+func SetResponseHeader(key, val string) ServerResponseFunc {
+	return func(ctx context.Context, headers thrift.THeaderMap) context.Context {
+		headers[key] = val
+		return ctx
+	}
+}
+
+type contextKey int
+
+const (
+	// ContextKeyRequestMethod is populated in the context by servers and
+	// clients. Its value is the name of the Thrift method.
+	ContextKeyRequestMethod contextKey = iota
+)
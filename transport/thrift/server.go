@@ -0,0 +1,205 @@
+package thrift
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/go-kit/log"
+)
+
+// Server wraps an endpoint and implements thrift.TProcessorFunction, for a
+// single method of a Thrift service.
+type Server struct {
+	method       string
+	e            endpoint.Endpoint
+	newArgs      func() thrift.TStruct
+	dec          DecodeRequestFunc
+	enc          EncodeResponseFunc
+	before       []ServerRequestFunc
+	after        []ServerResponseFunc
+	errorEncoder ErrorEncoder
+	finalizer    []ServerFinalizerFunc
+	errorHandler transport.ErrorHandler
+}
+
+// NewServer constructs a new server for the Thrift method, which wraps the
+// provided endpoint. newArgs returns a new args struct of the method, which
+// is generated by the Thrift compiler; for a method sum of the service Add,
+// it's typically func() thrift.TStruct { return addsvc.NewAddSumArgs() }.
+//
+// The server replaces the function of the method in the generated processor:
+//
+//	processor := addsvc.NewAddProcessor(nil)
+//	processor.AddToProcessorMap("sum", server)
+func NewServer(
+	method string,
+	e endpoint.Endpoint,
+	newArgs func() thrift.TStruct,
+	dec DecodeRequestFunc,
+	enc EncodeResponseFunc,
+	options ...ServerOption,
+) *Server {
+	s := &Server{
+		method:       method,
+		e:            e,
+		newArgs:      newArgs,
+		dec:          dec,
+		enc:          enc,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(*Server)
+
+// ServerBefore functions are executed on the request headers before the
+// request is decoded.
+func ServerBefore(before ...ServerRequestFunc) ServerOption {
+	return func(s *Server) { s.before = append(s.before, before...) }
+}
+
+// ServerAfter functions are executed on the response headers after the
+// endpoint is invoked, but before anything is written to the client.
+func ServerAfter(after ...ServerResponseFunc) ServerOption {
+	return func(s *Server) { s.after = append(s.after, after...) }
+}
+
+// ServerErrorEncoder is used to encode errors to the client. By default,
+// errors are encoded with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *Server) { s.errorEncoder = ee }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored.
+func ServerErrorHandler(errorHandler transport.ErrorHandler) ServerOption {
+	return func(s *Server) { s.errorHandler = errorHandler }
+}
+
+// ServerFinalizer is executed at the end of every Thrift request.
+// By default, no finalizer is registered.
+func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
+	return func(s *Server) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// Process implements thrift.TProcessorFunction.
+func (s Server) Process(ctx context.Context, seqID int32, in, out thrift.TProtocol) (ok bool, exception thrift.TException) {
+	ctx = context.WithValue(ctx, ContextKeyRequestMethod, s.method)
+
+	var err error
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	args := s.newArgs()
+	if err = args.Read(ctx, in); err != nil {
+		in.ReadMessageEnd(ctx)
+		s.errorHandler.Handle(ctx, err)
+		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
+		s.write(ctx, out, seqID, x)
+		return false, thrift.WrapTException(err)
+	}
+	if err = in.ReadMessageEnd(ctx); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return false, thrift.WrapTException(err)
+	}
+
+	headers := thrift.THeaderMap{}
+	for _, key := range thrift.GetReadHeaderList(ctx) {
+		if value, ok := thrift.GetHeader(ctx, key); ok {
+			headers[key] = value
+		}
+	}
+	for _, f := range s.before {
+		ctx = f(ctx, headers)
+	}
+
+	var result thrift.TStruct
+	result, err = s.serve(ctx, args)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		result = s.errorEncoder(ctx, err)
+	}
+
+	if writeErr := s.write(ctx, out, seqID, result); writeErr != nil {
+		s.errorHandler.Handle(ctx, writeErr)
+		return false, thrift.WrapTException(writeErr)
+	}
+	if err != nil {
+		return true, thrift.WrapTException(err)
+	}
+	return true, nil
+}
+
+func (s Server) serve(ctx context.Context, args thrift.TStruct) (thrift.TStruct, error) {
+	request, err := s.dec(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := thrift.THeaderMap{}
+	for _, f := range s.after {
+		ctx = f(ctx, headers)
+	}
+	if helper, ok := thrift.GetResponseHelper(ctx); ok {
+		for key, value := range headers {
+			helper.SetHeader(key, value)
+		}
+	}
+
+	return s.enc(ctx, response)
+}
+
+// write writes the result of the method, or the exception.
+func (s Server) write(ctx context.Context, out thrift.TProtocol, seqID int32, result thrift.TStruct) error {
+	messageType := thrift.REPLY
+	if _, ok := result.(thrift.TApplicationException); ok {
+		messageType = thrift.EXCEPTION
+	}
+	if err := out.WriteMessageBegin(ctx, s.method, messageType, seqID); err != nil {
+		return err
+	}
+	if err := result.Write(ctx, out); err != nil {
+		return err
+	}
+	if err := out.WriteMessageEnd(ctx); err != nil {
+		return err
+	}
+	return out.Flush(ctx)
+}
+
+// ErrorEncoder is responsible for encoding an error to the client. It returns
+// either the result struct of the method, with one of the exceptions declared
+// by the method, or a thrift.TApplicationException.
+type ErrorEncoder func(ctx context.Context, err error) thrift.TStruct
+
+// DefaultErrorEncoder encodes every error as a thrift.TApplicationException
+// with the INTERNAL_ERROR type, like the processors generated by the Thrift
+// compiler do for undeclared exceptions.
+func DefaultErrorEncoder(_ context.Context, err error) thrift.TStruct {
+	if x, ok := err.(thrift.TApplicationException); ok {
+		return x
+	}
+	return thrift.NewTApplicationException(thrift.INTERNAL_ERROR, err.Error())
+}
+
+// ServerFinalizerFunc can be used to perform work at the end of a Thrift
+// request, after the response has been written to the client.
+type ServerFinalizerFunc func(ctx context.Context, err error)
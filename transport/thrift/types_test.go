@@ -0,0 +1,164 @@
+package thrift_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// The types below are written like the code generated by the Thrift compiler
+// for the service
+//
+//    exception ConcatError { 1: string message }
+//    service Concat { string concat(1: string a, 2: string b) throws (1: ConcatError err) }
+
+type field struct {
+	id    int16
+	typ   thrift.TType
+	write func() error
+}
+
+func writeStruct(ctx context.Context, p thrift.TProtocol, name string, fields ...field) error {
+	if err := p.WriteStructBegin(ctx, name); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := p.WriteFieldBegin(ctx, "", f.typ, f.id); err != nil {
+			return err
+		}
+		if err := f.write(); err != nil {
+			return err
+		}
+		if err := p.WriteFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	if err := p.WriteFieldStop(ctx); err != nil {
+		return err
+	}
+	return p.WriteStructEnd(ctx)
+}
+
+func readStruct(ctx context.Context, p thrift.TProtocol, fields map[int16]func() error) error {
+	if _, err := p.ReadStructBegin(ctx); err != nil {
+		return err
+	}
+	for {
+		_, typ, id, err := p.ReadFieldBegin(ctx)
+		if err != nil {
+			return err
+		}
+		if typ == thrift.STOP {
+			break
+		}
+		if read, ok := fields[id]; ok {
+			err = read()
+		} else {
+			err = p.Skip(ctx, typ)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.ReadFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	return p.ReadStructEnd(ctx)
+}
+
+type concatArgs struct {
+	A string
+	B string
+}
+
+func newConcatArgs() thrift.TStruct { return &concatArgs{} }
+
+func (a *concatArgs) Read(ctx context.Context, p thrift.TProtocol) error {
+	return readStruct(ctx, p, map[int16]func() error{
+		1: func() (err error) { a.A, err = p.ReadString(ctx); return err },
+		2: func() (err error) { a.B, err = p.ReadString(ctx); return err },
+	})
+}
+
+func (a *concatArgs) Write(ctx context.Context, p thrift.TProtocol) error {
+	return writeStruct(ctx, p, "concat_args",
+		field{1, thrift.STRING, func() error { return p.WriteString(ctx, a.A) }},
+		field{2, thrift.STRING, func() error { return p.WriteString(ctx, a.B) }},
+	)
+}
+
+type concatError struct {
+	Message string
+}
+
+func (e *concatError) Error() string { return fmt.Sprintf("ConcatError(%s)", e.Message) }
+
+func (e *concatError) Read(ctx context.Context, p thrift.TProtocol) error {
+	return readStruct(ctx, p, map[int16]func() error{
+		1: func() (err error) { e.Message, err = p.ReadString(ctx); return err },
+	})
+}
+
+func (e *concatError) Write(ctx context.Context, p thrift.TProtocol) error {
+	return writeStruct(ctx, p, "ConcatError",
+		field{1, thrift.STRING, func() error { return p.WriteString(ctx, e.Message) }},
+	)
+}
+
+type concatResult struct {
+	Success *string
+	Err     *concatError
+}
+
+func newConcatResult() thrift.TStruct { return &concatResult{} }
+
+func (r *concatResult) Read(ctx context.Context, p thrift.TProtocol) error {
+	return readStruct(ctx, p, map[int16]func() error{
+		0: func() error {
+			s, err := p.ReadString(ctx)
+			r.Success = &s
+			return err
+		},
+		1: func() error {
+			r.Err = &concatError{}
+			return r.Err.Read(ctx, p)
+		},
+	})
+}
+
+func (r *concatResult) Write(ctx context.Context, p thrift.TProtocol) error {
+	var fields []field
+	if r.Success != nil {
+		fields = append(fields, field{0, thrift.STRING, func() error { return p.WriteString(ctx, *r.Success) }})
+	}
+	if r.Err != nil {
+		fields = append(fields, field{1, thrift.STRUCT, func() error { return r.Err.Write(ctx, p) }})
+	}
+	return writeStruct(ctx, p, "concat_result", fields...)
+}
+
+// processor dispatches messages to its functions, like generated processors.
+type processor map[string]thrift.TProcessorFunction
+
+func (p processor) Process(ctx context.Context, in, out thrift.TProtocol) (bool, thrift.TException) {
+	name, _, seqID, err := in.ReadMessageBegin(ctx)
+	if err != nil {
+		return false, thrift.WrapTException(err)
+	}
+	if f, ok := p[name]; ok {
+		return f.Process(ctx, seqID, in, out)
+	}
+	in.Skip(ctx, thrift.STRUCT)
+	in.ReadMessageEnd(ctx)
+	x := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function "+name)
+	out.WriteMessageBegin(ctx, name, thrift.EXCEPTION, seqID)
+	x.Write(ctx, out)
+	out.WriteMessageEnd(ctx)
+	out.Flush(ctx)
+	return false, x
+}
+
+func (p processor) ProcessorMap() map[string]thrift.TProcessorFunction { return p }
+
+func (p processor) AddToProcessorMap(name string, f thrift.TProcessorFunction) { p[name] = f }